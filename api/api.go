@@ -153,6 +153,7 @@ func (srv *Server) initAPI(password string) {
 		router.GET("/host", srv.hostHandlerGET)                                           // Get the host status.
 		router.POST("/host", requirePassword(srv.hostHandlerPOST, password))              // Change the settings of the host.
 		router.POST("/host/announce", requirePassword(srv.hostAnnounceHandler, password)) // Announce the host to the network.
+		router.POST("/host/mode", requirePassword(srv.hostModeHandler, password))         // Set the mode of the host.
 
 		// Calls pertaining to the storage manager that the host uses.
 		router.GET("/host/storage", srv.storageHandler)
@@ -120,6 +120,25 @@ func (srv *Server) hostAnnounceHandler(w http.ResponseWriter, req *http.Request,
 	writeSuccess(w)
 }
 
+// hostModeHandler handles the API call to set the mode of the host, which is
+// one of "live", "maintenance" or "standby".
+func (srv *Server) hostModeHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	mode := modules.HostModeLive
+	for mode.String() != req.FormValue("mode") {
+		mode++
+		if mode > modules.HostModeStandby {
+			writeError(w, Error{"Malformed mode"}, http.StatusBadRequest)
+			return
+		}
+	}
+	err := srv.host.SetMode(mode)
+	if err != nil {
+		writeError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
+
 // storageHandler returns a bunch of information about storage management on
 // the host.
 func (srv *Server) storageHandler(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
@@ -1,6 +1,9 @@
 package modules
 
 import (
+	"net"
+	"time"
+
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -9,6 +12,39 @@ const (
 	HostDir = "host"
 )
 
+// A HostMode determines whether a host forms and renews contracts. In every
+// mode, the host continues to serve its settings and existing contracts.
+type HostMode uint8
+
+const (
+	// HostModeLive is the mode of a host that forms and renews contracts.
+	HostModeLive HostMode = iota
+
+	// HostModeMaintenance is the mode of a host undergoing planned
+	// maintenance. The host will not form or renew contracts until
+	// maintenance is over.
+	HostModeMaintenance
+
+	// HostModeStandby is the mode of a host that has announced itself, so
+	// that it can become reachable and build a reputation, but is not
+	// accepting contracts yet.
+	HostModeStandby
+)
+
+// String implements the fmt.Stringer interface.
+func (m HostMode) String() string {
+	switch m {
+	case HostModeLive:
+		return "live"
+	case HostModeMaintenance:
+		return "maintenance"
+	case HostModeStandby:
+		return "standby"
+	default:
+		return "unknown"
+	}
+}
+
 var (
 	// BytesPerTerabyte is the conversion rate between bytes and terabytes.
 	BytesPerTerabyte = types.NewCurrency64(1e12)
@@ -55,6 +91,7 @@ type (
 		MaxDuration          types.BlockHeight `json:"maxduration"`
 		MaxReviseBatchSize   uint64            `json:"maxrevisebatchsize"`
 		NetAddress           NetAddress        `json:"netaddress"`
+		RemoteMetricsLimit   uint64            `json:"remotemetricslimit"`
 		WindowSize           types.BlockHeight `json:"windowsize"`
 
 		Collateral       types.Currency `json:"collateral"`
@@ -65,18 +102,299 @@ type (
 		MinDownloadBandwidthPrice types.Currency `json:"mindownloadbandwidthprice"`
 		MinStoragePrice           types.Currency `json:"minstorageprice"`
 		MinUploadBandwidthPrice   types.Currency `json:"minuploadbandwidthprice"`
+
+		// DisabledRPCs lists the RPCs that the host will refuse to serve. An
+		// empty list means that all RPCs are enabled.
+		DisabledRPCs []types.Specifier `json:"disabledrpcs"`
+
+		// SyncGraceRPCs lists the RPCs that the host will serve while it is
+		// not yet synced, such as RPCDownload to keep serving existing
+		// contracts during a brief resync. All other RPCs are refused until
+		// the host is ready. An empty list allows only RPCSettings,
+		// RPCAuthSettings and RPCPing.
+		SyncGraceRPCs []types.Specifier `json:"syncgracerpcs"`
+
+		// HostnameProviders lists, in order of preference, the methods that
+		// the host uses to discover its external address. Each provider is
+		// "upnp", the URL of a service that responds with the external IP
+		// as plain text, "static:<hostname>" to always use the given
+		// hostname, or "stun:<host:port>" to ask a STUN server. An empty
+		// list uses the defaults, which end with a public STUN server.
+		HostnameProviders []string `json:"hostnameproviders"`
+
+		// WhitelistEnabled restricts incoming connections to the remote
+		// addresses in Whitelist, each entry of which is either an IP
+		// address such as "192.168.1.5" or a range in CIDR notation such as
+		// "10.0.0.0/16". All other connections are closed immediately. When
+		// disabled, the whitelist is ignored.
+		WhitelistEnabled bool     `json:"whitelistenabled"`
+		Whitelist        []string `json:"whitelist"`
+
+		// Blacklist lists the ranges of remote addresses, in CIDR notation
+		// such as "203.0.113.0/24", from which the host refuses all
+		// connections. The blacklist applies whether or not whitelist mode
+		// is enabled.
+		Blacklist []string `json:"blacklist"`
+
+		// ConnectionDeadline is the initial deadline applied to each incoming
+		// connection, which cannot be negative and is replaced by the default
+		// if 0, and MaxConnections is the maximum number of connections
+		// that the host will serve at once, with 0 meaning no limit. Both
+		// take effect for new connections as soon as the settings are
+		// updated. The address that the host listens on is not a setting,
+		// changing it requires rebinding the listener with SetListenAddress.
+		// ConnectionDeadlineJitter is the upper bound of a random duration
+		// added to the deadline of each connection, so that connections
+		// made at the same time do not all expire at the same time. 0 uses
+		// the default jitter, and a negative jitter disables it.
+		ConnectionDeadline       time.Duration `json:"connectiondeadline"`
+		ConnectionDeadlineJitter time.Duration `json:"connectiondeadlinejitter"`
+		MaxConnections           uint64        `json:"maxconnections"`
+
+		// ReadBufferSize and WriteBufferSize set the size in bytes of the
+		// operating system's receive and send buffers of each incoming
+		// connection, with 0 keeping the operating system's defaults.
+		// Larger buffers can improve throughput on links with a high
+		// latency, at the cost of memory for every open connection. The
+		// operating system may round, double or cap the requested sizes,
+		// so the effect varies between platforms.
+		ReadBufferSize  uint64 `json:"readbuffersize"`
+		WriteBufferSize uint64 `json:"writebuffersize"`
+
+		// ConnLogRate is the number of warnings per second that may be
+		// logged while handling incoming connections. Warnings in excess of
+		// the rate are dropped, and the number that were dropped is logged
+		// once warnings are allowed again. 0 uses the default rate.
+		ConnLogRate uint64 `json:"connlograte"`
+
+		// MinAnnounceInterval is the minimum amount of time between two
+		// announcements of the host. Announcements requested sooner, whether
+		// automatically or through Announce, are refused so that the host
+		// cannot spend an unbounded amount on fees. 0 uses the default
+		// interval, and a negative interval disables the rate limit.
+		MinAnnounceInterval time.Duration `json:"minannounceinterval"`
+
+		// PortForwardTimeout is the amount of time that the host waits for
+		// the router to forward or clear a port using UPnP before giving up.
+		// Routers that do not respond would otherwise delay startup and
+		// shutdown.
+		PortForwardTimeout time.Duration `json:"portforwardtimeout"`
+
+		// IdleTimeout closes a connection if no data is read from or written
+		// to it for the given duration, even if the connection deadline has
+		// not been reached. 0 disables the idle timeout.
+		IdleTimeout time.Duration `json:"idletimeout"`
+
+		// MaxConnectionLifetime closes a connection once it has been open
+		// for the given duration, no matter how far the RPCs have extended
+		// the connection deadline. 0 uses the default lifetime.
+		MaxConnectionLifetime time.Duration `json:"maxconnectionlifetime"`
+
+		// DebugCapture writes a hex dump of the raw bytes read from and
+		// written to incoming connections to the "captures" folder of the
+		// host's persist directory, for diagnosing protocol
+		// incompatibilities. SENSITIVE: captures hold everything sent over
+		// the connection, including signatures, contract revisions and file
+		// data, and should be deleted once they are no longer needed.
+		// Capturing stops once DebugCaptureConnections connections have
+		// been captured or DebugCaptureWindow has passed since capture was
+		// enabled, and at most DebugCaptureBytes are recorded for each
+		// connection. Zero limits use the defaults.
+		DebugCapture            bool          `json:"debugcapture"`
+		DebugCaptureBytes       uint64        `json:"debugcapturebytes"`
+		DebugCaptureConnections uint64        `json:"debugcaptureconnections"`
+		DebugCaptureWindow      time.Duration `json:"debugcapturewindow"`
+
+		// RPCTimeouts overrides the deadline of individual RPCs, keyed by
+		// the name of the RPC, such as "Settings" or "Download". For RPCs
+		// that iterate, the deadline applies to each iteration. RPCs that
+		// are not listed use the default deadlines of the protocol.
+		RPCTimeouts map[string]time.Duration `json:"rpctimeouts"`
+
+		// RPCConcurrencyLimits caps the number of calls of individual RPCs
+		// that are served at once, keyed by the name of the RPC. Calls in
+		// excess of the limit are refused with a busy response. RPCs that
+		// are not listed are only bound by MaxConnections.
+		RPCConcurrencyLimits map[string]uint64 `json:"rpcconcurrencylimits"`
+
+		// RPCBandwidthLimits caps the combined rate, in bytes per second,
+		// at which data is sent and received by all calls of individual
+		// RPCs, keyed by the name of the RPC. RPCs that are not listed are
+		// not limited.
+		RPCBandwidthLimits map[string]uint64 `json:"rpcbandwidthlimits"`
+
+		// RPCRetries is the number of times that the handler of a failed
+		// call is retried before the call is counted as an error, keyed by
+		// the name of the RPC. Only idempotent RPCs, such as "Settings", may
+		// be retried. RPCs that are not listed are not retried.
+		RPCRetries map[string]uint64 `json:"rpcretries"`
+
+		// SelfDialCheck has the host ping its own net address on each
+		// hostname discovery cycle to confirm that it is reachable. Some
+		// routers do not support connecting to their own external address,
+		// so the check is optional.
+		SelfDialCheck bool `json:"selfdialcheck"`
+
+		// AnnounceWhenReachable defers the automatic announcements of the
+		// host until port forwarding and a self-dial check have both
+		// succeeded, and re-announces the host if it becomes reachable again
+		// after having been unreachable. The self-dial check is performed in
+		// this mode even if SelfDialCheck is disabled.
+		AnnounceWhenReachable bool `json:"announcewhenreachable"`
+
+		// AnnounceOnlyWhenAccepting defers every announcement of the host
+		// while it is not accepting contracts, including while it is not in
+		// HostModeLive, so that renters are not drawn to a
+		// host that will refuse them. The deferred announcement is made once
+		// the host begins accepting contracts. Operators who want to
+		// announce early to build a reputation should leave it disabled.
+		AnnounceOnlyWhenAccepting bool `json:"announceonlywhenaccepting"`
+
+		// PrivateMetrics refuses RPCHostMetrics, so that callers cannot
+		// request the public metrics of the host, such as the number of
+		// calls that it has served and its uptime.
+		PrivateMetrics bool `json:"privatemetrics"`
+
+		// RemoteSettingsUpdates serves RPCUpdateSettings, which lets
+		// operators replace these settings over the network with a request
+		// signed by the host's secret key. It is disabled by default, as
+		// anyone holding the key can then reconfigure the host.
+		RemoteSettingsUpdates bool `json:"remotesettingsupdates"`
+
+		// SettingsChallengeDifficulty requires callers to solve a
+		// proof-of-work challenge of the given difficulty, through
+		// RPCAuthSettings, before the settings of the host are served.
+		// Plain RPCSettings calls are refused, which makes mass scanning of
+		// hosts more expensive, but also hides the host from renters that
+		// do not solve challenges. 0 serves settings to every caller.
+		SettingsChallengeDifficulty uint64 `json:"settingschallengedifficulty"`
+
+		// TLSCertFile and TLSKeyFile are the paths of a PEM encoded
+		// certificate and private key. When both are set, the host also
+		// accepts TLS connections on its usual address, and advertises that
+		// it does so in its external settings. Plaintext connections are
+		// always accepted.
+		TLSCertFile string `json:"tlscertfile"`
+		TLSKeyFile  string `json:"tlskeyfile"`
 	}
 
 	// HostNetworkMetrics reports the quantity of each type of RPC call that
 	// has been made to the host.
 	HostNetworkMetrics struct {
-		DownloadCalls     uint64 `json:"downloadcalls"`
-		ErrorCalls        uint64 `json:"errorcalls"`
-		FormContractCalls uint64 `json:"formcontractcalls"`
-		RenewCalls        uint64 `json:"renewcalls"`
-		ReviseCalls       uint64 `json:"revisecalls"`
-		SettingsCalls     uint64 `json:"settingscalls"`
-		UnrecognizedCalls uint64 `json:"unrecognizedcalls"`
+		ActiveConnections       uint64 `json:"activeconnections"`
+		ActiveThreads           uint64 `json:"activethreads"` // Routines tracked by the thread group.
+		AdmissionRejects        uint64 `json:"admissionrejects"`
+		Announcements           uint64 `json:"announcements"`
+		AuthSettingsCalls       uint64 `json:"authsettingscalls"`
+		BlacklistRejects        uint64 `json:"blacklistrejects"`
+		BusyCalls               uint64 `json:"busycalls"`
+		CapacityRejects         uint64 `json:"capacityrejects"`
+		ChallengeFailures       uint64 `json:"challengefailures"`
+		ChallengeRejects        uint64 `json:"challengerejects"`
+		ConsensusErrors         uint64 `json:"consensuserrors"`
+		DeadlineFailures        uint64 `json:"deadlinefailures"`
+		DecodeErrors            uint64 `json:"decodeerrors"`
+		DisabledCalls           uint64 `json:"disabledcalls"`
+		DownloadCalls           uint64 `json:"downloadcalls"`
+		DownloadThroughput      uint64 `json:"downloadthroughput"` // bytes per second
+		ErrorCalls              uint64 `json:"errorcalls"`
+		FormContractCalls       uint64 `json:"formcontractcalls"`
+		HandlerErrors           uint64 `json:"handlererrors"` // Errors returned by RPC handlers.
+		HostMetricsCalls        uint64 `json:"hostmetricscalls"`
+		IOErrors                uint64 `json:"ioerrors"`
+		IdleTimeoutCalls        uint64 `json:"idletimeoutcalls"`
+		LifetimeCloses          uint64 `json:"lifetimecloses"`
+		MaintenanceCalls        uint64 `json:"maintenancecalls"`
+		NotReadyCalls           uint64 `json:"notreadycalls"`
+		PanicCalls              uint64 `json:"paniccalls"`
+		PeakConnections         uint64 `json:"peakconnections"` // Since startup.
+		PingCalls               uint64 `json:"pingcalls"`
+		PreDispatchErrors       uint64 `json:"predispatcherrors"` // Failures before the RPC was identified.
+		RecoveredCalls          uint64 `json:"recoveredcalls"`    // Retried calls that succeeded.
+		RenewCalls              uint64 `json:"renewcalls"`
+		RetriedCalls            uint64 `json:"retriedcalls"`
+		ReviseCalls             uint64 `json:"revisecalls"`
+		SettingsCalls           uint64 `json:"settingscalls"`
+		ShutdownClosedCalls     uint64 `json:"shutdownclosedcalls"`
+		StandbyCalls            uint64 `json:"standbycalls"`
+		SuppressedAnnouncements uint64 `json:"suppressedannouncements"`
+		TimeoutCalls            uint64 `json:"timeoutcalls"`
+		UnrecognizedCalls       uint64 `json:"unrecognizedcalls"`
+		UpdateSettingsCalls     uint64 `json:"updatesettingscalls"`
+		ValidationErrors        uint64 `json:"validationerrors"`
+		WhitelistRejects        uint64 `json:"whitelistrejects"`
+
+		// PeerVersions counts the connections made to the host by the
+		// protocol version advertised by the peer.
+		PeerVersions map[string]uint64 `json:"peerversions"`
+
+		// ThreadSites counts the routines tracked by the thread group by
+		// the function that registered them. It is only reported by debug
+		// builds.
+		ThreadSites map[string]int `json:"threadsites,omitempty"`
+
+		// RPCsInUse counts the calls of each RPC that are currently being
+		// served, keyed by the name of the RPC. RPCs that are not being
+		// served are omitted.
+		RPCsInUse map[string]uint64 `json:"rpcsinuse"`
+	}
+
+	// HostMetrics combines the network metrics of the host with gauges of
+	// the contracts that it holds and the storage that it offers.
+	// CommittedStorage is the part of TotalStorage that is holding sectors,
+	// and RemainingStorage is the part that is still free.
+	HostMetrics struct {
+		Network HostNetworkMetrics `json:"network"`
+
+		ContractCount    uint64 `json:"contractcount"`
+		CommittedStorage uint64 `json:"committedstorage"`
+		RemainingStorage uint64 `json:"remainingstorage"`
+		TotalStorage     uint64 `json:"totalstorage"`
+	}
+
+	// HostTimeoutConfig reports the timeouts that the host is currently
+	// applying. RPCTimeouts holds the effective deadline of every RPC served
+	// by the host, keyed by the name of the RPC, including the RPCs that use
+	// the default deadline of the protocol.
+	HostTimeoutConfig struct {
+		ConnectionDeadline       time.Duration            `json:"connectiondeadline"`
+		ConnectionDeadlineJitter time.Duration            `json:"connectiondeadlinejitter"`
+		IdleTimeout              time.Duration            `json:"idletimeout"`
+		MaxConnectionLifetime    time.Duration            `json:"maxconnectionlifetime"`
+		PortForwardTimeout       time.Duration            `json:"portforwardtimeout"`
+		RPCTimeouts              map[string]time.Duration `json:"rpctimeouts"`
+	}
+
+	// HostRemoteMetrics reports the number of RPC calls, and the number of
+	// those calls that failed, that have been made to the host by a single
+	// remote address.
+	HostRemoteMetrics struct {
+		Address string `json:"address"`
+		Calls   uint64 `json:"calls"`
+		Errors  uint64 `json:"errors"`
+	}
+
+	// HostRejection describes a connection or call that the host refused.
+	// RPC is the name of the refused RPC, and is empty if the connection was
+	// refused before the RPC was read.
+	HostRejection struct {
+		Address string    `json:"address"`
+		RPC     string    `json:"rpc"`
+		Reason  string    `json:"reason"`
+		Time    time.Time `json:"time"`
+	}
+
+	// HostAnnounceResult is the outcome of an announcement requested through
+	// AnnounceAsync. If Err is nil, the announcement transaction with the ID
+	// TransactionID was accepted by the transaction pool. Reachable and
+	// ReachableReason report the reachability of the host at the time the
+	// announcement completed, as returned by Reachable.
+	HostAnnounceResult struct {
+		Address         NetAddress
+		TransactionID   types.TransactionID
+		Err             error
+		Reachable       bool
+		ReachableReason string
 	}
 
 	// A Host can take storage from disk and offer it to the network, managing
@@ -86,13 +404,31 @@ type (
 		// Announce submits a host announcement to the blockchain.
 		Announce() error
 
+		// AnnounceAsync starts an announcement in the background and returns
+		// a channel that receives its result. Requests made while an
+		// announcement is in flight share its result.
+		AnnounceAsync() (<-chan HostAnnounceResult, error)
+
+		// AnnouncementPending returns true if the host is waiting to confirm
+		// that it is reachable, or to begin accepting contracts, before
+		// making an announcement.
+		AnnouncementPending() bool
+
 		// AnnounceAddress submits an announcement using the given address.
 		AnnounceAddress(NetAddress) error
 
+		// LastAnnouncement returns the time of the most recent successful
+		// announcement, or the zero time if the host has never announced.
+		LastAnnouncement() time.Time
+
 		// ExternalSettings returns the settings of the host as seen by an
 		// untrusted node querying the host for settings.
 		ExternalSettings() HostExternalSettings
 
+		// SettingsExtension returns the settings extension that the host
+		// sends along with its external settings.
+		SettingsExtension() HostSettingsExtension
+
 		// FinancialMetrics returns the financial statistics of the host.
 		FinancialMetrics() HostFinancialMetrics
 
@@ -100,13 +436,52 @@ type (
 		// potentially private or sensitive information.
 		InternalSettings() HostInternalSettings
 
+		// Mode returns the mode of the host.
+		Mode() HostMode
+
+		// Metrics returns the network metrics of the host along with its
+		// contract count and storage capacity.
+		Metrics() HostMetrics
+
+		// ListenAddr returns the local address that the host is listening on
+		// for incoming connections, or nil if the host is not yet listening.
+		ListenAddr() net.Addr
+
 		// NetworkMetrics returns information on the types of RPC calls that
 		// have been made to the host.
 		NetworkMetrics() HostNetworkMetrics
 
+		// Reachable returns whether the host believes that it can be reached
+		// by renters, along with the reason for that belief.
+		Reachable() (bool, string)
+
 		// SetInternalSettings sets the hosting parameters of the host.
 		SetInternalSettings(HostInternalSettings) error
 
+		// SetMode puts the host in the provided mode. Outside of
+		// HostModeLive, the host serves existing contracts and its settings,
+		// but refuses to form or renew contracts.
+		SetMode(HostMode) error
+
+		// SetReady sets whether the host is ready to negotiate contracts.
+		// While the host is not ready, only informational RPCs are served.
+		SetReady(bool)
+
+		// SetListenAddress moves the host's listener to a new address.
+		SetListenAddress(string) error
+
+		// TimeoutConfig returns the deadlines and timeouts that the host is
+		// currently applying to incoming connections.
+		TimeoutConfig() HostTimeoutConfig
+
+		// TopTalkers returns the metrics of the remote addresses that have
+		// made the most RPC calls to the host.
+		TopTalkers(n int) []HostRemoteMetrics
+
+		// RecentRejections returns the most recent connections and calls
+		// that the host refused, most recent first.
+		RecentRejections() []HostRejection
+
 		// The storage manager provides an interface for adding and removing
 		// storage folders and data sectors to the host.
 		StorageManager
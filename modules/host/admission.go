@@ -0,0 +1,92 @@
+package host
+
+// admission.go decides whether the host serves an incoming connection. The
+// built-in checks, the blacklist and the whitelist, are implemented as
+// AdmissionFuncs, and operators embedding the host can register an additional
+// AdmissionFunc to compose their own admission logic, such as geo-blocking or
+// allow-lists fetched from an external source.
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+)
+
+var (
+	// errAddressBlacklisted is returned by the blacklist admission check
+	// when the remote address falls within a blacklisted range.
+	errAddressBlacklisted = errors.New("address is blacklisted")
+
+	// errAddressNotWhitelisted is returned by the whitelist admission check
+	// when whitelist mode is enabled and the remote address is not
+	// whitelisted.
+	errAddressNotWhitelisted = errors.New("address is not whitelisted")
+)
+
+// An AdmissionFunc decides whether the host serves a connection from the
+// provided remote address. Returning an error closes the connection, and the
+// error is logged as the reason for the refusal. AdmissionFuncs are called for
+// every incoming connection, so they should return quickly.
+type AdmissionFunc func(remote net.Addr) error
+
+// addrHost returns the host portion of an address, or the whole address if it
+// has no port.
+func addrHost(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// admitBlacklist is the AdmissionFunc that refuses blacklisted addresses.
+func (h *Host) admitBlacklist(remote net.Addr) error {
+	if h.blacklisted(addrHost(remote)) {
+		return errAddressBlacklisted
+	}
+	return nil
+}
+
+// admitWhitelist is the AdmissionFunc that refuses addresses which are not
+// whitelisted.
+func (h *Host) admitWhitelist(remote net.Addr) error {
+	if !h.whitelisted(addrHost(remote)) {
+		return errAddressNotWhitelisted
+	}
+	return nil
+}
+
+// managedAdmit runs the built-in admission checks followed by the registered
+// AdmissionFunc, returning the first error. The refusal is counted under the
+// metric of the check that refused the connection.
+func (h *Host) managedAdmit(remote net.Addr) error {
+	lockID := h.mu.RLock()
+	custom := h.admissionFunc
+	h.mu.RUnlock(lockID)
+
+	if err := h.admitBlacklist(remote); err != nil {
+		atomic.AddUint64(&h.atomicBlacklistRejects, 1)
+		return err
+	}
+	if err := h.admitWhitelist(remote); err != nil {
+		atomic.AddUint64(&h.atomicWhitelistRejects, 1)
+		return err
+	}
+	if custom != nil {
+		if err := custom(remote); err != nil {
+			atomic.AddUint64(&h.atomicAdmissionRejects, 1)
+			return err
+		}
+	}
+	return nil
+}
+
+// SetAdmissionFunc registers an AdmissionFunc that is run for every incoming
+// connection after the blacklist and whitelist have admitted it. Only one
+// AdmissionFunc is registered at a time; registering nil restores the default,
+// which admits every connection.
+func (h *Host) SetAdmissionFunc(fn AdmissionFunc) {
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	h.admissionFunc = fn
+}
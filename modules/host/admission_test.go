@@ -0,0 +1,90 @@
+package host
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestAdmissionFunc checks that a registered AdmissionFunc can refuse
+// connections, that the refusals are counted, and that unregistering the
+// AdmissionFunc restores the permissive default.
+func TestAdmissionFunc(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestAdmissionFunc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	ping := func() error {
+		conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		err = encoding.WriteObject(conn, modules.RPCPing)
+		if err != nil {
+			return err
+		}
+		err = encoding.WriteObject(conn, [8]byte{})
+		if err != nil {
+			return err
+		}
+		var resp modules.HostPingResponse
+		return encoding.ReadObject(conn, &resp, 256)
+	}
+
+	// The AdmissionFunc should be called with the remote address of the
+	// caller.
+	remotes := make(chan net.Addr, 1)
+	ht.host.SetAdmissionFunc(func(remote net.Addr) error {
+		remotes <- remote
+		return errors.New("geo-blocked")
+	})
+	if ping() == nil {
+		t.Fatal("host served a connection refused by the AdmissionFunc")
+	}
+	if host := addrHost(<-remotes); net.ParseIP(host) == nil || !net.ParseIP(host).IsLoopback() {
+		t.Error("AdmissionFunc was called with an unexpected address:", host)
+	}
+	if ht.host.NetworkMetrics().AdmissionRejects != 1 {
+		t.Error("refused connection was not counted")
+	}
+
+	// The built-in checks run first, and their refusals are counted
+	// separately.
+	settings := ht.host.InternalSettings()
+	settings.Blacklist = []string{"127.0.0.0/8", "::1/128"}
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ping() == nil {
+		t.Fatal("host served a connection from a blacklisted range")
+	}
+	if nm := ht.host.NetworkMetrics(); nm.BlacklistRejects != 1 || nm.AdmissionRejects != 1 {
+		t.Error("refusal by the blacklist was counted incorrectly:", nm.BlacklistRejects, nm.AdmissionRejects)
+	}
+	select {
+	case <-remotes:
+		t.Error("AdmissionFunc was called for a blacklisted address")
+	default:
+	}
+	settings.Blacklist = nil
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ht.host.SetAdmissionFunc(nil)
+	if err := ping(); err != nil {
+		t.Fatal("host refused a connection after the AdmissionFunc was removed:", err)
+	}
+}
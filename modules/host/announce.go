@@ -2,8 +2,12 @@ package host
 
 import (
 	"errors"
+	"sync/atomic"
+	"time"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 var (
@@ -14,26 +18,111 @@ var (
 	// errUnknownAddress is returned if the host is unable to determine a
 	// public address for itself to use in the announcement.
 	errUnknownAddress = errors.New("host cannot announce, does not seem to have a valid address.")
+
+	// errAnnounceRateLimited is returned if the host is asked to announce
+	// before the minimum announcement interval has passed.
+	errAnnounceRateLimited = errors.New("host announced too recently, try again later")
+
+	// errAnnounceNotAccepting is returned if the host is asked to announce
+	// while it is not accepting contracts and AnnounceOnlyWhenAccepting is
+	// set.
+	errAnnounceNotAccepting = errors.New("host is not accepting contracts, the announcement will be made once it is")
+
+	// errAnnounceInFlight is returned if the host is asked to announce while
+	// an announcement requested through AnnounceAsync is in flight.
+	errAnnounceInFlight = errors.New("host is already making an announcement")
 )
 
-// announce creates an announcement transaction and submits it to the network.
-func (h *Host) announce(addr modules.NetAddress) error {
+// acceptingContracts returns true if the host is accepting contracts and is
+// live.
+func (h *Host) acceptingContracts() bool {
+	return h.settings.AcceptingContracts && h.mode == modules.HostModeLive
+}
+
+// makeDeferredAnnouncement makes the announcement that was deferred while the
+// host was not accepting contracts, if the host no longer needs to defer it.
+// It is called whenever the host may have begun accepting contracts. The
+// deferred announcement is kept until an announcement succeeds, so that an
+// announcement refused by the rate limit is retried by
+// startDeferredAnnouncement once the interval has passed.
+func (h *Host) makeDeferredAnnouncement() {
+	if h.deferredAnnounceAddr == "" {
+		return
+	}
+	if h.settings.AnnounceOnlyWhenAccepting && !h.acceptingContracts() {
+		return
+	}
+	err := h.announce(h.deferredAnnounceAddr)
+	if err != nil && err != errAnnounceRateLimited && err != errAnnounceInFlight {
+		h.log.Println("WARN: unable to make the announcement deferred until the host accepted contracts:", err)
+	}
+}
+
+// startDeferredAnnouncement starts the deferred announcement in the background
+// once the host is accepting contracts and the rate limit allows it. It is
+// called on each consensus change, while the consensus set waits on the host,
+// so the announcement is made by threadedAnnounce without the host lock held.
+func (h *Host) startDeferredAnnouncement() {
+	if h.deferredAnnounceAddr == "" || h.announceWaiters != nil {
+		return
+	}
+	if h.settings.AnnounceOnlyWhenAccepting && !h.acceptingContracts() {
+		return
+	}
+	if h.announceRateLimited() {
+		return
+	}
+	if h.tg.Add() != nil {
+		return
+	}
+	h.announceWaiters = []chan modules.HostAnnounceResult{}
+	go h.threadedAnnounce(h.deferredAnnounceAddr)
+}
+
+// announceRateLimited returns whether the host announced less than
+// MinAnnounceInterval ago. A negative interval disables the rate limit.
+func (h *Host) announceRateLimited() bool {
+	if h.settings.MinAnnounceInterval < 0 || h.lastAnnouncement.IsZero() {
+		return false
+	}
+	return time.Since(h.lastAnnouncement) < h.settings.MinAnnounceInterval
+}
+
+// checkAnnouncement returns an error if the host should not announce addr
+// right now. It refuses to announce more than once per MinAnnounceInterval,
+// and defers the announcement while the host is not accepting contracts if
+// AnnounceOnlyWhenAccepting is set.
+func (h *Host) checkAnnouncement(addr modules.NetAddress) error {
+	if h.settings.AnnounceOnlyWhenAccepting && !h.acceptingContracts() {
+		h.deferredAnnounceAddr = addr
+		atomic.AddUint64(&h.atomicSuppressedAnnouncements, 1)
+		h.log.Debugln("deferred announcement of", addr, "until the host is accepting contracts")
+		return errAnnounceNotAccepting
+	}
+	if h.announceRateLimited() {
+		atomic.AddUint64(&h.atomicSuppressedAnnouncements, 1)
+		h.log.Debugln("suppressed announcement of", addr, "- the host announced at", h.lastAnnouncement)
+		return errAnnounceRateLimited
+	}
+
 	// The wallet needs to be unlocked to add fees to the transaction, and the
 	// host needs to have an active unlock hash that renters can make payment
 	// to.
 	if !h.wallet.Unlocked() {
 		return errAnnWalletLocked
 	}
-	err := h.checkUnlockHash()
-	if err != nil {
-		return err
-	}
+	return h.checkUnlockHash()
+}
 
+// managedSubmitAnnouncement creates a transaction containing the signed
+// announcement of addr and submits it to the transaction pool. It does not
+// touch the state of the host, and is called without holding the host lock.
+func (h *Host) managedSubmitAnnouncement(addr modules.NetAddress, pk types.SiaPublicKey, sk crypto.SecretKey) (types.TransactionID, error) {
 	// Create the announcement that's going to be added to the arbitrary data
 	// field of the transaction.
-	signedAnnouncement, err := modules.CreateAnnouncement(addr, h.publicKey, h.secretKey)
+	signedAnnouncement, err := modules.CreateAnnouncement(addr, pk, sk)
 	if err != nil {
-		return err
+		return types.TransactionID{}, err
 	}
 
 	// Create a transaction, with a fee, that contains the full announcement.
@@ -43,27 +132,68 @@ func (h *Host) announce(addr modules.NetAddress) error {
 	err = txnBuilder.FundSiacoins(fee)
 	if err != nil {
 		txnBuilder.Drop()
-		return err
+		return types.TransactionID{}, err
 	}
 	_ = txnBuilder.AddMinerFee(fee)
 	_ = txnBuilder.AddArbitraryData(signedAnnouncement)
 	txnSet, err := txnBuilder.Sign(true)
 	if err != nil {
 		txnBuilder.Drop()
-		return err
+		return types.TransactionID{}, err
 	}
 
 	// Add the transactions to the transaction pool.
 	err = h.tpool.AcceptTransactionSet(txnSet)
 	if err != nil {
 		txnBuilder.Drop()
-		return err
+		return types.TransactionID{}, err
 	}
+	return txnSet[len(txnSet)-1].ID(), nil
+}
+
+// recordAnnouncement records the successful announcement of addr in the
+// transaction with the ID txnID.
+func (h *Host) recordAnnouncement(addr modules.NetAddress, txnID types.TransactionID) {
 	h.announced = true
+	h.announceTxnID = txnID
+	h.deferredAnnounceAddr = ""
+	h.lastAnnouncement = time.Now()
+	atomic.AddUint64(&h.atomicAnnouncements, 1)
+	err := h.save()
+	if err != nil {
+		h.log.Println("WARN: unable to save the time of the announcement:", err)
+	}
 	h.log.Printf("INFO: Successfully announced as %v", addr)
+}
+
+// announce creates an announcement transaction and submits it to the network.
+// Every announcement of the host goes through checkAnnouncement, and announce
+// refuses to announce while an announcement requested through AnnounceAsync
+// is in flight.
+func (h *Host) announce(addr modules.NetAddress) error {
+	if h.announceWaiters != nil {
+		return errAnnounceInFlight
+	}
+	err := h.checkAnnouncement(addr)
+	if err != nil {
+		return err
+	}
+	txnID, err := h.managedSubmitAnnouncement(addr, h.publicKey, h.secretKey)
+	if err != nil {
+		return err
+	}
+	h.recordAnnouncement(addr, txnID)
 	return nil
 }
 
+// LastAnnouncement returns the time of the most recent successful
+// announcement, or the zero time if the host has never announced.
+func (h *Host) LastAnnouncement() time.Time {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	return h.lastAnnouncement
+}
+
 // Announce creates a host announcement transaction, adding information to the
 // arbitrary data, signing the transaction, and submitting it to the
 // transaction pool.
@@ -99,3 +229,81 @@ func (h *Host) AnnounceAddress(addr modules.NetAddress) error {
 
 	return h.announce(addr)
 }
+
+// AnnounceAsync starts an announcement of the host in the background and
+// returns a channel that receives the result of the announcement once it has
+// been submitted to the transaction pool or has failed. If an announcement is
+// already in flight, no new announcement is started and the returned channel
+// receives the result of the announcement in flight instead. The channel is
+// closed after the result has been sent.
+func (h *Host) AnnounceAsync() (<-chan modules.HostAnnounceResult, error) {
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	err := h.tg.Add()
+	if err != nil {
+		return nil, err
+	}
+
+	c := make(chan modules.HostAnnounceResult, 1)
+	if h.announceWaiters != nil {
+		h.announceWaiters = append(h.announceWaiters, c)
+		h.tg.Done()
+		return c, nil
+	}
+
+	// Determine whether to use the settings.NetAddress or autoAddress.
+	addr := h.settings.NetAddress
+	if addr == "" {
+		addr = h.autoAddress
+	}
+	if addr == "" {
+		h.tg.Done()
+		return nil, errUnknownAddress
+	}
+	h.announceWaiters = []chan modules.HostAnnounceResult{c}
+	go h.threadedAnnounce(addr)
+	return c, nil
+}
+
+// threadedAnnounce announces the provided address and delivers the result to
+// every AnnounceAsync call waiting on the announcement. The host lock is not
+// held while the announcement transaction is built and submitted, and
+// announceWaiters remains set, marking the announcement as in flight, until
+// the result has been recorded.
+func (h *Host) threadedAnnounce(addr modules.NetAddress) {
+	defer h.tg.Done()
+
+	lockID := h.mu.Lock()
+	err := h.checkAnnouncement(addr)
+	pk, sk := h.publicKey, h.secretKey
+	h.mu.Unlock(lockID)
+
+	var txnID types.TransactionID
+	if err == nil {
+		txnID, err = h.managedSubmitAnnouncement(addr, pk, sk)
+	}
+
+	lockID = h.mu.Lock()
+	if err == nil {
+		h.recordAnnouncement(addr, txnID)
+	}
+	result := modules.HostAnnounceResult{
+		Address:         addr,
+		TransactionID:   txnID,
+		Err:             err,
+		Reachable:       h.reachable,
+		ReachableReason: h.reachableReason,
+	}
+	waiters := h.announceWaiters
+	h.announceWaiters = nil
+	h.mu.Unlock(lockID)
+
+	if err != nil && len(waiters) == 0 {
+		h.log.Println("WARN: unable to make the announcement deferred until the host accepted contracts:", err)
+	}
+
+	for _, c := range waiters {
+		c <- result
+		close(c)
+	}
+}
@@ -2,7 +2,9 @@ package host
 
 import (
 	"bytes"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
@@ -136,3 +138,340 @@ func TestHostAnnounceAddress(t *testing.T) {
 		t.Error("announcement has wrong host key")
 	}
 }
+
+// TestReannounceOnPortChange checks that a host that is accepting contracts
+// re-announces itself at its new address when its port changes.
+func TestReannounceOnPortChange(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := newHostTester("TestReannounceOnPortChange")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	af, err := newAnnouncementFinder(ht.cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer af.Close()
+
+	settings := ht.host.InternalSettings()
+	settings.AcceptingContracts = true
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldAddr := ht.host.autoAddress
+	err = ht.host.SetListenAddress("localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newAddr := ht.host.autoAddress
+	if newAddr == oldAddr {
+		t.Fatal("auto address was not updated")
+	}
+	listenAddr := modules.NetAddress(ht.host.ListenAddr().String())
+	if newAddr.Port() != listenAddr.Port() {
+		t.Error("auto address does not match the new listener:", newAddr, listenAddr)
+	}
+
+	_, err = ht.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(af.netAddresses) != 1 {
+		t.Fatal("expected one announcement, got", len(af.netAddresses))
+	}
+	if af.netAddresses[0] != newAddr {
+		t.Error("announcement has wrong address:", af.netAddresses[0])
+	}
+}
+
+// TestAnnounceRateLimit checks that announcements made sooner than the
+// minimum announcement interval are refused and counted.
+func TestAnnounceRateLimit(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := newHostTester("TestAnnounceRateLimit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	settings := ht.host.InternalSettings()
+	settings.MinAnnounceInterval = time.Hour
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if !ht.host.LastAnnouncement().IsZero() {
+		t.Fatal("host has not announced, but reports an announcement time")
+	}
+
+	if err := ht.host.Announce(); err != nil {
+		t.Fatal(err)
+	}
+	last := ht.host.LastAnnouncement()
+	if last.IsZero() {
+		t.Fatal("time of the announcement was not recorded")
+	}
+	if err := ht.host.AnnounceAddress("foo.com:1234"); err != errAnnounceRateLimited {
+		t.Fatal("expected the second announcement to be rate limited, got", err)
+	}
+	if !ht.host.LastAnnouncement().Equal(last) {
+		t.Error("suppressed announcement changed the announcement time")
+	}
+	nm := ht.host.NetworkMetrics()
+	if nm.Announcements != 1 || nm.SuppressedAnnouncements != 1 {
+		t.Error("wrong announcement metrics:", nm.Announcements, nm.SuppressedAnnouncements)
+	}
+
+	// An interval of 0 restores the default, and a negative interval
+	// disables the rate limit.
+	settings.MinAnnounceInterval = 0
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if interval := ht.host.InternalSettings().MinAnnounceInterval; interval != defaultMinAnnounceInterval {
+		t.Fatal("zero interval did not restore the default:", interval)
+	}
+	settings.MinAnnounceInterval = -1
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if err := ht.host.AnnounceAddress("foo.com:1234"); err != nil {
+		t.Fatal("announcement was refused with the rate limit disabled:", err)
+	}
+}
+
+// TestAnnounceOnlyWhenAccepting checks that announcements are deferred while
+// the host is not accepting contracts, and made once it is.
+func TestAnnounceOnlyWhenAccepting(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := newHostTester("TestAnnounceOnlyWhenAccepting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	settings := ht.host.InternalSettings()
+	settings.AcceptingContracts = false
+	settings.AnnounceOnlyWhenAccepting = true
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if err := ht.host.AnnounceAddress("foo.com:1234"); err != errAnnounceNotAccepting {
+		t.Fatal("expected the announcement to be deferred, got", err)
+	}
+	if !ht.host.AnnouncementPending() || !ht.host.LastAnnouncement().IsZero() {
+		t.Fatal("announcement was not deferred")
+	}
+
+	// Accepting contracts in standby mode does not release the announcement.
+	if err := ht.host.SetMode(modules.HostModeStandby); err != nil {
+		t.Fatal(err)
+	}
+	settings.AcceptingContracts = true
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if !ht.host.AnnouncementPending() {
+		t.Fatal("announcement was made while the host was in standby")
+	}
+
+	// Leaving standby makes the deferred announcement.
+	if err := ht.host.SetMode(modules.HostModeLive); err != nil {
+		t.Fatal(err)
+	}
+	if ht.host.AnnouncementPending() || ht.host.LastAnnouncement().IsZero() {
+		t.Fatal("deferred announcement was not made")
+	}
+	nm := ht.host.NetworkMetrics()
+	if nm.Announcements != 1 || nm.SuppressedAnnouncements != 1 {
+		t.Error("wrong announcement metrics:", nm.Announcements, nm.SuppressedAnnouncements)
+	}
+}
+
+// TestDeferredAnnouncementRateLimited checks that a deferred announcement
+// refused by the rate limit is kept across restarts, and made on a later
+// block once the interval has passed.
+func TestDeferredAnnouncementRateLimited(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := newHostTester("TestDeferredAnnouncementRateLimited")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	settings := ht.host.InternalSettings()
+	settings.MinAnnounceInterval = time.Hour
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if err := ht.host.AnnounceAddress("foo.com:1234"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Defer an announcement, then start accepting contracts while the rate
+	// limit still refuses it.
+	settings.AcceptingContracts = false
+	settings.AnnounceOnlyWhenAccepting = true
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if err := ht.host.AnnounceAddress("bar.com:1234"); err != errAnnounceNotAccepting {
+		t.Fatal("expected the announcement to be deferred, got", err)
+	}
+	settings.AcceptingContracts = true
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if !ht.host.AnnouncementPending() {
+		t.Fatal("deferred announcement was lost after being rate limited")
+	}
+
+	// The deferred announcement should survive a restart.
+	err = ht.host.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht.host, err = New(ht.cs, ht.tpool, ht.wallet, "localhost:0", filepath.Join(ht.persistDir, modules.HostDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ht.host.AnnouncementPending() {
+		t.Fatal("deferred announcement was not persisted")
+	}
+
+	// Once the interval has passed, the next block makes the announcement.
+	lockID := ht.host.mu.Lock()
+	ht.host.lastAnnouncement = time.Now().Add(-2 * time.Hour)
+	ht.host.mu.Unlock(lockID)
+	if _, err := ht.miner.AddBlock(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100 && ht.host.AnnouncementPending(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ht.host.AnnouncementPending() {
+		t.Fatal("deferred announcement was not retried")
+	}
+	if nm := ht.host.NetworkMetrics(); nm.Announcements != 2 {
+		t.Error("wrong number of announcements:", nm.Announcements)
+	}
+}
+
+// blockingTpool is a transaction pool that blocks in AcceptTransactionSet
+// until release is closed, signalling on accepting each time it is entered.
+type blockingTpool struct {
+	modules.TransactionPool
+	accepting chan struct{}
+	release   chan struct{}
+}
+
+// AcceptTransactionSet blocks until release is closed, then passes the set to
+// the underlying transaction pool.
+func (tp blockingTpool) AcceptTransactionSet(ts []types.Transaction) error {
+	tp.accepting <- struct{}{}
+	<-tp.release
+	return tp.TransactionPool.AcceptTransactionSet(ts)
+}
+
+// TestAnnounceAsync checks that AnnounceAsync delivers the result of the
+// announcement, that requests made while an announcement is in flight share
+// its result, and that the host lock is not held while the announcement is in
+// flight.
+func TestAnnounceAsync(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := newHostTester("TestAnnounceAsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	// Replace the host with one whose transaction pool holds the
+	// announcement in flight until it is released.
+	err = ht.host.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := blockingTpool{
+		TransactionPool: ht.tpool,
+		accepting:       make(chan struct{}, 1),
+		release:         make(chan struct{}),
+	}
+	ht.host, err = New(ht.cs, tp, ht.wallet, "localhost:0", filepath.Join(ht.persistDir, modules.HostDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := ht.host.InternalSettings()
+	settings.NetAddress = "foo.com:1234"
+	settings.MinAnnounceInterval = time.Hour
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	lastAnnouncement := ht.host.LastAnnouncement()
+
+	c1, err := ht.host.AnnounceAsync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-tp.accepting
+
+	// The announcement is in flight. Other calls should not block on it,
+	// further requests should share its result, and synchronous
+	// announcements should be refused.
+	if ht.host.LastAnnouncement() != lastAnnouncement {
+		t.Error("announcement was recorded before it completed")
+	}
+	c2, err := ht.host.AnnounceAsync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ht.host.Announce(); err != errAnnounceInFlight {
+		t.Error("expected errAnnounceInFlight, got", err)
+	}
+	close(tp.release)
+
+	r1, r2 := <-c1, <-c2
+	if r1.Err != nil {
+		t.Fatal(r1.Err)
+	}
+	if r1 != r2 {
+		t.Error("coalesced requests received different results:", r1, r2)
+	}
+	if r1.TransactionID == (types.TransactionID{}) || r1.Address != settings.NetAddress {
+		t.Error("wrong result:", r1)
+	}
+	if r1.ReachableReason == "" {
+		t.Error("result does not report the reachability of the host:", r1)
+	}
+	if _, ok := <-c1; ok {
+		t.Error("channel was not closed after the result was sent")
+	}
+	if nm := ht.host.NetworkMetrics(); nm.Announcements != 1 {
+		t.Error("coalesced requests made more than one announcement:", nm.Announcements)
+	}
+
+	// An announcement that fails reports its error.
+	c3, err := ht.host.AnnounceAsync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := <-c3; r.Err != errAnnounceRateLimited {
+		t.Error("expected errAnnounceRateLimited, got", r.Err)
+	}
+}
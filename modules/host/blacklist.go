@@ -0,0 +1,36 @@
+package host
+
+import (
+	"net"
+)
+
+// parseBlacklist parses the CIDR ranges of the blacklist, returning an error
+// if any of them is invalid.
+func parseBlacklist(blacklist []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(blacklist))
+	for _, cidr := range blacklist {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+// blacklisted returns true if the provided remote address falls within one of
+// the blacklisted ranges. Addresses that are not IPs are never blacklisted.
+func (h *Host) blacklisted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	for _, ipnet := range h.blacklist {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
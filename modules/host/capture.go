@@ -0,0 +1,136 @@
+package host
+
+// capture.go implements the debug capture mode of the host, which records the
+// raw bytes of incoming connections for diagnosing protocol
+// incompatibilities. Captures contain everything that is sent over a
+// connection, including signatures and file data, so capturing is disabled
+// by default and is bounded both in the number of connections and in the
+// number of bytes recorded per connection.
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// captureDir is the name of the folder within the persist directory
+	// that holds the capture files.
+	captureDir = "captures"
+)
+
+var (
+	// errNegativeCaptureWindow is returned if the debug capture window is
+	// negative.
+	errNegativeCaptureWindow = errors.New("debug capture window cannot be negative")
+)
+
+// captureConn is a net.Conn that writes a hex dump of the bytes read from and
+// written to the connection to a capture file. Once 'limit' bytes have been
+// recorded, the remaining traffic passes through without being recorded.
+type captureConn struct {
+	net.Conn
+	file     *os.File
+	limit    uint64
+	recorded uint64
+	mu       sync.Mutex
+}
+
+// record writes the provided bytes to the capture file, truncating them if
+// the limit of the capture has been reached.
+func (cc *captureConn) record(direction string, b []byte) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.recorded >= cc.limit || len(b) == 0 {
+		return
+	}
+	if remaining := cc.limit - cc.recorded; uint64(len(b)) > remaining {
+		b = b[:remaining]
+	}
+	cc.recorded += uint64(len(b))
+	fmt.Fprintf(cc.file, "%v %v %d bytes\n%s", time.Now().Format(time.RFC3339Nano), direction, len(b), hex.Dump(b))
+	if cc.recorded == cc.limit {
+		fmt.Fprintf(cc.file, "capture truncated after %d bytes\n", cc.limit)
+	}
+}
+
+// Read implements the io.Reader interface, recording the bytes that were
+// read.
+func (cc *captureConn) Read(b []byte) (int, error) {
+	n, err := cc.Conn.Read(b)
+	cc.record("read", b[:n])
+	return n, err
+}
+
+// Write implements the io.Writer interface, recording the bytes that were
+// written.
+func (cc *captureConn) Write(b []byte) (int, error) {
+	n, err := cc.Conn.Write(b)
+	cc.record("write", b[:n])
+	return n, err
+}
+
+// close closes the capture file. The connection is not closed.
+func (cc *captureConn) close() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.file.Close()
+}
+
+// startCapture resets the capture window and connection count. It should be
+// called whenever debug capture is enabled.
+func (h *Host) startCapture() {
+	h.captureStart = time.Now()
+	h.capturedConns = 0
+	h.log.Println("WARN: debug capture is enabled, raw connection data will be written to", filepath.Join(h.persistDir, captureDir))
+}
+
+// managedCaptureConn returns a captureConn wrapping the provided connection
+// if debug capture is enabled and neither the connection limit nor the
+// capture window has been exhausted. Otherwise, nil is returned.
+func (h *Host) managedCaptureConn(conn net.Conn) *captureConn {
+	// Avoid taking the write lock for every connection when capture is
+	// disabled, which is almost always.
+	lockID := h.mu.RLock()
+	enabled := h.settings.DebugCapture
+	h.mu.RUnlock(lockID)
+	if !enabled {
+		return nil
+	}
+
+	lockID = h.mu.Lock()
+	if !h.settings.DebugCapture || time.Since(h.captureStart) > h.settings.DebugCaptureWindow || h.capturedConns >= h.settings.DebugCaptureConnections {
+		h.mu.Unlock(lockID)
+		return nil
+	}
+	h.capturedConns++
+	n := h.capturedConns
+	start := h.captureStart
+	limit := h.settings.DebugCaptureBytes
+	h.mu.Unlock(lockID)
+
+	dir := filepath.Join(h.persistDir, captureDir)
+	err := h.mkdirAll(dir, 0700)
+	if err != nil {
+		h.log.Println("WARN: could not create the capture folder:", err)
+		return nil
+	}
+	name := fmt.Sprintf("%v-%d-%v.capture", start.Unix(), n, strings.Replace(conn.RemoteAddr().String(), ":", "_", -1))
+	file, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		h.log.Println("WARN: could not create a capture file:", err)
+		return nil
+	}
+	fmt.Fprintf(file, "capture of connection from %v, started %v\n", conn.RemoteAddr(), time.Now().Format(time.RFC3339Nano))
+	return &captureConn{
+		Conn:  conn,
+		file:  file,
+		limit: limit,
+	}
+}
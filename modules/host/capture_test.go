@@ -0,0 +1,89 @@
+package host
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestDebugCapture checks that debug capture records the bytes of a bounded
+// number of connections, truncating each capture at the byte limit.
+func TestDebugCapture(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestDebugCapture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	settings := ht.host.InternalSettings()
+	if settings.DebugCapture {
+		t.Fatal("debug capture should be disabled by default")
+	}
+	settings.DebugCaptureWindow = -time.Second
+	if err := ht.host.SetInternalSettings(settings); err == nil {
+		t.Fatal("expected a negative capture window to be rejected")
+	}
+	settings.DebugCapture = true
+	settings.DebugCaptureConnections = 1
+	settings.DebugCaptureBytes = 20
+	settings.DebugCaptureWindow = time.Minute
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	ping := func() {
+		conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		encoding.WriteObject(conn, modules.RPCPing)
+		encoding.WriteObject(conn, [8]byte{1})
+		var resp modules.HostPingResponse
+		if err := encoding.ReadObject(conn, &resp, 256); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ping()
+	ping()
+
+	// Only the first connection should have been captured. The capture file
+	// is closed once the host is done with the connection.
+	dir := filepath.Join(ht.host.persistDir, captureDir)
+	var files []string
+	for i := 0; i < 100; i++ {
+		files, _ = filepath.Glob(filepath.Join(dir, "*.capture"))
+		if len(files) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(files) != 1 {
+		t.Fatal("expected one capture file, got", len(files))
+	}
+	var contents string
+	for i := 0; i < 100 && !strings.Contains(contents, "truncated"); i++ {
+		b, err := ioutil.ReadFile(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents = string(b)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(contents, "read") || !strings.Contains(contents, "|Ping") {
+		t.Error("capture does not contain the RPC specifier:", contents)
+	}
+	if !strings.Contains(contents, "capture truncated after 20 bytes") {
+		t.Error("capture was not truncated at the byte limit:", contents)
+	}
+}
@@ -2,6 +2,7 @@ package host
 
 import (
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 
@@ -21,11 +22,75 @@ const (
 	// necessary to limit the impact of DoS attacks.
 	fileContractNegotiationTimeout = 120 * time.Second
 
+	// hostnameCheckInterval is the amount of time that the host waits between
+	// checks of its hostname while hostname discovery is succeeding.
+	hostnameCheckInterval = 30 * time.Minute
+
+	// hostnameRetryMinInterval is the amount of time that the host waits
+	// before checking its hostname again after a failed check. The interval
+	// doubles with each consecutive failure, up to hostnameCheckInterval.
+	hostnameRetryMinInterval = time.Minute
+
 	// iteratedConnectionTime is the amount of time that is allowed to pass
 	// before the host will stop accepting new iterations on an iterated
 	// connection.
 	iteratedConnectionTime = 1200 * time.Second
 
+	// defaultConnectionDeadline is the default initial deadline of an incoming
+	// connection. The deadline is generous, but finite, and RPCs can extend it
+	// if desired.
+	defaultConnectionDeadline = 5 * time.Minute
+
+	// defaultMaxConnectionLifetime is the default maximum lifetime of an
+	// incoming connection. It is much longer than any legitimate call should
+	// take, and only bounds callers that keep extending the deadline.
+	defaultMaxConnectionLifetime = 2 * time.Hour
+
+	// defaultConnectionDeadlineJitter is the default upper bound of the
+	// random duration that is added to the initial deadline of an incoming
+	// connection.
+	defaultConnectionDeadlineJitter = 5 * time.Second
+
+	// defaultConnLogRate is the default number of warnings per second that
+	// may be logged while handling incoming connections.
+	defaultConnLogRate = 10
+
+	// connLogFlushInterval is the amount of time after which warnings about
+	// incoming connections that were suppressed by the rate limit are
+	// reported, if no warning has been allowed through to report them.
+	connLogFlushInterval = 10 * time.Second
+
+	// defaultRemoteMetricsLimit is the default number of remote addresses for
+	// which the host tracks per-address RPC metrics. Each entry is small, but
+	// the limit prevents an attacker from consuming memory by connecting from
+	// many addresses.
+	defaultRemoteMetricsLimit = 1000
+
+	// defaultPortForwardTimeout is the default amount of time that the host
+	// waits for the router to respond to a UPnP request before giving up.
+	defaultPortForwardTimeout = time.Minute
+
+	// defaultDebugCaptureBytes, defaultDebugCaptureConnections and
+	// defaultDebugCaptureWindow bound the amount of data recorded by debug
+	// capture, so that a forgotten capture cannot fill the disk.
+	defaultDebugCaptureBytes       = 1 << 20
+	defaultDebugCaptureConnections = 10
+	defaultDebugCaptureWindow      = 10 * time.Minute
+
+	// maxConnBufferSize is the largest read or write buffer size that can be
+	// requested for an incoming connection. It keeps a misconfigured buffer
+	// size from exhausting the memory of the host.
+	maxConnBufferSize = 64 << 20
+
+	// reachabilityDialTimeout is the amount of time that the host waits for
+	// its own net address to respond when performing a self-dial check.
+	reachabilityDialTimeout = 10 * time.Second
+
+	// rpcSpecifierLen is the number of bytes read from an incoming
+	// connection to learn which RPC is being called. It is derived from the
+	// specifier type so that the two cannot drift apart.
+	rpcSpecifierLen = uint64(len(types.Specifier{}))
+
 	// resubmissionTimeout defines the number of blocks that a host will wait
 	// before attempting to resubmit a transaction to the blockchain.
 	// Typically, this transaction will contain either a file contract, a file
@@ -125,6 +190,22 @@ var (
 		panic("unrecognized release constant in host - defaultWindowSize")
 	}()
 
+	// defaultMinAnnounceInterval is the default minimum amount of time
+	// between two announcements of the host. Testing builds do not limit
+	// announcements, so that tests can announce as often as they need to.
+	defaultMinAnnounceInterval = func() time.Duration {
+		if build.Release == "dev" {
+			return time.Minute
+		}
+		if build.Release == "standard" {
+			return 10 * time.Minute
+		}
+		if build.Release == "testing" {
+			return 0
+		}
+		panic("unrecognized release constant in host - defaultMinAnnounceInterval")
+	}()
+
 	// maximumLockedStorageObligations sets the maximum number of storage
 	// obligations that are allowed to be locked at a time. The map uses an
 	// in-memory lock, but also a locked storage obligation could be reading a
@@ -158,6 +239,23 @@ var (
 		panic("unrecognized release constant in host - obligationLockTimeout")
 	}()
 
+	// panicLockTimeout is how long the host waits to acquire its lock after
+	// recovering from a panic in an RPC handler. If the lock cannot be
+	// acquired, the panic is assumed to have been raised while the lock was
+	// held, and the host does not recover from it.
+	panicLockTimeout = func() time.Duration {
+		if build.Release == "dev" {
+			return time.Second * 10
+		}
+		if build.Release == "standard" {
+			return time.Second * 30
+		}
+		if build.Release == "testing" {
+			return time.Second
+		}
+		panic("unrecognized release constant in host - panicLockTimeout")
+	}()
+
 	// revisionSubmissionBuffer describes the number of blocks ahead of time
 	// that the host will submit a file contract revision. The host will not
 	// accept any more revisions once inside the submission buffer.
@@ -202,4 +300,10 @@ func init() {
 	if revisionSubmissionBuffer < resubmissionTimeout {
 		build.Critical("revision submission buffer needs to be larger than or equal to the resubmission timeout")
 	}
+
+	// The RPC specifier is read with a limit of rpcSpecifierLen bytes, which
+	// must match the encoded size of a specifier, or no RPC can be read.
+	if uint64(len(encoding.Marshal(types.Specifier{}))) != rpcSpecifierLen {
+		build.Critical("rpcSpecifierLen does not match the encoded size of a specifier")
+	}
 }
@@ -64,10 +64,12 @@ package host
 // TODO: update_test.go has commented out tests.
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
 	"path/filepath"
+	"time"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
@@ -115,14 +117,64 @@ var (
 type Host struct {
 	// RPC Metrics - atomic variables need to be placed at the top to preserve
 	// compatibility with 32bit systems.
+	atomicAdmissionRejects    uint64
+	atomicAuthSettingsCalls   uint64
+	atomicBlacklistRejects    uint64
+	atomicBusyCalls           uint64
+	atomicCapacityRejects     uint64
+	atomicChallengeFailures   uint64
+	atomicChallengeRejects    uint64
+	atomicDeadlineFailures    uint64
+	atomicDisabledCalls       uint64
 	atomicDownloadCalls       uint64
 	atomicErroredCalls        uint64
 	atomicFormContractCalls   uint64
+	atomicHostMetricsCalls    uint64
+	atomicIdleTimeoutCalls    uint64
+	atomicLifetimeCloses      uint64
+	atomicMaintenanceCalls    uint64
+	atomicNotReadyCalls       uint64
+	atomicPanicCalls          uint64
+	atomicPingCalls           uint64
+	atomicRecoveredCalls      uint64
 	atomicRenewCalls          uint64
+	atomicRetriedCalls        uint64
 	atomicReviseCalls         uint64
 	atomicRecentRevisionCalls uint64
 	atomicSettingsCalls       uint64
+	atomicShutdownClosedCalls uint64
+	atomicStandbyCalls        uint64
+	atomicTimeoutCalls        uint64
 	atomicUnrecognizedCalls   uint64
+	atomicUpdateSettingsCalls uint64
+	atomicWhitelistRejects    uint64
+
+	// The errors returned by RPC handlers, counted by category. Errors that
+	// do not fall into any of the categories are only counted in
+	// atomicErroredCalls.
+	atomicConsensusErrors  uint64
+	atomicDecodeErrors     uint64
+	atomicIOErrors         uint64
+	atomicValidationErrors uint64
+
+	// atomicPreDispatchErrors counts the connections that failed before the
+	// requested RPC was identified, such as those that could not have their
+	// deadline set or that sent a malformed specifier. atomicHandlerErrors
+	// counts the RPCs whose handler returned an error.
+	atomicHandlerErrors     uint64
+	atomicPreDispatchErrors uint64
+
+	// atomicAnnouncements is the number of announcements that the host has
+	// made, and atomicSuppressedAnnouncements is the number that were
+	// refused because of the minimum announcement interval.
+	atomicAnnouncements           uint64
+	atomicSuppressedAnnouncements uint64
+
+	// atomicOpenConnections is the number of connections currently being
+	// handled by the host, and atomicPeakConnections is the highest number
+	// of connections handled at once since the host was started.
+	atomicOpenConnections int64
+	atomicPeakConnections int64
 
 	// Dependencies.
 	cs     modules.ConsensusSet
@@ -150,7 +202,9 @@ type Host struct {
 	// successful announcement with the current address.
 	announced        bool
 	autoAddress      modules.NetAddress
+	lastAnnouncement time.Time
 	financialMetrics modules.HostFinancialMetrics
+	mode             modules.HostMode
 	publicKey        types.SiaPublicKey
 	revisionNumber   uint64
 	secretKey        crypto.SecretKey
@@ -162,14 +216,105 @@ type Host struct {
 	// be locked separately.
 	lockedStorageObligations map[types.FileContractID]*siasync.TryMutex
 
+	// ready indicates whether the host is prepared to negotiate contracts. The
+	// host is ready by default, embedders that track the synchronization of
+	// the consensus set can mark the host as not ready while it catches up.
+	ready bool
+
+	// portForwardErr is the result of the most recent attempt to forward the
+	// host's port. reachable and reachableReason hold the host's best
+	// understanding of whether it can be reached by renters, and are updated
+	// on each hostname discovery cycle.
+	portForwardErr  error
+	reachable       bool
+	reachableReason string
+
+	// announcePending indicates that an automatic announcement has been
+	// deferred until the host has confirmed that it is reachable, which
+	// requires both port forwarding and a self-dial to succeed.
+	// reachabilityConfirmed is the result of the most recent confirmation.
+	announcePending       bool
+	reachabilityConfirmed bool
+
+	// deferredAnnounceAddr is the address of an announcement that has been
+	// deferred until the host is accepting contracts, and is empty if no
+	// announcement has been deferred. It is persisted, and cleared once an
+	// announcement succeeds.
+	deferredAnnounceAddr modules.NetAddress
+
+	// announceTxnID is the ID of the transaction of the most recent
+	// successful announcement. announceWaiters holds the channels of the
+	// AnnounceAsync calls waiting on the announcement in flight, and is nil
+	// if no announcement is in flight.
+	announceTxnID   types.TransactionID
+	announceWaiters []chan modules.HostAnnounceResult
+
+	// remoteMetrics tracks the RPC calls made by each of the most recently
+	// seen remote addresses.
+	remoteMetrics *remoteMetrics
+
+	// settingsCache holds the most recently signed external settings, which
+	// are served by the settings RPCs until the settings change.
+	settingsCache settingsCache
+
+	// rejections records the most recent connections and calls that the
+	// host refused.
+	rejections *rejectionLog
+
+	// connLogLimiter rate limits the warnings logged while handling
+	// incoming connections.
+	connLogLimiter *logLimiter
+
+	// admissionFunc is the AdmissionFunc registered by the operator, and is
+	// nil if none is registered.
+	admissionFunc AdmissionFunc
+
+	// resolver is used to resolve hostnames during hostname discovery and
+	// the self-dial check. A nil resolver uses the system resolver.
+	resolver *net.Resolver
+
+	// peerVersions counts the connections made to the host by the protocol
+	// version advertised by the peer.
+	peerVersions *peerVersions
+
+	// rpcsInUse counts the calls of each RPC that are currently being
+	// served, for enforcing the per-RPC concurrency limits.
+	rpcsInUse *rpcsInUse
+
+	// rpcBandwidth holds the token buckets shared by the calls of each RPC
+	// that has a bandwidth limit.
+	rpcBandwidth *rpcBandwidth
+
+	// downloadThroughput is a moving average of the throughput achieved when
+	// sending data to renters, in bytes per second.
+	downloadThroughput uint64
+
+	// blacklist and whitelist hold the parsed ranges of the blacklist and
+	// the whitelist in the settings.
+	blacklist []*net.IPNet
+	whitelist []*net.IPNet
+
+	// captureStart is the time at which debug capture was last enabled, and
+	// capturedConns is the number of connections captured since then.
+	captureStart  time.Time
+	capturedConns uint64
+
+	// startTime is the time at which the host was created.
+	startTime time.Time
+
+	// tlsConfig is used to serve TLS connections, and is nil if the host has
+	// not been configured with a certificate.
+	tlsConfig *tls.Config
+
 	// Utilities.
-	db         *persist.BoltDatabase
-	listener   net.Listener
-	log        *persist.Logger
-	mu         *siasync.RWMutex
-	persistDir string
-	port       string
-	tg         siasync.ThreadGroup
+	db             *persist.BoltDatabase
+	listener       net.Listener
+	listenerClosed chan struct{} // Closed when the current listener's thread returns.
+	log            *persist.Logger
+	mu             *siasync.RWMutex
+	persistDir     string
+	port           string
+	tg             siasync.ThreadGroup
 }
 
 // checkUnlockHash will check that the host has an unlock hash. If the host
@@ -220,6 +365,14 @@ func newHost(dependencies dependencies, cs modules.ConsensusSet, tpool modules.T
 		dependencies: dependencies,
 
 		lockedStorageObligations: make(map[types.FileContractID]*siasync.TryMutex),
+		peerVersions:             newPeerVersions(),
+		rpcsInUse:                newRPCsInUse(),
+		rpcBandwidth:             newRPCBandwidth(),
+		reachableReason:          reachabilityUnknown,
+		ready:                    true,
+		rejections:               newRejectionLog(rejectionLogLen),
+		remoteMetrics:            newRemoteMetrics(defaultRemoteMetricsLimit),
+		startTime:                time.Now(),
 
 		mu:         siasync.New(modules.SafeMutexDelay, 2),
 		persistDir: persistDir,
@@ -253,6 +406,10 @@ func newHost(dependencies dependencies, cs modules.ConsensusSet, tpool modules.T
 			fmt.Println("Error when closing the logger:", err)
 		}
 	})
+	// Report suppressed connection warnings to the logger until it is
+	// closed.
+	h.connLogLimiter = newLogLimiter(defaultConnLogRate, connLogFlushInterval, h.logSuppressedConnLines)
+	h.tg.AfterStop(h.connLogLimiter.stop)
 
 	// Add the storage manager to the host, and set up the stop call that will
 	// close the storage manager.
@@ -304,7 +461,16 @@ func New(cs modules.ConsensusSet, tpool modules.TransactionPool, wallet modules.
 	return newHost(productionDependencies{}, cs, tpool, wallet, address, persistDir)
 }
 
-// Close shuts down the host.
+// Close shuts down the host. The shutdown happens in a fixed order:
+//
+//  1. The listener is closed, so that no new connections are accepted, and
+//     the host waits for threadedListen to return.
+//  2. The connections that are still being handled are closed, and the host
+//     waits for their handlers to return. A connection that was accepted
+//     during shutdown is closed without being served.
+//  3. The background workers, such as hostname discovery and port
+//     forwarding, are stopped.
+//  4. The host is saved, and the storage manager and logger are closed.
 func (h *Host) Close() error {
 	return h.tg.Stop()
 }
@@ -323,6 +489,14 @@ func (h *Host) ExternalSettings() modules.HostExternalSettings {
 	return h.externalSettings()
 }
 
+// SettingsExtension returns the settings extension that the host sends along
+// with its external settings.
+func (h *Host) SettingsExtension() modules.HostSettingsExtension {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	return h.settingsExtension()
+}
+
 // FinancialMetrics returns information about the financial commitments,
 // rewards, and activities of the host.
 func (h *Host) FinancialMetrics() modules.HostFinancialMetrics {
@@ -336,6 +510,29 @@ func (h *Host) FinancialMetrics() modules.HostFinancialMetrics {
 	return h.financialMetrics
 }
 
+// Metrics returns the network metrics of the host together with the number
+// of contracts that it holds and its committed and free storage. The gauges
+// are read under a single acquisition of the host lock, so that they describe
+// the same moment.
+func (h *Host) Metrics() modules.HostMetrics {
+	nm := h.NetworkMetrics()
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	total, remaining := h.capacity()
+	var committed uint64
+	if remaining < total {
+		committed = total - remaining
+	}
+	return modules.HostMetrics{
+		Network: nm,
+
+		ContractCount:    h.financialMetrics.ContractCount,
+		CommittedStorage: committed,
+		RemainingStorage: remaining,
+		TotalStorage:     total,
+	}
+}
+
 // SetInternalSettings updates the host's internal HostInternalSettings object.
 func (h *Host) SetInternalSettings(settings modules.HostInternalSettings) error {
 	lockID := h.mu.Lock()
@@ -345,7 +542,12 @@ func (h *Host) SetInternalSettings(settings modules.HostInternalSettings) error
 		return err
 	}
 	defer h.tg.Done()
+	return h.setInternalSettings(settings)
+}
 
+// setInternalSettings validates and applies new internal settings, then saves
+// the host. The host must be locked, and the thread group added to.
+func (h *Host) setInternalSettings(settings modules.HostInternalSettings) error {
 	// The host should not be accepting file contracts if it does not have an
 	// unlock hash.
 	if settings.AcceptingContracts {
@@ -355,6 +557,72 @@ func (h *Host) SetInternalSettings(settings modules.HostInternalSettings) error
 		}
 	}
 
+	err := checkHostnameProviders(settings.HostnameProviders)
+	if err != nil {
+		return errors.New("internal settings not updated, invalid HostnameProviders: " + err.Error())
+	}
+
+	err = checkBufferSizes(settings.ReadBufferSize, settings.WriteBufferSize)
+	if err != nil {
+		return errors.New("internal settings not updated, invalid buffer size: " + err.Error())
+	}
+
+	err = checkSyncGraceRPCs(settings.SyncGraceRPCs)
+	if err != nil {
+		return errors.New("internal settings not updated, invalid SyncGraceRPCs: " + err.Error())
+	}
+
+	whitelist, err := parseWhitelist(settings.WhitelistEnabled, settings.Whitelist)
+	if err != nil {
+		return errors.New("internal settings not updated, invalid Whitelist: " + err.Error())
+	}
+
+	if settings.ConnectionDeadline < 0 {
+		return errors.New("internal settings not updated, invalid ConnectionDeadline: " + errNegativeConnectionDeadline.Error())
+	}
+	if settings.PortForwardTimeout < 0 {
+		return errors.New("internal settings not updated, invalid PortForwardTimeout: " + errNegativePortForwardTimeout.Error())
+	}
+	if settings.IdleTimeout < 0 {
+		return errors.New("internal settings not updated, invalid IdleTimeout: " + errNegativeIdleTimeout.Error())
+	}
+	if settings.MaxConnectionLifetime < 0 {
+		return errors.New("internal settings not updated, invalid MaxConnectionLifetime: " + errNegativeConnectionLifetime.Error())
+	}
+	if settings.DebugCaptureWindow < 0 {
+		return errors.New("internal settings not updated, invalid DebugCaptureWindow: " + errNegativeCaptureWindow.Error())
+	}
+
+	blacklist, err := parseBlacklist(settings.Blacklist)
+	if err != nil {
+		return errors.New("internal settings not updated, invalid Blacklist: " + err.Error())
+	}
+
+	err = checkRPCTimeouts(settings.RPCTimeouts)
+	if err != nil {
+		return errors.New("internal settings not updated, invalid RPCTimeouts: " + err.Error())
+	}
+	err = checkRPCConcurrencyLimits(settings.RPCConcurrencyLimits)
+	if err != nil {
+		return errors.New("internal settings not updated, invalid RPCConcurrencyLimits: " + err.Error())
+	}
+	err = checkRPCBandwidthLimits(settings.RPCBandwidthLimits)
+	if err != nil {
+		return errors.New("internal settings not updated, invalid RPCBandwidthLimits: " + err.Error())
+	}
+	err = checkRPCRetries(settings.RPCRetries)
+	if err != nil {
+		return errors.New("internal settings not updated, invalid RPCRetries: " + err.Error())
+	}
+	if settings.SettingsChallengeDifficulty > modules.MaxSettingsChallengeDifficulty {
+		return errors.New("internal settings not updated, invalid SettingsChallengeDifficulty: " + modules.ErrSettingsChallengeTooHard.Error())
+	}
+
+	tlsConfig, err := loadTLSConfig(settings.TLSCertFile, settings.TLSKeyFile)
+	if err != nil {
+		return errors.New("internal settings not updated, invalid TLS certificate: " + err.Error())
+	}
+
 	if settings.NetAddress != "" {
 		err := settings.NetAddress.IsValid()
 		if err != nil {
@@ -369,8 +637,49 @@ func (h *Host) SetInternalSettings(settings modules.HostInternalSettings) error
 		h.announced = false
 	}
 
+	if settings.RemoteMetricsLimit == 0 {
+		settings.RemoteMetricsLimit = defaultRemoteMetricsLimit
+	}
+	h.remoteMetrics.setLimit(int(settings.RemoteMetricsLimit))
+	if settings.ConnLogRate == 0 {
+		settings.ConnLogRate = defaultConnLogRate
+	}
+	h.connLogLimiter.setRate(settings.ConnLogRate)
+	if settings.ConnectionDeadline == 0 {
+		settings.ConnectionDeadline = defaultConnectionDeadline
+	}
+	if settings.ConnectionDeadlineJitter == 0 {
+		settings.ConnectionDeadlineJitter = defaultConnectionDeadlineJitter
+	}
+	if settings.MinAnnounceInterval == 0 {
+		settings.MinAnnounceInterval = defaultMinAnnounceInterval
+	}
+	if settings.MaxConnectionLifetime == 0 {
+		settings.MaxConnectionLifetime = defaultMaxConnectionLifetime
+	}
+	if settings.PortForwardTimeout == 0 {
+		settings.PortForwardTimeout = defaultPortForwardTimeout
+	}
+	if settings.DebugCaptureBytes == 0 {
+		settings.DebugCaptureBytes = defaultDebugCaptureBytes
+	}
+	if settings.DebugCaptureConnections == 0 {
+		settings.DebugCaptureConnections = defaultDebugCaptureConnections
+	}
+	if settings.DebugCaptureWindow == 0 {
+		settings.DebugCaptureWindow = defaultDebugCaptureWindow
+	}
+	enablingCapture := settings.DebugCapture && !h.settings.DebugCapture
+
 	h.settings = settings
+	h.tlsConfig = tlsConfig
+	h.blacklist = blacklist
+	h.whitelist = whitelist
 	h.revisionNumber++
+	if enablingCapture {
+		h.startCapture()
+	}
+	h.makeDeferredAnnouncement()
 
 	err = h.saveSync()
 	if err != nil {
@@ -379,6 +688,47 @@ func (h *Host) SetInternalSettings(settings modules.HostInternalSettings) error
 	return nil
 }
 
+// Mode returns the mode of the host.
+func (h *Host) Mode() modules.HostMode {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	return h.mode
+}
+
+// SetMode puts the host in the provided mode. Outside of HostModeLive, the
+// host continues to serve settings, pings, metrics, and downloads and
+// revisions for existing contracts, but refuses to form or renew contracts,
+// and advertises its mode in its settings extension. A host in
+// HostModeStandby can announce itself and build a reputation before going
+// live.
+func (h *Host) SetMode(mode modules.HostMode) error {
+	if mode > modules.HostModeStandby {
+		return errUnknownHostMode
+	}
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	err := h.tg.Add()
+	if err != nil {
+		return err
+	}
+	defer h.tg.Done()
+	if h.mode == mode {
+		return nil
+	}
+	h.mode = mode
+	h.revisionNumber++
+	h.makeDeferredAnnouncement()
+	return h.saveSync()
+}
+
+// SetReady sets whether the host is ready to negotiate contracts. While the
+// host is not ready, calls to form, renew, or revise contracts are refused.
+func (h *Host) SetReady(ready bool) {
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	h.ready = ready
+}
+
 // InternalSettings returns the settings of a host.
 func (h *Host) InternalSettings() modules.HostInternalSettings {
 	lockID := h.mu.RLock()
@@ -530,3 +530,36 @@ func TestPersistentSettings(t *testing.T) {
 	}
 }
 */
+
+// TestHostMetrics checks that Metrics reports the contract count and the
+// storage capacity of the host.
+func TestHostMetrics(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := newHostTester("TestHostMetrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	lockID := ht.host.mu.Lock()
+	ht.host.financialMetrics.ContractCount = 2
+	ht.host.mu.Unlock(lockID)
+	ht.host.atomicSettingsCalls = 3
+
+	m := ht.host.Metrics()
+	if m.ContractCount != 2 {
+		t.Error("wrong contract count:", m.ContractCount)
+	}
+	if m.TotalStorage != modules.SectorSize*8*3 {
+		t.Error("wrong total storage:", m.TotalStorage)
+	}
+	if m.RemainingStorage != m.TotalStorage || m.CommittedStorage != 0 {
+		t.Error("empty host reported committed storage:", m.CommittedStorage, m.RemainingStorage)
+	}
+	if m.Network.SettingsCalls != 3 {
+		t.Error("network metrics were not included")
+	}
+}
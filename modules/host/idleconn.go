@@ -0,0 +1,77 @@
+package host
+
+// idleconn.go implements the idle timeout of incoming connections. Unlike the
+// connection deadline, which bounds the total length of a call, the idle
+// timeout is reset every time data is read from or written to the connection,
+// so that stalled callers are dropped quickly while long transfers that are
+// making progress are allowed to continue.
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// errNegativeIdleTimeout is returned if the idle timeout is negative.
+	errNegativeIdleTimeout = errors.New("idle timeout cannot be negative")
+)
+
+// idleConn is a net.Conn that is closed if no reads or writes complete
+// within the timeout. A single read or write that blocks for longer than the
+// timeout, such as a large write to a slow caller, will also close the
+// connection.
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+	timer   *time.Timer
+
+	// atomicIdled is set to 1 when the connection has been closed by the
+	// timer.
+	atomicIdled int32
+}
+
+// newIdleConn wraps a connection with an idle timeout. The timer starts
+// immediately.
+func newIdleConn(conn net.Conn, timeout time.Duration) *idleConn {
+	ic := &idleConn{
+		Conn:    conn,
+		timeout: timeout,
+	}
+	ic.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&ic.atomicIdled, 1)
+		ic.Conn.Close()
+	})
+	return ic
+}
+
+// Read implements the io.Reader interface, resetting the idle timer once the
+// read completes.
+func (ic *idleConn) Read(b []byte) (int, error) {
+	n, err := ic.Conn.Read(b)
+	if n > 0 {
+		ic.timer.Reset(ic.timeout)
+	}
+	return n, err
+}
+
+// Write implements the io.Writer interface, resetting the idle timer once the
+// write completes.
+func (ic *idleConn) Write(b []byte) (int, error) {
+	n, err := ic.Conn.Write(b)
+	if n > 0 {
+		ic.timer.Reset(ic.timeout)
+	}
+	return n, err
+}
+
+// idled returns true if the connection was closed by the idle timer.
+func (ic *idleConn) idled() bool {
+	return atomic.LoadInt32(&ic.atomicIdled) == 1
+}
+
+// stop stops the idle timer. The connection is not closed.
+func (ic *idleConn) stop() {
+	ic.timer.Stop()
+}
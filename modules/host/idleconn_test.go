@@ -0,0 +1,83 @@
+package host
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestIdleTimeout checks that idle connections are closed and counted, and
+// that connections which keep sending data outlive the idle timeout.
+func TestIdleTimeout(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestIdleTimeout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	settings := ht.host.InternalSettings()
+	settings.IdleTimeout = -time.Second
+	if err := ht.host.SetInternalSettings(settings); err == nil {
+		t.Fatal("expected a negative idle timeout to be rejected")
+	}
+	settings.IdleTimeout = 200 * time.Millisecond
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	// A connection that sends nothing should be closed well before the
+	// connection deadline.
+	idle, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	idle.SetReadDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	if _, err := idle.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected the idle connection to be closed")
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Fatal("idle connection was not closed by the idle timeout")
+	}
+	for i := 0; i < 100 && ht.host.NetworkMetrics().IdleTimeoutCalls == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := ht.host.NetworkMetrics().IdleTimeoutCalls; n != 1 {
+		t.Fatal("expected one idle timeout, got", n)
+	}
+
+	// A ping that trickles in over several idle timeouts should succeed.
+	var call bytes.Buffer
+	encoding.WriteObject(&call, modules.RPCPing)
+	encoding.WriteObject(&call, [8]byte{1})
+	active, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer active.Close()
+	for _, b := range call.Bytes() {
+		if _, err := active.Write([]byte{b}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(25 * time.Millisecond)
+	}
+	var resp modules.HostPingResponse
+	if err := encoding.ReadObject(active, &resp, 256); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Nonce != [8]byte{1} {
+		t.Error("wrong nonce in ping response")
+	}
+	if n := ht.host.NetworkMetrics().IdleTimeoutCalls; n != 1 {
+		t.Error("active connection was counted as idle")
+	}
+}
@@ -0,0 +1,55 @@
+package host
+
+// lifetimeconn.go implements the maximum lifetime of incoming connections.
+// RPCs such as downloads extend the connection deadline as they make
+// progress, so a caller that keeps a long transfer going could otherwise hold
+// a connection indefinitely. The lifetime is measured from the time that the
+// connection was accepted, and is enforced no matter how far the deadline has
+// been extended.
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// errNegativeConnectionLifetime is returned if the maximum connection
+	// lifetime is negative.
+	errNegativeConnectionLifetime = errors.New("maximum connection lifetime cannot be negative")
+)
+
+// lifetimeConn is a net.Conn that is closed once it has been open for longer
+// than its lifetime.
+type lifetimeConn struct {
+	net.Conn
+	timer *time.Timer
+
+	// atomicExpired is set to 1 when the connection has been closed by the
+	// timer.
+	atomicExpired int32
+}
+
+// newLifetimeConn wraps a connection with a maximum lifetime. The timer
+// starts immediately.
+func newLifetimeConn(conn net.Conn, lifetime time.Duration) *lifetimeConn {
+	lc := &lifetimeConn{
+		Conn: conn,
+	}
+	lc.timer = time.AfterFunc(lifetime, func() {
+		atomic.StoreInt32(&lc.atomicExpired, 1)
+		lc.Conn.Close()
+	})
+	return lc
+}
+
+// expired returns true if the connection was closed by the lifetime timer.
+func (lc *lifetimeConn) expired() bool {
+	return atomic.LoadInt32(&lc.atomicExpired) == 1
+}
+
+// stop stops the lifetime timer. The connection is not closed.
+func (lc *lifetimeConn) stop() {
+	lc.timer.Stop()
+}
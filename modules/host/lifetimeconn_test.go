@@ -0,0 +1,66 @@
+package host
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestMaxConnectionLifetime checks that connections are closed and counted
+// once they reach the maximum connection lifetime, even if their deadline
+// has not been reached.
+func TestMaxConnectionLifetime(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestMaxConnectionLifetime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	settings := ht.host.InternalSettings()
+	if settings.MaxConnectionLifetime != defaultMaxConnectionLifetime {
+		t.Error("host does not use the default lifetime:", settings.MaxConnectionLifetime)
+	}
+	settings.MaxConnectionLifetime = -time.Second
+	if err := ht.host.SetInternalSettings(settings); err == nil {
+		t.Fatal("expected a negative lifetime to be rejected")
+	}
+	settings.MaxConnectionLifetime = 300 * time.Millisecond
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	// Start a ping, but never send the nonce. The connection should be
+	// closed well before the ping deadline.
+	conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := encoding.WriteObject(conn, modules.RPCPing); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected the connection to be closed")
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Fatal("connection was not closed at the end of its lifetime")
+	}
+	for i := 0; i < 100 && ht.host.NetworkMetrics().LifetimeCloses == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := ht.host.NetworkMetrics().LifetimeCloses; n != 1 {
+		t.Fatal("expected one lifetime close, got", n)
+	}
+	if tc := ht.host.TimeoutConfig(); tc.MaxConnectionLifetime != 300*time.Millisecond {
+		t.Error("wrong lifetime reported:", tc.MaxConnectionLifetime)
+	}
+}
@@ -0,0 +1,131 @@
+package host
+
+// loglimit.go rate limits the warnings logged while handling incoming
+// connections. Even with the cap on the number of logged RPC errors, a burst
+// of distinct errors from a misbehaving peer could flood the log. Lines in
+// excess of the rate are dropped, and the number of dropped lines is logged
+// with the next line that is allowed through, or after a flush interval if no
+// line is allowed through before then, so that the log still shows that
+// errors are occurring.
+
+import (
+	"sync"
+	"time"
+)
+
+// logLimiter is a token bucket that allows up to 'rate' log lines per second,
+// with bursts of up to 'rate' lines. Suppressed lines that are not reported
+// along with an allowed line within 'flushInterval' are reported to
+// 'onFlush'.
+type logLimiter struct {
+	rate       uint64
+	tokens     float64
+	last       time.Time
+	suppressed uint64
+
+	flushInterval time.Duration
+	onFlush       func(suppressed uint64)
+	flushTimer    *time.Timer
+	stopped       bool
+
+	mu sync.Mutex
+}
+
+// newLogLimiter returns a logLimiter that allows 'rate' lines per second,
+// calling 'onFlush' with the number of suppressed lines that have gone
+// unreported for 'flushInterval'. 'onFlush' may be nil.
+func newLogLimiter(rate uint64, flushInterval time.Duration, onFlush func(uint64)) *logLimiter {
+	return &logLimiter{
+		rate:   rate,
+		tokens: float64(rate),
+
+		flushInterval: flushInterval,
+		onFlush:       onFlush,
+	}
+}
+
+// allow reports whether a line may be logged at time 'now'. If it may, the
+// number of lines that were suppressed since the previous allowed line is
+// returned as well, and the count is reset.
+func (ll *logLimiter) allow(now time.Time) (ok bool, suppressed uint64) {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+
+	if !ll.last.IsZero() {
+		ll.tokens += now.Sub(ll.last).Seconds() * float64(ll.rate)
+		if ll.tokens > float64(ll.rate) {
+			ll.tokens = float64(ll.rate)
+		}
+	}
+	ll.last = now
+	if ll.tokens < 1 {
+		ll.suppressed++
+		if ll.flushTimer == nil && ll.onFlush != nil && !ll.stopped {
+			ll.flushTimer = time.AfterFunc(ll.flushInterval, ll.flush)
+		}
+		return false, 0
+	}
+	ll.tokens--
+	if ll.flushTimer != nil {
+		ll.flushTimer.Stop()
+		ll.flushTimer = nil
+	}
+	suppressed, ll.suppressed = ll.suppressed, 0
+	return true, suppressed
+}
+
+// flush reports the lines suppressed since the last report to 'onFlush'. The
+// lock is held during the call, so that no report is made once stop has
+// returned.
+func (ll *logLimiter) flush() {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+	ll.flushTimer = nil
+	if ll.stopped || ll.suppressed == 0 {
+		return
+	}
+	suppressed := ll.suppressed
+	ll.suppressed = 0
+	ll.onFlush(suppressed)
+}
+
+// stop cancels any pending report of suppressed lines. It should be called
+// before the log that the lines are reported to is closed.
+func (ll *logLimiter) stop() {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+	ll.stopped = true
+	if ll.flushTimer != nil {
+		ll.flushTimer.Stop()
+		ll.flushTimer = nil
+	}
+}
+
+// setRate changes the number of lines allowed per second.
+func (ll *logLimiter) setRate(rate uint64) {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+	ll.rate = rate
+	if ll.tokens > float64(rate) {
+		ll.tokens = float64(rate)
+	}
+}
+
+// connLogf logs a warning about an incoming connection, subject to the rate
+// limit of the connection log.
+func (h *Host) connLogf(format string, v ...interface{}) {
+	ok, suppressed := h.connLogLimiter.allow(time.Now())
+	if !ok {
+		return
+	}
+	if suppressed > 0 {
+		h.logSuppressedConnLines(suppressed)
+	}
+	h.log.Printf(format, v...)
+}
+
+// logSuppressedConnLines logs the number of warnings about incoming
+// connections that were suppressed by the rate limit.
+func (h *Host) logSuppressedConnLines(suppressed uint64) {
+	h.log.Printf("WARN: suppressed %v log lines from incoming connections", suppressed)
+}
@@ -0,0 +1,93 @@
+package host
+
+import (
+	"testing"
+	"time"
+)
+
+// TestLogLimiter checks that the log limiter allows bursts of up to the rate,
+// suppresses the excess, and reports the number of suppressed lines once
+// lines are allowed again.
+func TestLogLimiter(t *testing.T) {
+	ll := newLogLimiter(3, time.Hour, nil)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if ok, _ := ll.allow(now); !ok {
+			t.Fatal("line within the burst was suppressed")
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if ok, _ := ll.allow(now); ok {
+			t.Fatal("line beyond the burst was allowed")
+		}
+	}
+
+	// After half a second, one more line is allowed, along with the
+	// count of suppressed lines.
+	now = now.Add(time.Second / 2)
+	ok, suppressed := ll.allow(now)
+	if !ok || suppressed != 5 {
+		t.Fatalf("expected the line to be allowed with 5 suppressed, got %v %v", ok, suppressed)
+	}
+	if ok, _ := ll.allow(now); ok {
+		t.Fatal("line was allowed before the bucket refilled")
+	}
+
+	// The bucket never holds more than a second's worth of lines.
+	now = now.Add(time.Hour)
+	var allowed int
+	for i := 0; i < 10; i++ {
+		if ok, _ := ll.allow(now); ok {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Error("expected a burst of 3 lines after a long pause, got", allowed)
+	}
+
+	// Lowering the rate takes effect immediately.
+	ll.setRate(1)
+	now = now.Add(time.Hour)
+	if ok, _ := ll.allow(now); !ok {
+		t.Fatal("line was suppressed after the rate was lowered")
+	}
+	if ok, _ := ll.allow(now); ok {
+		t.Fatal("burst exceeded the lowered rate")
+	}
+}
+
+// TestLogLimiterFlush checks that suppressed lines are reported after the
+// flush interval if no line is allowed through in the meantime, and that no
+// report is made once the limiter has been stopped.
+func TestLogLimiterFlush(t *testing.T) {
+	flushed := make(chan uint64, 1)
+	ll := newLogLimiter(1, 10*time.Millisecond, func(n uint64) { flushed <- n })
+	now := time.Now()
+	ll.allow(now)
+	for i := 0; i < 3; i++ {
+		if ok, _ := ll.allow(now); ok {
+			t.Fatal("line beyond the burst was allowed")
+		}
+	}
+	select {
+	case n := <-flushed:
+		if n != 3 {
+			t.Error("expected 3 suppressed lines to be reported, got", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("suppressed lines were not reported")
+	}
+
+	// The reported lines are not reported again with the next line.
+	if ok, suppressed := ll.allow(now.Add(time.Hour)); !ok || suppressed != 0 {
+		t.Fatalf("expected the line to be allowed with 0 suppressed, got %v %v", ok, suppressed)
+	}
+
+	ll.allow(now.Add(time.Hour))
+	ll.stop()
+	select {
+	case n := <-flushed:
+		t.Error("suppressed lines were reported after the limiter was stopped:", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
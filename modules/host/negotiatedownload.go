@@ -82,18 +82,18 @@ var (
 // the download loop for RPCDownload.
 func (h *Host) managedDownloadIteration(conn net.Conn, so *storageObligation) error {
 	// Exchange settings with the renter.
-	err := h.managedRPCSettings(conn)
+	err := h.managedNegotiationSettings(conn)
 	if err != nil {
 		return err
 	}
 
 	// Extend the deadline for the download.
-	conn.SetDeadline(time.Now().Add(modules.NegotiateDownloadTime))
+	conn.SetDeadline(time.Now().Add(h.managedRPCTimeout(modules.RPCDownload)))
 
 	// The renter will either accept or reject the host's settings.
 	err = modules.ReadNegotiationAcceptance(conn)
 	if err != nil {
-		return err
+		return negotiationErr(err)
 	}
 
 	// Grab a set of variables that will be useful later in the function.
@@ -109,11 +109,11 @@ func (h *Host) managedDownloadIteration(conn net.Conn, so *storageObligation) er
 	var paymentRevision types.FileContractRevision
 	err = encoding.ReadObject(conn, &requests, modules.NegotiateMaxDownloadActionRequestSize)
 	if err != nil {
-		return err
+		return decodeErr(err)
 	}
 	err = encoding.ReadObject(conn, &paymentRevision, modules.NegotiateMaxFileContractRevisionSize)
 	if err != nil {
-		return err
+		return decodeErr(err)
 	}
 
 	// Verify that the request is acceptable, and then fetch all of the data
@@ -153,19 +153,19 @@ func (h *Host) managedDownloadIteration(conn net.Conn, so *storageObligation) er
 		return nil
 	}()
 	if err != nil {
-		return modules.WriteNegotiationRejection(conn, err)
+		return modules.WriteNegotiationRejection(conn, validationErr(err))
 	}
 	// Revision is acceptable, write acceptance.
 	err = modules.WriteNegotiationAcceptance(conn)
 	if err != nil {
-		return err
+		return ioErr(err)
 	}
 
 	// Renter will send a transaction siganture for the file contract revision.
 	var renterSignature types.TransactionSignature
 	err = encoding.ReadObject(conn, &renterSignature, modules.NegotiateMaxTransactionSignatureSize)
 	if err != nil {
-		return err
+		return decodeErr(err)
 	}
 	txn, err := createRevisionSignature(paymentRevision, renterSignature, secretKey, blockHeight)
 
@@ -186,13 +186,23 @@ func (h *Host) managedDownloadIteration(conn net.Conn, so *storageObligation) er
 	// the host signature and all of the data.
 	err = modules.WriteNegotiationAcceptance(conn)
 	if err != nil {
-		return err
+		return ioErr(err)
 	}
 	err = encoding.WriteObject(conn, txn.TransactionSignatures[1])
 	if err != nil {
-		return err
+		return ioErr(err)
+	}
+	var payloadSize uint64
+	for _, data := range payload {
+		payloadSize += uint64(len(data))
 	}
-	return encoding.WriteObject(conn, payload)
+	start := time.Now()
+	err = encoding.WriteObject(conn, payload)
+	if err != nil {
+		return ioErr(err)
+	}
+	h.managedRecordDownloadThroughput(payloadSize, time.Since(start))
+	return nil
 }
 
 // verifyPaymentRevision verifies that the revision being provided to pay for
@@ -126,7 +126,7 @@ func (h *Host) managedAddCollateral(settings modules.HostInternalSettings, txnSe
 // the blockchain.
 func (h *Host) managedRPCFormContract(conn net.Conn) error {
 	// Send the host settings to the renter.
-	err := h.managedRPCSettings(conn)
+	err := h.managedNegotiationSettings(conn)
 	if err != nil {
 		return err
 	}
@@ -141,12 +141,12 @@ func (h *Host) managedRPCFormContract(conn net.Conn) error {
 	}
 
 	// Extend the deadline to meet the rest of file contract negotiation.
-	conn.SetDeadline(time.Now().Add(modules.NegotiateFileContractTime))
+	conn.SetDeadline(time.Now().Add(h.managedRPCTimeout(modules.RPCFormContract)))
 
 	// The renter will either accept or reject the host's settings.
 	err = modules.ReadNegotiationAcceptance(conn)
 	if err != nil {
-		return err
+		return negotiationErr(err)
 	}
 	// If the renter sends an acceptance of the settings, it will be followed
 	// by an unsigned transaction containing funding from the renter and a file
@@ -158,11 +158,11 @@ func (h *Host) managedRPCFormContract(conn net.Conn) error {
 	var renterPK crypto.PublicKey
 	err = encoding.ReadObject(conn, &txnSet, modules.NegotiateMaxFileContractSetLen)
 	if err != nil {
-		return err
+		return decodeErr(err)
 	}
 	err = encoding.ReadObject(conn, &renterPK, modules.NegotiateMaxSiaPubkeySize)
 	if err != nil {
-		return err
+		return decodeErr(err)
 	}
 
 	// The host verifies that the file contract coming over the wire is
@@ -171,7 +171,7 @@ func (h *Host) managedRPCFormContract(conn net.Conn) error {
 	if err != nil {
 		// The incoming file contract is not acceptable to the host, indicate
 		// why to the renter.
-		return modules.WriteNegotiationRejection(conn, err)
+		return modules.WriteNegotiationRejection(conn, validationErr(err))
 	}
 	// The host adds collateral to the transaction.
 	txnBuilder, newParents, newInputs, newOutputs, err := h.managedAddCollateral(settings, txnSet)
@@ -182,19 +182,19 @@ func (h *Host) managedRPCFormContract(conn net.Conn) error {
 	// transactions, inputs and outputs that were added to the transaction.
 	err = modules.WriteNegotiationAcceptance(conn)
 	if err != nil {
-		return err
+		return ioErr(err)
 	}
 	err = encoding.WriteObject(conn, newParents)
 	if err != nil {
-		return err
+		return ioErr(err)
 	}
 	err = encoding.WriteObject(conn, newInputs)
 	if err != nil {
-		return err
+		return ioErr(err)
 	}
 	err = encoding.WriteObject(conn, newOutputs)
 	if err != nil {
-		return err
+		return ioErr(err)
 	}
 
 	// The renter will now send a negotiation response, followed by transaction
@@ -203,17 +203,17 @@ func (h *Host) managedRPCFormContract(conn net.Conn) error {
 	// siganture, to sign a no-op file contract revision.
 	err = modules.ReadNegotiationAcceptance(conn)
 	if err != nil {
-		return err
+		return negotiationErr(err)
 	}
 	var renterTxnSignatures []types.TransactionSignature
 	var renterRevisionSignature types.TransactionSignature
 	err = encoding.ReadObject(conn, &renterTxnSignatures, modules.NegotiateMaxTransactionSignaturesSize)
 	if err != nil {
-		return err
+		return decodeErr(err)
 	}
 	err = encoding.ReadObject(conn, &renterRevisionSignature, modules.NegotiateMaxTransactionSignatureSize)
 	if err != nil {
-		return err
+		return decodeErr(err)
 	}
 
 	// The host adds the renter transaction signatures, then signs the
@@ -232,19 +232,19 @@ func (h *Host) managedRPCFormContract(conn net.Conn) error {
 	if err != nil {
 		// The incoming file contract is not acceptable to the host, indicate
 		// why to the renter.
-		return modules.WriteNegotiationRejection(conn, err)
+		return modules.WriteNegotiationRejection(conn, validationErr(err))
 	}
 	err = modules.WriteNegotiationAcceptance(conn)
 	if err != nil {
-		return err
+		return ioErr(err)
 	}
 	// The host sends the transaction signatures to the renter, followed by the
 	// revision signature. Negotiation is complete.
 	err = encoding.WriteObject(conn, hostTxnSignatures)
 	if err != nil {
-		return err
+		return ioErr(err)
 	}
-	return encoding.WriteObject(conn, hostRevisionSignature)
+	return ioErr(encoding.WriteObject(conn, hostRevisionSignature))
 }
 
 // managedVerifyNewContract checks that an incoming file contract matches the host's
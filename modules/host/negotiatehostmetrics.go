@@ -0,0 +1,34 @@
+package host
+
+import (
+	"net"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// hostMetrics returns the public subset of the network metrics of the host.
+func (h *Host) hostMetrics() modules.HostMetricsResponse {
+	nm := h.NetworkMetrics()
+	return modules.HostMetricsResponse{
+		DownloadCalls:      nm.DownloadCalls,
+		DownloadThroughput: nm.DownloadThroughput,
+		ErrorCalls:         nm.ErrorCalls,
+		FormContractCalls:  nm.FormContractCalls,
+		RenewCalls:         nm.RenewCalls,
+		ReviseCalls:        nm.ReviseCalls,
+		SettingsCalls:      nm.SettingsCalls,
+		TimeoutCalls:       nm.TimeoutCalls,
+		Uptime:             uint64(time.Since(h.startTime).Seconds()),
+	}
+}
+
+// managedRPCHostMetrics is an rpc that returns the public metrics of the
+// host, which renters can use as an additional signal when selecting hosts.
+// Metrics that could identify the callers of the host are never sent.
+func (h *Host) managedRPCHostMetrics(conn net.Conn) error {
+	// Set the negotiation deadline.
+	conn.SetDeadline(time.Now().Add(h.managedRPCTimeout(modules.RPCHostMetrics)))
+	return ioErr(encoding.WriteObject(conn, h.hostMetrics()))
+}
@@ -0,0 +1,28 @@
+package host
+
+import (
+	"net"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// managedRPCPing is an rpc that allows a caller to cheaply check that the
+// host is reachable. The caller provides a nonce, and the host responds with
+// the nonce and its current time.
+func (h *Host) managedRPCPing(conn net.Conn) error {
+	// Set the negotiation deadline.
+	conn.SetDeadline(time.Now().Add(h.managedRPCTimeout(modules.RPCPing)))
+
+	var nonce [8]byte
+	err := encoding.ReadObject(conn, &nonce, uint64(len(nonce)))
+	if err != nil {
+		return decodeErr(err)
+	}
+	return ioErr(encoding.WriteObject(conn, modules.HostPingResponse{
+		Nonce: nonce,
+		Time:  types.CurrentTimestamp(),
+	}))
+}
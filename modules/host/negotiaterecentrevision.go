@@ -88,13 +88,13 @@ func (h *Host) managedVerifyChallengeResponse(fcid types.FileContractID, challen
 // The storage obligation is returned under a storage obligation lock.
 func (h *Host) managedRPCRecentRevision(conn net.Conn) (types.FileContractID, storageObligation, error) {
 	// Set the negotiation deadline.
-	conn.SetDeadline(time.Now().Add(modules.NegotiateRecentRevisionTime))
+	conn.SetDeadline(time.Now().Add(h.managedRPCTimeout(modules.RPCRecentRevision)))
 
 	// Receive the file contract id from the renter.
 	var fcid types.FileContractID
 	err := encoding.ReadObject(conn, &fcid, uint64(len(fcid)))
 	if err != nil {
-		return types.FileContractID{}, storageObligation{}, err
+		return types.FileContractID{}, storageObligation{}, decodeErr(err)
 	}
 
 	// Send a challenge to the renter to verify that the renter has write
@@ -106,20 +106,20 @@ func (h *Host) managedRPCRecentRevision(conn net.Conn) (types.FileContractID, st
 	}
 	err = encoding.WriteObject(conn, challenge)
 	if err != nil {
-		return types.FileContractID{}, storageObligation{}, err
+		return types.FileContractID{}, storageObligation{}, ioErr(err)
 	}
 
 	// Read the signed response from the renter.
 	var challengeResponse crypto.Signature
 	err = encoding.ReadObject(conn, &challengeResponse, uint64(len(challengeResponse)))
 	if err != nil {
-		return types.FileContractID{}, storageObligation{}, err
+		return types.FileContractID{}, storageObligation{}, decodeErr(err)
 	}
 	// Verify the response. In the process, fetch the related storage
 	// obligation, file contract revision, and transaction signatures.
 	so, recentRevision, revisionSigs, err := h.managedVerifyChallengeResponse(fcid, challenge, challengeResponse)
 	if err != nil {
-		return types.FileContractID{}, storageObligation{}, modules.WriteNegotiationRejection(conn, err)
+		return types.FileContractID{}, storageObligation{}, modules.WriteNegotiationRejection(conn, validationErr(err))
 	}
 	// Defer a call to unlock the storage obligation in the event of an error.
 	defer func() {
@@ -132,15 +132,15 @@ func (h *Host) managedRPCRecentRevision(conn net.Conn) (types.FileContractID, st
 	// renter.
 	err = modules.WriteNegotiationAcceptance(conn)
 	if err != nil {
-		return types.FileContractID{}, storageObligation{}, err
+		return types.FileContractID{}, storageObligation{}, ioErr(err)
 	}
 	err = encoding.WriteObject(conn, recentRevision)
 	if err != nil {
-		return types.FileContractID{}, storageObligation{}, err
+		return types.FileContractID{}, storageObligation{}, ioErr(err)
 	}
 	err = encoding.WriteObject(conn, revisionSigs)
 	if err != nil {
-		return types.FileContractID{}, storageObligation{}, err
+		return types.FileContractID{}, storageObligation{}, ioErr(err)
 	}
 	return fcid, so, nil
 }
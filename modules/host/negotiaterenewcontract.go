@@ -88,18 +88,18 @@ func (h *Host) managedRPCRenewContract(conn net.Conn) error {
 	}()
 
 	// Perform the host settings exchange with the renter.
-	err = h.managedRPCSettings(conn)
+	err = h.managedNegotiationSettings(conn)
 	if err != nil {
 		return err
 	}
 
 	// Set the renewal deadline.
-	conn.SetDeadline(time.Now().Add(modules.NegotiateRenewContractTime))
+	conn.SetDeadline(time.Now().Add(h.managedRPCTimeout(modules.RPCRenewContract)))
 
 	// The renter will either accept or reject the host's settings.
 	err = modules.ReadNegotiationAcceptance(conn)
 	if err != nil {
-		return err
+		return negotiationErr(err)
 	}
 	// If the renter sends an acceptance of the settings, it will be followed
 	// by an unsigned transaction containing funding from the renter and a file
@@ -111,11 +111,11 @@ func (h *Host) managedRPCRenewContract(conn net.Conn) error {
 	var renterPK crypto.PublicKey
 	err = encoding.ReadObject(conn, &txnSet, modules.NegotiateMaxFileContractSetLen)
 	if err != nil {
-		return err
+		return decodeErr(err)
 	}
 	err = encoding.ReadObject(conn, &renterPK, modules.NegotiateMaxSiaPubkeySize)
 	if err != nil {
-		return err
+		return decodeErr(err)
 	}
 
 	lockID := h.mu.RLock()
@@ -125,7 +125,7 @@ func (h *Host) managedRPCRenewContract(conn net.Conn) error {
 	// Verify that the transaction coming over the wire is a proper renewal.
 	err = h.managedVerifyRenewedContract(so, txnSet, renterPK)
 	if err != nil {
-		return modules.WriteNegotiationRejection(conn, err)
+		return modules.WriteNegotiationRejection(conn, validationErr(err))
 	}
 	txnBuilder, newParents, newInputs, newOutputs, err := h.managedAddRenewCollateral(so, settings, txnSet)
 	if err != nil {
@@ -135,19 +135,19 @@ func (h *Host) managedRPCRenewContract(conn net.Conn) error {
 	// outputs to the transaction.
 	err = modules.WriteNegotiationAcceptance(conn)
 	if err != nil {
-		return err
+		return ioErr(err)
 	}
 	err = encoding.WriteObject(conn, newParents)
 	if err != nil {
-		return err
+		return ioErr(err)
 	}
 	err = encoding.WriteObject(conn, newInputs)
 	if err != nil {
-		return err
+		return ioErr(err)
 	}
 	err = encoding.WriteObject(conn, newOutputs)
 	if err != nil {
-		return err
+		return ioErr(err)
 	}
 
 	// The renter will send a negotiation response, followed by transaction
@@ -157,17 +157,17 @@ func (h *Host) managedRPCRenewContract(conn net.Conn) error {
 	// new file contract.
 	err = modules.ReadNegotiationAcceptance(conn)
 	if err != nil {
-		return err
+		return negotiationErr(err)
 	}
 	var renterTxnSignatures []types.TransactionSignature
 	var renterRevisionSignature types.TransactionSignature
 	err = encoding.ReadObject(conn, &renterTxnSignatures, modules.NegotiateMaxTransactionSignatureSize)
 	if err != nil {
-		return err
+		return decodeErr(err)
 	}
 	err = encoding.ReadObject(conn, &renterRevisionSignature, modules.NegotiateMaxTransactionSignatureSize)
 	if err != nil {
-		return err
+		return decodeErr(err)
 	}
 
 	// The host adds the renter transaction signatures, then signs the
@@ -186,19 +186,19 @@ func (h *Host) managedRPCRenewContract(conn net.Conn) error {
 	h.mu.RUnlock(lockID)
 	hostTxnSignatures, hostRevisionSignature, err := h.managedFinalizeContract(txnBuilder, renterPK, renterTxnSignatures, renterRevisionSignature, so.SectorRoots, renewCollateral, renewRevenue, renewRisk)
 	if err != nil {
-		return modules.WriteNegotiationRejection(conn, err)
+		return modules.WriteNegotiationRejection(conn, validationErr(err))
 	}
 	err = modules.WriteNegotiationAcceptance(conn)
 	if err != nil {
-		return err
+		return ioErr(err)
 	}
 	// The host sends the transaction signatures to the renter, followed by the
 	// revision signature. Negotiation is complete.
 	err = encoding.WriteObject(conn, hostTxnSignatures)
 	if err != nil {
-		return err
+		return ioErr(err)
 	}
-	return encoding.WriteObject(conn, hostRevisionSignature)
+	return ioErr(encoding.WriteObject(conn, hostRevisionSignature))
 }
 
 // managedVerifyRenewedContract checks that the contract renewal matches the
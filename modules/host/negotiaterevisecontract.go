@@ -110,20 +110,20 @@ func (h *Host) managedRevisionIteration(conn net.Conn, so *storageObligation, fi
 	// Send the settings to the renter. The host will keep going even if it is
 	// not accepting contracts, because in this case the contract already
 	// exists.
-	err := h.managedRPCSettings(conn)
+	err := h.managedNegotiationSettings(conn)
 	if err != nil {
 		return err
 	}
 
 	// Set the negotiation deadline.
-	conn.SetDeadline(time.Now().Add(modules.NegotiateFileContractRevisionTime))
+	conn.SetDeadline(time.Now().Add(h.managedRPCTimeout(modules.RPCReviseContract)))
 
 	// The renter will either accept or reject the settings + revision
 	// transaction. It may also return a stop response to indicate that it
 	// wishes to terminate the revision loop.
 	err = modules.ReadNegotiationAcceptance(conn)
 	if err != nil {
-		return err
+		return negotiationErr(err)
 	}
 
 	// Read some variables from the host for use later in the function.
@@ -139,11 +139,11 @@ func (h *Host) managedRevisionIteration(conn net.Conn, so *storageObligation, fi
 	var revision types.FileContractRevision
 	err = encoding.ReadObject(conn, &modifications, settings.MaxReviseBatchSize)
 	if err != nil {
-		return err
+		return decodeErr(err)
 	}
 	err = encoding.ReadObject(conn, &revision, modules.NegotiateMaxFileContractRevisionSize)
 	if err != nil {
-		return err
+		return decodeErr(err)
 	}
 
 	// First read all of the modifications. Then make the modifications, but
@@ -229,24 +229,24 @@ func (h *Host) managedRevisionIteration(conn net.Conn, so *storageObligation, fi
 		return verifyRevision(*so, revision, blockHeight, newRevenue, newCollateral)
 	}()
 	if err != nil {
-		return modules.WriteNegotiationRejection(conn, err)
+		return modules.WriteNegotiationRejection(conn, validationErr(err))
 	}
 	// Revision is acceptable, write an acceptance string.
 	err = modules.WriteNegotiationAcceptance(conn)
 	if err != nil {
-		return err
+		return ioErr(err)
 	}
 
 	// Renter will send a transaction signature for the file contract revision.
 	var renterSig types.TransactionSignature
 	err = encoding.ReadObject(conn, &renterSig, modules.NegotiateMaxTransactionSignatureSize)
 	if err != nil {
-		return err
+		return decodeErr(err)
 	}
 	// Verify that the signature is valid and get the host's signature.
 	txn, err := createRevisionSignature(revision, renterSig, secretKey, blockHeight)
 	if err != nil {
-		return modules.WriteNegotiationRejection(conn, err)
+		return modules.WriteNegotiationRejection(conn, validationErr(err))
 	}
 
 	so.PotentialStorageRevenue = so.PotentialStorageRevenue.Add(storageRevenue)
@@ -268,9 +268,9 @@ func (h *Host) managedRevisionIteration(conn net.Conn, so *storageObligation, fi
 		err = modules.WriteNegotiationAcceptance(conn)
 	}
 	if err != nil {
-		return err
+		return ioErr(err)
 	}
-	return encoding.WriteObject(conn, txn.TransactionSignatures[1])
+	return ioErr(encoding.WriteObject(conn, txn.TransactionSignatures[1]))
 }
 
 // managedRPCReviseContract accepts a request to revise an existing contract.
@@ -1,12 +1,22 @@
 package host
 
 import (
+	"errors"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	// errBadChallengeSolution is returned to the caller of RPCAuthSettings
+	// when the provided solution does not solve the settings challenge.
+	errBadChallengeSolution = errors.New("the provided solution does not solve the settings challenge")
 )
 
 // capacity returns the amount of storage still available on the machine. The
@@ -33,7 +43,7 @@ func (h *Host) externalSettings() modules.HostExternalSettings {
 		netAddr = h.autoAddress
 	}
 	return modules.HostExternalSettings{
-		AcceptingContracts:   h.settings.AcceptingContracts,
+		AcceptingContracts:   h.settings.AcceptingContracts && h.mode == modules.HostModeLive,
 		MaxDownloadBatchSize: h.settings.MaxDownloadBatchSize,
 		MaxDuration:          h.settings.MaxDuration,
 		MaxReviseBatchSize:   h.settings.MaxReviseBatchSize,
@@ -57,17 +67,125 @@ func (h *Host) externalSettings() modules.HostExternalSettings {
 	}
 }
 
+// settingsExtension compiles and returns the settings extension that
+// accompanies the external settings of the host.
+func (h *Host) settingsExtension() modules.HostSettingsExtension {
+	// The locked collateral can exceed the budget if the budget was reduced
+	// after contracts were formed.
+	var remainingCollateralBudget types.Currency
+	if h.settings.CollateralBudget.Cmp(h.financialMetrics.LockedStorageCollateral) > 0 {
+		remainingCollateralBudget = h.settings.CollateralBudget.Sub(h.financialMetrics.LockedStorageCollateral)
+	}
+	return modules.HostSettingsExtension{
+		SettingsRevision: h.revisionNumber,
+		Mode:             h.mode,
+
+		TLS:                h.tlsConfig != nil,
+		TLSCertificateHash: tlsCertificateHash(h.tlsConfig),
+
+		CollateralBudgetReported:  true,
+		RemainingCollateralBudget: remainingCollateralBudget,
+	}
+}
+
+// managedRPCAuthSettings is an rpc that returns the host's settings once the
+// caller has solved a settings challenge. The challenge has the difficulty
+// set in the host settings, and a difficulty of zero accepts any solution.
+func (h *Host) managedRPCAuthSettings(conn net.Conn) error {
+	// Set the negotiation deadline.
+	conn.SetDeadline(time.Now().Add(h.managedRPCTimeout(modules.RPCAuthSettings)))
+
+	lockID := h.mu.RLock()
+	challenge := modules.SettingsChallenge{Difficulty: h.settings.SettingsChallengeDifficulty}
+	h.mu.RUnlock(lockID)
+	nonce, err := crypto.RandBytes(len(challenge.Nonce))
+	if err != nil {
+		return err
+	}
+	copy(challenge.Nonce[:], nonce)
+	err = encoding.WriteObject(conn, challenge)
+	if err != nil {
+		return ioErr(err)
+	}
+
+	var solution [16]byte
+	err = encoding.ReadObject(conn, &solution, uint64(len(solution)))
+	if err != nil {
+		return decodeErr(err)
+	}
+	if !challenge.Verify(solution) {
+		atomic.AddUint64(&h.atomicChallengeFailures, 1)
+		return validationErr(modules.WriteNegotiationRejection(conn, errBadChallengeSolution))
+	}
+	err = modules.WriteNegotiationAcceptance(conn)
+	if err != nil {
+		return ioErr(err)
+	}
+	return h.managedWriteSettings(conn, true)
+}
+
 // managedRPCSettings is an rpc that returns the host's settings.
 func (h *Host) managedRPCSettings(conn net.Conn) error {
 	// Set the negotiation deadline.
-	conn.SetDeadline(time.Now().Add(modules.NegotiateSettingsTime))
+	conn.SetDeadline(time.Now().Add(h.managedRPCTimeout(modules.RPCSettings)))
+	return h.managedWriteSettings(conn, true)
+}
+
+// managedNegotiationSettings sends the host's settings to a renter at the
+// start of a contract negotiation. The settings extension is not sent,
+// because the renter continues the negotiation directly after reading the
+// external settings.
+func (h *Host) managedNegotiationSettings(conn net.Conn) error {
+	// Set the negotiation deadline.
+	conn.SetDeadline(time.Now().Add(h.managedRPCTimeout(modules.RPCSettings)))
+	return h.managedWriteSettings(conn, false)
+}
+
+// managedWriteSettings writes the signed external settings of the host to the
+// connection, followed by the signed settings extension if 'withExtension' is
+// set. The signed settings are served from the settings cache unless the
+// settings have changed since they were last signed, in which case the
+// revision number is incremented and the settings are signed again. The new
+// revision number is persisted before the settings are signed, so that the
+// host never signs two different sets of settings with the same revision
+// number, even across restarts.
+func (h *Host) managedWriteSettings(conn net.Conn, withExtension bool) error {
+	lockID := h.mu.RLock()
+	encoded := encoding.MarshalAll(h.externalSettings(), h.settingsExtension())
+	h.mu.RUnlock(lockID)
+	if signed, settingsLen, ok := h.settingsCache.lookup(encoded); ok {
+		if !withExtension {
+			signed = signed[:settingsLen]
+		}
+		_, err := conn.Write(signed)
+		return ioErr(err)
+	}
 
-	var hes modules.HostExternalSettings
-	var secretKey crypto.SecretKey
-	lockID := h.mu.Lock()
+	lockID = h.mu.Lock()
 	h.revisionNumber++
-	secretKey = h.secretKey
-	hes = h.externalSettings()
+	err := h.saveSync()
+	if err != nil {
+		h.mu.Unlock(lockID)
+		return err
+	}
+	secretKey := h.secretKey
+	encSettings := encoding.Marshal(h.externalSettings())
+	encExt := encoding.Marshal(h.settingsExtension())
 	h.mu.Unlock(lockID)
-	return crypto.WriteSignedObject(conn, hes, secretKey)
+	sig, err := crypto.SignHash(crypto.HashBytes(encSettings), secretKey)
+	if err != nil {
+		return err
+	}
+	extSig, err := crypto.SignHash(crypto.HashBytes(encExt), secretKey)
+	if err != nil {
+		return err
+	}
+	signedSettings := encoding.MarshalAll(sig, encSettings)
+	signed := append(signedSettings, encoding.MarshalAll(extSig, encExt)...)
+	h.settingsCache.store(append(encSettings, encExt...), signed, len(signedSettings))
+	if !withExtension {
+		signed = signedSettings
+	}
+	_, err = conn.Write(signed)
+	return ioErr(err)
 }
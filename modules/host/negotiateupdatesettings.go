@@ -0,0 +1,78 @@
+package host
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	// errStaleSettingsRevision is returned to the caller of an
+	// RPCUpdateSettings if the request was made against a different revision
+	// of the host settings, which is the case when a request is replayed.
+	errStaleSettingsRevision = errors.New("settings update was made against a different revision of the host settings")
+
+	// errBadSettingsUpdateSpecifier is returned to the caller of an
+	// RPCUpdateSettings if the signed request does not begin with
+	// modules.PrefixHostUpdateSettings.
+	errBadSettingsUpdateSpecifier = errors.New("settings update request has the wrong specifier")
+)
+
+// managedRPCUpdateSettings is an rpc that replaces the internal settings of
+// the host with settings sent over the network. The request must be signed
+// by the secret key of the host, so only the operator of the host can make
+// it. The caller receives an acceptance once the settings have been applied,
+// or a rejection explaining why they were not.
+func (h *Host) managedRPCUpdateSettings(conn net.Conn) error {
+	// Set the negotiation deadline.
+	conn.SetDeadline(time.Now().Add(h.managedRPCTimeout(modules.RPCUpdateSettings)))
+
+	lockID := h.mu.RLock()
+	var pk crypto.PublicKey
+	copy(pk[:], h.publicKey.Key)
+	h.mu.RUnlock(lockID)
+
+	// A request that is unsigned, or signed by any key other than the host's,
+	// fails verification.
+	var req modules.HostUpdateSettingsRequest
+	err := crypto.ReadSignedObject(conn, &req, modules.NegotiateMaxHostUpdateSettingsRequestLen, pk)
+	if err == crypto.ErrInvalidSignature {
+		modules.WriteNegotiationRejection(conn, err)
+		return validationErr(err)
+	} else if err != nil {
+		modules.WriteNegotiationRejection(conn, err)
+		return decodeErr(err)
+	}
+	if req.Specifier != modules.PrefixHostUpdateSettings {
+		modules.WriteNegotiationRejection(conn, errBadSettingsUpdateSpecifier)
+		return validationErr(errBadSettingsUpdateSpecifier)
+	}
+	var settings modules.HostInternalSettings
+	err = json.Unmarshal(req.Settings, &settings)
+	if err != nil {
+		modules.WriteNegotiationRejection(conn, err)
+		return decodeErr(err)
+	}
+
+	// The revision is checked under the same lock that the settings are
+	// applied with, so that two requests made against the same revision
+	// cannot both be applied.
+	lockID = h.mu.Lock()
+	if req.RevisionNumber != h.revisionNumber {
+		h.mu.Unlock(lockID)
+		modules.WriteNegotiationRejection(conn, errStaleSettingsRevision)
+		return validationErr(errStaleSettingsRevision)
+	}
+	err = h.setInternalSettings(settings)
+	h.mu.Unlock(lockID)
+	if err != nil {
+		modules.WriteNegotiationRejection(conn, err)
+		return validationErr(err)
+	}
+	h.log.Printf("INFO: internal settings were updated remotely by %v", conn.RemoteAddr())
+	return ioErr(modules.WriteNegotiationAcceptance(conn))
+}
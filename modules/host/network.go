@@ -1,58 +1,289 @@
 package host
 
 import (
+	"errors"
 	"net"
+	"runtime/debug"
 	"sync/atomic"
 	"time"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
-// rpcSettingsDeprecated is a specifier for a deprecated settings request.
-var rpcSettingsDeprecated = types.Specifier{'S', 'e', 't', 't', 'i', 'n', 'g', 's'}
+var (
+	// errHostMaintenance is returned to the caller when a new contract is
+	// requested while the host is in maintenance mode.
+	errHostMaintenance = errors.New("host is undergoing maintenance and is not forming or renewing contracts")
+
+	// errHostStandby is returned to the caller when a new contract is
+	// requested while the host is in standby mode.
+	errHostStandby = errors.New("host is not accepting contracts yet")
+
+	// errUnknownHostMode is returned if the host is put in a mode that it
+	// does not recognize.
+	errUnknownHostMode = errors.New("unknown host mode")
+
+	// modeRefusals maps each mode in which the host refuses new contracts to
+	// the error returned to callers requesting one.
+	modeRefusals = map[modules.HostMode]error{
+		modules.HostModeMaintenance: errHostMaintenance,
+		modules.HostModeStandby:     errHostStandby,
+	}
+
+	// errRPCDisabled is returned to the caller when the requested RPC has
+	// been disabled in the host's settings.
+	errRPCDisabled = errors.New("the requested RPC has been disabled by the host")
+
+	// errSettingsChallengeRequired is returned to the caller of RPCSettings
+	// when the host only serves its settings through RPCAuthSettings.
+	errSettingsChallengeRequired = errors.New("the host requires a settings challenge to be solved, use RPCAuthSettings")
+
+	// errRPCBusy is returned to the caller when the host is already serving
+	// the maximum number of concurrent calls of the requested RPC.
+	errRPCBusy = errors.New("the host is too busy to serve the requested RPC, try again later")
+
+	// errConnectionLimit is recorded as the reason for refusing a
+	// connection when the host is serving the maximum number of connections.
+	errConnectionLimit = errors.New("connection limit reached")
+
+	// errHostNotReady is returned to the caller when an RPC outside of the
+	// sync grace list is requested before the host is ready.
+	errHostNotReady = errors.New("host not ready, the host is still synchronizing")
+
+	// errUnknownGraceRPC is returned if the sync grace list names an RPC
+	// that the host does not serve.
+	errUnknownGraceRPC = errors.New("sync grace list contains an unknown RPC")
+
+	// defaultSyncGraceRPCs are the RPCs that are served while the host is
+	// not ready, unless the settings provide a different list.
+	defaultSyncGraceRPCs = []types.Specifier{modules.RPCSettings, modules.RPCAuthSettings, modules.RPCPing}
+
+	// errNegativeConnectionDeadline is returned if the connection deadline is
+	// negative.
+	errNegativeConnectionDeadline = errors.New("connection deadline cannot be negative")
+
+	// errBufferSizeTooLarge is returned if a connection buffer size exceeds
+	// maxConnBufferSize.
+	errBufferSizeTooLarge = errors.New("connection buffer size is too large")
+
+	// errNetworkingInitialized is returned if initNetworking is called on a
+	// host whose networking has already been initialized.
+	errNetworkingInitialized = errors.New("host networking has already been initialized")
+
+	// rpcSettingsDeprecated is a specifier for a deprecated settings request.
+	rpcSettingsDeprecated = types.Specifier{'S', 'e', 't', 't', 'i', 'n', 'g', 's'}
+)
+
+// rpcDisabled returns true if the operator has disabled the provided RPC.
+// RPCHostMetrics is also disabled if the host keeps its metrics private, and
+// RPCUpdateSettings is disabled unless remote settings updates are enabled.
+func (h *Host) rpcDisabled(id types.Specifier) bool {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	if id == modules.RPCHostMetrics && h.settings.PrivateMetrics {
+		return true
+	}
+	if id == modules.RPCUpdateSettings && !h.settings.RemoteSettingsUpdates {
+		return true
+	}
+	for _, disabled := range h.settings.DisabledRPCs {
+		if disabled == id {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBufferSizes returns an error if either of the connection buffer sizes
+// is larger than the host allows.
+func checkBufferSizes(read, write uint64) error {
+	if read > maxConnBufferSize || write > maxConnBufferSize {
+		return errBufferSizeTooLarge
+	}
+	return nil
+}
+
+// setBufferSizes sets the operating system buffer sizes of a connection. A
+// size of 0 leaves the corresponding buffer at the operating system's
+// default. Connections that are not TCP connections are left unchanged.
+func setBufferSizes(conn net.Conn, read, write uint64) error {
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	if read != 0 {
+		if err := tc.SetReadBuffer(int(read)); err != nil {
+			return err
+		}
+	}
+	if write != 0 {
+		if err := tc.SetWriteBuffer(int(write)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jitteredDeadline returns the deadline plus a random duration of less than
+// 'jitter', at millisecond granularity.
+func jitteredDeadline(deadline, jitter time.Duration) time.Duration {
+	ms := int(jitter / time.Millisecond)
+	if ms <= 0 {
+		return deadline
+	}
+	n, err := crypto.RandIntn(ms)
+	if err != nil {
+		return deadline
+	}
+	return deadline + time.Duration(n)*time.Millisecond
+}
+
+// isTimeout returns true if the error was caused by a connection deadline
+// being reached.
+func isTimeout(err error) bool {
+	netErr, ok := errorCause(err).(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// rpcChallenged returns true if the provided RPC is a plain settings request
+// and the host requires callers to solve a settings challenge first.
+func (h *Host) rpcChallenged(id types.Specifier) bool {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	return id == modules.RPCSettings && h.settings.SettingsChallengeDifficulty > 0
+}
+
+// rpcModeRefusal returns the mode of the host and the error with which the
+// provided RPC is refused in that mode, or a nil error if the RPC is served.
+// Outside of HostModeLive, RPCs that create a new contract are refused.
+func (h *Host) rpcModeRefusal(id types.Specifier) (modules.HostMode, error) {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	if id != modules.RPCFormContract && id != modules.RPCRenewContract {
+		return h.mode, nil
+	}
+	return h.mode, modeRefusals[h.mode]
+}
+
+// checkSyncGraceRPCs returns an error if the sync grace list names an RPC
+// that the host does not serve.
+func checkSyncGraceRPCs(ids []types.Specifier) error {
+	for _, id := range ids {
+		if _, known := defaultRPCTimeouts[id]; !known {
+			return errUnknownGraceRPC
+		}
+	}
+	return nil
+}
+
+// rpcNotReady returns true if the host is not yet ready and the provided RPC
+// is not in the sync grace list. Unknown RPCs are left to the dispatch, so
+// that they are still counted as unrecognized.
+func (h *Host) rpcNotReady(id types.Specifier) bool {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	if h.ready {
+		return false
+	}
+	if _, known := defaultRPCTimeouts[id]; !known {
+		return false
+	}
+	grace := h.settings.SyncGraceRPCs
+	if len(grace) == 0 {
+		grace = defaultSyncGraceRPCs
+	}
+	for _, allowed := range grace {
+		if allowed == id {
+			return false
+		}
+	}
+	return true
+}
+
+// hostnameRetryInterval returns the amount of time to wait before trying to
+// learn the hostname again after 'failures' consecutive failed attempts. The
+// interval starts at hostnameRetryMinInterval and doubles with each failure,
+// up to hostnameCheckInterval.
+func hostnameRetryInterval(failures int) time.Duration {
+	if failures == 0 {
+		return hostnameCheckInterval
+	}
+	interval := hostnameRetryMinInterval
+	for i := 1; i < failures && interval < hostnameCheckInterval; i++ {
+		interval *= 2
+	}
+	if interval > hostnameCheckInterval {
+		interval = hostnameCheckInterval
+	}
+	return interval
+}
 
 // threadedUpdateHostname periodically runs 'managedLearnHostname', which
 // checks if the host's hostname has changed, and makes an updated host
 // announcement if so.
 func (h *Host) threadedUpdateHostname(closeChan chan struct{}) {
 	defer close(closeChan)
+	var failures int
 	for {
-		h.managedLearnHostname()
-		// Wait 30 minutes to check again. If the hostname is changing
-		// regularly (more than once a week), we want the host to be able to be
-		// seen as having 95% uptime. Every minute that the announcement is
-		// pointing to the wrong address is a minute of perceived downtime to
-		// the renters.
+		err := h.managedLearnHostname()
+		if err != nil {
+			failures++
+		} else {
+			failures = 0
+		}
+		h.managedUpdateReachability(err)
+		// After a success, wait 30 minutes to check again. If the hostname is
+		// changing regularly (more than once a week), we want the host to be
+		// able to be seen as having 95% uptime. Every minute that the
+		// announcement is pointing to the wrong address is a minute of
+		// perceived downtime to the renters. After a failure, check again
+		// sooner so that the host recovers quickly once connectivity returns.
 		select {
 		case <-h.tg.StopChan():
 			return
-		case <-time.After(time.Minute * 30):
+		case <-time.After(hostnameRetryInterval(failures)):
 			continue
 		}
 	}
 }
 
 // initNetworking performs actions like port forwarding, and gets the
-// host established on the network.
+// host established on the network. It may only be called once; use
+// SetListenAddress to move the listener of a running host.
 func (h *Host) initNetworking(address string) (err error) {
+	// Replacing the listener would leak the first listener and register the
+	// shutdown procedures a second time.
+	if h.listener != nil {
+		return errNetworkingInitialized
+	}
+
 	// Create the listener and setup the close procedures.
-	threadedListenerClosedChan := make(chan struct{})
+	h.listenerClosed = make(chan struct{})
 	h.listener, err = h.dependencies.listen("tcp", address)
 	if err != nil {
 		return err
 	}
-	// Automatically close the listener when h.tg.Stop() is called.
+	// Automatically close the listener when h.tg.Stop() is called. The
+	// listener may have been replaced by SetListenAddress, so the current
+	// listener is closed. This must remain the last OnStop function that is
+	// registered by the host, so that it runs first and the host stops
+	// accepting connections before anything else is shut down; see Close for
+	// the full order.
 	h.tg.OnStop(func() {
-		err := h.listener.Close()
+		lockID := h.mu.RLock()
+		listener, listenerClosed := h.listener, h.listenerClosed
+		h.mu.RUnlock(lockID)
+		err := listener.Close()
 		if err != nil {
 			h.log.Println("WARN: closing the listener failed:", err)
 		}
 
 		// Wait until the threadedListener has returned to continue shutdown.
-		<-threadedListenerClosedChan
+		<-listenerClosed
 	})
 
 	// Set the port.
@@ -69,12 +300,27 @@ func (h *Host) initNetworking(address string) (err error) {
 	// Non-blocking, perform port forwarding and create the hostname discovery
 	// thread.
 	go func() {
+		// Hold the thread group until the hostname discovery thread has been
+		// registered, so that the logger is not closed while the thread is
+		// still running.
+		if h.tg.Add() != nil {
+			return
+		}
+		defer h.tg.Done()
+
 		err := h.managedForwardPort()
 		if err != nil {
 			h.log.Println("ERROR: failed to forward port:", err)
 		}
-		// Clear the port that was forwarded at startup.
-		h.tg.OnStop(func() {
+		lockID := h.mu.Lock()
+		h.portForwardErr = err
+		h.mu.Unlock(lockID)
+		// Clear the port that was forwarded at startup. The background
+		// workers are stopped after the connection handlers have drained,
+		// rather than in OnStop, because they are registered after the
+		// listener and would otherwise be stopped while it is still
+		// accepting connections.
+		h.tg.AfterStop(func() {
 			err := h.managedClearPort()
 			if err != nil {
 				h.log.Println("ERROR: failed to clear port:", err)
@@ -83,26 +329,153 @@ func (h *Host) initNetworking(address string) (err error) {
 
 		threadedUpdateHostnameClosedChan := make(chan struct{})
 		go h.threadedUpdateHostname(threadedUpdateHostnameClosedChan)
-		h.tg.OnStop(func() {
+		h.tg.AfterStop(func() {
 			<-threadedUpdateHostnameClosedChan
 		})
 	}()
 
 	// Launch the listener.
-	go h.threadedListen(threadedListenerClosedChan)
+	go h.threadedListen(h.listener, h.listenerClosed)
 	return nil
 }
 
+// SetListenAddress moves the host's listener to a new address without
+// restarting the host. The new listener is opened before the old one is
+// closed; if the new address cannot be bound, the old listener is kept.
+// Connections that were accepted by the old listener are not interrupted, and
+// are allowed to complete normally. If the port changes, the new port is
+// forwarded, the old port is cleared, and the host re-announces itself at its
+// new address.
+func (h *Host) SetListenAddress(address string) error {
+	err := h.tg.Add()
+	if err != nil {
+		return err
+	}
+	defer h.tg.Done()
+
+	listener, err := h.dependencies.listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	// Swap the listeners. If the host began shutting down before the lock
+	// was acquired, the old listener may already be closed, and the new
+	// listener would never be closed.
+	listenerClosed := make(chan struct{})
+	lockID := h.mu.Lock()
+	select {
+	case <-h.tg.StopChan():
+		h.mu.Unlock(lockID)
+		listener.Close()
+		return errHostClosed
+	default:
+	}
+	oldListener, oldListenerClosed := h.listener, h.listenerClosed
+	h.listener, h.listenerClosed = listener, listenerClosed
+	oldPort := h.port
+	h.port = port
+	if build.Release == "testing" {
+		h.autoAddress = modules.NetAddress(net.JoinHostPort("localhost", h.port))
+	} else if h.autoAddress != "" {
+		h.autoAddress = modules.NetAddress(net.JoinHostPort(h.autoAddress.Host(), h.port))
+	}
+	err = h.save()
+	if err != nil {
+		h.log.Println(err)
+	}
+	h.mu.Unlock(lockID)
+	go h.threadedListen(listener, listenerClosed)
+
+	if port != oldPort {
+		err = h.managedRunUPnP(func() error { return h.forwardPort(port) }, h.tg.StopChan())
+		if err != nil {
+			h.log.Println("ERROR: failed to forward port:", err)
+		}
+		lockID = h.mu.Lock()
+		h.portForwardErr = err
+		h.mu.Unlock(lockID)
+		err = h.managedRunUPnP(func() error { return h.clearPort(oldPort) }, h.tg.StopChan())
+		if err != nil {
+			h.log.Println("WARN: failed to clear old port:", err)
+		}
+		h.managedReannounce()
+	}
+
+	// Stop accepting connections on the old listener.
+	err = oldListener.Close()
+	<-oldListenerClosed
+	if err != nil {
+		h.log.Println("WARN: closing the old listener failed:", err)
+	}
+	return nil
+}
+
+// managedReannounce announces the host at its new auto address after the port
+// has changed. Hosts that have set a NetAddress manually are responsible for
+// updating it themselves, and hosts that are neither accepting contracts nor
+// storing data have no reason to announce.
+func (h *Host) managedReannounce() {
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	if h.settings.NetAddress != "" || h.autoAddress == "" {
+		return
+	}
+	if !h.settings.AcceptingContracts && h.financialMetrics.ContractCount == 0 {
+		return
+	}
+	if h.settings.AnnounceWhenReachable {
+		// The new port has not yet been confirmed to be reachable.
+		h.reachabilityConfirmed = false
+		h.announced = false
+		h.announcePending = true
+		h.log.Debugln("deferring announcement of", h.autoAddress, "until the host is reachable")
+		return
+	}
+	err := h.announce(h.autoAddress)
+	if err != nil {
+		// Clear h.announced so that the announcement is retried when the
+		// hostname is next checked.
+		h.announced = false
+		h.log.Println("WARN: unable to announce the host after its port changed:", err)
+	}
+}
+
+// recordPeakConnections raises the peak number of concurrent connections to
+// 'openConns' if it is a new high.
+func (h *Host) recordPeakConnections(openConns int64) {
+	for {
+		peak := atomic.LoadInt64(&h.atomicPeakConnections)
+		if openConns <= peak || atomic.CompareAndSwapInt64(&h.atomicPeakConnections, peak, openConns) {
+			return
+		}
+	}
+}
+
 // threadedHandleConn handles an incoming connection to the host, typically an
 // RPC.
 func (h *Host) threadedHandleConn(conn net.Conn) {
+	// Count the connection as open for the entire lifetime of the call, so
+	// that the gauge stays accurate across every early return.
+	openConns := atomic.AddInt64(&h.atomicOpenConnections, 1)
+	defer atomic.AddInt64(&h.atomicOpenConnections, -1)
+	h.recordPeakConnections(openConns)
+
 	// Close the conn on host.Close or when the method terminates, whichever comes
-	// first.
+	// first. atomicShutdownClosed is set if the conn was closed by host.Close,
+	// so that an RPC interrupted by the shutdown can be told apart from one
+	// that failed on its own.
+	var atomicShutdownClosed int32
 	connCloseChan := make(chan struct{})
 	defer close(connCloseChan)
 	go func() {
 		select {
 		case <-h.tg.StopChan():
+			atomic.StoreInt32(&atomicShutdownClosed, 1)
 		case <-connCloseChan:
 		}
 		conn.Close()
@@ -114,23 +487,185 @@ func (h *Host) threadedHandleConn(conn net.Conn) {
 	}
 	defer h.tg.Done()
 
+	// A panic in an RPC handler should not take down the host. Recover, log
+	// the panic, and let the deferred cleanup close the connection. Debug
+	// builds panic on critical errors, so the panic is raised again instead
+	// of being swallowed. A panic raised while the host lock was held leaves
+	// the lock held, and the host cannot continue either.
+	var id types.Specifier
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		atomic.AddUint64(&h.atomicPanicCalls, 1)
+		h.log.Printf("ERROR: panic while handling RPC \"%v\" from %v: %v\n%s", id, conn.RemoteAddr(), r, debug.Stack())
+		if build.DEBUG || !h.managedLockReleased(panicLockTimeout) {
+			panic(r)
+		}
+	}()
+
+	// Refuse the connection if the host is already serving the maximum number
+	// of connections.
+	lockID := h.mu.RLock()
+	maxConns := h.settings.MaxConnections
+	deadline := jitteredDeadline(h.settings.ConnectionDeadline, h.settings.ConnectionDeadlineJitter)
+	idleTimeout := h.settings.IdleTimeout
+	lifetime := h.settings.MaxConnectionLifetime
+	readBufferSize, writeBufferSize := h.settings.ReadBufferSize, h.settings.WriteBufferSize
+	h.mu.RUnlock(lockID)
+	if maxConns != 0 && uint64(openConns) > maxConns {
+		atomic.AddUint64(&h.atomicCapacityRejects, 1)
+		h.recordRejection(conn.RemoteAddr(), types.Specifier{}, errConnectionLimit)
+		h.log.Debugf("INFO: refused connection from %v, connection limit reached", conn.RemoteAddr())
+		return
+	}
+
+	// Close connections from addresses that the host is not willing to serve.
+	if err := h.managedAdmit(conn.RemoteAddr()); err != nil {
+		h.recordRejection(conn.RemoteAddr(), types.Specifier{}, err)
+		h.log.Debugf("INFO: refused connection from %v, %v", conn.RemoteAddr(), err)
+		return
+	}
+
+	// A failure to resize the buffers only affects throughput, so the
+	// connection is still served.
+	if err := setBufferSizes(conn, readBufferSize, writeBufferSize); err != nil {
+		h.log.Debugf("WARN: could not set the buffer sizes of connection from %v: %v", conn.RemoteAddr(), err)
+	}
+
+	// Close the connection once it reaches its maximum lifetime, however far
+	// the RPCs have extended the deadline.
+	lc := newLifetimeConn(conn, lifetime)
+	defer lc.stop()
+	conn = lc
+
 	// Set an initial duration that is generous, but finite. RPCs can extend
-	// this if desired.
-	err = conn.SetDeadline(time.Now().Add(5 * time.Minute))
+	// this if desired. A failure may be transient, so setting the deadline
+	// is attempted a second time before the connection is given up on. The
+	// connection is closed by the deferred cleanup above.
+	err = conn.SetDeadline(time.Now().Add(deadline))
+	if err != nil {
+		err = conn.SetDeadline(time.Now().Add(deadline))
+	}
 	if err != nil {
-		h.log.Println("WARN: could not set deadline on connection:", err)
+		atomic.AddUint64(&h.atomicDeadlineFailures, 1)
+		atomic.AddUint64(&h.atomicPreDispatchErrors, 1)
+		h.connLogf("WARN: could not set deadline on connection: %v", err)
 		return
 	}
 
+	// Record the raw bytes of the connection if the operator has enabled
+	// debug capture. The capture is applied beneath the idle timer and TLS,
+	// so that the bytes are recorded exactly as they cross the network.
+	if cc := h.managedCaptureConn(conn); cc != nil {
+		defer cc.close()
+		conn = cc
+	}
+
+	// Close the connection early if the caller stops sending and receiving
+	// data. The wrapper is applied beneath TLS, so that handshake and record
+	// traffic counts as activity.
+	var ic *idleConn
+	if idleTimeout > 0 {
+		ic = newIdleConn(conn, idleTimeout)
+		defer ic.stop()
+		conn = ic
+	}
+
+	// Unwrap the connection if the caller has opted in to TLS.
+	conn = h.managedSniffTLS(conn)
+
 	// Read a specifier indicating which action is being called.
-	var id types.Specifier
-	if err := encoding.ReadObject(conn, &id, 16); err != nil {
+	if err := encoding.ReadObject(conn, &id, rpcSpecifierLen); err != nil && ic != nil && ic.idled() {
+		atomic.AddUint64(&h.atomicIdleTimeoutCalls, 1)
+		atomic.AddUint64(&h.atomicPreDispatchErrors, 1)
+		h.log.Debugf("INFO: incoming conn %v sent no RPC for %v and was closed", conn.RemoteAddr(), idleTimeout)
+		return
+	} else if err != nil {
 		atomic.AddUint64(&h.atomicUnrecognizedCalls, 1)
+		atomic.AddUint64(&h.atomicPreDispatchErrors, 1)
+		h.remoteMetrics.record(remoteHost(conn), true)
 		h.log.Debugf("WARN: incoming conn %v was malformed: %v", conn.RemoteAddr(), err)
 		return
 	}
 
+	// The RPC protocol does not yet include a version handshake, so peers
+	// are counted as not having advertised a version. Once a handshake is
+	// added, the advertised version should be recorded here instead.
+	h.peerVersions.record("")
+
+	// Refuse the call if the operator has disabled the requested RPC.
+	if h.rpcDisabled(id) {
+		atomic.AddUint64(&h.atomicDisabledCalls, 1)
+		h.remoteMetrics.record(remoteHost(conn), false)
+		h.recordRejection(conn.RemoteAddr(), id, errRPCDisabled)
+		modules.WriteNegotiationRejection(conn, errRPCDisabled)
+		h.log.Debugf("INFO: refused disabled RPC \"%v\" from %v", id, conn.RemoteAddr())
+		return
+	}
+
+	// Refuse plain settings calls if the host requires a settings challenge.
+	if h.rpcChallenged(id) {
+		atomic.AddUint64(&h.atomicChallengeRejects, 1)
+		h.remoteMetrics.record(remoteHost(conn), false)
+		h.recordRejection(conn.RemoteAddr(), id, errSettingsChallengeRequired)
+		modules.WriteNegotiationRejection(conn, errSettingsChallengeRequired)
+		h.log.Debugf("INFO: refused RPC \"%v\" from %v, settings challenge required", id, conn.RemoteAddr())
+		return
+	}
+
+	// Refuse contract calls until the host is ready to negotiate contracts.
+	if h.rpcNotReady(id) {
+		atomic.AddUint64(&h.atomicNotReadyCalls, 1)
+		h.remoteMetrics.record(remoteHost(conn), false)
+		h.recordRejection(conn.RemoteAddr(), id, errHostNotReady)
+		modules.WriteNegotiationRejection(conn, errHostNotReady)
+		h.log.Debugf("INFO: refused RPC \"%v\" from %v, host not ready", id, conn.RemoteAddr())
+		return
+	}
+
+	// Refuse new contracts while the host is not live.
+	if mode, refusal := h.rpcModeRefusal(id); refusal != nil {
+		switch mode {
+		case modules.HostModeMaintenance:
+			atomic.AddUint64(&h.atomicMaintenanceCalls, 1)
+		case modules.HostModeStandby:
+			atomic.AddUint64(&h.atomicStandbyCalls, 1)
+		}
+		h.remoteMetrics.record(remoteHost(conn), false)
+		h.recordRejection(conn.RemoteAddr(), id, refusal)
+		modules.WriteNegotiationRejection(conn, refusal)
+		h.log.Debugf("INFO: refused RPC \"%v\" from %v, host in %v mode", id, conn.RemoteAddr(), mode)
+		return
+	}
+
+	// Refuse the call if the host is already serving as many calls of the
+	// requested RPC as the operator allows.
+	if !h.managedAcquireRPC(id) {
+		atomic.AddUint64(&h.atomicBusyCalls, 1)
+		h.remoteMetrics.record(remoteHost(conn), false)
+		h.recordRejection(conn.RemoteAddr(), id, errRPCBusy)
+		modules.WriteNegotiationRejection(conn, errRPCBusy)
+		h.log.Debugf("INFO: refused RPC \"%v\" from %v, concurrency limit reached", id, conn.RemoteAddr())
+		return
+	}
+	defer h.rpcsInUse.release(id)
+
+	// Throttle the call if the operator has limited the bandwidth of the
+	// requested RPC.
+	conn = h.managedLimitBandwidth(id, conn)
+
+	// interrupted reports whether the connection was closed by the host
+	// while the call was being served.
+	interrupted := func() bool {
+		return atomic.LoadInt32(&atomicShutdownClosed) == 1 || lc.expired() || (ic != nil && ic.idled())
+	}
+	var unrecognized bool
 	switch id {
+	case modules.RPCAuthSettings:
+		atomic.AddUint64(&h.atomicAuthSettingsCalls, 1)
+		err = h.managedRPCAuthSettings(conn)
 	case modules.RPCDownload:
 		atomic.AddUint64(&h.atomicDownloadCalls, 1)
 		err = h.managedRPCDownload(conn)
@@ -143,6 +678,12 @@ func (h *Host) threadedHandleConn(conn net.Conn) {
 	case modules.RPCReviseContract:
 		atomic.AddUint64(&h.atomicReviseCalls, 1)
 		err = h.managedRPCReviseContract(conn)
+	case modules.RPCHostMetrics:
+		atomic.AddUint64(&h.atomicHostMetricsCalls, 1)
+		err = h.managedRetryRPC(id, conn, (*Host).managedRPCHostMetrics, interrupted)
+	case modules.RPCPing:
+		atomic.AddUint64(&h.atomicPingCalls, 1)
+		err = h.managedRetryRPC(id, conn, (*Host).managedRPCPing, interrupted)
 	case modules.RPCRecentRevision:
 		atomic.AddUint64(&h.atomicRecentRevisionCalls, 1)
 		var so storageObligation
@@ -154,39 +695,74 @@ func (h *Host) threadedHandleConn(conn net.Conn) {
 		}
 	case modules.RPCSettings:
 		atomic.AddUint64(&h.atomicSettingsCalls, 1)
-		err = h.managedRPCSettings(conn)
+		err = h.managedRetryRPC(id, conn, (*Host).managedRPCSettings, interrupted)
+	case modules.RPCUpdateSettings:
+		atomic.AddUint64(&h.atomicUpdateSettingsCalls, 1)
+		err = h.managedRPCUpdateSettings(conn)
 	case rpcSettingsDeprecated:
 		h.log.Debugln("Received deprecated settings call")
 	default:
 		h.log.Debugf("WARN: incoming conn %v requested unknown RPC \"%v\"", conn.RemoteAddr(), id)
 		atomic.AddUint64(&h.atomicUnrecognizedCalls, 1)
+		unrecognized = true
 	}
+	h.remoteMetrics.record(remoteHost(conn), err != nil || unrecognized)
 	if err != nil {
+		atomic.AddUint64(&h.atomicHandlerErrors, 1)
+		h.recordErrorCategory(err)
+	}
+	if err != nil && atomic.LoadInt32(&atomicShutdownClosed) == 1 {
+		// The connection was closed because the host is shutting down.
+		// Calls that completed before the shutdown returned no error, and
+		// are not counted.
+		atomic.AddUint64(&h.atomicErroredCalls, 1)
+		atomic.AddUint64(&h.atomicShutdownClosedCalls, 1)
+		h.log.Debugf("INFO: incoming RPC \"%v\" from %v was interrupted by the host shutting down", id, conn.RemoteAddr())
+	} else if err != nil && lc.expired() {
+		// The connection was closed because it reached its maximum lifetime.
+		atomic.AddUint64(&h.atomicErroredCalls, 1)
+		atomic.AddUint64(&h.atomicLifetimeCloses, 1)
+		h.log.Debugf("INFO: incoming RPC \"%v\" from %v reached the maximum connection lifetime of %v and was closed", id, conn.RemoteAddr(), lifetime)
+	} else if err != nil && ic != nil && ic.idled() {
+		// The connection was closed because the caller stopped sending and
+		// receiving data, which is counted apart from the RPC deadlines.
+		atomic.AddUint64(&h.atomicErroredCalls, 1)
+		atomic.AddUint64(&h.atomicIdleTimeoutCalls, 1)
+		h.log.Debugf("INFO: incoming RPC \"%v\" from %v was idle for %v and was closed", id, conn.RemoteAddr(), idleTimeout)
+	} else if err != nil && isTimeout(err) {
+		// The connection was closed because the RPC ran past its deadline. A
+		// rising number of timeouts suggests that the deadlines are too tight
+		// for the speed of the host's connection.
+		atomic.AddUint64(&h.atomicErroredCalls, 1)
+		atomic.AddUint64(&h.atomicTimeoutCalls, 1)
+		h.log.Debugf("INFO: incoming RPC \"%v\" from %v exceeded its %v timeout: %v", id, conn.RemoteAddr(), h.managedRPCTimeout(id), err)
+	} else if err != nil {
 		atomic.AddUint64(&h.atomicErroredCalls, 1)
 
 		// If there have been less than 1000 errored rpcs, print the error
 		// message. This is to help developers debug live systems that are
 		// running into issues. Ultimately though, this error can be triggered
 		// by a malicious actor, and therefore should not be logged except for
-		// DEBUG builds.
+		// DEBUG builds. The messages are also rate limited, so that a burst
+		// of errors does not flood the log.
 		erroredCalls := atomic.LoadUint64(&h.atomicErroredCalls)
 		if erroredCalls < 1e3 {
-			h.log.Printf("WARN: incoming RPC \"%v\" failed: %v", id, err)
+			h.connLogf("WARN: incoming RPC \"%v\" failed with %v error: %v", id, errorCategory(err), err)
 		} else {
-			h.log.Debugf("WARN: incoming RPC \"%v\" failed: %v", id, err)
+			h.log.Debugf("WARN: incoming RPC \"%v\" failed with %v error: %v", id, errorCategory(err), err)
 		}
 	}
 }
 
 // listen listens for incoming RPCs and spawns an appropriate handler for each.
-func (h *Host) threadedListen(closeChan chan struct{}) {
+func (h *Host) threadedListen(listener net.Listener, closeChan chan struct{}) {
 	defer close(closeChan)
 
 	// Receive connections until an error is returned by the listener. When an
 	// error is returned, there will be no more calls to receive.
 	for {
 		// Block until there is a connection to handle.
-		conn, err := h.listener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
 			return
 		}
@@ -195,6 +771,38 @@ func (h *Host) threadedListen(closeChan chan struct{}) {
 	}
 }
 
+// managedLockReleased returns true if the host lock can be acquired within
+// the provided timeout. If it cannot, the goroutine waiting on the lock is
+// left behind, and releases the lock once it has been acquired.
+func (h *Host) managedLockReleased(timeout time.Duration) bool {
+	acquired := make(chan struct{})
+	go func() {
+		lockID := h.mu.Lock()
+		close(acquired)
+		h.mu.Unlock(lockID)
+	}()
+	select {
+	case <-acquired:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// ListenAddr returns the local address that the host's listener is bound to,
+// including the port chosen by the operating system if the host was started
+// on port 0. Unlike NetAddress, the listen address is known as soon as the
+// host has started, before any hostname has been discovered or announced.
+// ListenAddr returns nil if the host is not yet listening.
+func (h *Host) ListenAddr() net.Addr {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	if h.listener == nil {
+		return nil
+	}
+	return h.listener.Addr()
+}
+
 // NetAddress returns the address at which the host can be reached.
 func (h *Host) NetAddress() modules.NetAddress {
 	lockID := h.mu.RLock()
@@ -212,12 +820,52 @@ func (h *Host) NetworkMetrics() modules.HostNetworkMetrics {
 	lockID := h.mu.RLock()
 	defer h.mu.RUnlock(lockID)
 	return modules.HostNetworkMetrics{
-		DownloadCalls:     atomic.LoadUint64(&h.atomicDownloadCalls),
-		ErrorCalls:        atomic.LoadUint64(&h.atomicErroredCalls),
-		FormContractCalls: atomic.LoadUint64(&h.atomicFormContractCalls),
-		RenewCalls:        atomic.LoadUint64(&h.atomicRenewCalls),
-		ReviseCalls:       atomic.LoadUint64(&h.atomicReviseCalls),
-		SettingsCalls:     atomic.LoadUint64(&h.atomicSettingsCalls),
-		UnrecognizedCalls: atomic.LoadUint64(&h.atomicUnrecognizedCalls),
+		ActiveConnections:       uint64(atomic.LoadInt64(&h.atomicOpenConnections)),
+		ActiveThreads:           uint64(h.tg.Active()),
+		AdmissionRejects:        atomic.LoadUint64(&h.atomicAdmissionRejects),
+		Announcements:           atomic.LoadUint64(&h.atomicAnnouncements),
+		AuthSettingsCalls:       atomic.LoadUint64(&h.atomicAuthSettingsCalls),
+		BlacklistRejects:        atomic.LoadUint64(&h.atomicBlacklistRejects),
+		BusyCalls:               atomic.LoadUint64(&h.atomicBusyCalls),
+		CapacityRejects:         atomic.LoadUint64(&h.atomicCapacityRejects),
+		ChallengeFailures:       atomic.LoadUint64(&h.atomicChallengeFailures),
+		ChallengeRejects:        atomic.LoadUint64(&h.atomicChallengeRejects),
+		ConsensusErrors:         atomic.LoadUint64(&h.atomicConsensusErrors),
+		DeadlineFailures:        atomic.LoadUint64(&h.atomicDeadlineFailures),
+		DecodeErrors:            atomic.LoadUint64(&h.atomicDecodeErrors),
+		DisabledCalls:           atomic.LoadUint64(&h.atomicDisabledCalls),
+		DownloadCalls:           atomic.LoadUint64(&h.atomicDownloadCalls),
+		DownloadThroughput:      h.downloadThroughput,
+		ErrorCalls:              atomic.LoadUint64(&h.atomicErroredCalls),
+		FormContractCalls:       atomic.LoadUint64(&h.atomicFormContractCalls),
+		HandlerErrors:           atomic.LoadUint64(&h.atomicHandlerErrors),
+		HostMetricsCalls:        atomic.LoadUint64(&h.atomicHostMetricsCalls),
+		IOErrors:                atomic.LoadUint64(&h.atomicIOErrors),
+		IdleTimeoutCalls:        atomic.LoadUint64(&h.atomicIdleTimeoutCalls),
+		LifetimeCloses:          atomic.LoadUint64(&h.atomicLifetimeCloses),
+		MaintenanceCalls:        atomic.LoadUint64(&h.atomicMaintenanceCalls),
+		NotReadyCalls:           atomic.LoadUint64(&h.atomicNotReadyCalls),
+		PanicCalls:              atomic.LoadUint64(&h.atomicPanicCalls),
+		PeakConnections:         uint64(atomic.LoadInt64(&h.atomicPeakConnections)),
+		PingCalls:               atomic.LoadUint64(&h.atomicPingCalls),
+		PreDispatchErrors:       atomic.LoadUint64(&h.atomicPreDispatchErrors),
+		RecoveredCalls:          atomic.LoadUint64(&h.atomicRecoveredCalls),
+		RenewCalls:              atomic.LoadUint64(&h.atomicRenewCalls),
+		RetriedCalls:            atomic.LoadUint64(&h.atomicRetriedCalls),
+		ReviseCalls:             atomic.LoadUint64(&h.atomicReviseCalls),
+		SettingsCalls:           atomic.LoadUint64(&h.atomicSettingsCalls),
+		ShutdownClosedCalls:     atomic.LoadUint64(&h.atomicShutdownClosedCalls),
+		StandbyCalls:            atomic.LoadUint64(&h.atomicStandbyCalls),
+		SuppressedAnnouncements: atomic.LoadUint64(&h.atomicSuppressedAnnouncements),
+		TimeoutCalls:            atomic.LoadUint64(&h.atomicTimeoutCalls),
+		UnrecognizedCalls:       atomic.LoadUint64(&h.atomicUnrecognizedCalls),
+		UpdateSettingsCalls:     atomic.LoadUint64(&h.atomicUpdateSettingsCalls),
+		ValidationErrors:        atomic.LoadUint64(&h.atomicValidationErrors),
+		WhitelistRejects:        atomic.LoadUint64(&h.atomicWhitelistRejects),
+
+		PeerVersions: h.peerVersions.snapshot(),
+		ThreadSites:  h.tg.ActiveSites(),
+
+		RPCsInUse: h.rpcsInUse.snapshot(),
 	}
 }
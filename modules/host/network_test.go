@@ -1,14 +1,893 @@
 package host
 
-/*
 import (
-	"path/filepath"
+	"encoding/json"
+	"net"
 	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
+	siasync "github.com/NebulousLabs/Sia/sync"
+	"github.com/NebulousLabs/Sia/types"
 )
 
+// TestDisabledRPC checks that the host refuses RPCs that have been disabled in
+// its settings, while continuing to serve the others.
+func TestDisabledRPC(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestDisabledRPC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	settings := ht.host.InternalSettings()
+	settings.DisabledRPCs = []types.Specifier{modules.RPCFormContract}
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Call the disabled RPC, the host should respond with a rejection.
+	conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	err = encoding.WriteObject(conn, modules.RPCFormContract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = modules.ReadNegotiationAcceptance(conn)
+	if err == nil || err.Error() != errRPCDisabled.Error() {
+		t.Fatalf("expected %v, got %v", errRPCDisabled, err)
+	}
+	if ht.host.NetworkMetrics().DisabledCalls != 1 {
+		t.Error("disabled call was not counted")
+	}
+	if ht.host.NetworkMetrics().FormContractCalls != 0 {
+		t.Error("disabled call was counted as a form contract call")
+	}
+}
+
+// TestSettingsChallenge checks that a host requiring a settings challenge
+// refuses plain settings calls, refuses wrong solutions, and serves its
+// settings to callers that solve the challenge.
+func TestSettingsChallenge(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestSettingsChallenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	settings := ht.host.InternalSettings()
+	settings.SettingsChallengeDifficulty = modules.MaxSettingsChallengeDifficulty + 1
+	if err := ht.host.SetInternalSettings(settings); err == nil {
+		t.Fatal("difficulty beyond the maximum was accepted")
+	}
+	settings.SettingsChallengeDifficulty = 8
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	// A plain settings call is refused.
+	conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := encoding.WriteObject(conn, modules.RPCSettings); err != nil {
+		t.Fatal(err)
+	}
+	err = modules.ReadNegotiationAcceptance(conn)
+	if err == nil || err.Error() != errSettingsChallengeRequired.Error() {
+		t.Fatalf("expected %v, got %v", errSettingsChallengeRequired, err)
+	}
+
+	// requestSettings calls RPCAuthSettings, answering the challenge with
+	// the solution returned by 'solve'.
+	requestSettings := func(solve func(modules.SettingsChallenge) [16]byte) (modules.HostExternalSettings, error) {
+		conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+		if err != nil {
+			return modules.HostExternalSettings{}, err
+		}
+		defer conn.Close()
+		if err := encoding.WriteObject(conn, modules.RPCAuthSettings); err != nil {
+			return modules.HostExternalSettings{}, err
+		}
+		var challenge modules.SettingsChallenge
+		if err := encoding.ReadObject(conn, &challenge, 256); err != nil {
+			return modules.HostExternalSettings{}, err
+		}
+		if challenge.Difficulty != 8 {
+			t.Error("wrong challenge difficulty:", challenge.Difficulty)
+		}
+		if err := encoding.WriteObject(conn, solve(challenge)); err != nil {
+			return modules.HostExternalSettings{}, err
+		}
+		if err := modules.ReadNegotiationAcceptance(conn); err != nil {
+			return modules.HostExternalSettings{}, err
+		}
+		var pk crypto.PublicKey
+		copy(pk[:], ht.host.publicKey.Key)
+		var hes modules.HostExternalSettings
+		err = crypto.ReadSignedObject(conn, &hes, modules.NegotiateMaxHostExternalSettingsLen, pk)
+		return hes, err
+	}
+
+	// A wrong solution is refused.
+	_, err = requestSettings(func(sc modules.SettingsChallenge) (solution [16]byte) {
+		for n := byte(0); sc.Verify(solution); n++ {
+			solution[0] = n
+		}
+		return solution
+	})
+	if err == nil || err.Error() != errBadChallengeSolution.Error() {
+		t.Fatalf("expected %v, got %v", errBadChallengeSolution, err)
+	}
+
+	// A correct solution is answered with the settings.
+	hes, err := requestSettings(func(sc modules.SettingsChallenge) [16]byte {
+		solution, err := sc.Solve()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return solution
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hes.NetAddress != ht.host.NetAddress() {
+		t.Error("wrong settings were served:", hes.NetAddress)
+	}
+
+	nm := ht.host.NetworkMetrics()
+	if nm.ChallengeRejects != 1 || nm.ChallengeFailures != 1 || nm.AuthSettingsCalls != 2 {
+		t.Errorf("challenges were not counted correctly: %v rejects, %v failures, %v calls", nm.ChallengeRejects, nm.ChallengeFailures, nm.AuthSettingsCalls)
+	}
+	if nm.SettingsCalls != 0 {
+		t.Error("refused settings call was counted as a settings call")
+	}
+}
+
+// TestRPCPing checks that the host echoes the nonce of a ping and counts the
+// call.
+func TestRPCPing(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestRPCPing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	nonce := [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+	err = encoding.WriteObject(conn, modules.RPCPing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = encoding.WriteObject(conn, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp modules.HostPingResponse
+	err = encoding.ReadObject(conn, &resp, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Nonce != nonce {
+		t.Error("host did not echo the nonce")
+	}
+	if resp.Time == 0 {
+		t.Error("host did not report its time")
+	}
+	if ht.host.NetworkMetrics().PingCalls != 1 {
+		t.Error("ping call was not counted")
+	}
+}
+
+// TestRPCHostMetrics checks that the host reports its public metrics, and
+// refuses to do so when its metrics are private.
+func TestRPCHostMetrics(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestRPCHostMetrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	callMetrics := func() (modules.HostMetricsResponse, error) {
+		conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+		if err != nil {
+			return modules.HostMetricsResponse{}, err
+		}
+		defer conn.Close()
+		err = encoding.WriteObject(conn, modules.RPCHostMetrics)
+		if err != nil {
+			return modules.HostMetricsResponse{}, err
+		}
+		var resp modules.HostMetricsResponse
+		err = encoding.ReadObject(conn, &resp, 256)
+		return resp, err
+	}
+
+	resp, err := callMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nm := ht.host.NetworkMetrics()
+	if resp.SettingsCalls != nm.SettingsCalls || resp.ErrorCalls != nm.ErrorCalls {
+		t.Error("host metrics do not match the network metrics:", resp, nm)
+	}
+	if nm.HostMetricsCalls != 1 {
+		t.Error("host metrics call was not counted")
+	}
+
+	settings := ht.host.InternalSettings()
+	settings.PrivateMetrics = true
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := callMetrics(); err == nil {
+		t.Error("host served its metrics while they were private")
+	}
+	if ht.host.NetworkMetrics().DisabledCalls != 1 {
+		t.Error("refused host metrics call was not counted")
+	}
+}
+
+// TestListenAddr checks that the listen address of the host is available
+// immediately after startup and points at the host's listener.
+func TestListenAddr(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// A host that is not yet listening has no listen address.
+	h := &Host{mu: siasync.New(modules.SafeMutexDelay, 2)}
+	if addr := h.ListenAddr(); addr != nil {
+		t.Fatal("host without a listener returned a listen address:", addr)
+	}
+
+	ht, err := blankHostTester("TestListenAddr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	addr := ht.host.ListenAddr()
+	if addr.String() != ht.host.listener.Addr().String() {
+		t.Fatal("listen address does not match the listener:", addr)
+	}
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+// TestRPCUpdateSettings checks that the host applies settings updates that
+// are signed by its own key, and refuses all others.
+func TestRPCUpdateSettings(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestRPCUpdateSettings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	specifier := modules.PrefixHostUpdateSettings
+	updateSettings := func(settings modules.HostInternalSettings, revision uint64, sk crypto.SecretKey) error {
+		conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		err = encoding.WriteObject(conn, modules.RPCUpdateSettings)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(settings)
+		if err != nil {
+			return err
+		}
+		req := modules.HostUpdateSettingsRequest{Specifier: specifier, RevisionNumber: revision, Settings: b}
+		err = crypto.WriteSignedObject(conn, req, sk)
+		if err != nil {
+			return err
+		}
+		return modules.ReadNegotiationAcceptance(conn)
+	}
+
+	// The RPC is disabled by default.
+	settings := ht.host.InternalSettings()
+	settings.MaxDuration = 1234
+	err = updateSettings(settings, ht.host.ExternalSettings().RevisionNumber, ht.host.secretKey)
+	if err == nil || err.Error() != errRPCDisabled.Error() {
+		t.Fatalf("expected %v, got %v", errRPCDisabled, err)
+	}
+
+	enabled := ht.host.InternalSettings()
+	enabled.RemoteSettingsUpdates = true
+	err = ht.host.SetInternalSettings(enabled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.RemoteSettingsUpdates = true
+
+	// A request signed by another key should be refused.
+	sk, _, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	revision := ht.host.ExternalSettings().RevisionNumber
+	err = updateSettings(settings, revision, sk)
+	if err == nil || err.Error() != crypto.ErrInvalidSignature.Error() {
+		t.Fatalf("expected %v, got %v", crypto.ErrInvalidSignature, err)
+	}
+	if ht.host.InternalSettings().MaxDuration == 1234 {
+		t.Fatal("settings were updated by a request with the wrong signature")
+	}
+
+	// A request without the settings update specifier should be refused,
+	// even if signed by the host.
+	specifier = modules.RPCUpdateSettings
+	err = updateSettings(settings, revision, ht.host.secretKey)
+	if err == nil || err.Error() != errBadSettingsUpdateSpecifier.Error() {
+		t.Fatalf("expected %v, got %v", errBadSettingsUpdateSpecifier, err)
+	}
+	specifier = modules.PrefixHostUpdateSettings
+
+	// A request signed by the host should be applied.
+	err = updateSettings(settings, revision, ht.host.secretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ht.host.InternalSettings().MaxDuration != 1234 {
+		t.Fatal("settings were not updated")
+	}
+
+	// Replaying the request should fail, as the revision has changed.
+	err = updateSettings(settings, revision, ht.host.secretKey)
+	if err == nil || err.Error() != errStaleSettingsRevision.Error() {
+		t.Fatalf("expected %v, got %v", errStaleSettingsRevision, err)
+	}
+	if n := ht.host.NetworkMetrics().UpdateSettingsCalls; n != 4 {
+		t.Error("expected 4 update settings calls, got", n)
+	}
+}
+
+// TestHostNotReady checks that the host refuses contract RPCs while it is not
+// ready, but continues to serve the settings RPC.
+func TestHostNotReady(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestHostNotReady")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+	ht.host.SetReady(false)
+
+	// Call an RPC that forms a contract, the host should respond with a
+	// rejection.
+	conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	err = encoding.WriteObject(conn, modules.RPCFormContract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = modules.ReadNegotiationAcceptance(conn)
+	if err == nil || err.Error() != errHostNotReady.Error() {
+		t.Fatalf("expected %v, got %v", errHostNotReady, err)
+	}
+	if ht.host.NetworkMetrics().NotReadyCalls != 1 {
+		t.Error("not ready call was not counted")
+	}
+
+	// The settings RPC should still be served.
+	conn2, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	err = encoding.WriteObject(conn2, modules.RPCSettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pk crypto.PublicKey
+	copy(pk[:], ht.host.publicKey.Key)
+	var settings modules.HostExternalSettings
+	err = crypto.ReadSignedObject(conn2, &settings, modules.NegotiateMaxHostExternalSettingsLen, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ht.host.NetworkMetrics().NotReadyCalls != 1 {
+		t.Error("settings call was counted as not ready")
+	}
+}
+
+// TestSyncGraceRPCs checks that only the RPCs in the sync grace list are
+// served while the host is not ready.
+func TestSyncGraceRPCs(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestSyncGraceRPCs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+	ht.host.SetReady(false)
+
+	// By default, only the settings and ping RPCs are allowed.
+	for id := range defaultRPCTimeouts {
+		allowed := id == modules.RPCSettings || id == modules.RPCAuthSettings || id == modules.RPCPing
+		if ht.host.rpcNotReady(id) == allowed {
+			t.Errorf("RPC %v: expected allowed to be %v", rpcName(id), allowed)
+		}
+	}
+	if ht.host.rpcNotReady(rpcSettingsDeprecated) {
+		t.Error("unknown RPC was refused as not ready")
+	}
+
+	// Allow downloads, but keep blocking new contracts.
+	settings := ht.host.InternalSettings()
+	settings.SyncGraceRPCs = []types.Specifier{modules.RPCDownload, modules.RPCSettings}
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ht.host.rpcNotReady(modules.RPCDownload) {
+		t.Error("download was refused despite being in the grace list")
+	}
+	if !ht.host.rpcNotReady(modules.RPCFormContract) {
+		t.Error("contract formation was allowed while not ready")
+	}
+	if !ht.host.rpcNotReady(modules.RPCPing) {
+		t.Error("ping was allowed despite not being in the grace list")
+	}
+
+	// Once the host is ready, every RPC is allowed.
+	ht.host.SetReady(true)
+	if ht.host.rpcNotReady(modules.RPCFormContract) {
+		t.Error("contract formation was refused while ready")
+	}
+
+	// Unknown RPCs cannot be added to the grace list.
+	settings.SyncGraceRPCs = []types.Specifier{{'B', 'o', 'g', 'u', 's'}}
+	if err := ht.host.SetInternalSettings(settings); err == nil {
+		t.Error("grace list with an unknown RPC was accepted")
+	}
+}
+
+// TestDeadlineFailure checks that the host counts connections that are dropped
+// because a deadline could not be set.
+func TestDeadlineFailure(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestDeadlineFailure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	// Setting a deadline on a closed pipe will always fail.
+	conn, _ := net.Pipe()
+	conn.Close()
+	ht.host.threadedHandleConn(conn)
+	if ht.host.NetworkMetrics().DeadlineFailures != 1 {
+		t.Error("deadline failure was not counted")
+	}
+	if ht.host.NetworkMetrics().UnrecognizedCalls != 0 {
+		t.Error("connection was handled despite the deadline failure")
+	}
+}
+
+// TestIsTimeout checks that isTimeout only recognizes errors caused by a
+// connection deadline.
+func TestIsTimeout(t *testing.T) {
+	conn, _ := net.Pipe()
+	defer conn.Close()
+	err := conn.SetDeadline(time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Read(make([]byte, 1))
+	if !isTimeout(err) {
+		t.Error("deadline error was not recognized as a timeout:", err)
+	}
+	if isTimeout(errRPCDisabled) {
+		t.Error("non-network error was recognized as a timeout")
+	}
+	if isTimeout(nil) {
+		t.Error("nil error was recognized as a timeout")
+	}
+}
+
+// TestSetListenAddress checks that the host's listener can be moved to a new
+// address at runtime.
+func TestSetListenAddress(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestSetListenAddress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	// A failed bind should keep the old listener.
+	oldAddr := ht.host.ListenAddr().String()
+	if err := ht.host.SetListenAddress("not an address"); err == nil {
+		t.Fatal("expected an error when binding an invalid address")
+	}
+	if ht.host.ListenAddr().String() != oldAddr {
+		t.Fatal("listener was replaced after a failed bind")
+	}
+
+	err = ht.host.SetListenAddress("localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newAddr := ht.host.ListenAddr().String()
+	if newAddr == oldAddr {
+		t.Fatal("listener was not moved")
+	}
+
+	// The old listener should be closed, and the new one should serve RPCs.
+	if conn, err := net.Dial("tcp", oldAddr); err == nil {
+		conn.Close()
+		t.Error("old listener is still accepting connections")
+	}
+	conn, err := net.Dial("tcp", newAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	err = encoding.WriteObject(conn, modules.RPCPing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = encoding.WriteObject(conn, [8]byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp modules.HostPingResponse
+	err = encoding.ReadObject(conn, &resp, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestJitteredDeadline checks that connection deadlines are spread over the
+// jitter range.
+func TestJitteredDeadline(t *testing.T) {
+	if jitteredDeadline(time.Minute, 0) != time.Minute || jitteredDeadline(time.Minute, -time.Second) != time.Minute {
+		t.Error("deadline was changed without any jitter")
+	}
+	seen := make(map[time.Duration]struct{})
+	for i := 0; i < 100; i++ {
+		d := jitteredDeadline(time.Minute, time.Second)
+		if d < time.Minute || d >= time.Minute+time.Second {
+			t.Fatal("jittered deadline is out of range:", d)
+		}
+		seen[d] = struct{}{}
+	}
+	if len(seen) < 10 {
+		t.Error("jittered deadlines are not spread out:", len(seen))
+	}
+}
+
+// TestBufferSizes checks that oversized connection buffers are rejected, and
+// that the host keeps serving RPCs with custom buffer sizes.
+func TestBufferSizes(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestBufferSizes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	settings := ht.host.InternalSettings()
+	settings.ReadBufferSize = maxConnBufferSize + 1
+	if err := ht.host.SetInternalSettings(settings); err == nil {
+		t.Fatal("expected an oversized read buffer to be rejected")
+	}
+	settings.ReadBufferSize = 1 << 20
+	settings.WriteBufferSize = 1 << 20
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := setBufferSizes(conn, 1<<16, 0); err != nil {
+		t.Fatal(err)
+	}
+	encoding.WriteObject(conn, modules.RPCPing)
+	encoding.WriteObject(conn, [8]byte{1})
+	var resp modules.HostPingResponse
+	if err := encoding.ReadObject(conn, &resp, 256); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMaxConnections checks that the host refuses connections beyond the
+// configured limit.
+func TestMaxConnections(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestMaxConnections")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	settings := ht.host.InternalSettings()
+	settings.MaxConnections = 1
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Open a connection that holds the only slot.
+	conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; i < 100 && atomic.LoadInt64(&ht.host.atomicOpenConnections) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A second connection should be closed without being served.
+	conn2, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	if _, err := conn2.Read(make([]byte, 1)); err == nil {
+		t.Fatal("connection beyond the limit was served")
+	}
+	if ht.host.NetworkMetrics().CapacityRejects != 1 {
+		t.Error("refused connection was not counted")
+	}
+}
+
+// TestHostModes checks that the host refuses new contracts while in
+// maintenance or standby mode, continues to serve its settings, and
+// advertises its mode in its settings extension.
+func TestHostModes(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := newHostTester("TestHostModes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	settings := ht.host.InternalSettings()
+	settings.AcceptingContracts = true
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ht.host.SetMode(modules.HostModeStandby + 1); err != errUnknownHostMode {
+		t.Fatal("expected errUnknownHostMode, got", err)
+	}
+
+	tests := []struct {
+		mode    modules.HostMode
+		rpc     types.Specifier
+		refusal error
+		calls   func() uint64
+	}{
+		{modules.HostModeMaintenance, modules.RPCRenewContract, errHostMaintenance, func() uint64 { return ht.host.NetworkMetrics().MaintenanceCalls }},
+		{modules.HostModeStandby, modules.RPCFormContract, errHostStandby, func() uint64 { return ht.host.NetworkMetrics().StandbyCalls }},
+	}
+	for _, test := range tests {
+		err = ht.host.SetMode(test.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ht.host.Mode() != test.mode {
+			t.Fatalf("host is not in %v mode", test.mode)
+		}
+		if ht.host.SettingsExtension().Mode != test.mode || ht.host.ExternalSettings().AcceptingContracts {
+			t.Errorf("settings do not reflect %v mode", test.mode)
+		}
+
+		// The settings are still served, and carry the mode in the
+		// extension.
+		_, hes, ext, err := readSettings(ht.host, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ext.Mode != test.mode || hes.AcceptingContracts {
+			t.Errorf("served settings do not reflect %v mode", test.mode)
+		}
+
+		conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = encoding.WriteObject(conn, test.rpc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = modules.ReadNegotiationAcceptance(conn)
+		conn.Close()
+		if err == nil || err.Error() != test.refusal.Error() {
+			t.Fatalf("expected %v, got %v", test.refusal, err)
+		}
+		if test.calls() != 1 {
+			t.Error("refused call was not counted")
+		}
+	}
+
+	// Going live restores the settings.
+	err = ht.host.SetMode(modules.HostModeLive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ht.host.SettingsExtension().Mode != modules.HostModeLive || !ht.host.ExternalSettings().AcceptingContracts {
+		t.Error("settings still reflect the previous mode")
+	}
+}
+
+// panicConn is a net.Conn that panics when it is read from.
+type panicConn struct {
+	net.Conn
+}
+
+func (panicConn) Read([]byte) (int, error) { panic("read from panicConn") }
+
+// TestHandlerPanic checks that a panic while handling a connection is
+// counted, and that it is raised again in debug builds.
+func TestHandlerPanic(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestHandlerPanic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	func() {
+		defer func() {
+			if r := recover(); (r != nil) != build.DEBUG {
+				t.Error("panic was raised again outside of a debug build, or swallowed in one:", r)
+			}
+		}()
+		ht.host.threadedHandleConn(panicConn{conn})
+	}()
+	if ht.host.NetworkMetrics().PanicCalls != 1 {
+		t.Error("panic was not counted")
+	}
+
+	// The connection should have been closed.
+	if _, err := peer.Read(make([]byte, 1)); err == nil {
+		t.Error("connection was not closed after the panic")
+	}
+}
+
+// TestLockReleased checks that managedLockReleased reports whether the host
+// lock is held.
+func TestLockReleased(t *testing.T) {
+	h := &Host{mu: siasync.New(modules.SafeMutexDelay, 2)}
+	if !h.managedLockReleased(time.Second) {
+		t.Error("free lock was reported as held")
+	}
+	lockID := h.mu.Lock()
+	if h.managedLockReleased(50 * time.Millisecond) {
+		t.Error("held lock was reported as free")
+	}
+	h.mu.Unlock(lockID)
+}
+
+// TestRPCSpecifierLen checks that the read limit for RPC specifiers matches
+// the size of an encoded specifier.
+func TestRPCSpecifierLen(t *testing.T) {
+	if rpcSpecifierLen != types.SpecifierLen {
+		t.Error("rpcSpecifierLen does not match the size of a specifier:", rpcSpecifierLen, types.SpecifierLen)
+	}
+	if n := uint64(len(encoding.Marshal(modules.RPCSettings))); n != rpcSpecifierLen {
+		t.Error("encoded specifier is", n, "bytes, expected", rpcSpecifierLen)
+	}
+}
+
+// TestConnectionGauges checks that the host reports the number of open
+// connections and the peak number of concurrent connections.
+func TestConnectionGauges(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestConnectionGauges")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	var conns []net.Conn
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+	for i := 0; i < 100 && ht.host.NetworkMetrics().ActiveConnections != 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if nm := ht.host.NetworkMetrics(); nm.ActiveConnections != 3 || nm.PeakConnections != 3 {
+		t.Fatal("wrong connection gauges:", nm.ActiveConnections, nm.PeakConnections)
+	}
+
+	// Closing the connections causes the host to return early, which should
+	// still release the connections.
+	for _, conn := range conns {
+		conn.Close()
+	}
+	for i := 0; i < 100 && ht.host.NetworkMetrics().ActiveConnections != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if nm := ht.host.NetworkMetrics(); nm.ActiveConnections != 0 || nm.PeakConnections != 3 {
+		t.Error("wrong connection gauges after closing:", nm.ActiveConnections, nm.PeakConnections)
+	}
+}
+
+/*
 // TestRPCMetrics checks that the rpc tracking is counting incoming RPC cals.
 func TestRPCMetrics(t *testing.T) {
 	if testing.Short() {
@@ -55,3 +934,164 @@ func TestRPCMetrics(t *testing.T) {
 	}
 }
 */
+
+// TestInitNetworkingTwice checks that initializing the networking of a host a
+// second time is refused, and that the original listener keeps serving.
+func TestInitNetworkingTwice(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestInitNetworkingTwice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	listener := ht.host.listener
+	err = ht.host.initNetworking("localhost:0")
+	if err != errNetworkingInitialized {
+		t.Fatal("expected errNetworkingInitialized, got", err)
+	}
+	if ht.host.listener != listener {
+		t.Fatal("the listener was replaced")
+	}
+
+	// The original listener should still be serving.
+	conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	nonce := [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+	err = encoding.WriteObject(conn, modules.RPCPing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = encoding.WriteObject(conn, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp modules.HostPingResponse
+	err = encoding.ReadObject(conn, &resp, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Nonce != nonce {
+		t.Error("host did not echo the nonce")
+	}
+}
+
+// TestShutdownDuringConnection checks that connections which are being
+// handled, or which arrive while the host is shutting down, are closed, and
+// that the host stops accepting connections once it has shut down.
+func TestShutdownDuringConnection(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestShutdownDuringConnection")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+	addr := ht.host.ListenAddr().String()
+
+	// Open a connection that is being handled, waiting for a specifier.
+	idle, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+
+	// Keep opening connections while the host shuts down.
+	closeErr := make(chan error)
+	go func() {
+		closeErr <- ht.host.Close()
+	}()
+	var arrivals []net.Conn
+	defer func() {
+		for _, conn := range arrivals {
+			conn.Close()
+		}
+	}()
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		arrivals = append(arrivals, conn)
+		if len(arrivals) > 1000 {
+			t.Fatal("host did not stop accepting connections")
+		}
+	}
+	select {
+	case err := <-closeErr:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("host did not shut down")
+	}
+
+	// Every connection should have been closed without being served.
+	for _, conn := range append(arrivals, idle) {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Read(make([]byte, 1)); err == nil {
+			t.Fatal("connection was not closed during shutdown")
+		} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			t.Fatal("connection was left open after shutdown")
+		}
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Fatal("host accepted a connection after shutdown")
+	}
+}
+
+// TestShutdownClosedCalls checks that RPCs interrupted by the host shutting
+// down are counted apart from other errors, and that completed RPCs are not
+// counted.
+func TestShutdownClosedCalls(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestShutdownClosedCalls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	// Complete a ping, then start a ping that never sends its nonce.
+	done, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer done.Close()
+	encoding.WriteObject(done, modules.RPCPing)
+	encoding.WriteObject(done, [8]byte{1})
+	var resp modules.HostPingResponse
+	if err := encoding.ReadObject(done, &resp, 256); err != nil {
+		t.Fatal(err)
+	}
+	stalled, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stalled.Close()
+	encoding.WriteObject(stalled, modules.RPCPing)
+	for i := 0; i < 100 && ht.host.NetworkMetrics().PingCalls < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := ht.host.Close(); err != nil {
+		t.Fatal(err)
+	}
+	nm := ht.host.NetworkMetrics()
+	if nm.ShutdownClosedCalls != 1 {
+		t.Error("expected one call interrupted by the shutdown, got", nm.ShutdownClosedCalls)
+	}
+	if nm.TimeoutCalls != 0 || nm.IdleTimeoutCalls != 0 {
+		t.Error("interrupted call was counted as a timeout")
+	}
+}
@@ -0,0 +1,68 @@
+package host
+
+// peerversions.go tracks the distribution of the protocol versions advertised
+// by the peers that connect to the host, so that operators can see how many
+// renters are still on old versions before a version is deprecated. The
+// number of distinct versions that are tracked is bounded, because the
+// advertised version is chosen by the peer.
+
+import (
+	"sync"
+)
+
+const (
+	// maxPeerVersions is the maximum number of distinct versions that are
+	// counted individually. Versions seen after the limit has been reached
+	// are counted together under peerVersionOther.
+	maxPeerVersions = 32
+
+	// maxPeerVersionLen is the maximum length of a version that is counted
+	// individually. Longer versions are counted under peerVersionOther.
+	maxPeerVersionLen = 32
+
+	// peerVersionUnknown counts the peers that did not advertise a version.
+	peerVersionUnknown = "unknown"
+
+	// peerVersionOther counts the peers whose version could not be tracked
+	// individually.
+	peerVersionOther = "other"
+)
+
+// peerVersions counts the connections made to the host by advertised version.
+type peerVersions struct {
+	counts map[string]uint64
+	mu     sync.Mutex
+}
+
+// newPeerVersions returns an empty set of peer version counts.
+func newPeerVersions() *peerVersions {
+	return &peerVersions{
+		counts: make(map[string]uint64),
+	}
+}
+
+// record counts a connection from a peer that advertised the provided
+// version. An empty version is counted as unknown.
+func (pv *peerVersions) record(version string) {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+
+	if version == "" {
+		version = peerVersionUnknown
+	}
+	if _, exists := pv.counts[version]; !exists && (len(pv.counts) >= maxPeerVersions || len(version) > maxPeerVersionLen) {
+		version = peerVersionOther
+	}
+	pv.counts[version]++
+}
+
+// snapshot returns a copy of the peer version counts.
+func (pv *peerVersions) snapshot() map[string]uint64 {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+	counts := make(map[string]uint64, len(pv.counts))
+	for version, n := range pv.counts {
+		counts[version] = n
+	}
+	return counts
+}
@@ -0,0 +1,51 @@
+package host
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestPeerVersions checks that connections are counted by version, that
+// absent versions are counted as unknown, and that the number of versions
+// counted individually is bounded.
+func TestPeerVersions(t *testing.T) {
+	pv := newPeerVersions()
+	pv.record("1.0.0")
+	pv.record("1.0.0")
+	pv.record("")
+	pv.record(strings.Repeat("9", maxPeerVersionLen+1))
+
+	counts := pv.snapshot()
+	if counts["1.0.0"] != 2 {
+		t.Error("expected 2 connections from version 1.0.0, got", counts["1.0.0"])
+	}
+	if counts[peerVersionUnknown] != 1 {
+		t.Error("expected 1 connection with an unknown version, got", counts[peerVersionUnknown])
+	}
+	if counts[peerVersionOther] != 1 {
+		t.Error("expected an overlong version to be counted as other, got", counts[peerVersionOther])
+	}
+
+	// The snapshot should not share memory with the counts.
+	counts["1.0.0"] = 100
+	if pv.snapshot()["1.0.0"] != 2 {
+		t.Error("modifying the snapshot modified the counts")
+	}
+
+	// Once the limit is reached, new versions are counted together.
+	for i := 0; i < 2*maxPeerVersions; i++ {
+		pv.record(strconv.Itoa(i))
+	}
+	counts = pv.snapshot()
+	if len(counts) > maxPeerVersions+1 {
+		t.Error("peer versions grew beyond the limit:", len(counts))
+	}
+	if counts["1.0.0"] != 2 {
+		t.Error("an existing version was not kept after the limit was reached")
+	}
+	pv.record("1.0.0")
+	if pv.snapshot()["1.0.0"] != 3 {
+		t.Error("an existing version was not counted after the limit was reached")
+	}
+}
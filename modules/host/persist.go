@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync/atomic"
+	"time"
 
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
@@ -15,15 +16,50 @@ import (
 
 // persistence is the data that is kept when the host is restarted.
 type persistence struct {
+	// Announcement Metrics.
+	Announcements           uint64 `json:"announcements"`
+	SuppressedAnnouncements uint64 `json:"suppressedannouncements"`
+
+	// RPC Error Metrics.
+	ConsensusErrors  uint64 `json:"consensuserrors"`
+	DecodeErrors     uint64 `json:"decodeerrors"`
+	IOErrors         uint64 `json:"ioerrors"`
+	ValidationErrors uint64 `json:"validationerrors"`
+
 	// RPC Metrics.
+	AdmissionRejects    uint64 `json:"admissionrejects"`
+	AuthSettingsCalls   uint64 `json:"authsettingscalls"`
+	BlacklistRejects    uint64 `json:"blacklistrejects"`
+	BusyCalls           uint64 `json:"busycalls"`
+	CapacityRejects     uint64 `json:"capacityrejects"`
+	ChallengeFailures   uint64 `json:"challengefailures"`
+	ChallengeRejects    uint64 `json:"challengerejects"`
+	DeadlineFailures    uint64 `json:"deadlinefailures"`
+	DisabledCalls       uint64 `json:"disabledcalls"`
 	DownloadCalls       uint64 `json:"downloadcalls"`
 	ErroredCalls        uint64 `json:"erroredcalls"`
 	FormContractCalls   uint64 `json:"formcontractcalls"`
+	HandlerErrors       uint64 `json:"handlererrors"`
+	HostMetricsCalls    uint64 `json:"hostmetricscalls"`
+	IdleTimeoutCalls    uint64 `json:"idletimeoutcalls"`
+	LifetimeCloses      uint64 `json:"lifetimecloses"`
+	MaintenanceCalls    uint64 `json:"maintenancecalls"`
+	NotReadyCalls       uint64 `json:"notreadycalls"`
+	PanicCalls          uint64 `json:"paniccalls"`
+	PingCalls           uint64 `json:"pingcalls"`
+	PreDispatchErrors   uint64 `json:"predispatcherrors"`
+	RecoveredCalls      uint64 `json:"recoveredcalls"`
 	RenewCalls          uint64 `json:"renewcalls"`
+	RetriedCalls        uint64 `json:"retriedcalls"`
 	ReviseCalls         uint64 `json:"revisecalls"`
 	RecentRevisionCalls uint64 `json:"recentrevisioncalls"`
 	SettingsCalls       uint64 `json:"settingscalls"`
+	ShutdownClosedCalls uint64 `json:"shutdownclosedcalls"`
+	StandbyCalls        uint64 `json:"standbycalls"`
+	TimeoutCalls        uint64 `json:"timeoutcalls"`
 	UnrecognizedCalls   uint64 `json:"unrecognizedcalls"`
+	UpdateSettingsCalls uint64 `json:"updatesettingscalls"`
+	WhitelistRejects    uint64 `json:"whitelistrejects"`
 
 	// Consensus Tracking.
 	BlockHeight  types.BlockHeight         `json:"blockheight"`
@@ -32,7 +68,10 @@ type persistence struct {
 	// Host Identity.
 	Announced        bool                         `json:"announced"`
 	AutoAddress      modules.NetAddress           `json:"autoaddress"`
+	DeferredAnnounce modules.NetAddress           `json:"deferredannounce"`
+	LastAnnouncement time.Time                    `json:"lastannouncement"`
 	FinancialMetrics modules.HostFinancialMetrics `json:"financialmetrics"`
+	Mode             modules.HostMode             `json:"mode"`
 	PublicKey        types.SiaPublicKey           `json:"publickey"`
 	RevisionNumber   uint64                       `json:"revisionnumber"`
 	SecretKey        crypto.SecretKey             `json:"secretkey"`
@@ -43,15 +82,50 @@ type persistence struct {
 // persistData returns the data in the Host that will be saved to disk.
 func (h *Host) persistData() persistence {
 	return persistence{
+		// Announcement Metrics.
+		Announcements:           atomic.LoadUint64(&h.atomicAnnouncements),
+		SuppressedAnnouncements: atomic.LoadUint64(&h.atomicSuppressedAnnouncements),
+
+		// RPC Error Metrics.
+		ConsensusErrors:  atomic.LoadUint64(&h.atomicConsensusErrors),
+		DecodeErrors:     atomic.LoadUint64(&h.atomicDecodeErrors),
+		IOErrors:         atomic.LoadUint64(&h.atomicIOErrors),
+		ValidationErrors: atomic.LoadUint64(&h.atomicValidationErrors),
+
 		// RPC Metrics.
+		AdmissionRejects:    atomic.LoadUint64(&h.atomicAdmissionRejects),
+		AuthSettingsCalls:   atomic.LoadUint64(&h.atomicAuthSettingsCalls),
+		BlacklistRejects:    atomic.LoadUint64(&h.atomicBlacklistRejects),
+		BusyCalls:           atomic.LoadUint64(&h.atomicBusyCalls),
+		CapacityRejects:     atomic.LoadUint64(&h.atomicCapacityRejects),
+		ChallengeFailures:   atomic.LoadUint64(&h.atomicChallengeFailures),
+		ChallengeRejects:    atomic.LoadUint64(&h.atomicChallengeRejects),
+		DeadlineFailures:    atomic.LoadUint64(&h.atomicDeadlineFailures),
+		DisabledCalls:       atomic.LoadUint64(&h.atomicDisabledCalls),
 		DownloadCalls:       atomic.LoadUint64(&h.atomicDownloadCalls),
 		ErroredCalls:        atomic.LoadUint64(&h.atomicErroredCalls),
 		FormContractCalls:   atomic.LoadUint64(&h.atomicFormContractCalls),
+		HandlerErrors:       atomic.LoadUint64(&h.atomicHandlerErrors),
+		HostMetricsCalls:    atomic.LoadUint64(&h.atomicHostMetricsCalls),
+		IdleTimeoutCalls:    atomic.LoadUint64(&h.atomicIdleTimeoutCalls),
+		LifetimeCloses:      atomic.LoadUint64(&h.atomicLifetimeCloses),
+		MaintenanceCalls:    atomic.LoadUint64(&h.atomicMaintenanceCalls),
+		NotReadyCalls:       atomic.LoadUint64(&h.atomicNotReadyCalls),
+		PanicCalls:          atomic.LoadUint64(&h.atomicPanicCalls),
+		PingCalls:           atomic.LoadUint64(&h.atomicPingCalls),
+		PreDispatchErrors:   atomic.LoadUint64(&h.atomicPreDispatchErrors),
+		RecoveredCalls:      atomic.LoadUint64(&h.atomicRecoveredCalls),
 		RenewCalls:          atomic.LoadUint64(&h.atomicRenewCalls),
+		RetriedCalls:        atomic.LoadUint64(&h.atomicRetriedCalls),
 		ReviseCalls:         atomic.LoadUint64(&h.atomicReviseCalls),
 		RecentRevisionCalls: atomic.LoadUint64(&h.atomicRecentRevisionCalls),
 		SettingsCalls:       atomic.LoadUint64(&h.atomicSettingsCalls),
+		ShutdownClosedCalls: atomic.LoadUint64(&h.atomicShutdownClosedCalls),
+		StandbyCalls:        atomic.LoadUint64(&h.atomicStandbyCalls),
+		TimeoutCalls:        atomic.LoadUint64(&h.atomicTimeoutCalls),
 		UnrecognizedCalls:   atomic.LoadUint64(&h.atomicUnrecognizedCalls),
+		UpdateSettingsCalls: atomic.LoadUint64(&h.atomicUpdateSettingsCalls),
+		WhitelistRejects:    atomic.LoadUint64(&h.atomicWhitelistRejects),
 
 		// Consensus Tracking.
 		BlockHeight:  h.blockHeight,
@@ -60,7 +134,10 @@ func (h *Host) persistData() persistence {
 		// Host Identity.
 		Announced:        h.announced,
 		AutoAddress:      h.autoAddress,
+		DeferredAnnounce: h.deferredAnnounceAddr,
+		LastAnnouncement: h.lastAnnouncement,
 		FinancialMetrics: h.financialMetrics,
+		Mode:             h.mode,
 		PublicKey:        h.publicKey,
 		RevisionNumber:   h.revisionNumber,
 		SecretKey:        h.secretKey,
@@ -77,6 +154,7 @@ func (h *Host) establishDefaults() error {
 		MaxDownloadBatchSize: uint64(defaultMaxDownloadBatchSize),
 		MaxDuration:          defaultMaxDuration,
 		MaxReviseBatchSize:   uint64(defaultMaxReviseBatchSize),
+		RemoteMetricsLimit:   defaultRemoteMetricsLimit,
 		WindowSize:           defaultWindowSize,
 
 		Collateral:       defaultCollateral,
@@ -87,6 +165,17 @@ func (h *Host) establishDefaults() error {
 		MinContractPrice:          defaultContractPrice,
 		MinDownloadBandwidthPrice: defaultDownloadBandwidthPrice,
 		MinUploadBandwidthPrice:   defaultUploadBandwidthPrice,
+
+		ConnectionDeadline:       defaultConnectionDeadline,
+		ConnectionDeadlineJitter: defaultConnectionDeadlineJitter,
+		ConnLogRate:              defaultConnLogRate,
+		MaxConnectionLifetime:    defaultMaxConnectionLifetime,
+		MinAnnounceInterval:      defaultMinAnnounceInterval,
+		PortForwardTimeout:       defaultPortForwardTimeout,
+
+		DebugCaptureBytes:       defaultDebugCaptureBytes,
+		DebugCaptureConnections: defaultDebugCaptureConnections,
+		DebugCaptureWindow:      defaultDebugCaptureWindow,
 	}
 
 	// Generate signing key, for revising contracts.
@@ -152,14 +241,45 @@ func (h *Host) load() error {
 	}
 
 	// Copy over rpc tracking.
+	atomic.StoreUint64(&h.atomicAdmissionRejects, p.AdmissionRejects)
+	atomic.StoreUint64(&h.atomicAuthSettingsCalls, p.AuthSettingsCalls)
+	atomic.StoreUint64(&h.atomicBlacklistRejects, p.BlacklistRejects)
+	atomic.StoreUint64(&h.atomicBusyCalls, p.BusyCalls)
+	atomic.StoreUint64(&h.atomicCapacityRejects, p.CapacityRejects)
+	atomic.StoreUint64(&h.atomicChallengeFailures, p.ChallengeFailures)
+	atomic.StoreUint64(&h.atomicChallengeRejects, p.ChallengeRejects)
+	atomic.StoreUint64(&h.atomicDeadlineFailures, p.DeadlineFailures)
+	atomic.StoreUint64(&h.atomicDisabledCalls, p.DisabledCalls)
 	atomic.StoreUint64(&h.atomicDownloadCalls, p.DownloadCalls)
 	atomic.StoreUint64(&h.atomicErroredCalls, p.ErroredCalls)
 	atomic.StoreUint64(&h.atomicFormContractCalls, p.FormContractCalls)
+	atomic.StoreUint64(&h.atomicHandlerErrors, p.HandlerErrors)
+	atomic.StoreUint64(&h.atomicHostMetricsCalls, p.HostMetricsCalls)
+	atomic.StoreUint64(&h.atomicMaintenanceCalls, p.MaintenanceCalls)
+	atomic.StoreUint64(&h.atomicIdleTimeoutCalls, p.IdleTimeoutCalls)
+	atomic.StoreUint64(&h.atomicLifetimeCloses, p.LifetimeCloses)
+	atomic.StoreUint64(&h.atomicNotReadyCalls, p.NotReadyCalls)
+	atomic.StoreUint64(&h.atomicPanicCalls, p.PanicCalls)
+	atomic.StoreUint64(&h.atomicPingCalls, p.PingCalls)
+	atomic.StoreUint64(&h.atomicPreDispatchErrors, p.PreDispatchErrors)
+	atomic.StoreUint64(&h.atomicRecoveredCalls, p.RecoveredCalls)
 	atomic.StoreUint64(&h.atomicRenewCalls, p.RenewCalls)
+	atomic.StoreUint64(&h.atomicRetriedCalls, p.RetriedCalls)
 	atomic.StoreUint64(&h.atomicReviseCalls, p.ReviseCalls)
 	atomic.StoreUint64(&h.atomicRecentRevisionCalls, p.RecentRevisionCalls)
 	atomic.StoreUint64(&h.atomicSettingsCalls, p.SettingsCalls)
+	atomic.StoreUint64(&h.atomicShutdownClosedCalls, p.ShutdownClosedCalls)
+	atomic.StoreUint64(&h.atomicStandbyCalls, p.StandbyCalls)
+	atomic.StoreUint64(&h.atomicTimeoutCalls, p.TimeoutCalls)
 	atomic.StoreUint64(&h.atomicUnrecognizedCalls, p.UnrecognizedCalls)
+	atomic.StoreUint64(&h.atomicUpdateSettingsCalls, p.UpdateSettingsCalls)
+	atomic.StoreUint64(&h.atomicWhitelistRejects, p.WhitelistRejects)
+	atomic.StoreUint64(&h.atomicAnnouncements, p.Announcements)
+	atomic.StoreUint64(&h.atomicSuppressedAnnouncements, p.SuppressedAnnouncements)
+	atomic.StoreUint64(&h.atomicConsensusErrors, p.ConsensusErrors)
+	atomic.StoreUint64(&h.atomicDecodeErrors, p.DecodeErrors)
+	atomic.StoreUint64(&h.atomicIOErrors, p.IOErrors)
+	atomic.StoreUint64(&h.atomicValidationErrors, p.ValidationErrors)
 
 	// Copy over consensus tracking.
 	h.blockHeight = p.BlockHeight
@@ -167,12 +287,15 @@ func (h *Host) load() error {
 
 	// Copy over host identity.
 	h.announced = p.Announced
+	h.lastAnnouncement = p.LastAnnouncement
 	h.autoAddress = p.AutoAddress
 	if err := p.AutoAddress.IsValid(); err != nil {
 		h.log.Printf("WARN: AutoAddress '%v' loaded from persist is invalid: %v", p.AutoAddress, err)
 		h.autoAddress = ""
 	}
+	h.deferredAnnounceAddr = p.DeferredAnnounce
 	h.financialMetrics = p.FinancialMetrics
+	h.mode = p.Mode
 	h.publicKey = p.PublicKey
 	h.revisionNumber = p.RevisionNumber
 	h.secretKey = p.SecretKey
@@ -182,6 +305,60 @@ func (h *Host) load() error {
 		h.settings.NetAddress = ""
 	}
 	h.unlockHash = p.UnlockHash
+	if h.settings.RemoteMetricsLimit == 0 {
+		h.settings.RemoteMetricsLimit = defaultRemoteMetricsLimit
+	}
+	if h.settings.ConnectionDeadline == 0 {
+		h.settings.ConnectionDeadline = defaultConnectionDeadline
+	}
+	if h.settings.ConnectionDeadlineJitter == 0 {
+		h.settings.ConnectionDeadlineJitter = defaultConnectionDeadlineJitter
+	}
+	if h.settings.MinAnnounceInterval == 0 {
+		h.settings.MinAnnounceInterval = defaultMinAnnounceInterval
+	}
+	if h.settings.MaxConnectionLifetime == 0 {
+		h.settings.MaxConnectionLifetime = defaultMaxConnectionLifetime
+	}
+	if h.settings.PortForwardTimeout == 0 {
+		h.settings.PortForwardTimeout = defaultPortForwardTimeout
+	}
+	if h.settings.DebugCaptureBytes == 0 {
+		h.settings.DebugCaptureBytes = defaultDebugCaptureBytes
+	}
+	if h.settings.DebugCaptureConnections == 0 {
+		h.settings.DebugCaptureConnections = defaultDebugCaptureConnections
+	}
+	if h.settings.DebugCaptureWindow == 0 {
+		h.settings.DebugCaptureWindow = defaultDebugCaptureWindow
+	}
+	// A capture that was enabled before the host was restarted gets a new
+	// window.
+	if h.settings.DebugCapture {
+		h.startCapture()
+	}
+	h.remoteMetrics.setLimit(int(h.settings.RemoteMetricsLimit))
+	if h.settings.ConnLogRate == 0 {
+		h.settings.ConnLogRate = defaultConnLogRate
+	}
+	h.connLogLimiter.setRate(h.settings.ConnLogRate)
+	h.blacklist, err = parseBlacklist(h.settings.Blacklist)
+	if err != nil {
+		h.log.Println("WARN: could not parse the blacklist, the blacklist is disabled:", err)
+	}
+	// A whitelist that can no longer be parsed leaves whitelist mode
+	// refusing every connection, rather than admitting addresses the
+	// operator meant to exclude.
+	h.whitelist, err = parseWhitelist(h.settings.WhitelistEnabled, h.settings.Whitelist)
+	if err != nil {
+		h.log.Println("WARN: could not parse the whitelist, all connections are refused in whitelist mode:", err)
+	}
+	// A certificate that can no longer be loaded should not prevent the host
+	// from starting, the host continues without TLS.
+	h.tlsConfig, err = loadTLSConfig(h.settings.TLSCertFile, h.settings.TLSKeyFile)
+	if err != nil {
+		h.log.Println("WARN: could not load TLS certificate, TLS is disabled:", err)
+	}
 
 	// Get the number of storage obligations by looking at the storage
 	// obligation database.
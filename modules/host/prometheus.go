@@ -0,0 +1,145 @@
+package host
+
+// prometheus.go renders the host's metrics in the Prometheus text exposition
+// format. The format is written by hand so that embedders which do not use
+// Prometheus are not forced to import the Prometheus client libraries.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// WritePrometheusMetrics writes the network, RPC, contract and storage
+// metrics of the host to 'w' in the Prometheus text exposition format,
+// suitable for serving from a scrape endpoint.
+func (h *Host) WritePrometheusMetrics(w io.Writer) error {
+	m := h.Metrics()
+	nm := m.Network
+	lockID := h.mu.RLock()
+	uptime := time.Since(h.startTime)
+	h.mu.RUnlock(lockID)
+
+	var buf bytes.Buffer
+	metric := func(name, typ, help string) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	metric("sia_host_rpc_calls_total", "counter", "Number of RPC calls made to the host, by RPC.")
+	calls := []struct {
+		rpc   string
+		count uint64
+	}{
+		{"authsettings", nm.AuthSettingsCalls},
+		{"download", nm.DownloadCalls},
+		{"formcontract", nm.FormContractCalls},
+		{"hostmetrics", nm.HostMetricsCalls},
+		{"ping", nm.PingCalls},
+		{"renew", nm.RenewCalls},
+		{"revise", nm.ReviseCalls},
+		{"settings", nm.SettingsCalls},
+		{"unrecognized", nm.UnrecognizedCalls},
+		{"updatesettings", nm.UpdateSettingsCalls},
+	}
+	for _, c := range calls {
+		fmt.Fprintf(&buf, "sia_host_rpc_calls_total{rpc=%q} %d\n", c.rpc, c.count)
+	}
+
+	metric("sia_host_rpc_errors_total", "counter", "Number of RPC calls made to the host that failed.")
+	fmt.Fprintf(&buf, "sia_host_rpc_errors_total %d\n", nm.ErrorCalls)
+	metric("sia_host_rpc_errors_by_category_total", "counter", "Number of RPC calls made to the host that failed, by the category of the failure.")
+	categories := []struct {
+		category string
+		count    uint64
+	}{
+		{"consensus", nm.ConsensusErrors},
+		{"decode", nm.DecodeErrors},
+		{"io", nm.IOErrors},
+		{"validation", nm.ValidationErrors},
+	}
+	for _, c := range categories {
+		fmt.Fprintf(&buf, "sia_host_rpc_errors_by_category_total{category=%q} %d\n", c.category, c.count)
+	}
+	metric("sia_host_rpc_errors_by_stage_total", "counter", "Number of connections that failed, by whether they failed before or after the RPC was identified.")
+	fmt.Fprintf(&buf, "sia_host_rpc_errors_by_stage_total{stage=%q} %d\n", "predispatch", nm.PreDispatchErrors)
+	fmt.Fprintf(&buf, "sia_host_rpc_errors_by_stage_total{stage=%q} %d\n", "handler", nm.HandlerErrors)
+	metric("sia_host_rpc_panics_total", "counter", "Number of RPC calls that panicked.")
+	fmt.Fprintf(&buf, "sia_host_rpc_panics_total %d\n", nm.PanicCalls)
+	metric("sia_host_rpc_timeouts_total", "counter", "Number of RPC calls that ran past their deadline.")
+	fmt.Fprintf(&buf, "sia_host_rpc_timeouts_total %d\n", nm.TimeoutCalls)
+	metric("sia_host_rpc_idle_timeouts_total", "counter", "Number of connections closed because no data flowed for the idle timeout.")
+	fmt.Fprintf(&buf, "sia_host_rpc_idle_timeouts_total %d\n", nm.IdleTimeoutCalls)
+	metric("sia_host_rpc_shutdown_interrupted_total", "counter", "Number of RPC calls interrupted by the host shutting down.")
+	fmt.Fprintf(&buf, "sia_host_rpc_shutdown_interrupted_total %d\n", nm.ShutdownClosedCalls)
+	metric("sia_host_rpc_retries_total", "counter", "Number of failed RPC calls that were retried, by whether a retry succeeded.")
+	fmt.Fprintf(&buf, "sia_host_rpc_retries_total{result=%q} %d\n", "recovered", nm.RecoveredCalls)
+	fmt.Fprintf(&buf, "sia_host_rpc_retries_total{result=%q} %d\n", "failed", nm.RetriedCalls-nm.RecoveredCalls)
+	metric("sia_host_rpc_lifetime_exceeded_total", "counter", "Number of connections closed because they reached the maximum connection lifetime.")
+	fmt.Fprintf(&buf, "sia_host_rpc_lifetime_exceeded_total %d\n", nm.LifetimeCloses)
+
+	metric("sia_host_announcements_total", "counter", "Number of announcements requested of the host, by result.")
+	fmt.Fprintf(&buf, "sia_host_announcements_total{result=%q} %d\n", "announced", nm.Announcements)
+	fmt.Fprintf(&buf, "sia_host_announcements_total{result=%q} %d\n", "suppressed", nm.SuppressedAnnouncements)
+
+	metric("sia_host_rejected_connections_total", "counter", "Number of connections refused by the host, by reason.")
+	rejects := []struct {
+		reason string
+		count  uint64
+	}{
+		{"admission", nm.AdmissionRejects},
+		{"blacklist", nm.BlacklistRejects},
+		{"busy", nm.BusyCalls},
+		{"capacity", nm.CapacityRejects},
+		{"challenge", nm.ChallengeRejects},
+		{"challengefailure", nm.ChallengeFailures},
+		{"deadline", nm.DeadlineFailures},
+		{"disabled", nm.DisabledCalls},
+		{"maintenance", nm.MaintenanceCalls},
+		{"notready", nm.NotReadyCalls},
+		{"standby", nm.StandbyCalls},
+		{"whitelist", nm.WhitelistRejects},
+	}
+	for _, r := range rejects {
+		fmt.Fprintf(&buf, "sia_host_rejected_connections_total{reason=%q} %d\n", r.reason, r.count)
+	}
+
+	metric("sia_host_download_throughput_bytes", "gauge", "Moving average of the throughput of downloads, in bytes per second.")
+	fmt.Fprintf(&buf, "sia_host_download_throughput_bytes %d\n", nm.DownloadThroughput)
+	metric("sia_host_active_connections", "gauge", "Number of connections currently being handled by the host.")
+	fmt.Fprintf(&buf, "sia_host_active_connections %d\n", atomic.LoadInt64(&h.atomicOpenConnections))
+	metric("sia_host_active_threads", "gauge", "Number of routines currently tracked by the host's thread group.")
+	fmt.Fprintf(&buf, "sia_host_active_threads %d\n", nm.ActiveThreads)
+	metric("sia_host_peak_connections", "gauge", "Highest number of connections handled at once since the host was started.")
+	fmt.Fprintf(&buf, "sia_host_peak_connections %d\n", atomic.LoadInt64(&h.atomicPeakConnections))
+	metric("sia_host_peer_versions_total", "counter", "Number of connections made to the host, by the protocol version advertised by the peer.")
+	versions := make([]string, 0, len(nm.PeerVersions))
+	for version := range nm.PeerVersions {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	for _, version := range versions {
+		fmt.Fprintf(&buf, "sia_host_peer_versions_total{version=%q} %d\n", version, nm.PeerVersions[version])
+	}
+	metric("sia_host_rpcs_in_use", "gauge", "Number of calls currently being served, by RPC.")
+	rpcs := make([]string, 0, len(nm.RPCsInUse))
+	for rpc := range nm.RPCsInUse {
+		rpcs = append(rpcs, rpc)
+	}
+	sort.Strings(rpcs)
+	for _, rpc := range rpcs {
+		fmt.Fprintf(&buf, "sia_host_rpcs_in_use{rpc=%q} %d\n", rpc, nm.RPCsInUse[rpc])
+	}
+	metric("sia_host_contracts", "gauge", "Number of contracts held by the host.")
+	fmt.Fprintf(&buf, "sia_host_contracts %d\n", m.ContractCount)
+	metric("sia_host_storage_bytes", "gauge", "Storage offered by the host, by whether it is committed to sectors or free.")
+	fmt.Fprintf(&buf, "sia_host_storage_bytes{state=%q} %d\n", "committed", m.CommittedStorage)
+	fmt.Fprintf(&buf, "sia_host_storage_bytes{state=%q} %d\n", "remaining", m.RemainingStorage)
+	metric("sia_host_uptime_seconds", "gauge", "Number of seconds since the host was started.")
+	fmt.Fprintf(&buf, "sia_host_uptime_seconds %d\n", int64(uptime.Seconds()))
+
+	_, err := buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,44 @@
+package host
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestWritePrometheusMetrics checks that the host metrics are rendered in the
+// Prometheus text format.
+func TestWritePrometheusMetrics(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestWritePrometheusMetrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	ht.host.atomicSettingsCalls = 3
+	ht.host.peerVersions.record("")
+	var buf bytes.Buffer
+	err = ht.host.WritePrometheusMetrics(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, line := range []string{
+		"# TYPE sia_host_rpc_calls_total counter",
+		`sia_host_rpc_calls_total{rpc="settings"} 3`,
+		`sia_host_rejected_connections_total{reason="whitelist"} 0`,
+		"sia_host_active_connections 0",
+		`sia_host_peer_versions_total{version="unknown"} 1`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("output is missing %q:\n%v", line, out)
+		}
+	}
+	if !strings.Contains(out, "sia_host_uptime_seconds ") {
+		t.Error("output is missing the uptime")
+	}
+}
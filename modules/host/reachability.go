@@ -0,0 +1,150 @@
+package host
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// reachabilityUnknown is the reason reported until the first
+	// reachability check has completed.
+	reachabilityUnknown = "reachability has not been checked yet"
+)
+
+var (
+	// errPingNonceMismatch is returned if the host does not echo the nonce
+	// of a self-dial ping, meaning that some other node answered.
+	errPingNonceMismatch = errors.New("ping response did not match the nonce that was sent")
+)
+
+// managedSelfDial pings the host at the provided address, confirming that the
+// address leads back to a host that responds to RPCs.
+func (h *Host) managedSelfDial(addr modules.NetAddress) error {
+	lockID := h.mu.RLock()
+	dialer := &net.Dialer{Timeout: reachabilityDialTimeout, Resolver: h.resolver}
+	h.mu.RUnlock(lockID)
+	conn, err := dialer.Dial("tcp", string(addr))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(reachabilityDialTimeout))
+
+	var nonce [8]byte
+	_, err = h.dependencies.randRead(nonce[:])
+	if err != nil {
+		return err
+	}
+	err = encoding.WriteObject(conn, modules.RPCPing)
+	if err != nil {
+		return err
+	}
+	err = encoding.WriteObject(conn, nonce)
+	if err != nil {
+		return err
+	}
+	var resp modules.HostPingResponse
+	err = encoding.ReadObject(conn, &resp, 1024)
+	if err != nil {
+		return err
+	}
+	if resp.Nonce != nonce {
+		return errPingNonceMismatch
+	}
+	return nil
+}
+
+// managedUpdateReachability combines the results of port forwarding, hostname
+// discovery, and the optional self-dial check into a single judgement of
+// whether the host is reachable. 'hostnameErr' is the result of the most
+// recent hostname discovery. If the host is deferring its announcement, the
+// announcement is made once reachability has been confirmed.
+func (h *Host) managedUpdateReachability(hostnameErr error) {
+	lockID := h.mu.RLock()
+	forwardErr := h.portForwardErr
+	configured := h.settings.NetAddress
+	deferAnnounce := h.settings.AnnounceWhenReachable
+	selfDial := h.settings.SelfDialCheck || deferAnnounce
+	addr := h.autoAddress
+	if configured != "" {
+		addr = configured
+	}
+	h.mu.RUnlock(lockID)
+
+	var reachable, confirmed bool
+	var reason string
+	if hostnameErr != nil {
+		reason = "external address discovery failed: " + hostnameErr.Error()
+	} else if addr == "" {
+		reason = "no external address is known"
+	} else if selfDial {
+		err := h.managedSelfDial(addr)
+		if err != nil {
+			reason = "self-dial of " + string(addr) + " failed: " + err.Error()
+		} else {
+			reachable = true
+			confirmed = forwardErr == nil
+			reason = "self-dial of " + string(addr) + " succeeded"
+		}
+	} else if configured != "" {
+		reachable = true
+		reason = "using the configured net address " + string(addr)
+	} else if forwardErr != nil {
+		reason = "port forwarding failed: " + forwardErr.Error()
+	} else {
+		reachable = true
+		reason = "port forwarded and external address " + string(addr) + " discovered"
+	}
+
+	lockID = h.mu.Lock()
+	changed := reachable != h.reachable || reason != h.reachableReason
+	h.reachable = reachable
+	h.reachableReason = reason
+	wasConfirmed := h.reachabilityConfirmed
+	h.reachabilityConfirmed = confirmed
+	if deferAnnounce {
+		// If the host has lost reachability, announce again once it is
+		// regained.
+		if wasConfirmed && !confirmed {
+			h.announcePending = true
+		}
+		if confirmed && h.announcePending {
+			err := h.announce(addr)
+			if err == errAnnounceNotAccepting {
+				// The announcement is now waiting for the host to accept
+				// contracts instead.
+				h.announcePending = false
+			} else if err != nil {
+				h.log.Println("WARN: unable to make deferred announcement:", err)
+			} else {
+				h.announcePending = false
+			}
+		}
+	}
+	h.mu.Unlock(lockID)
+	if changed {
+		h.log.Println("INFO: host reachability updated:", reason)
+	}
+}
+
+// AnnouncementPending returns true if the host is waiting to confirm that it
+// is reachable, or to begin accepting contracts, before making an
+// announcement.
+func (h *Host) AnnouncementPending() bool {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	return h.announcePending || h.deferredAnnounceAddr != ""
+}
+
+// Reachable returns whether the host believes that it can be reached by
+// renters, along with the reason for that belief. Until the first check has
+// completed, the host reports that it is not reachable.
+func (h *Host) Reachable() (bool, string) {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	return h.reachable, h.reachableReason
+}
@@ -0,0 +1,135 @@
+package host
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestReachable checks that the host reports its reachability once the first
+// discovery cycle has completed, and that the reason reflects the outcome of
+// each check.
+func TestReachable(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestReachable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	// Port forwarding and hostname discovery always succeed in testing
+	// builds, so the host should soon consider itself reachable.
+	for i := 0; i < 50; i++ {
+		if _, reason := ht.host.Reachable(); reason != reachabilityUnknown {
+			break
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	reachable, reason := ht.host.Reachable()
+	if !reachable {
+		t.Fatal("host should be reachable:", reason)
+	}
+
+	// A failed hostname discovery should make the host unreachable.
+	ht.host.managedUpdateReachability(errors.New("no route"))
+	reachable, reason = ht.host.Reachable()
+	if reachable || !strings.Contains(reason, "no route") {
+		t.Error("failed discovery not reflected in reachability:", reachable, reason)
+	}
+
+	// Enable the self-dial check, which should succeed against the host's
+	// localhost auto address.
+	settings := ht.host.InternalSettings()
+	settings.SelfDialCheck = true
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht.host.managedUpdateReachability(nil)
+	reachable, reason = ht.host.Reachable()
+	if !reachable || !strings.Contains(reason, "self-dial") {
+		t.Error("self-dial check not reflected in reachability:", reachable, reason)
+	}
+
+	// A self-dial to an address that nothing is listening on should fail.
+	lockID := ht.host.mu.Lock()
+	ht.host.autoAddress = "localhost:1"
+	ht.host.mu.Unlock(lockID)
+	ht.host.managedUpdateReachability(nil)
+	if reachable, reason = ht.host.Reachable(); reachable {
+		t.Error("host should not be reachable after a failed self-dial:", reason)
+	}
+}
+
+// TestAnnounceWhenReachable checks that a deferred announcement is made once
+// the host confirms that it is reachable, and made again after reachability
+// is lost and regained.
+func TestAnnounceWhenReachable(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := newHostTester("TestAnnounceWhenReachable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	settings := ht.host.InternalSettings()
+	settings.AnnounceWhenReachable = true
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// setAutoAddress changes the address that the self-dial check uses.
+	setAutoAddress := func(addr string) {
+		lockID := ht.host.mu.Lock()
+		ht.host.autoAddress = modules.NetAddress(addr)
+		ht.host.mu.Unlock(lockID)
+	}
+	goodAddr := string(ht.host.NetAddress())
+
+	// Simulate a deferred announcement while the host is unreachable.
+	lockID := ht.host.mu.Lock()
+	ht.host.announcePending = true
+	ht.host.announced = false
+	ht.host.mu.Unlock(lockID)
+	setAutoAddress("localhost:1")
+	ht.host.managedUpdateReachability(nil)
+	if !ht.host.AnnouncementPending() {
+		t.Fatal("announcement was made while the host is unreachable")
+	}
+
+	// Once the host is reachable, the announcement should be made.
+	setAutoAddress(goodAddr)
+	ht.host.managedUpdateReachability(nil)
+	if ht.host.AnnouncementPending() {
+		t.Fatal("announcement is still pending after reachability was confirmed")
+	}
+	lockID = ht.host.mu.RLock()
+	announced := ht.host.announced
+	ht.host.mu.RUnlock(lockID)
+	if !announced {
+		t.Fatal("host did not announce after reachability was confirmed")
+	}
+
+	// Losing reachability should queue another announcement, which is made
+	// when reachability is regained.
+	setAutoAddress("localhost:1")
+	ht.host.managedUpdateReachability(nil)
+	if !ht.host.AnnouncementPending() {
+		t.Fatal("losing reachability did not queue an announcement")
+	}
+	setAutoAddress(goodAddr)
+	ht.host.managedUpdateReachability(nil)
+	if ht.host.AnnouncementPending() {
+		t.Error("announcement was not made after reachability was regained")
+	}
+}
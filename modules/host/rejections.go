@@ -0,0 +1,81 @@
+package host
+
+// rejections.go keeps a record of the most recent connections and calls that
+// the host refused, along with the reason for each refusal, so that an
+// operator can find out why a particular renter is unable to use the host.
+// The record is bounded, and the oldest refusals are overwritten first.
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// rejectionLogLen is the number of refusals that are kept.
+	rejectionLogLen = 100
+)
+
+// rejectionLog is a ring buffer of the most recent refusals.
+type rejectionLog struct {
+	entries []modules.HostRejection
+	next    int // Index of the entry that is overwritten next.
+	mu      sync.Mutex
+}
+
+// newRejectionLog returns an empty rejectionLog that holds at most 'n'
+// refusals.
+func newRejectionLog(n int) *rejectionLog {
+	return &rejectionLog{
+		entries: make([]modules.HostRejection, 0, n),
+	}
+}
+
+// record adds a refusal to the log, overwriting the oldest refusal if the log
+// is full.
+func (rl *rejectionLog) record(r modules.HostRejection) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if len(rl.entries) < cap(rl.entries) {
+		rl.entries = append(rl.entries, r)
+		return
+	}
+	rl.entries[rl.next] = r
+	rl.next = (rl.next + 1) % len(rl.entries)
+}
+
+// recent returns the refusals in the log, most recent first.
+func (rl *rejectionLog) recent() []modules.HostRejection {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	recent := make([]modules.HostRejection, 0, len(rl.entries))
+	for i := 0; i < len(rl.entries); i++ {
+		j := (rl.next - 1 - i + 2*len(rl.entries)) % len(rl.entries)
+		recent = append(recent, rl.entries[j])
+	}
+	return recent
+}
+
+// recordRejection records that the host refused a connection from 'remote'.
+// 'id' is the RPC that was refused, and is empty if the connection was
+// refused before the RPC was read.
+func (h *Host) recordRejection(remote net.Addr, id types.Specifier, reason error) {
+	r := modules.HostRejection{
+		Address: remote.String(),
+		Reason:  reason.Error(),
+		Time:    time.Now(),
+	}
+	if id != (types.Specifier{}) {
+		r.RPC = rpcName(id)
+	}
+	h.rejections.record(r)
+}
+
+// RecentRejections returns the most recent connections and calls that the
+// host refused, most recent first.
+func (h *Host) RecentRejections() []modules.HostRejection {
+	return h.rejections.recent()
+}
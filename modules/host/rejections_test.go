@@ -0,0 +1,63 @@
+package host
+
+import (
+	"net"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestRejectionLog checks that the rejection log returns the most recent
+// refusals first and discards the oldest refusals once it is full.
+func TestRejectionLog(t *testing.T) {
+	rl := newRejectionLog(3)
+	if len(rl.recent()) != 0 {
+		t.Fatal("empty log returned refusals")
+	}
+	for _, reason := range []string{"a", "b", "c", "d", "e"} {
+		rl.record(modules.HostRejection{Reason: reason})
+	}
+	recent := rl.recent()
+	if len(recent) != 3 || recent[0].Reason != "e" || recent[1].Reason != "d" || recent[2].Reason != "c" {
+		t.Fatal("wrong refusals:", recent)
+	}
+}
+
+// TestRecentRejections checks that the host records the refusal of an RPC
+// along with its reason.
+func TestRecentRejections(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestRecentRejections")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	if err := ht.host.SetMode(modules.HostModeMaintenance); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := encoding.WriteObject(conn, modules.RPCFormContract); err != nil {
+		t.Fatal(err)
+	}
+	if err := modules.ReadNegotiationAcceptance(conn); err == nil {
+		t.Fatal("expected the RPC to be refused")
+	}
+
+	rejections := ht.host.RecentRejections()
+	if len(rejections) != 1 {
+		t.Fatal("wrong number of refusals:", rejections)
+	}
+	r := rejections[0]
+	if r.RPC != "FormContract" || r.Reason != errHostMaintenance.Error() || r.Address != conn.LocalAddr().String() || r.Time.IsZero() {
+		t.Error("wrong refusal:", r)
+	}
+}
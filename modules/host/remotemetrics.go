@@ -0,0 +1,115 @@
+package host
+
+// remotemetrics.go tracks the number of calls and errors made by each remote
+// address that connects to the host. The number of addresses tracked is
+// bounded, and the least recently seen address is evicted to make room for
+// new addresses.
+
+import (
+	"container/list"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+type (
+	// remoteMetrics is an LRU-bounded set of per-address RPC metrics.
+	remoteMetrics struct {
+		limit   int
+		entries map[string]*list.Element
+		order   *list.List // Front is the most recently seen address.
+		mu      sync.Mutex
+	}
+
+	// remoteMetricsByCalls sorts a set of remote metrics by the number of
+	// calls, busiest first.
+	remoteMetricsByCalls []modules.HostRemoteMetrics
+)
+
+func (rm remoteMetricsByCalls) Len() int           { return len(rm) }
+func (rm remoteMetricsByCalls) Less(i, j int) bool { return rm[i].Calls > rm[j].Calls }
+func (rm remoteMetricsByCalls) Swap(i, j int)      { rm[i], rm[j] = rm[j], rm[i] }
+
+// newRemoteMetrics returns a remoteMetrics that will track at most 'limit'
+// addresses.
+func newRemoteMetrics(limit int) *remoteMetrics {
+	return &remoteMetrics{
+		limit:   limit,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// remoteHost returns the host portion of the remote address of a connection,
+// so that multiple connections from the same machine are tracked together.
+func remoteHost(conn net.Conn) string {
+	return addrHost(conn.RemoteAddr())
+}
+
+// evict removes the least recently seen addresses until the number of tracked
+// addresses is within the limit.
+func (rm *remoteMetrics) evict() {
+	for rm.order.Len() > rm.limit {
+		oldest := rm.order.Back()
+		rm.order.Remove(oldest)
+		delete(rm.entries, oldest.Value.(*modules.HostRemoteMetrics).Address)
+	}
+}
+
+// record counts a call from the provided address, and counts an error as well
+// if the call failed.
+func (rm *remoteMetrics) record(addr string, failed bool) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	elem, exists := rm.entries[addr]
+	if exists {
+		rm.order.MoveToFront(elem)
+	} else {
+		elem = rm.order.PushFront(&modules.HostRemoteMetrics{Address: addr})
+		rm.entries[addr] = elem
+		rm.evict()
+	}
+	metrics := elem.Value.(*modules.HostRemoteMetrics)
+	metrics.Calls++
+	if failed {
+		metrics.Errors++
+	}
+}
+
+// setLimit changes the maximum number of addresses that are tracked, evicting
+// the least recently seen addresses if the limit has been reduced.
+func (rm *remoteMetrics) setLimit(limit int) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.limit = limit
+	rm.evict()
+}
+
+// top returns the metrics of the 'n' addresses that have made the most calls.
+// A negative 'n' is treated as 0.
+func (rm *remoteMetrics) top(n int) []modules.HostRemoteMetrics {
+	rm.mu.Lock()
+	all := make([]modules.HostRemoteMetrics, 0, rm.order.Len())
+	for elem := rm.order.Front(); elem != nil; elem = elem.Next() {
+		all = append(all, *elem.Value.(*modules.HostRemoteMetrics))
+	}
+	rm.mu.Unlock()
+
+	sort.Stable(remoteMetricsByCalls(all))
+	if n < 0 {
+		n = 0
+	}
+	if n < len(all) {
+		all = all[:n]
+	}
+	return all
+}
+
+// TopTalkers returns the metrics of the 'n' remote addresses that have made
+// the most RPC calls to the host. Only recently seen addresses are tracked.
+func (h *Host) TopTalkers(n int) []modules.HostRemoteMetrics {
+	return h.remoteMetrics.top(n)
+}
@@ -0,0 +1,58 @@
+package host
+
+import (
+	"strconv"
+	"testing"
+)
+
+// TestRemoteMetrics checks that the remote metrics are counted per address,
+// that the busiest addresses are reported first, and that the least recently
+// seen addresses are evicted once the limit is reached.
+func TestRemoteMetrics(t *testing.T) {
+	rm := newRemoteMetrics(3)
+	for i := 0; i < 3; i++ {
+		rm.record("a", false)
+	}
+	rm.record("b", true)
+	rm.record("b", false)
+	rm.record("c", false)
+
+	top := rm.top(2)
+	if len(top) != 2 {
+		t.Fatal("expected 2 addresses, got", len(top))
+	}
+	if top[0].Address != "a" || top[0].Calls != 3 || top[0].Errors != 0 {
+		t.Error("unexpected busiest address:", top[0])
+	}
+	if top[1].Address != "b" || top[1].Calls != 2 || top[1].Errors != 1 {
+		t.Error("unexpected second busiest address:", top[1])
+	}
+
+	// Adding a fourth address should evict "a", which was seen least
+	// recently.
+	rm.record("d", false)
+	for _, m := range rm.top(10) {
+		if m.Address == "a" {
+			t.Error("least recently seen address was not evicted")
+		}
+	}
+
+	// Reducing the limit should evict addresses immediately.
+	rm.setLimit(1)
+	top = rm.top(10)
+	if len(top) != 1 || top[0].Address != "d" {
+		t.Error("unexpected addresses after reducing the limit:", top)
+	}
+
+	// The number of tracked addresses should never exceed the limit.
+	rm.setLimit(50)
+	for i := 0; i < 100; i++ {
+		rm.record(strconv.Itoa(i), false)
+	}
+	if len(rm.top(1000)) != 50 {
+		t.Error("remote metrics grew beyond the limit")
+	}
+	if len(rm.top(-1)) != 0 {
+		t.Error("a negative count should return no metrics")
+	}
+}
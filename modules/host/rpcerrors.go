@@ -0,0 +1,147 @@
+package host
+
+// rpcerrors.go classifies the errors returned by the RPC handlers. Handlers
+// wrap the errors that they return with the category of the failure, so that
+// threadedHandleConn can count failed calls by category instead of in a single
+// undifferentiated counter. The wrapped errors keep the message of the
+// original error, which is what gets sent to the renter in rejections.
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// The categories of RPC errors.
+const (
+	errCategoryUnknown rpcErrorCategory = iota
+	errCategoryDecode
+	errCategoryValidation
+	errCategoryConsensus
+	errCategoryIO
+)
+
+// rpcErrorCategory is the category of an error returned by an RPC handler.
+type rpcErrorCategory int
+
+// String implements the fmt.Stringer interface.
+func (c rpcErrorCategory) String() string {
+	switch c {
+	case errCategoryDecode:
+		return "decode"
+	case errCategoryValidation:
+		return "validation"
+	case errCategoryConsensus:
+		return "consensus"
+	case errCategoryIO:
+		return "I/O"
+	default:
+		return "unknown"
+	}
+}
+
+// rpcError is an error returned by an RPC handler, tagged with the category
+// of the failure.
+type rpcError struct {
+	error
+	category rpcErrorCategory
+}
+
+// classify tags an error with a category. Errors that have already been
+// tagged keep their original category, so that a consensus error which
+// causes a rejection is not reclassified as a validation error.
+func classify(err error, category rpcErrorCategory) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(rpcError); ok {
+		return err
+	}
+	return rpcError{error: err, category: category}
+}
+
+// isIOError returns true if the error was caused by the connection rather
+// than by the data sent over it.
+func isIOError(err error) bool {
+	_, ok := err.(net.Error)
+	return ok || err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// decodeErr tags an error encountered while reading an object from the
+// caller. Failures of the connection are tagged as I/O errors, everything
+// else means that the caller sent something that could not be decoded.
+func decodeErr(err error) error {
+	if isIOError(err) {
+		return classify(err, errCategoryIO)
+	}
+	return classify(err, errCategoryDecode)
+}
+
+// negotiationErr tags an error returned by modules.ReadNegotiationAcceptance.
+// A stop response is not a failure and is returned untagged, so that it can
+// still be compared against modules.ErrStopResponse. A rejection means that
+// the caller found the terms of the host unacceptable.
+func negotiationErr(err error) error {
+	if err == modules.ErrStopResponse {
+		return err
+	}
+	if isIOError(err) {
+		return classify(err, errCategoryIO)
+	}
+	return classify(err, errCategoryValidation)
+}
+
+// validationErr tags an error caused by a request that the host found to be
+// unacceptable.
+func validationErr(err error) error {
+	return classify(err, errCategoryValidation)
+}
+
+// consensusErr tags an error returned by the consensus set or transaction
+// pool.
+func consensusErr(err error) error {
+	return classify(err, errCategoryConsensus)
+}
+
+// ioErr tags an error encountered while writing to the caller.
+func ioErr(err error) error {
+	return classify(err, errCategoryIO)
+}
+
+// errorCategory returns the category of an error returned by an RPC handler.
+// Untagged errors from the connection are treated as I/O errors.
+func errorCategory(err error) rpcErrorCategory {
+	if re, ok := err.(rpcError); ok {
+		return re.category
+	}
+	if isIOError(err) {
+		return errCategoryIO
+	}
+	return errCategoryUnknown
+}
+
+// errorCause returns the error that was tagged with a category, or the error
+// itself if it was not tagged.
+func errorCause(err error) error {
+	if re, ok := err.(rpcError); ok {
+		return re.error
+	}
+	return err
+}
+
+// recordErrorCategory increments the counter of the category of an error
+// returned by an RPC handler.
+func (h *Host) recordErrorCategory(err error) {
+	switch errorCategory(err) {
+	case errCategoryDecode:
+		atomic.AddUint64(&h.atomicDecodeErrors, 1)
+	case errCategoryValidation:
+		atomic.AddUint64(&h.atomicValidationErrors, 1)
+	case errCategoryConsensus:
+		atomic.AddUint64(&h.atomicConsensusErrors, 1)
+	case errCategoryIO:
+		atomic.AddUint64(&h.atomicIOErrors, 1)
+	}
+}
@@ -0,0 +1,138 @@
+package host
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestErrorCategory checks the classification of RPC errors.
+func TestErrorCategory(t *testing.T) {
+	errBad := errors.New("bad")
+	tests := []struct {
+		err      error
+		category rpcErrorCategory
+	}{
+		{errBad, errCategoryUnknown},
+		{io.EOF, errCategoryIO},
+		{decodeErr(errBad), errCategoryDecode},
+		{decodeErr(io.ErrUnexpectedEOF), errCategoryIO},
+		{negotiationErr(errBad), errCategoryValidation},
+		{validationErr(errBad), errCategoryValidation},
+		{validationErr(consensusErr(errBad)), errCategoryConsensus},
+		{ioErr(errBad), errCategoryIO},
+	}
+	for i, test := range tests {
+		if c := errorCategory(test.err); c != test.category {
+			t.Errorf("%v: expected %v, got %v", i, test.category, c)
+		}
+	}
+
+	if decodeErr(nil) != nil || ioErr(nil) != nil {
+		t.Error("nil errors should not be tagged")
+	}
+	if negotiationErr(modules.ErrStopResponse) != modules.ErrStopResponse {
+		t.Error("stop response should not be tagged")
+	}
+	if validationErr(errBad).Error() != errBad.Error() {
+		t.Error("tagging an error changed its message")
+	}
+	if errorCause(ioErr(errBad)) != errBad {
+		t.Error("wrong cause of a tagged error")
+	}
+}
+
+// TestDecodeErrorMetrics checks that a call with a malformed payload is
+// counted as a decode error.
+func TestDecodeErrorMetrics(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestDecodeErrorMetrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	err = encoding.WriteObject(conn, modules.RPCPing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Send a nonce that is longer than the host will read.
+	err = encoding.WriteObject(conn, make([]byte, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100 && ht.host.NetworkMetrics().ErrorCalls == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	nm := ht.host.NetworkMetrics()
+	if nm.ErrorCalls != 1 || nm.DecodeErrors != 1 {
+		t.Error("malformed call was not counted as a decode error:", nm.ErrorCalls, nm.DecodeErrors)
+	}
+	if nm.IOErrors != 0 || nm.ValidationErrors != 0 || nm.ConsensusErrors != 0 {
+		t.Error("malformed call was counted in the wrong category")
+	}
+}
+
+// TestErrorStageMetrics checks that connections that fail before the RPC is
+// identified are counted apart from the failures of RPC handlers.
+func TestErrorStageMetrics(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestErrorStageMetrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	// Send a truncated specifier.
+	conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte{1, 2, 3})
+	conn.Close()
+	for i := 0; i < 100 && ht.host.NetworkMetrics().PreDispatchErrors == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	nm := ht.host.NetworkMetrics()
+	if nm.PreDispatchErrors != 1 || nm.HandlerErrors != 0 {
+		t.Fatal("truncated specifier was not counted as a pre-dispatch error:", nm.PreDispatchErrors, nm.HandlerErrors)
+	}
+
+	// Send a ping with a malformed nonce.
+	conn, err = net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	err = encoding.WriteObject(conn, modules.RPCPing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = encoding.WriteObject(conn, make([]byte, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100 && ht.host.NetworkMetrics().HandlerErrors == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	nm = ht.host.NetworkMetrics()
+	if nm.PreDispatchErrors != 1 || nm.HandlerErrors != 1 {
+		t.Error("malformed ping was not counted as a handler error:", nm.PreDispatchErrors, nm.HandlerErrors)
+	}
+}
@@ -0,0 +1,266 @@
+package host
+
+// rpclimits.go enforces the per-RPC concurrency and bandwidth limits of the
+// host. The limits let an operator keep expensive RPCs, such as downloads,
+// from crowding out the lightweight ones, such as settings and ping, when the
+// host is under load.
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	// errInvalidRPCConcurrencyLimit is returned if an RPC concurrency limit
+	// is zero.
+	errInvalidRPCConcurrencyLimit = errors.New("RPC concurrency limits must be positive")
+
+	// errUnknownRPCConcurrencyLimit is returned if an RPC concurrency limit
+	// is provided for an RPC that the host does not serve.
+	errUnknownRPCConcurrencyLimit = errors.New("RPC concurrency limit provided for an unknown RPC")
+
+	// errInvalidRPCBandwidthLimit is returned if an RPC bandwidth limit is
+	// zero.
+	errInvalidRPCBandwidthLimit = errors.New("RPC bandwidth limits must be positive")
+
+	// errUnknownRPCBandwidthLimit is returned if an RPC bandwidth limit is
+	// provided for an RPC that the host does not serve.
+	errUnknownRPCBandwidthLimit = errors.New("RPC bandwidth limit provided for an unknown RPC")
+)
+
+type (
+	// bandwidthLimiter is a token bucket shared by all calls of one RPC. The
+	// bucket holds up to one second of traffic, and may go into debt, in
+	// which case the callers sleep until the debt has been paid off.
+	bandwidthLimiter struct {
+		rate   uint64 // bytes per second
+		tokens float64
+		last   time.Time
+		mu     sync.Mutex
+	}
+
+	// rpcBandwidth holds the bandwidth limiters of the RPCs that have a
+	// bandwidth limit.
+	rpcBandwidth struct {
+		limiters map[types.Specifier]*bandwidthLimiter
+		mu       sync.Mutex
+	}
+
+	// rateLimitedConn wraps a connection, limiting the combined rate at which
+	// data is read and written to that of a bandwidth limiter.
+	rateLimitedConn struct {
+		net.Conn
+		bl *bandwidthLimiter
+	}
+)
+
+// rpcsInUse counts the calls of each RPC that are currently being served.
+type rpcsInUse struct {
+	counts map[types.Specifier]uint64
+	mu     sync.Mutex
+}
+
+// newRPCsInUse returns an empty set of in-use counts.
+func newRPCsInUse() *rpcsInUse {
+	return &rpcsInUse{
+		counts: make(map[types.Specifier]uint64),
+	}
+}
+
+// acquire counts a call of the provided RPC as in use, unless 'limit' calls
+// are already in use, in which case false is returned. A limit of 0 means
+// that the RPC is not limited.
+func (ru *rpcsInUse) acquire(id types.Specifier, limit uint64) bool {
+	ru.mu.Lock()
+	defer ru.mu.Unlock()
+	if limit != 0 && ru.counts[id] >= limit {
+		return false
+	}
+	ru.counts[id]++
+	return true
+}
+
+// release counts a call of the provided RPC as no longer in use.
+func (ru *rpcsInUse) release(id types.Specifier) {
+	ru.mu.Lock()
+	defer ru.mu.Unlock()
+	if ru.counts[id] <= 1 {
+		delete(ru.counts, id)
+		return
+	}
+	ru.counts[id]--
+}
+
+// snapshot returns the in-use counts keyed by the name of the RPC.
+func (ru *rpcsInUse) snapshot() map[string]uint64 {
+	ru.mu.Lock()
+	defer ru.mu.Unlock()
+	counts := make(map[string]uint64, len(ru.counts))
+	for id, n := range ru.counts {
+		counts[rpcName(id)] = n
+	}
+	return counts
+}
+
+// knownRPCName returns whether 'name' is the name of an RPC that the host
+// serves.
+func knownRPCName(name string) bool {
+	for id := range defaultRPCTimeouts {
+		if rpcName(id) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRPCConcurrencyLimits returns an error if any of the provided RPC
+// concurrency limits names an unknown RPC or is zero.
+func checkRPCConcurrencyLimits(limits map[string]uint64) error {
+	for name, limit := range limits {
+		if !knownRPCName(name) {
+			return errUnknownRPCConcurrencyLimit
+		}
+		if limit == 0 {
+			return errInvalidRPCConcurrencyLimit
+		}
+	}
+	return nil
+}
+
+// checkRPCBandwidthLimits returns an error if any of the provided RPC
+// bandwidth limits names an unknown RPC or is zero.
+func checkRPCBandwidthLimits(limits map[string]uint64) error {
+	for name, limit := range limits {
+		if !knownRPCName(name) {
+			return errUnknownRPCBandwidthLimit
+		}
+		if limit == 0 {
+			return errInvalidRPCBandwidthLimit
+		}
+	}
+	return nil
+}
+
+// newBandwidthLimiter returns a bandwidth limiter with a full bucket.
+func newBandwidthLimiter(rate uint64) *bandwidthLimiter {
+	return &bandwidthLimiter{
+		rate:   rate,
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// setRate changes the rate of the limiter.
+func (bl *bandwidthLimiter) setRate(rate uint64) {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	bl.rate = rate
+}
+
+// chunk returns the largest number of bytes, up to 'n', that should be
+// transferred at once, which is the size of a full bucket.
+func (bl *bandwidthLimiter) chunk(n int) int {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	if uint64(n) > bl.rate {
+		return int(bl.rate)
+	}
+	return n
+}
+
+// reserve takes 'n' bytes from the bucket, returning how long the caller must
+// wait until the bucket is out of debt.
+func (bl *bandwidthLimiter) reserve(n int) time.Duration {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	now := time.Now()
+	bl.tokens += now.Sub(bl.last).Seconds() * float64(bl.rate)
+	if bl.tokens > float64(bl.rate) {
+		bl.tokens = float64(bl.rate)
+	}
+	bl.last = now
+	bl.tokens -= float64(n)
+	if bl.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-bl.tokens / float64(bl.rate) * float64(time.Second))
+}
+
+// newRPCBandwidth returns an empty set of bandwidth limiters.
+func newRPCBandwidth() *rpcBandwidth {
+	return &rpcBandwidth{
+		limiters: make(map[types.Specifier]*bandwidthLimiter),
+	}
+}
+
+// limiter returns the bandwidth limiter of the provided RPC, updated to
+// 'rate', or nil if 'rate' is 0, meaning that the RPC is not limited.
+func (rb *rpcBandwidth) limiter(id types.Specifier, rate uint64) *bandwidthLimiter {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if rate == 0 {
+		delete(rb.limiters, id)
+		return nil
+	}
+	bl, exists := rb.limiters[id]
+	if !exists {
+		bl = newBandwidthLimiter(rate)
+		rb.limiters[id] = bl
+		return bl
+	}
+	bl.setRate(rate)
+	return bl
+}
+
+// Read implements the io.Reader interface, waiting after the read until the
+// bytes read fit within the bandwidth limit.
+func (rc *rateLimitedConn) Read(b []byte) (int, error) {
+	n, err := rc.Conn.Read(b[:rc.bl.chunk(len(b))])
+	time.Sleep(rc.bl.reserve(n))
+	return n, err
+}
+
+// Write implements the io.Writer interface, writing 'b' in chunks and waiting
+// before each chunk until it fits within the bandwidth limit.
+func (rc *rateLimitedConn) Write(b []byte) (int, error) {
+	var written int
+	for written < len(b) {
+		chunk := rc.bl.chunk(len(b) - written)
+		time.Sleep(rc.bl.reserve(chunk))
+		n, err := rc.Conn.Write(b[written : written+chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// managedAcquireRPC counts a call of the provided RPC as in use, returning
+// false if the host is already serving as many calls of the RPC as the
+// settings allow. Every successful acquisition must be followed by a call to
+// h.rpcsInUse.release.
+func (h *Host) managedAcquireRPC(id types.Specifier) bool {
+	lockID := h.mu.RLock()
+	limit := h.settings.RPCConcurrencyLimits[rpcName(id)]
+	h.mu.RUnlock(lockID)
+	return h.rpcsInUse.acquire(id, limit)
+}
+
+// managedLimitBandwidth wraps the connection of a call of the provided RPC so
+// that the calls of the RPC together stay within the bandwidth limit in the
+// settings. The connection is returned unchanged if the RPC has no limit.
+func (h *Host) managedLimitBandwidth(id types.Specifier, conn net.Conn) net.Conn {
+	lockID := h.mu.RLock()
+	rate := h.settings.RPCBandwidthLimits[rpcName(id)]
+	h.mu.RUnlock(lockID)
+	bl := h.rpcBandwidth.limiter(id, rate)
+	if bl == nil {
+		return conn
+	}
+	return &rateLimitedConn{Conn: conn, bl: bl}
+}
@@ -0,0 +1,189 @@
+package host
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestRPCsInUse checks that calls are refused once the limit of an RPC has
+// been reached, and are accepted again once a call is released.
+func TestRPCsInUse(t *testing.T) {
+	ru := newRPCsInUse()
+	if !ru.acquire(modules.RPCDownload, 2) || !ru.acquire(modules.RPCDownload, 2) {
+		t.Fatal("calls within the limit were refused")
+	}
+	if ru.acquire(modules.RPCDownload, 2) {
+		t.Fatal("call beyond the limit was accepted")
+	}
+	if !ru.acquire(modules.RPCSettings, 2) {
+		t.Fatal("limit of one RPC was applied to another")
+	}
+	if counts := ru.snapshot(); counts["Download"] != 2 || counts["Settings"] != 1 {
+		t.Fatal("wrong in-use counts:", counts)
+	}
+
+	ru.release(modules.RPCDownload)
+	if !ru.acquire(modules.RPCDownload, 2) {
+		t.Fatal("call was refused after a call was released")
+	}
+	ru.release(modules.RPCSettings)
+	if _, exists := ru.snapshot()["Settings"]; exists {
+		t.Fatal("RPC with no calls in use was reported")
+	}
+
+	// A limit of 0 does not limit the RPC.
+	for i := 0; i < 10; i++ {
+		if !ru.acquire(modules.RPCPing, 0) {
+			t.Fatal("unlimited RPC was refused")
+		}
+	}
+}
+
+// TestRPCConcurrencyLimit checks that the host refuses calls of an RPC that
+// is at its concurrency limit, and that invalid limits are rejected.
+func TestRPCConcurrencyLimit(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestRPCConcurrencyLimit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	settings := ht.host.InternalSettings()
+	settings.RPCConcurrencyLimits = map[string]uint64{"Unknown": 1}
+	if err := ht.host.SetInternalSettings(settings); err == nil {
+		t.Fatal("limit for an unknown RPC was accepted")
+	}
+	settings.RPCConcurrencyLimits = map[string]uint64{"Settings": 0}
+	if err := ht.host.SetInternalSettings(settings); err == nil {
+		t.Fatal("zero limit was accepted")
+	}
+	settings.RPCConcurrencyLimits = map[string]uint64{"Settings": 1}
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	// Occupy the only settings slot, the host should respond with a
+	// rejection.
+	if !ht.host.managedAcquireRPC(modules.RPCSettings) {
+		t.Fatal("could not acquire the settings RPC")
+	}
+	conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	err = encoding.WriteObject(conn, modules.RPCSettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = modules.ReadNegotiationAcceptance(conn)
+	if err == nil || err.Error() != errRPCBusy.Error() {
+		t.Fatalf("expected %v, got %v", errRPCBusy, err)
+	}
+	nm := ht.host.NetworkMetrics()
+	if nm.BusyCalls != 1 {
+		t.Error("busy call was not counted")
+	}
+	if nm.SettingsCalls != 0 {
+		t.Error("busy call was counted as a settings call")
+	}
+	if nm.RPCsInUse["Settings"] != 1 {
+		t.Error("wrong in-use count:", nm.RPCsInUse)
+	}
+}
+
+// TestRateLimitedConn checks that reads and writes through rate-limited
+// connections sharing a limiter stay within the combined bandwidth limit.
+func TestRateLimitedConn(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	const rate = 4096
+	bl := newBandwidthLimiter(rate)
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	w := &rateLimitedConn{Conn: c1, bl: bl}
+	r := &rateLimitedConn{Conn: c2, bl: bl}
+
+	// The bucket starts full, so the first second of traffic is not
+	// delayed. Each byte is counted twice, once by each end of the pipe, so
+	// transferring 2*rate bytes uses 4 seconds of traffic, of which 3 must be
+	// waited out.
+	data := bytes.Repeat([]byte{1}, 2*rate)
+	start := time.Now()
+	go w.Write(data)
+	buf := make([]byte, len(data))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data) {
+		t.Fatal("wrong data read through the rate-limited connection")
+	}
+	if elapsed := time.Since(start); elapsed < 2500*time.Millisecond {
+		t.Error("transfer exceeded the bandwidth limit, took", elapsed)
+	}
+}
+
+// TestRPCBandwidthLimits checks that invalid bandwidth limits are rejected,
+// and that only the connections of limited RPCs are throttled.
+func TestRPCBandwidthLimits(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestRPCBandwidthLimits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	settings := ht.host.InternalSettings()
+	settings.RPCBandwidthLimits = map[string]uint64{"Unknown": 1}
+	if err := ht.host.SetInternalSettings(settings); err == nil {
+		t.Fatal("limit for an unknown RPC was accepted")
+	}
+	settings.RPCBandwidthLimits = map[string]uint64{"Download": 0}
+	if err := ht.host.SetInternalSettings(settings); err == nil {
+		t.Fatal("zero limit was accepted")
+	}
+	settings.RPCBandwidthLimits = map[string]uint64{"Download": 1 << 20}
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	if conn := ht.host.managedLimitBandwidth(modules.RPCSettings, c1); conn != c1 {
+		t.Error("connection of an unlimited RPC was wrapped")
+	}
+	conn := ht.host.managedLimitBandwidth(modules.RPCDownload, c1)
+	rc, ok := conn.(*rateLimitedConn)
+	if !ok {
+		t.Fatal("connection of a limited RPC was not wrapped")
+	}
+	if conn2 := ht.host.managedLimitBandwidth(modules.RPCDownload, c2); conn2.(*rateLimitedConn).bl != rc.bl {
+		t.Error("calls of the same RPC do not share a limiter")
+	}
+
+	// Changing the limit should update the shared limiter.
+	settings.RPCBandwidthLimits = map[string]uint64{"Download": 1 << 10}
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	ht.host.managedLimitBandwidth(modules.RPCDownload, c1)
+	if rc.bl.chunk(1<<20) != 1<<10 {
+		t.Error("limiter was not updated to the new limit")
+	}
+}
@@ -0,0 +1,176 @@
+package host
+
+// rpcretries.go retries the handlers of idempotent RPCs that fail, so that a
+// transient failure, such as brief contention on the consensus lock, does not
+// count as a hard error. Retries are configured per RPC, and only RPCs that
+// can be served again without side effects may be retried. RPCs that modify
+// contracts are never retried.
+//
+// A retried handler must not see a connection that an earlier attempt has
+// already consumed or written to. While retries are enabled for an RPC, its
+// handler is served through a replayConn, which records the request as it is
+// read and holds back the response until the handler succeeds. A retry then
+// reads the same request again and only its own response reaches the caller.
+// Failures of the underlying connection are never retried.
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// maxRPCRetries is the maximum number of times that the handler of a
+	// failed call may be retried.
+	maxRPCRetries = 5
+
+	// rpcRetryBackoff is the time waited before the first retry of a failed
+	// call. Each further retry waits an additional rpcRetryBackoff.
+	rpcRetryBackoff = 50 * time.Millisecond
+)
+
+var (
+	// errNonIdempotentRPCRetries is returned if retries are provided for an
+	// RPC that cannot be safely retried.
+	errNonIdempotentRPCRetries = errors.New("retries can only be enabled for idempotent RPCs")
+
+	// errTooManyRPCRetries is returned if the retries of an RPC exceed
+	// maxRPCRetries.
+	errTooManyRPCRetries = errors.New("RPC retries cannot exceed 5")
+
+	// errUnknownRPCRetries is returned if retries are provided for an RPC
+	// that the host does not serve.
+	errUnknownRPCRetries = errors.New("RPC retries provided for an unknown RPC")
+)
+
+// idempotentRPCs holds the RPCs that can be retried. Serving any of them again
+// has no effect beyond the response sent to the caller, and none of them read
+// from the caller after writing to it.
+var idempotentRPCs = map[types.Specifier]struct{}{
+	modules.RPCHostMetrics: {},
+	modules.RPCPing:        {},
+	modules.RPCSettings:    {},
+}
+
+// replayConn is a net.Conn that records the data read from the underlying
+// connection and buffers the data written to it. After a rewind, reads are
+// served from the recorded data before the underlying connection is read
+// again, and the buffered writes are discarded.
+type replayConn struct {
+	net.Conn
+
+	recorded []byte
+	pos      int
+	out      bytes.Buffer
+
+	// connErr is the first error returned by the underlying connection.
+	connErr error
+}
+
+// Read implements the io.Reader interface.
+func (rc *replayConn) Read(b []byte) (int, error) {
+	if rc.pos < len(rc.recorded) {
+		n := copy(b, rc.recorded[rc.pos:])
+		rc.pos += n
+		return n, nil
+	}
+	n, err := rc.Conn.Read(b)
+	rc.recorded = append(rc.recorded, b[:n]...)
+	rc.pos += n
+	if err != nil && rc.connErr == nil {
+		rc.connErr = err
+	}
+	return n, err
+}
+
+// Write implements the io.Writer interface.
+func (rc *replayConn) Write(b []byte) (int, error) {
+	return rc.out.Write(b)
+}
+
+// rewind discards the buffered writes and replays the recorded reads.
+func (rc *replayConn) rewind() {
+	rc.pos = 0
+	rc.out.Reset()
+}
+
+// flush writes the buffered writes to the underlying connection.
+func (rc *replayConn) flush() error {
+	_, err := rc.Conn.Write(rc.out.Bytes())
+	rc.out.Reset()
+	return err
+}
+
+// checkRPCRetries returns an error if any of the provided RPC retries names
+// an unknown or non-idempotent RPC, or exceeds maxRPCRetries.
+func checkRPCRetries(retries map[string]uint64) error {
+	for name, n := range retries {
+		var id types.Specifier
+		known := false
+		for rpc := range defaultRPCTimeouts {
+			if rpcName(rpc) == name {
+				id, known = rpc, true
+				break
+			}
+		}
+		if !known {
+			return errUnknownRPCRetries
+		}
+		if _, idempotent := idempotentRPCs[id]; !idempotent {
+			return errNonIdempotentRPCRetries
+		}
+		if n > maxRPCRetries {
+			return errTooManyRPCRetries
+		}
+	}
+	return nil
+}
+
+// managedRetryRPC serves a call to the provided handler, retrying the handler
+// as many times as the settings allow for the RPC, and returns the error of
+// the last attempt. The call is not retried once 'interrupted' returns true
+// or the underlying connection fails, because the connection can no longer be
+// used, nor if it failed with a decode or validation error, because those are
+// caused by the caller and would recur.
+func (h *Host) managedRetryRPC(id types.Specifier, conn net.Conn, handler func(*Host, net.Conn) error, interrupted func() bool) error {
+	lockID := h.mu.RLock()
+	retries := h.settings.RPCRetries[rpcName(id)]
+	h.mu.RUnlock(lockID)
+	if _, idempotent := idempotentRPCs[id]; !idempotent || retries == 0 {
+		return handler(h, conn)
+	}
+
+	rc := &replayConn{Conn: conn}
+	err := handler(h, rc)
+	retried := false
+	for attempt := uint64(0); attempt < retries && err != nil; attempt++ {
+		category := errorCategory(err)
+		if rc.connErr != nil || interrupted() || isTimeout(err) || category == errCategoryDecode || category == errCategoryValidation {
+			break
+		}
+		select {
+		case <-time.After(rpcRetryBackoff * time.Duration(attempt+1)):
+		case <-h.tg.StopChan():
+			return err
+		}
+		if !retried {
+			atomic.AddUint64(&h.atomicRetriedCalls, 1)
+			retried = true
+		}
+		h.log.Debugf("INFO: retrying RPC \"%v\" from %v after error: %v", id, conn.RemoteAddr(), err)
+		rc.rewind()
+		err = handler(h, rc)
+	}
+	if err != nil {
+		return err
+	}
+	if retried {
+		atomic.AddUint64(&h.atomicRecoveredCalls, 1)
+	}
+	return ioErr(rc.flush())
+}
@@ -0,0 +1,140 @@
+package host
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestCheckRPCRetries checks that retries are only accepted for known,
+// idempotent RPCs, and are bounded.
+func TestCheckRPCRetries(t *testing.T) {
+	tests := []struct {
+		retries map[string]uint64
+		err     error
+	}{
+		{nil, nil},
+		{map[string]uint64{"Settings": 2, "Ping": maxRPCRetries}, nil},
+		{map[string]uint64{"Unknown": 1}, errUnknownRPCRetries},
+		{map[string]uint64{"ReviseContract": 1}, errNonIdempotentRPCRetries},
+		{map[string]uint64{"FormContract": 1}, errNonIdempotentRPCRetries},
+		{map[string]uint64{"Settings": maxRPCRetries + 1}, errTooManyRPCRetries},
+	}
+	for _, test := range tests {
+		if err := checkRPCRetries(test.retries); err != test.err {
+			t.Errorf("%v: expected %v, got %v", test.retries, test.err, err)
+		}
+	}
+}
+
+// TestManagedRetryRPC checks that a failed ping is retried on the same
+// request without the output of the failed attempt reaching the caller, and
+// that calls failing with an error caused by the caller or having no retries
+// configured are not retried.
+func TestManagedRetryRPC(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestManagedRetryRPC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	notInterrupted := func() bool { return false }
+	transient := ioErr(errors.New("transient failure"))
+
+	// flakyPing consumes the request and writes garbage before failing on
+	// its first attempt, and serves the ping on later attempts.
+	attempts := 0
+	flakyPing := func(h *Host, conn net.Conn) error {
+		attempts++
+		if attempts > 1 {
+			return h.managedRPCPing(conn)
+		}
+		var nonce [8]byte
+		if err := encoding.ReadObject(conn, &nonce, uint64(len(nonce))); err != nil {
+			return decodeErr(err)
+		}
+		conn.Write([]byte("garbage"))
+		return transient
+	}
+	failing := func(err error) func(*Host, net.Conn) error {
+		return func(*Host, net.Conn) error { return err }
+	}
+
+	// Without retries configured the error is returned unchanged.
+	hostConn, renterConn := net.Pipe()
+	defer hostConn.Close()
+	defer renterConn.Close()
+	if err := ht.host.managedRetryRPC(modules.RPCPing, hostConn, failing(transient), notInterrupted); err != transient {
+		t.Fatal("call was retried without retries configured:", err)
+	}
+
+	settings := ht.host.InternalSettings()
+	settings.RPCRetries = map[string]uint64{"Ping": 2}
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	settings.RPCRetries = map[string]uint64{"RenewContract": 1}
+	if err := ht.host.SetInternalSettings(settings); err == nil {
+		t.Fatal("retries of a non-idempotent RPC were accepted")
+	}
+
+	// A decode error is caused by the caller and is not retried.
+	decode := decodeErr(errors.New("malformed request"))
+	if err := ht.host.managedRetryRPC(modules.RPCPing, hostConn, failing(decode), notInterrupted); err != decode {
+		t.Fatal("decode error was retried:", err)
+	}
+
+	// A transient error is retried on the same request, and only the
+	// response of the successful attempt is sent.
+	nonce := [8]byte{1, 2, 3}
+	done := make(chan error)
+	go func() {
+		if err := encoding.WriteObject(renterConn, nonce); err != nil {
+			done <- err
+			return
+		}
+		var resp modules.HostPingResponse
+		if err := encoding.ReadObject(renterConn, &resp, 1024); err != nil {
+			done <- err
+			return
+		}
+		if resp.Nonce != nonce {
+			done <- errors.New("wrong nonce in ping response")
+			return
+		}
+		done <- nil
+	}()
+	if err := ht.host.managedRetryRPC(modules.RPCPing, hostConn, flakyPing, notInterrupted); err != nil {
+		t.Fatal("retry failed:", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal("retry did not serve the ping:", err)
+	}
+	if attempts != 2 {
+		t.Fatal("expected 2 attempts, got", attempts)
+	}
+
+	nm := ht.host.NetworkMetrics()
+	if nm.RetriedCalls != 1 || nm.RecoveredCalls != 1 {
+		t.Error("wrong retry metrics:", nm.RetriedCalls, nm.RecoveredCalls)
+	}
+
+	// A failure of the connection itself is not retried.
+	hostConn.Close()
+	attempts = 0
+	readFailing := func(h *Host, conn net.Conn) error {
+		attempts++
+		conn.Read(make([]byte, 1))
+		return transient
+	}
+	if err := ht.host.managedRetryRPC(modules.RPCPing, hostConn, readFailing, notInterrupted); err != transient || attempts != 1 {
+		t.Fatal("call on a closed connection was retried:", attempts, err)
+	}
+}
@@ -0,0 +1,103 @@
+package host
+
+import (
+	"errors"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	// defaultRPCTimeouts are the deadlines of each RPC when the settings do
+	// not override them. Lightweight RPCs get tight deadlines, and RPCs that
+	// transfer data get generous ones.
+	defaultRPCTimeouts = map[types.Specifier]time.Duration{
+		modules.RPCAuthSettings:   modules.NegotiateAuthSettingsTime,
+		modules.RPCDownload:       modules.NegotiateDownloadTime,
+		modules.RPCFormContract:   modules.NegotiateFileContractTime,
+		modules.RPCHostMetrics:    modules.NegotiateHostMetricsTime,
+		modules.RPCPing:           modules.NegotiatePingTime,
+		modules.RPCRecentRevision: modules.NegotiateRecentRevisionTime,
+		modules.RPCRenewContract:  modules.NegotiateRenewContractTime,
+		modules.RPCReviseContract: modules.NegotiateFileContractRevisionTime,
+		modules.RPCSettings:       modules.NegotiateSettingsTime,
+		modules.RPCUpdateSettings: modules.NegotiateUpdateSettingsTime,
+	}
+
+	// errInvalidRPCTimeout is returned if an RPC timeout is not positive.
+	errInvalidRPCTimeout = errors.New("RPC timeouts must be positive")
+
+	// errUnknownRPCTimeout is returned if an RPC timeout is provided for an
+	// RPC that the host does not serve.
+	errUnknownRPCTimeout = errors.New("RPC timeout provided for an unknown RPC")
+)
+
+// rpcName returns the name of an RPC, which is its specifier without the
+// trailing version byte, e.g. "Settings".
+func rpcName(id types.Specifier) string {
+	var i int
+	for i = 0; i < len(id); i++ {
+		if id[i] < ' ' {
+			break
+		}
+	}
+	return string(id[:i])
+}
+
+// checkRPCTimeouts returns an error if any of the provided RPC timeouts names
+// an unknown RPC or is not positive.
+func checkRPCTimeouts(timeouts map[string]time.Duration) error {
+	for name, timeout := range timeouts {
+		known := false
+		for id := range defaultRPCTimeouts {
+			if rpcName(id) == name {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return errUnknownRPCTimeout
+		}
+		if timeout <= 0 {
+			return errInvalidRPCTimeout
+		}
+	}
+	return nil
+}
+
+// managedRPCTimeout returns the deadline of the provided RPC, preferring the
+// value in the host settings over the default deadline.
+func (h *Host) managedRPCTimeout(id types.Specifier) time.Duration {
+	lockID := h.mu.RLock()
+	timeout, exists := h.settings.RPCTimeouts[rpcName(id)]
+	h.mu.RUnlock(lockID)
+	if exists {
+		return timeout
+	}
+	return defaultRPCTimeouts[id]
+}
+
+// TimeoutConfig returns the deadlines and timeouts that the host is currently
+// applying, so that operators can confirm that a change to the settings took
+// effect.
+func (h *Host) TimeoutConfig() modules.HostTimeoutConfig {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	tc := modules.HostTimeoutConfig{
+		ConnectionDeadline:       h.settings.ConnectionDeadline,
+		ConnectionDeadlineJitter: h.settings.ConnectionDeadlineJitter,
+		IdleTimeout:              h.settings.IdleTimeout,
+		MaxConnectionLifetime:    h.settings.MaxConnectionLifetime,
+		PortForwardTimeout:       h.settings.PortForwardTimeout,
+		RPCTimeouts:              make(map[string]time.Duration, len(defaultRPCTimeouts)),
+	}
+	for id, timeout := range defaultRPCTimeouts {
+		name := rpcName(id)
+		if override, exists := h.settings.RPCTimeouts[name]; exists {
+			timeout = override
+		}
+		tc.RPCTimeouts[name] = timeout
+	}
+	return tc
+}
@@ -0,0 +1,150 @@
+package host
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestRPCName checks that RPC names drop the version of the specifier.
+func TestRPCName(t *testing.T) {
+	if name := rpcName(modules.RPCSettings); name != "Settings" {
+		t.Error("wrong name for the settings RPC:", name)
+	}
+	if name := rpcName(modules.RPCPing); name != "Ping" {
+		t.Error("wrong name for the ping RPC:", name)
+	}
+}
+
+// TestCheckRPCTimeouts probes the validation of the RPC timeout settings.
+func TestCheckRPCTimeouts(t *testing.T) {
+	tests := []struct {
+		timeouts map[string]time.Duration
+		err      error
+	}{
+		{nil, nil},
+		{map[string]time.Duration{"Settings": time.Second, "Download": time.Hour}, nil},
+		{map[string]time.Duration{"Settings": 0}, errInvalidRPCTimeout},
+		{map[string]time.Duration{"Ping": -time.Second}, errInvalidRPCTimeout},
+		{map[string]time.Duration{"NotAnRPC": time.Second}, errUnknownRPCTimeout},
+	}
+	for _, test := range tests {
+		if err := checkRPCTimeouts(test.timeouts); err != test.err {
+			t.Errorf("checkRPCTimeouts(%v): expected %v, got %v", test.timeouts, test.err, err)
+		}
+	}
+}
+
+// TestRPCTimeouts checks that the per-RPC timeouts in the settings override
+// the default deadlines.
+func TestRPCTimeouts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestRPCTimeouts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	if ht.host.managedRPCTimeout(modules.RPCDownload) != modules.NegotiateDownloadTime {
+		t.Error("download RPC does not use the default timeout")
+	}
+	settings := ht.host.InternalSettings()
+	settings.RPCTimeouts = map[string]time.Duration{"Ping": 100 * time.Millisecond}
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ht.host.managedRPCTimeout(modules.RPCPing) != 100*time.Millisecond {
+		t.Error("ping RPC does not use the configured timeout")
+	}
+	if ht.host.managedRPCTimeout(modules.RPCDownload) != modules.NegotiateDownloadTime {
+		t.Error("download RPC does not use the default timeout")
+	}
+
+	// Start a ping without sending the nonce, the host should give up on the
+	// call once the configured timeout has passed.
+	conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	err = encoding.WriteObject(conn, modules.RPCPing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50 && ht.host.NetworkMetrics().TimeoutCalls == 0; i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if ht.host.NetworkMetrics().TimeoutCalls != 1 {
+		t.Error("ping RPC did not time out")
+	}
+}
+
+// TestTimeoutConfig checks that TimeoutConfig reports the effective timeouts,
+// including the RPCs that use the default deadlines.
+func TestTimeoutConfig(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestTimeoutConfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	tc := ht.host.TimeoutConfig()
+	if tc.ConnectionDeadline != defaultConnectionDeadline || tc.IdleTimeout != 0 {
+		t.Error("wrong default timeouts:", tc)
+	}
+	if tc.RPCTimeouts["Settings"] != modules.NegotiateSettingsTime {
+		t.Error("wrong default settings timeout:", tc.RPCTimeouts["Settings"])
+	}
+
+	settings := ht.host.InternalSettings()
+	settings.ConnectionDeadline = -time.Minute
+	if err := ht.host.SetInternalSettings(settings); err == nil {
+		t.Fatal("expected a negative connection deadline to be rejected")
+	}
+	settings.ConnectionDeadline = time.Minute
+	settings.IdleTimeout = 10 * time.Second
+	settings.RPCTimeouts = map[string]time.Duration{"Settings": time.Second}
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	tc = ht.host.TimeoutConfig()
+	if tc.ConnectionDeadline != time.Minute || tc.IdleTimeout != 10*time.Second {
+		t.Error("updated timeouts were not reported:", tc)
+	}
+	if tc.RPCTimeouts["Settings"] != time.Second {
+		t.Error("RPC timeout override was not reported:", tc.RPCTimeouts["Settings"])
+	}
+	if tc.RPCTimeouts["Download"] != modules.NegotiateDownloadTime {
+		t.Error("default RPC timeout was not reported:", tc.RPCTimeouts["Download"])
+	}
+
+	// A jitter of 0 restores the default, and a negative jitter disables it.
+	settings.ConnectionDeadlineJitter = 0
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if tc = ht.host.TimeoutConfig(); tc.ConnectionDeadlineJitter != defaultConnectionDeadlineJitter {
+		t.Error("zero jitter did not restore the default:", tc.ConnectionDeadlineJitter)
+	}
+	settings.ConnectionDeadlineJitter = -1
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal("negative jitter was rejected:", err)
+	}
+	if tc = ht.host.TimeoutConfig(); tc.ConnectionDeadlineJitter != -1 {
+		t.Error("disabled jitter was not kept:", tc.ConnectionDeadlineJitter)
+	}
+	if len(tc.RPCTimeouts) != len(defaultRPCTimeouts) {
+		t.Error("wrong number of RPC timeouts:", len(tc.RPCTimeouts))
+	}
+}
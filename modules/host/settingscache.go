@@ -0,0 +1,42 @@
+package host
+
+// settingscache.go caches the signed settings of the host, so that serving
+// the settings RPC does not require the settings to be signed again for each
+// call. A host flooded with settings requests by scanners would otherwise
+// spend most of its CPU on signatures. The cache is only rebuilt once the
+// settings of the host change.
+
+import (
+	"bytes"
+	"sync"
+)
+
+// settingsCache holds the most recently signed external settings and
+// settings extension of the host.
+type settingsCache struct {
+	encoded     []byte // The encoded settings and extension that were signed.
+	signed      []byte // The signed settings followed by the signed extension.
+	settingsLen int    // The length of the signed settings within signed.
+	mu          sync.RWMutex
+}
+
+// lookup returns the signed settings and extension, and the length of the
+// signed settings, if they were signed from the provided encoded settings and
+// extension. False is returned if either has changed since they were signed.
+func (sc *settingsCache) lookup(encoded []byte) ([]byte, int, bool) {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	if sc.signed == nil || !bytes.Equal(sc.encoded, encoded) {
+		return nil, 0, false
+	}
+	return sc.signed, sc.settingsLen, true
+}
+
+// store replaces the cached settings.
+func (sc *settingsCache) store(encoded, signed []byte, settingsLen int) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.encoded = encoded
+	sc.signed = signed
+	sc.settingsLen = settingsLen
+}
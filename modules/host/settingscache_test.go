@@ -0,0 +1,137 @@
+package host
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
+)
+
+// readSettings writes the settings of the host to a pipe and returns the
+// bytes that were written along with the decoded settings and extension.
+// 'withExtension' is passed to managedWriteSettings.
+func readSettings(h *Host, withExtension bool) ([]byte, modules.HostExternalSettings, modules.HostSettingsExtension, error) {
+	hostConn, renterConn := net.Pipe()
+	defer renterConn.Close()
+	go func() {
+		h.managedWriteSettings(hostConn, withExtension)
+		hostConn.Close()
+	}()
+	raw, err := ioutil.ReadAll(renterConn)
+	if err != nil {
+		return nil, modules.HostExternalSettings{}, modules.HostSettingsExtension{}, err
+	}
+	var pk crypto.PublicKey
+	copy(pk[:], h.publicKey.Key)
+	r := bytes.NewReader(raw)
+	var hes modules.HostExternalSettings
+	err = crypto.ReadSignedObject(r, &hes, modules.NegotiateMaxHostExternalSettingsLen, pk)
+	if err != nil {
+		return nil, modules.HostExternalSettings{}, modules.HostSettingsExtension{}, err
+	}
+	ext, err := modules.ReadSettingsExtension(r, pk, hes.RevisionNumber)
+	return raw, hes, ext, err
+}
+
+// TestSettingsCache checks that unchanged settings are served from the cache
+// with the same revision number, and that the cache is rebuilt with a new
+// revision number once the settings change.
+func TestSettingsCache(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestSettingsCache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	raw1, hes1, ext1, err := readSettings(ht.host, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ext1.SettingsRevision != hes1.RevisionNumber {
+		t.Fatal("extension was not sent with the settings")
+	}
+	// The revision number was persisted before the settings were signed, so
+	// that a restarted host does not sign it again.
+	var p persistence
+	err = persist.LoadFile(persistMetadata, &p, filepath.Join(ht.host.persistDir, settingsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.RevisionNumber != hes1.RevisionNumber {
+		t.Fatal("signed revision number was not persisted:", p.RevisionNumber, hes1.RevisionNumber)
+	}
+	raw2, hes2, _, err := readSettings(ht.host, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw1, raw2) || hes1.RevisionNumber != hes2.RevisionNumber {
+		t.Fatal("unchanged settings were not served from the cache")
+	}
+
+	// Settings sent within a negotiation omit the extension.
+	raw, _, ext, err := readSettings(ht.host, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw, raw1[:len(raw)]) || len(raw) == len(raw1) || !reflect.DeepEqual(ext, modules.HostSettingsExtension{}) {
+		t.Fatal("negotiation settings were sent with the extension")
+	}
+
+	settings := ht.host.InternalSettings()
+	settings.MaxDuration++
+	if err := ht.host.SetInternalSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	_, hes3, _, err := readSettings(ht.host, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hes3.MaxDuration != settings.MaxDuration {
+		t.Error("stale settings were served after the settings changed")
+	}
+	if hes3.RevisionNumber <= hes2.RevisionNumber {
+		t.Error("revision number did not increase after the settings changed")
+	}
+}
+
+// BenchmarkSettingsFlood measures the cost of serving a settings request when
+// the signed settings are served from the cache, and when they are signed
+// again for each request.
+func BenchmarkSettingsFlood(b *testing.B) {
+	ht, err := blankHostTester("BenchmarkSettingsFlood")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ht.Close()
+
+	hostConn, renterConn := net.Pipe()
+	defer hostConn.Close()
+	go io.Copy(ioutil.Discard, renterConn)
+
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := ht.host.managedWriteSettings(hostConn, true); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			ht.host.settingsCache.store(nil, nil, 0)
+			if err := ht.host.managedWriteSettings(hostConn, true); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
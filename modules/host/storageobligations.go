@@ -394,7 +394,12 @@ func (h *Host) addStorageObligation(so storageObligation) error {
 	err = composeErrors(err0, err1, err2, err3)
 	if err != nil {
 		h.log.Println("Error with transaction set, redacting obligation, id", so.id())
-		return composeErrors(err, h.removeStorageObligation(so, obligationRejected))
+		err = composeErrors(err, h.removeStorageObligation(so, obligationRejected))
+		if err0 != nil {
+			// The transaction pool refused the file contract.
+			return consensusErr(err)
+		}
+		return err
 	}
 	return nil
 }
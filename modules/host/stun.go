@@ -0,0 +1,164 @@
+package host
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+const (
+	// stunBindingRequest and stunBindingResponse are the message types of a
+	// STUN binding request and its success response (RFC 5389, section 6).
+	stunBindingRequest  = 0x0001
+	stunBindingResponse = 0x0101
+
+	// stunMagicCookie is the fixed value that follows the message length in
+	// every STUN message.
+	stunMagicCookie = 0x2112A442
+
+	// stunHeaderSize is the size of a STUN message header.
+	stunHeaderSize = 20
+
+	// stunMappedAddress and stunXorMappedAddress are the attributes in which
+	// a STUN server reports the address that a request came from. Servers
+	// that predate RFC 5389 only send the former.
+	stunMappedAddress    = 0x0001
+	stunXorMappedAddress = 0x0020
+
+	// stunTimeout is the amount of time that the host waits for a STUN server
+	// to respond to a binding request.
+	stunTimeout = 10 * time.Second
+)
+
+var (
+	// errBadSTUNResponse is returned if a STUN server responds with a message
+	// that is not a well-formed answer to the binding request.
+	errBadSTUNResponse = errors.New("malformed STUN binding response")
+
+	// errNoSTUNAddress is returned if a STUN binding response does not contain
+	// a mapped address.
+	errNoSTUNAddress = errors.New("STUN binding response did not contain an address")
+)
+
+// stunExternalIP discovers the host's external IP by sending a STUN binding
+// request to 'server' over UDP and reading the address that the server saw
+// the request come from. The name of the server is resolved using 'resolver',
+// or the system resolver if 'resolver' is nil.
+func stunExternalIP(server string, resolver *net.Resolver) (string, error) {
+	dialer := &net.Dialer{Timeout: stunTimeout, Resolver: resolver}
+	conn, err := dialer.Dial("udp", server)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(stunTimeout))
+
+	var txnID [12]byte
+	if _, err := rand.Read(txnID[:]); err != nil {
+		return "", err
+	}
+	req := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(req[0:2], stunBindingRequest)
+	binary.BigEndian.PutUint32(req[4:8], stunMagicCookie)
+	copy(req[8:20], txnID[:])
+	if _, err := conn.Write(req); err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	ip, err := parseSTUNResponse(buf[:n], txnID)
+	if err != nil {
+		return "", err
+	}
+	return ip.String(), nil
+}
+
+// parseSTUNResponse returns the mapped address reported in a STUN binding
+// response to the request with the provided transaction ID. The
+// XOR-MAPPED-ADDRESS attribute is preferred over MAPPED-ADDRESS.
+func parseSTUNResponse(msg []byte, txnID [12]byte) (net.IP, error) {
+	if len(msg) < stunHeaderSize {
+		return nil, errBadSTUNResponse
+	}
+	if binary.BigEndian.Uint16(msg[0:2]) != stunBindingResponse ||
+		binary.BigEndian.Uint32(msg[4:8]) != stunMagicCookie ||
+		!bytes.Equal(msg[8:20], txnID[:]) {
+		return nil, errBadSTUNResponse
+	}
+	length := int(binary.BigEndian.Uint16(msg[2:4]))
+	if length > len(msg)-stunHeaderSize {
+		return nil, errBadSTUNResponse
+	}
+
+	var mapped net.IP
+	attrs := msg[stunHeaderSize : stunHeaderSize+length]
+	for len(attrs) >= 4 {
+		attrType := binary.BigEndian.Uint16(attrs[0:2])
+		attrLen := int(binary.BigEndian.Uint16(attrs[2:4]))
+		if attrLen > len(attrs)-4 {
+			return nil, errBadSTUNResponse
+		}
+		value := attrs[4 : 4+attrLen]
+		switch attrType {
+		case stunXorMappedAddress:
+			ip, err := parseSTUNAddress(value)
+			if err != nil {
+				return nil, err
+			}
+			// The address is XORed with the magic cookie followed by the
+			// transaction ID.
+			var key [16]byte
+			binary.BigEndian.PutUint32(key[0:4], stunMagicCookie)
+			copy(key[4:], txnID[:])
+			for i := range ip {
+				ip[i] ^= key[i]
+			}
+			return ip, nil
+		case stunMappedAddress:
+			ip, err := parseSTUNAddress(value)
+			if err != nil {
+				return nil, err
+			}
+			mapped = ip
+		}
+		// Attributes are padded to a multiple of 4 bytes.
+		padded := 4 + (attrLen+3)&^3
+		if padded > len(attrs) {
+			break
+		}
+		attrs = attrs[padded:]
+	}
+	if mapped == nil {
+		return nil, errNoSTUNAddress
+	}
+	return mapped, nil
+}
+
+// parseSTUNAddress returns a copy of the IP in the value of a MAPPED-ADDRESS
+// or XOR-MAPPED-ADDRESS attribute, which consists of a reserved byte, the
+// address family, the port and the address.
+func parseSTUNAddress(value []byte) (net.IP, error) {
+	if len(value) < 4 {
+		return nil, errBadSTUNResponse
+	}
+	var size int
+	switch value[1] {
+	case 0x01:
+		size = net.IPv4len
+	case 0x02:
+		size = net.IPv6len
+	default:
+		return nil, errBadSTUNResponse
+	}
+	if len(value) != 4+size {
+		return nil, errBadSTUNResponse
+	}
+	return append(net.IP(nil), value[4:]...), nil
+}
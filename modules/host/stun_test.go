@@ -0,0 +1,95 @@
+package host
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// stunServer answers STUN binding requests on a local UDP socket, reporting
+// 'ip' as the mapped address of every request.
+func stunServer(t *testing.T, ip net.IP, xor bool) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < stunHeaderSize {
+				continue
+			}
+			attrType := uint16(stunMappedAddress)
+			addrBytes := append(net.IP(nil), ip.To4()...)
+			if xor {
+				attrType = stunXorMappedAddress
+				var cookie [4]byte
+				binary.BigEndian.PutUint32(cookie[:], stunMagicCookie)
+				for i := range addrBytes {
+					addrBytes[i] ^= cookie[i]
+				}
+			}
+			resp := make([]byte, stunHeaderSize+12)
+			binary.BigEndian.PutUint16(resp[0:2], stunBindingResponse)
+			binary.BigEndian.PutUint16(resp[2:4], 12)
+			copy(resp[4:20], buf[4:20])
+			binary.BigEndian.PutUint16(resp[20:22], attrType)
+			binary.BigEndian.PutUint16(resp[22:24], 8)
+			resp[25] = 0x01
+			copy(resp[28:32], addrBytes)
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn
+}
+
+// TestSTUNExternalIP checks that stunExternalIP reports the address in both
+// the XOR-MAPPED-ADDRESS and MAPPED-ADDRESS attributes.
+func TestSTUNExternalIP(t *testing.T) {
+	for _, xor := range []bool{true, false} {
+		srv := stunServer(t, net.ParseIP("203.0.113.7"), xor)
+		ip, err := stunExternalIP(srv.LocalAddr().String(), nil)
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ip != "203.0.113.7" {
+			t.Errorf("xor %v: wrong address reported: %v", xor, ip)
+		}
+	}
+}
+
+// TestParseSTUNResponse checks that malformed and mismatched STUN responses
+// are rejected.
+func TestParseSTUNResponse(t *testing.T) {
+	var txnID [12]byte
+	txnID[0] = 1
+	header := func(msgType, length uint16) []byte {
+		msg := make([]byte, stunHeaderSize)
+		binary.BigEndian.PutUint16(msg[0:2], msgType)
+		binary.BigEndian.PutUint16(msg[2:4], length)
+		binary.BigEndian.PutUint32(msg[4:8], stunMagicCookie)
+		copy(msg[8:20], txnID[:])
+		return msg
+	}
+
+	if _, err := parseSTUNResponse(header(stunBindingResponse, 0)[:10], txnID); err != errBadSTUNResponse {
+		t.Errorf("short message: expected %v, got %v", errBadSTUNResponse, err)
+	}
+	if _, err := parseSTUNResponse(header(stunBindingRequest, 0), txnID); err != errBadSTUNResponse {
+		t.Errorf("wrong type: expected %v, got %v", errBadSTUNResponse, err)
+	}
+	if _, err := parseSTUNResponse(header(stunBindingResponse, 0), [12]byte{}); err != errBadSTUNResponse {
+		t.Errorf("wrong transaction: expected %v, got %v", errBadSTUNResponse, err)
+	}
+	if _, err := parseSTUNResponse(header(stunBindingResponse, 8), txnID); err != errBadSTUNResponse {
+		t.Errorf("truncated attributes: expected %v, got %v", errBadSTUNResponse, err)
+	}
+	if _, err := parseSTUNResponse(header(stunBindingResponse, 0), txnID); err != errNoSTUNAddress {
+		t.Errorf("no address: expected %v, got %v", errNoSTUNAddress, err)
+	}
+}
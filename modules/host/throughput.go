@@ -0,0 +1,27 @@
+package host
+
+import (
+	"time"
+)
+
+// downloadThroughputDecay determines how quickly old download throughput
+// samples are forgotten. Each new sample contributes 1/downloadThroughputDecay
+// of the moving average.
+const downloadThroughputDecay = 8
+
+// managedRecordDownloadThroughput folds the throughput of a completed download
+// into the host's moving average of download throughput.
+func (h *Host) managedRecordDownloadThroughput(bytes uint64, elapsed time.Duration) {
+	if bytes == 0 || elapsed <= 0 {
+		return
+	}
+	sample := uint64(float64(bytes) / elapsed.Seconds())
+
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	if h.downloadThroughput == 0 {
+		h.downloadThroughput = sample
+		return
+	}
+	h.downloadThroughput = (h.downloadThroughput*(downloadThroughputDecay-1) + sample) / downloadThroughputDecay
+}
@@ -0,0 +1,86 @@
+package host
+
+// tls.go implements the optional TLS support of the host. TLS and plaintext
+// connections are served on the same address: the first byte of every TLS
+// connection is the record type of the handshake (0x16), while a plaintext
+// connection starts with the 8 byte little-endian length prefix of the RPC
+// specifier, whose first byte is always types.SpecifierLen (0x10). The host
+// can therefore tell the two apart before reading the specifier.
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"net"
+
+	"github.com/NebulousLabs/Sia/crypto"
+)
+
+const (
+	// tlsHandshakeRecord is the first byte sent on a TLS connection.
+	tlsHandshakeRecord = 0x16
+)
+
+var (
+	// errIncompleteTLSSettings is returned if only one of the TLS
+	// certificate and key has been provided.
+	errIncompleteTLSSettings = errors.New("both a certificate and a key must be provided to enable TLS")
+)
+
+// peekConn is a net.Conn that has had data read from it ahead of time. Reads
+// are served from the buffered reader, so that no data is lost.
+type peekConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// Read implements the io.Reader interface.
+func (pc peekConn) Read(b []byte) (int, error) {
+	return pc.r.Read(b)
+}
+
+// loadTLSConfig loads the certificate and key at the provided paths. If
+// neither path is set, TLS is disabled and a nil config is returned.
+func loadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errIncompleteTLSSettings
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// tlsCertificateHash returns the hash of the certificate served under the
+// provided config, or the zero hash if TLS is disabled.
+func tlsCertificateHash(config *tls.Config) crypto.Hash {
+	if config == nil || len(config.Certificates) == 0 || len(config.Certificates[0].Certificate) == 0 {
+		return crypto.Hash{}
+	}
+	return crypto.HashBytes(config.Certificates[0].Certificate[0])
+}
+
+// managedSniffTLS returns a connection that serves the RPC on the provided
+// connection. If the host has TLS enabled and the caller has started a TLS
+// handshake, the connection is wrapped in TLS. Otherwise the connection is
+// treated as plaintext.
+func (h *Host) managedSniffTLS(conn net.Conn) net.Conn {
+	lockID := h.mu.RLock()
+	tlsConfig := h.tlsConfig
+	h.mu.RUnlock(lockID)
+	if tlsConfig == nil {
+		return conn
+	}
+
+	pc := peekConn{Conn: conn, r: bufio.NewReader(conn)}
+	first, err := pc.r.Peek(1)
+	if err != nil || first[0] != tlsHandshakeRecord {
+		// Any read error will resurface when the specifier is read.
+		return pc
+	}
+	return tls.Server(pc, tlsConfig)
+}
@@ -0,0 +1,150 @@
+package host
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// writeTestCertificate writes a self-signed certificate for localhost and
+// its key to the provided directory, returning the paths of both files.
+func writeTestCertificate(dir string) (certFile, keyFile string, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		return "", "", err
+	}
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	if err != nil {
+		return "", "", err
+	}
+	return certFile, keyFile, nil
+}
+
+// TestLoadTLSConfig probes the validation of the TLS settings.
+func TestLoadTLSConfig(t *testing.T) {
+	if config, err := loadTLSConfig("", ""); config != nil || err != nil {
+		t.Error("TLS should be disabled without a certificate:", err)
+	}
+	if _, err := loadTLSConfig("cert.pem", ""); err != errIncompleteTLSSettings {
+		t.Error("expected errIncompleteTLSSettings, got", err)
+	}
+	if _, err := loadTLSConfig("", "key.pem"); err != errIncompleteTLSSettings {
+		t.Error("expected errIncompleteTLSSettings, got", err)
+	}
+	if _, err := loadTLSConfig("does-not-exist.pem", "does-not-exist.pem"); err == nil {
+		t.Error("loading a missing certificate should fail")
+	}
+}
+
+// TestHostTLS checks that a host with a certificate serves RPCs over both TLS
+// and plaintext connections, and advertises its TLS support and certificate.
+func TestHostTLS(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestHostTLS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+	if ht.host.SettingsExtension().TLS {
+		t.Fatal("host should not advertise TLS by default")
+	}
+
+	certFile, keyFile, err := writeTestCertificate(ht.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := ht.host.InternalSettings()
+	settings.TLSCertFile = certFile
+	err = ht.host.SetInternalSettings(settings)
+	if err == nil {
+		t.Fatal("incomplete TLS settings were accepted")
+	}
+	settings.TLSKeyFile = keyFile
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// fetchExtension requests the settings of the host over the provided
+	// connection and returns the settings extension.
+	var pk crypto.PublicKey
+	copy(pk[:], ht.host.publicKey.Key)
+	fetchExtension := func(conn net.Conn) modules.HostSettingsExtension {
+		err := encoding.WriteObject(conn, modules.RPCSettings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var hes modules.HostExternalSettings
+		err = crypto.ReadSignedObject(conn, &hes, modules.NegotiateMaxHostExternalSettingsLen, pk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ext, err := modules.ReadSettingsExtension(conn, pk, hes.RevisionNumber)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ext
+	}
+
+	tlsConn, err := tls.Dial("tcp", string(ht.host.NetAddress()), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tlsConn.Close()
+	ext := fetchExtension(tlsConn)
+	if !ext.TLS {
+		t.Error("host did not advertise TLS support")
+	}
+	served := tlsConn.ConnectionState().PeerCertificates[0].Raw
+	if ext.TLSCertificateHash != crypto.HashBytes(served) {
+		t.Error("advertised certificate hash does not match the served certificate")
+	}
+
+	plainConn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plainConn.Close()
+	if !fetchExtension(plainConn).TLS {
+		t.Error("host did not advertise TLS support")
+	}
+}
@@ -326,6 +326,10 @@ func (h *Host) ProcessConsensusChange(cc modules.ConsensusChange) {
 	// change.
 	h.recentChange = cc.ID
 
+	// Retry an announcement that was deferred until the host accepted
+	// contracts and then refused by the rate limit.
+	h.startDeferredAnnouncement()
+
 	// Save the host.
 	err = h.save()
 	if err != nil {
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -16,12 +17,187 @@ import (
 	"github.com/NebulousLabs/Sia/modules"
 )
 
+const (
+	// upnpHostnameProvider is the name of the hostname provider that asks the
+	// router for the external IP using UPnP.
+	upnpHostnameProvider = "upnp"
+
+	// staticHostnameProviderPrefix prefixes a hostname provider that always
+	// reports the hostname following the prefix, e.g. "static:203.0.113.7".
+	staticHostnameProviderPrefix = "static:"
+
+	// stunHostnameProviderPrefix prefixes a hostname provider that asks a
+	// STUN server for the external IP, e.g. "stun:stun.l.google.com:19302".
+	stunHostnameProviderPrefix = "stun:"
+)
+
+var (
+	// defaultHostnameProviders is the list of hostname providers that are used
+	// if the host settings do not specify any. UPnP is tried first, then
+	// myexternalip.com, falling back to a public STUN server.
+	defaultHostnameProviders = []string{
+		upnpHostnameProvider,
+		"http://myexternalip.com/raw",
+		stunHostnameProviderPrefix + "stun.l.google.com:19302",
+	}
+
+	// errInvalidHostnameProvider is returned if a hostname provider in the
+	// settings is not one of the recognized kinds.
+	errInvalidHostnameProvider = errors.New("hostname provider must be 'upnp', an http(s) url, 'static:<hostname>' or 'stun:<host:port>'")
+
+	// errNoHostnameProviders is returned if hostname discovery is attempted
+	// with an empty list of providers.
+	errNoHostnameProviders = errors.New("no hostname providers available")
+
+	// errNegativePortForwardTimeout is returned if the port forwarding
+	// timeout is negative.
+	errNegativePortForwardTimeout = errors.New("port forward timeout cannot be negative")
+
+	// errPortForwardTimeout is returned if the router does not complete a
+	// UPnP request within the port forwarding timeout.
+	errPortForwardTimeout = errors.New("timed out waiting for the router to respond to UPnP")
+)
+
+// A hostnameProvider is a method of discovering the host's external
+// hostname.
+type hostnameProvider interface {
+	// String returns the provider as it appears in the host settings.
+	String() string
+
+	// discover returns the external hostname reported by the provider. Any
+	// names the provider needs to look up are resolved using 'resolver', or
+	// the system resolver if 'resolver' is nil.
+	discover(resolver *net.Resolver) (string, error)
+}
+
+type (
+	// upnpProvider asks the router for the external IP using UPnP.
+	upnpProvider struct{}
+
+	// httpProvider queries a service that responds with the external IP as
+	// plain text.
+	httpProvider struct {
+		url string
+	}
+
+	// staticProvider always reports the same hostname. It lets the user pin
+	// the auto address without disabling hostname discovery.
+	staticProvider struct {
+		hostname string
+	}
+
+	// stunProvider sends a STUN binding request to a server and reports the
+	// address the server saw the request come from.
+	stunProvider struct {
+		server string
+	}
+)
+
+func (upnpProvider) String() string     { return upnpHostnameProvider }
+func (p httpProvider) String() string   { return p.url }
+func (p staticProvider) String() string { return staticHostnameProviderPrefix + p.hostname }
+func (p stunProvider) String() string   { return stunHostnameProviderPrefix + p.server }
+
+func (upnpProvider) discover(*net.Resolver) (string, error) {
+	d, err := upnp.Discover()
+	if err != nil {
+		return "", err
+	}
+	return d.ExternalIP()
+}
+
+func (p httpProvider) discover(resolver *net.Resolver) (string, error) {
+	return myExternalIP(p.url, resolver)
+}
+
+func (p staticProvider) discover(*net.Resolver) (string, error) {
+	return p.hostname, nil
+}
+
+func (p stunProvider) discover(resolver *net.Resolver) (string, error) {
+	return stunExternalIP(p.server, resolver)
+}
+
+// parseHostnameProvider returns the hostname provider described by 'provider',
+// or errInvalidHostnameProvider if it is not recognized.
+func parseHostnameProvider(provider string) (hostnameProvider, error) {
+	switch {
+	case provider == upnpHostnameProvider:
+		return upnpProvider{}, nil
+	case strings.HasPrefix(provider, staticHostnameProviderPrefix):
+		hostname := strings.TrimPrefix(provider, staticHostnameProviderPrefix)
+		if hostname == "" || strings.ContainsAny(hostname, " \t/") {
+			return nil, errInvalidHostnameProvider
+		}
+		return staticProvider{hostname: hostname}, nil
+	case strings.HasPrefix(provider, stunHostnameProviderPrefix):
+		server := strings.TrimPrefix(provider, stunHostnameProviderPrefix)
+		host, port, err := net.SplitHostPort(server)
+		if err != nil || host == "" || port == "" {
+			return nil, errInvalidHostnameProvider
+		}
+		return stunProvider{server: server}, nil
+	}
+	u, err := url.Parse(provider)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errInvalidHostnameProvider
+	}
+	return httpProvider{url: provider}, nil
+}
+
+// parseHostnameProviders parses each of the provided hostname providers,
+// returning an error if any of them is not recognized.
+func parseHostnameProviders(providers []string) ([]hostnameProvider, error) {
+	parsed := make([]hostnameProvider, 0, len(providers))
+	for _, provider := range providers {
+		p, err := parseHostnameProvider(provider)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, p)
+	}
+	return parsed, nil
+}
+
+// checkHostnameProviders returns an error if any of the provided hostname
+// providers is not recognized.
+func checkHostnameProviders(providers []string) error {
+	_, err := parseHostnameProviders(providers)
+	return err
+}
+
+// discoverHostname tries each of the hostname providers in order, returning
+// the hostname reported by the first provider to succeed along with that
+// provider. The names of the providers are resolved using 'resolver', or the
+// system resolver if 'resolver' is nil.
+func discoverHostname(providers []hostnameProvider, resolver *net.Resolver) (hostname string, provider hostnameProvider, err error) {
+	err = errNoHostnameProviders
+	for _, p := range providers {
+		hostname, err = p.discover(resolver)
+		if err == nil {
+			return hostname, p, nil
+		}
+	}
+	return "", nil, err
+}
+
 // myExternalIP discovers the host's external IP by querying a centralized
-// service, http://myexternalip.com.
-func myExternalIP() (string, error) {
+// service, such as http://myexternalip.com, which responds with the IP as
+// plain text.
+func myExternalIP(service string, resolver *net.Resolver) (string, error) {
 	// timeout after 10 seconds
-	client := http.Client{Timeout: time.Duration(10 * time.Second)}
-	resp, err := client.Get("http://myexternalip.com/raw")
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Resolver: resolver}
+	// The transport is used for a single request, so keep-alives are
+	// disabled to avoid leaking an idle connection on every call.
+	client := http.Client{
+		Timeout: time.Duration(10 * time.Second),
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			DialContext:       dialer.DialContext,
+			DisableKeepAlives: true,
+		},
+	}
+	resp, err := client.Get(service)
 	if err != nil {
 		return "", err
 	}
@@ -35,53 +211,67 @@ func myExternalIP() (string, error) {
 		return "", err
 	}
 	if len(buf) == 0 {
-		return "", errors.New("myexternalip.com returned a 0 length IP address")
+		return "", errors.New(service + " returned a 0 length IP address")
 	}
 	// trim newline
 	return strings.TrimSpace(string(buf)), nil
 }
 
+// SetResolver sets the resolver that the host uses to resolve hostnames
+// during hostname discovery and the self-dial check, such as a resolver that
+// queries a specific DNS server. Setting nil restores the system resolver.
+func (h *Host) SetResolver(r *net.Resolver) {
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	h.resolver = r
+}
+
 // managedLearnHostname discovers the external IP of the Host. If the host's
 // net address is blank and the host's auto address appears to have changed,
-// the host will make an announcement on the blockchain.
-func (h *Host) managedLearnHostname() {
+// the host will make an announcement on the blockchain. An error is returned if
+// the external IP of the host could not be discovered.
+func (h *Host) managedLearnHostname() error {
 	if build.Release == "testing" {
-		return
+		return nil
 	}
 	lockID := h.mu.RLock()
 	netAddr := h.settings.NetAddress
+	providers := h.settings.HostnameProviders
+	resolver := h.resolver
 	h.mu.RUnlock(lockID)
 	// If the settings indicate that an address has been manually set, there is
 	// no reason to learn the hostname.
 	if netAddr != "" {
-		return
+		return nil
 	}
 
-	// try UPnP first, then fallback to myexternalip.com
-	var hostname string
-	d, err := upnp.Discover()
-	if err == nil {
-		hostname, err = d.ExternalIP()
+	// Try each of the configured hostname providers in order.
+	if len(providers) == 0 {
+		providers = defaultHostnameProviders
 	}
+	parsed, err := parseHostnameProviders(providers)
 	if err != nil {
-		hostname, err = myExternalIP()
+		h.log.Println("WARN: failed to discover external IP:", err)
+		return err
 	}
+	hostname, provider, err := discoverHostname(parsed, resolver)
 	if err != nil {
-		h.log.Println("WARN: failed to discover external IP")
-		return
+		h.log.Println("WARN: failed to discover external IP:", err)
+		return err
 	}
+	h.log.Printf("INFO: external hostname %v reported by hostname provider %v", hostname, provider)
 
 	lockID = h.mu.Lock()
 	defer h.mu.Unlock(lockID)
 	autoAddress := modules.NetAddress(net.JoinHostPort(hostname, h.port))
 	if err := autoAddress.IsValid(); err != nil {
 		h.log.Printf("WARN: discovered hostname %q is invalid: %v", autoAddress, err)
-		return
+		return err
 	}
 	if autoAddress == h.autoAddress && h.announced {
 		// Nothing to do - the auto address has not changed and the previous
 		// annoucement was successful.
-		return
+		return nil
 	}
 
 	h.autoAddress = autoAddress
@@ -94,7 +284,12 @@ func (h *Host) managedLearnHostname() {
 	// has a storage obligation. If the host is not accepting contracts and has
 	// no open contracts, there is no reason to notify anyone that the host's
 	// address has changed.
-	if h.settings.AcceptingContracts || h.financialMetrics.ContractCount > 0 {
+	if h.settings.AnnounceWhenReachable && !h.reachabilityConfirmed {
+		// Wait until the new address has been confirmed to be reachable.
+		h.announced = false
+		h.announcePending = true
+		h.log.Debugln("deferring announcement of", autoAddress, "until the host is reachable")
+	} else if h.settings.AcceptingContracts || h.financialMetrics.ContractCount > 0 {
 		err = h.announce(autoAddress)
 		if err != nil {
 			// Set h.announced to false, as the address has changed yet the
@@ -103,15 +298,51 @@ func (h *Host) managedLearnHostname() {
 			h.log.Debugln("unable to announce address after upnp-detected address change:", err)
 		}
 	}
+	return nil
 }
 
-// managedForwardPort adds a port mapping to the router.
+// managedRunUPnP runs a UPnP request, giving up if the request does not
+// complete within the port forwarding timeout or if 'stop' is closed. The
+// go-upnp package cannot cancel a request, so a request that is given up on
+// continues in the background until the router responds or the request fails,
+// but it no longer delays the caller.
+func (h *Host) managedRunUPnP(request func() error, stop <-chan struct{}) error {
+	lockID := h.mu.RLock()
+	timeout := h.settings.PortForwardTimeout
+	h.mu.RUnlock(lockID)
+	if timeout == 0 {
+		timeout = defaultPortForwardTimeout
+	}
+
+	// The channel is buffered so that an abandoned request can still exit.
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- request()
+	}()
+	select {
+	case err := <-errChan:
+		return err
+	case <-time.After(timeout):
+		h.log.Printf("WARN: UPnP request timed out after %v, the router may be unresponsive", timeout)
+		return errPortForwardTimeout
+	case <-stop:
+		return errHostClosed
+	}
+}
+
+// managedForwardPort adds a port mapping to the router for the port that the
+// host is listening on. The host gives up on forwarding when it shuts down.
 func (h *Host) managedForwardPort() error {
-	// If the port is invalid, there is no need to perform any of the other
-	// tasks.
 	lockID := h.mu.RLock()
 	port := h.port
 	h.mu.RUnlock(lockID)
+	return h.managedRunUPnP(func() error { return h.forwardPort(port) }, h.tg.StopChan())
+}
+
+// forwardPort adds a port mapping to the router.
+func (h *Host) forwardPort(port string) error {
+	// If the port is invalid, there is no need to perform any of the other
+	// tasks.
 	portInt, err := strconv.Atoi(port)
 	if err != nil {
 		return err
@@ -133,13 +364,20 @@ func (h *Host) managedForwardPort() error {
 	return nil
 }
 
-// managedClearPort removes a port mapping from the router.
+// managedClearPort removes the port mapping for the port that the host is
+// listening on from the router. The mapping is usually cleared during
+// shutdown, so only the timeout applies.
 func (h *Host) managedClearPort() error {
-	// If the port is invalid, there is no need to perform any of the other
-	// tasks.
 	lockID := h.mu.RLock()
 	port := h.port
 	h.mu.RUnlock(lockID)
+	return h.managedRunUPnP(func() error { return h.clearPort(port) }, nil)
+}
+
+// clearPort removes a port mapping from the router.
+func (h *Host) clearPort(port string) error {
+	// If the port is invalid, there is no need to perform any of the other
+	// tasks.
 	portInt, err := strconv.Atoi(port)
 	if err != nil {
 		return err
@@ -0,0 +1,192 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestCheckHostnameProviders checks that only UPnP, http(s) urls, static
+// hostnames and STUN servers are accepted as hostname providers.
+func TestCheckHostnameProviders(t *testing.T) {
+	valid := []string{"upnp", "http://myexternalip.com/raw", "https://example.com/ip", "static:203.0.113.7", "stun:stun.example.com:3478"}
+	if err := checkHostnameProviders(valid); err != nil {
+		t.Error("valid providers were rejected:", err)
+	}
+	if err := checkHostnameProviders(defaultHostnameProviders); err != nil {
+		t.Error("default providers were rejected:", err)
+	}
+	for _, provider := range []string{"", "stun", "stun:example.com", "static:", "ftp://example.com", "http://"} {
+		if err := checkHostnameProviders([]string{provider}); err != errInvalidHostnameProvider {
+			t.Errorf("provider %q: expected %v, got %v", provider, errInvalidHostnameProvider, err)
+		}
+	}
+}
+
+// TestDiscoverHostname checks that discoverHostname falls through failing
+// providers until one succeeds.
+func TestDiscoverHostname(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "203.0.113.7")
+	}))
+	defer working.Close()
+
+	hostname, provider, err := discoverHostname([]hostnameProvider{httpProvider{failing.URL}, httpProvider{working.URL}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hostname != "203.0.113.7" {
+		t.Error("wrong hostname discovered:", hostname)
+	}
+	if provider.String() != working.URL {
+		t.Error("wrong provider reported:", provider)
+	}
+
+	// A static provider after a failing one should answer.
+	hostname, provider, err = discoverHostname([]hostnameProvider{httpProvider{failing.URL}, staticProvider{"host.example.com"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hostname != "host.example.com" || provider.String() != "static:host.example.com" {
+		t.Errorf("expected host.example.com from the static provider, got %v from %v", hostname, provider)
+	}
+
+	_, _, err = discoverHostname([]hostnameProvider{httpProvider{failing.URL}}, nil)
+	if err == nil {
+		t.Error("expected an error when all providers fail")
+	}
+	_, _, err = discoverHostname(nil, nil)
+	if err != errNoHostnameProviders {
+		t.Errorf("expected %v, got %v", errNoHostnameProviders, err)
+	}
+}
+
+// TestMyExternalIPClosesConnections checks that myExternalIP does not leave
+// idle connections to the provider open.
+func TestMyExternalIPClosesConnections(t *testing.T) {
+	closed := make(chan struct{}, 1)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "203.0.113.7")
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed <- struct{}{}
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	if _, err := myExternalIP(srv.URL, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection to the provider was left open")
+	}
+}
+
+// TestDiscoverHostnameResolver checks that the names of hostname providers
+// are resolved using the provided resolver.
+func TestDiscoverHostnameResolver(t *testing.T) {
+	queried := make(chan struct{}, 16)
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(context.Context, string, string) (net.Conn, error) {
+			queried <- struct{}{}
+			return nil, errors.New("resolver unavailable")
+		},
+	}
+	_, _, err := discoverHostname([]hostnameProvider{httpProvider{"http://ip.sia.test/raw"}}, resolver)
+	if err == nil {
+		t.Fatal("discovery succeeded despite the resolver failing")
+	}
+	select {
+	case <-queried:
+	default:
+		t.Fatal("provided resolver was not used")
+	}
+}
+
+// TestHostnameRetryInterval checks that failed hostname checks are retried
+// with an exponential backoff.
+func TestHostnameRetryInterval(t *testing.T) {
+	tests := []struct {
+		failures int
+		interval time.Duration
+	}{
+		{0, hostnameCheckInterval},
+		{1, hostnameRetryMinInterval},
+		{2, 2 * hostnameRetryMinInterval},
+		{3, 4 * hostnameRetryMinInterval},
+		{5, 16 * hostnameRetryMinInterval},
+		{6, hostnameCheckInterval},
+		{1000, hostnameCheckInterval},
+	}
+	for _, test := range tests {
+		if interval := hostnameRetryInterval(test.failures); interval != test.interval {
+			t.Errorf("after %v failures: expected %v, got %v", test.failures, test.interval, interval)
+		}
+	}
+}
+
+// TestRunUPnPTimeout checks that UPnP requests that do not complete are given
+// up on after the port forwarding timeout, or when the host shuts down.
+func TestRunUPnPTimeout(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestRunUPnPTimeout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	settings := ht.host.InternalSettings()
+	settings.PortForwardTimeout = 50 * time.Millisecond
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hang := make(chan struct{})
+	defer close(hang)
+	request := func() error {
+		<-hang
+		return nil
+	}
+
+	err = ht.host.managedRunUPnP(func() error { return nil }, nil)
+	if err != nil {
+		t.Fatal("completed request returned an error:", err)
+	}
+	start := time.Now()
+	err = ht.host.managedRunUPnP(request, nil)
+	if err != errPortForwardTimeout {
+		t.Fatalf("expected %v, got %v", errPortForwardTimeout, err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("request took too long to time out")
+	}
+
+	stop := make(chan struct{})
+	close(stop)
+	settings.PortForwardTimeout = time.Hour
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ht.host.managedRunUPnP(request, stop)
+	if err != errHostClosed {
+		t.Fatalf("expected %v, got %v", errHostClosed, err)
+	}
+}
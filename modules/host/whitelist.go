@@ -0,0 +1,64 @@
+package host
+
+import (
+	"errors"
+	"net"
+)
+
+var (
+	// errEmptyWhitelist is returned when whitelist mode is enabled without
+	// any whitelisted addresses, which would refuse every connection.
+	errEmptyWhitelist = errors.New("whitelist mode is enabled, but the whitelist is empty")
+
+	// errInvalidWhitelistEntry is returned when an entry of the whitelist is
+	// neither an IP address nor a range in CIDR notation.
+	errInvalidWhitelistEntry = errors.New("whitelist entry is neither an IP address nor a range in CIDR notation")
+)
+
+// parseWhitelist parses the entries of the whitelist, each of which is either
+// a single IP address or a range in CIDR notation, returning an error if any
+// of them is invalid or if whitelist mode is enabled with an empty whitelist.
+func parseWhitelist(enabled bool, whitelist []string) ([]*net.IPNet, error) {
+	if enabled && len(whitelist) == 0 {
+		return nil, errEmptyWhitelist
+	}
+	nets := make([]*net.IPNet, 0, len(whitelist))
+	for _, entry := range whitelist {
+		if _, ipnet, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, ipnet)
+			continue
+		}
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, errInvalidWhitelistEntry
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return nets, nil
+}
+
+// whitelisted returns true if the host is willing to serve connections from
+// the provided remote address. All addresses are served unless whitelist mode
+// is enabled, in which case the address must be an IP that falls within one
+// of the whitelisted ranges.
+func (h *Host) whitelisted(addr string) bool {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	if !h.settings.WhitelistEnabled {
+		return true
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, ipnet := range h.whitelist {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package host
+
+import (
+	"net"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	siasync "github.com/NebulousLabs/Sia/sync"
+)
+
+// TestParseWhitelist probes the validation of the whitelist settings.
+func TestParseWhitelist(t *testing.T) {
+	tests := []struct {
+		enabled   bool
+		whitelist []string
+		err       error
+	}{
+		{false, nil, nil},
+		{true, []string{"10.0.0.0/16"}, nil},
+		{false, []string{"10.0.0.0/16", "192.168.1.5", "::1"}, nil},
+		{true, nil, errEmptyWhitelist},
+		{false, []string{"10.0.0.0/16", ""}, errInvalidWhitelistEntry},
+		{false, []string{"10.0."}, errInvalidWhitelistEntry},
+	}
+	for _, test := range tests {
+		if _, err := parseWhitelist(test.enabled, test.whitelist); err != test.err {
+			t.Errorf("parseWhitelist(%v, %v): expected %v, got %v", test.enabled, test.whitelist, test.err, err)
+		}
+	}
+}
+
+// TestWhitelisted checks that a whitelisted address admits only itself, and
+// not the addresses that it is a textual prefix of.
+func TestWhitelisted(t *testing.T) {
+	whitelist, err := parseWhitelist(true, []string{"192.168.1.5", "10.0.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Host{
+		mu:        siasync.New(modules.SafeMutexDelay, 2),
+		whitelist: whitelist,
+	}
+	h.settings.WhitelistEnabled = true
+	tests := []struct {
+		addr        string
+		whitelisted bool
+	}{
+		{"192.168.1.5", true},
+		{"192.168.1.50", false},
+		{"192.168.1.59", false},
+		{"10.0.255.1", true},
+		{"10.1.0.1", false},
+		{"foo.com", false},
+	}
+	for _, test := range tests {
+		if h.whitelisted(test.addr) != test.whitelisted {
+			t.Errorf("whitelisted(%v): expected %v", test.addr, test.whitelisted)
+		}
+	}
+}
+
+// TestWhitelist checks that the host closes connections from addresses that
+// are not whitelisted, and that the whitelist can be updated at runtime.
+func TestWhitelist(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestWhitelist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	// ping performs a ping RPC against the host.
+	ping := func() error {
+		conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		err = encoding.WriteObject(conn, modules.RPCPing)
+		if err != nil {
+			return err
+		}
+		err = encoding.WriteObject(conn, [8]byte{})
+		if err != nil {
+			return err
+		}
+		var resp modules.HostPingResponse
+		return encoding.ReadObject(conn, &resp, 256)
+	}
+
+	settings := ht.host.InternalSettings()
+	settings.WhitelistEnabled = true
+	settings.Whitelist = []string{"10.255.0.0/16"}
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ping() == nil {
+		t.Fatal("host served a connection from an address that is not whitelisted")
+	}
+	if ht.host.NetworkMetrics().WhitelistRejects != 1 {
+		t.Error("refused connection was not counted")
+	}
+
+	// Whitelist the loopback addresses.
+	settings.Whitelist = append(settings.Whitelist, "127.0.0.0/8", "::1")
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ping(); err != nil {
+		t.Fatal("host refused a whitelisted address:", err)
+	}
+}
+
+// TestBlacklist checks that the host validates the blacklist, and closes
+// connections from blacklisted ranges.
+func TestBlacklist(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester("TestBlacklist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ht.Close()
+
+	ping := func() error {
+		conn, err := net.Dial("tcp", string(ht.host.NetAddress()))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		err = encoding.WriteObject(conn, modules.RPCPing)
+		if err != nil {
+			return err
+		}
+		err = encoding.WriteObject(conn, [8]byte{})
+		if err != nil {
+			return err
+		}
+		var resp modules.HostPingResponse
+		return encoding.ReadObject(conn, &resp, 256)
+	}
+
+	settings := ht.host.InternalSettings()
+	settings.Blacklist = []string{"127.0.0.1"}
+	if err := ht.host.SetInternalSettings(settings); err == nil {
+		t.Fatal("blacklist entry without a prefix length was accepted")
+	}
+
+	settings.Blacklist = []string{"10.0.0.0/8"}
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ping(); err != nil {
+		t.Fatal("host refused a connection outside of the blacklist:", err)
+	}
+
+	settings.Blacklist = []string{"10.0.0.0/8", "127.0.0.0/8", "::1/128"}
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ping() == nil {
+		t.Fatal("host served a connection from a blacklisted range")
+	}
+	if ht.host.NetworkMetrics().BlacklistRejects != 1 {
+		t.Error("refused connection was not counted")
+	}
+}
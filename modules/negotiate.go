@@ -2,8 +2,11 @@ package modules
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"io"
+	"io/ioutil"
+	"reflect"
 	"time"
 
 	"github.com/NebulousLabs/Sia/build"
@@ -54,12 +57,38 @@ const (
 	// tree calculations that may be involved with renewing a file contract.
 	NegotiateRenewContractTime = 600 * time.Second
 
+	// NegotiatePingTime establishes the amount of time that the connection
+	// deadline is set to when a host is being pinged. A ping is tiny, so the
+	// deadline is kept short.
+	NegotiatePingTime = 15 * time.Second
+
+	// NegotiateHostMetricsTime establishes the amount of time that the
+	// connection deadline is set to when the metrics of a host are being
+	// requested.
+	NegotiateHostMetricsTime = 15 * time.Second
+
 	// NegotiateSettingsTime establishes the minimum amount of time that the
 	// connection deadline is expected to be set to when settings are being
 	// requested from the host. The deadline is long enough that the connection
 	// should be successful even if both parties are on Tor.
 	NegotiateSettingsTime = 120 * time.Second
 
+	// NegotiateAuthSettingsTime establishes the amount of time that the
+	// connection deadline is set to when settings are being requested
+	// through RPCAuthSettings. The deadline includes the time that the
+	// caller needs to solve the settings challenge.
+	NegotiateAuthSettingsTime = 180 * time.Second
+
+	// MaxSettingsChallengeDifficulty is the highest difficulty that a host
+	// may require of a settings challenge. Solving a challenge of the maximum
+	// difficulty takes about 2^24 hashes.
+	MaxSettingsChallengeDifficulty = 24
+
+	// NegotiateUpdateSettingsTime establishes the amount of time that the
+	// connection deadline is set to when the settings of a host are being
+	// updated remotely.
+	NegotiateUpdateSettingsTime = 60 * time.Second
+
 	// NegotiateMaxDownloadActionRequestSize defines the maximum size that a
 	// download request can be. Note, this is not a max size for the data that
 	// can be requested, but instead is a max size for the definition of the
@@ -87,6 +116,10 @@ const (
 	// encoded HostExternalSettings.
 	NegotiateMaxHostExternalSettingsLen = 16000
 
+	// NegotiateMaxHostUpdateSettingsRequestLen is the maximum allowed size
+	// of an encoded HostUpdateSettingsRequest.
+	NegotiateMaxHostUpdateSettingsRequestLen = 64e3
+
 	// NegotiateMaxSiaPubkeySize defines the maximum size that a SiaPubkey is
 	// allowed to be when being sent over the wire during negotiation.
 	NegotiateMaxSiaPubkeySize = 1e3
@@ -134,6 +167,14 @@ var (
 	// wrong number of transaction signatures.
 	ErrRevisionSigCount = errors.New("file contract revision has the wrong number of transaction signatures")
 
+	// ErrSettingsChallengeTooHard is returned when a host requires a
+	// settings challenge that is harder than MaxSettingsChallengeDifficulty.
+	ErrSettingsChallengeTooHard = errors.New("settings challenge is harder than the maximum difficulty")
+
+	// ErrSettingsExtensionRevision is returned by ReadSettingsExtension if
+	// the extension was not sent with the settings that it accompanies.
+	ErrSettingsExtensionRevision = errors.New("settings extension does not match the revision of the settings")
+
 	// ErrStopResponse is the error returned by ReadNegotiationAcceptance when
 	// it reads the StopResponse string.
 	ErrStopResponse = errors.New("sender wishes to stop communicating")
@@ -143,6 +184,16 @@ var (
 	// announcement will follow this prefix.
 	PrefixHostAnnouncement = types.Specifier{'H', 'o', 's', 't', 'A', 'n', 'n', 'o', 'u', 'n', 'c', 'e', 'm', 'e', 'n', 't'}
 
+	// PrefixHostUpdateSettings begins every HostUpdateSettingsRequest, so that
+	// a signature on a settings update cannot be mistaken for a signature on
+	// any other object signed by the host.
+	PrefixHostUpdateSettings = types.Specifier{'U', 'p', 'd', 'a', 't', 'e', 'S', 'e', 't', 't', 'i', 'n', 'g', 's', 'R', 'q'}
+
+	// RPCAuthSettings is the specifier for requesting settings from a host
+	// after solving a proof-of-work challenge. Hosts that require a
+	// challenge refuse RPCSettings from callers that have not solved one.
+	RPCAuthSettings = types.Specifier{'A', 'u', 't', 'h', 'S', 'e', 't', 't', 'i', 'n', 'g', 's'}
+
 	// RPCDownload is the specifier for downloading a file from a host.
 	RPCDownload = types.Specifier{'D', 'o', 'w', 'n', 'l', 'o', 'a', 'd', 2}
 
@@ -156,6 +207,14 @@ var (
 	// contract.
 	RPCReviseContract = types.Specifier{'R', 'e', 'v', 'i', 's', 'e', 'C', 'o', 'n', 't', 'r', 'a', 'c', 't', 2}
 
+	// RPCHostMetrics is the specifier for requesting the public metrics of a
+	// host.
+	RPCHostMetrics = types.Specifier{'H', 'o', 's', 't', 'M', 'e', 't', 'r', 'i', 'c', 's'}
+
+	// RPCPing is the specifier for checking that a host is reachable without
+	// requesting the full host settings.
+	RPCPing = types.Specifier{'P', 'i', 'n', 'g'}
+
 	// RPCRecentRevision is the specifier for getting the most recent file
 	// contract revision for a given file contract.
 	RPCRecentRevision = types.Specifier{'R', 'e', 'c', 'e', 'n', 't', 'R', 'e', 'v', 'i', 's', 'i', 'o', 'n', 2}
@@ -163,6 +222,10 @@ var (
 	// RPCSettings is the specifier for requesting settings from the host.
 	RPCSettings = types.Specifier{'S', 'e', 't', 't', 'i', 'n', 'g', 's', 2}
 
+	// RPCUpdateSettings is the specifier for replacing the internal settings
+	// of a host remotely. The request must be signed by the host's own key.
+	RPCUpdateSettings = types.Specifier{'U', 'p', 'd', 'a', 't', 'e', 'S', 'e', 't', 't', 'i', 'n', 'g', 's'}
+
 	// SectorSize defines how large a sector should be in bytes. The sector
 	// size needs to be a power of two to be compatible with package
 	// merkletree. 4MB has been chosen for the live network because large
@@ -265,6 +328,92 @@ type (
 		Version        string `json:"version"`
 	}
 
+	// HostSettingsExtension holds the parameters advertised by the host that
+	// are not part of HostExternalSettings. Fields cannot be added to
+	// HostExternalSettings without breaking the decoding of settings between
+	// peers of different versions, so the extension is signed separately and
+	// sent directly after the external settings in response to RPCSettings
+	// and RPCAuthSettings. Renters that predate the extension stop reading
+	// after the external settings, and hosts that predate it close the
+	// connection instead of sending it, which ReadSettingsExtension reports
+	// as an empty extension. Fields are only ever appended to the extension,
+	// and fields missing from the end of an extension are decoded as zero, so
+	// that extensions of different versions remain compatible.
+	HostSettingsExtension struct {
+		// SettingsRevision is the revision number of the external settings
+		// that the extension was sent with. It binds the extension to those
+		// settings, so that an extension cannot be replayed alongside other
+		// settings.
+		SettingsRevision uint64 `json:"settingsrevision"`
+
+		// Mode is the mode of the host. Renters should not attempt to form
+		// or renew contracts with a host that is not in HostModeLive.
+		Mode HostMode `json:"mode"`
+
+		// TLS indicates that the host accepts connections wrapped in TLS, in
+		// addition to plaintext connections, on its usual address.
+		// TLSCertificateHash is the hash of the DER encoding of the
+		// certificate that the host serves. Because the extension is
+		// signed by the host, renters can pin TLS connections to the
+		// certificate without trusting any certificate authority.
+		TLS                bool        `json:"tls"`
+		TLSCertificateHash crypto.Hash `json:"tlscertificatehash"`
+
+		// RemainingCollateralBudget is the amount of collateral that the host
+		// can still lock into new contracts before its collateral budget is
+		// exhausted. Hosts that predate the field leave
+		// CollateralBudgetReported unset, and their remaining budget is
+		// unknown.
+		CollateralBudgetReported  bool           `json:"collateralbudgetreported"`
+		RemainingCollateralBudget types.Currency `json:"remainingcollateralbudget"`
+	}
+
+	// HostPingResponse is the response sent by the host to an RPCPing. The
+	// nonce is an echo of the nonce provided by the caller, and the time is
+	// the current time according to the host.
+	HostPingResponse struct {
+		Nonce [8]byte
+		Time  types.Timestamp
+	}
+
+	// HostMetricsResponse is the response sent by the host to an
+	// RPCHostMetrics. It is a subset of the network metrics of the host that
+	// does not reveal anything about the callers of the host. Uptime is the
+	// number of seconds since the host was started.
+	HostMetricsResponse struct {
+		DownloadCalls      uint64
+		DownloadThroughput uint64 // bytes per second
+		ErrorCalls         uint64
+		FormContractCalls  uint64
+		RenewCalls         uint64
+		ReviseCalls        uint64
+		SettingsCalls      uint64
+		TimeoutCalls       uint64
+		Uptime             uint64
+	}
+
+	// HostUpdateSettingsRequest is sent, signed by the secret key of the
+	// host, by the caller of an RPCUpdateSettings. Settings holds the JSON
+	// encoding of the new HostInternalSettings, because the binary encoding
+	// does not support maps. RevisionNumber must match the revision number
+	// in the current external settings of the host, so that a request cannot
+	// be replayed once the settings have changed. Specifier must be
+	// PrefixHostUpdateSettings.
+	HostUpdateSettingsRequest struct {
+		Specifier      types.Specifier
+		RevisionNumber uint64
+		Settings       []byte
+	}
+
+	// A SettingsChallenge is sent by the host at the start of an
+	// RPCAuthSettings. The caller must respond with a solution such that the
+	// hash of the nonce followed by the solution begins with at least
+	// Difficulty zero bits. A difficulty of zero accepts any solution.
+	SettingsChallenge struct {
+		Nonce      [16]byte
+		Difficulty uint64
+	}
+
 	// A RevisionAction is a description of an edit to be performed on a file
 	// contract. Three types are allowed, 'ActionDelete', 'ActionInsert', and
 	// 'ActionModify'. ActionDelete just takes a sector index, indicating which
@@ -326,12 +475,91 @@ func WriteNegotiationRejection(w io.Writer, err error) error {
 	return err
 }
 
+// Verify returns true if the solution solves the challenge.
+func (sc SettingsChallenge) Verify(solution [16]byte) bool {
+	h := crypto.HashBytes(append(sc.Nonce[:], solution[:]...))
+	for i := uint64(0); i < sc.Difficulty; i++ {
+		if i/8 >= uint64(len(h)) || h[i/8]&(0x80>>(i%8)) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Solve returns a solution to the challenge. The time needed to find a
+// solution doubles with each unit of difficulty, so challenges that are
+// harder than MaxSettingsChallengeDifficulty are refused.
+func (sc SettingsChallenge) Solve() (solution [16]byte, err error) {
+	if sc.Difficulty > MaxSettingsChallengeDifficulty {
+		return solution, ErrSettingsChallengeTooHard
+	}
+	for n := uint64(0); ; n++ {
+		binary.LittleEndian.PutUint64(solution[:], n)
+		if sc.Verify(solution) {
+			return solution, nil
+		}
+	}
+}
+
 // WriteNegotiationStop writes the 'stop' response to w (usually a
 // net.Conn).
 func WriteNegotiationStop(w io.Writer) error {
 	return encoding.WriteObject(w, StopResponse)
 }
 
+// UnmarshalSia implements the encoding.SiaUnmarshaler interface. Fields are
+// decoded in order until the encoded extension is exhausted, and the fields
+// that follow are left zero, so that extensions sent by hosts that predate a
+// field can still be decoded.
+func (ext *HostSettingsExtension) UnmarshalSia(r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	br := bytes.NewReader(b)
+	dec := encoding.NewDecoder(br)
+	val := reflect.ValueOf(ext).Elem()
+	for i := 0; i < val.NumField() && br.Len() > 0; i++ {
+		err = dec.Decode(val.Field(i).Addr().Interface())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadSettingsExtension reads the signed settings extension that follows the
+// external settings sent by a host, and verifies its signature. 'revision' is
+// the revision number of the external settings that were read. If the host
+// closes the connection instead of sending an extension, it predates the
+// extension, and an empty extension is returned.
+func ReadSettingsExtension(r io.Reader, pk crypto.PublicKey, revision uint64) (HostSettingsExtension, error) {
+	var sig crypto.Signature
+	_, err := io.ReadFull(r, sig[:])
+	if err == io.EOF {
+		return HostSettingsExtension{}, nil
+	} else if err != nil {
+		return HostSettingsExtension{}, err
+	}
+	encExt, err := encoding.ReadPrefix(r, NegotiateMaxHostExternalSettingsLen)
+	if err != nil {
+		return HostSettingsExtension{}, err
+	}
+	err = crypto.VerifyHash(crypto.HashBytes(encExt), pk, sig)
+	if err != nil {
+		return HostSettingsExtension{}, err
+	}
+	var ext HostSettingsExtension
+	err = encoding.Unmarshal(encExt, &ext)
+	if err != nil {
+		return HostSettingsExtension{}, err
+	}
+	if ext.SettingsRevision != revision {
+		return HostSettingsExtension{}, ErrSettingsExtensionRevision
+	}
+	return ext, nil
+}
+
 // CreateAnnouncement will take a host announcement and encode it, returning
 // the exact []byte that should be added to the arbitrary data of a
 // transaction.
@@ -2,6 +2,7 @@ package modules
 
 import (
 	"bytes"
+	"reflect"
 	"testing"
 
 	"github.com/NebulousLabs/Sia/crypto"
@@ -128,3 +129,102 @@ func TestNegotiationResponses(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestSettingsChallenge checks that solutions found by Solve are accepted by
+// Verify, and that challenges beyond the maximum difficulty are refused.
+func TestSettingsChallenge(t *testing.T) {
+	t.Parallel()
+	sc := SettingsChallenge{Nonce: [16]byte{1, 2, 3}, Difficulty: 12}
+	solution, err := sc.Solve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sc.Verify(solution) {
+		t.Fatal("solution does not solve the challenge")
+	}
+	h := crypto.HashBytes(append(sc.Nonce[:], solution[:]...))
+	if h[0] != 0 || h[1]&0xf0 != 0 {
+		t.Fatal("solution hash does not have 12 leading zero bits:", h)
+	}
+
+	// A solution to one nonce should not solve another, at least for some
+	// nonces.
+	var rejected bool
+	for i := byte(0); i < 8 && !rejected; i++ {
+		other := sc
+		other.Nonce[15] = i + 1
+		rejected = !other.Verify(solution)
+	}
+	if !rejected {
+		t.Error("solution solves every challenge")
+	}
+
+	// Any solution solves a challenge of zero difficulty.
+	if !(SettingsChallenge{}).Verify([16]byte{}) {
+		t.Error("solution was refused by a challenge of zero difficulty")
+	}
+
+	sc.Difficulty = MaxSettingsChallengeDifficulty + 1
+	if _, err := sc.Solve(); err != ErrSettingsChallengeTooHard {
+		t.Error("expected ErrSettingsChallengeTooHard, got", err)
+	}
+}
+
+// TestReadSettingsExtension checks that settings extensions can be read from
+// hosts that send them, from hosts that predate them, and from hosts that
+// predate some of their fields.
+func TestReadSettingsExtension(t *testing.T) {
+	t.Parallel()
+	sk, pk, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A host that sends the settings and the extension.
+	buf := new(bytes.Buffer)
+	crypto.WriteSignedObject(buf, HostExternalSettings{RevisionNumber: 3}, sk)
+	crypto.WriteSignedObject(buf, HostSettingsExtension{SettingsRevision: 3, Mode: HostModeMaintenance}, sk)
+	var hes HostExternalSettings
+	if err := crypto.ReadSignedObject(buf, &hes, NegotiateMaxHostExternalSettingsLen, pk); err != nil {
+		t.Fatal(err)
+	}
+	ext, err := ReadSettingsExtension(buf, pk, hes.RevisionNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ext.Mode != HostModeMaintenance || ext.SettingsRevision != 3 {
+		t.Error("wrong extension:", ext)
+	}
+
+	// A host that predates the extension sends nothing.
+	ext, err = ReadSettingsExtension(new(bytes.Buffer), pk, 3)
+	if err != nil || !reflect.DeepEqual(ext, HostSettingsExtension{}) {
+		t.Error("missing extension was not read as empty:", ext, err)
+	}
+
+	// A host that predates the mode field.
+	buf.Reset()
+	crypto.WriteSignedObject(buf, uint64(3), sk)
+	ext, err = ReadSettingsExtension(buf, pk, 3)
+	if err != nil || !reflect.DeepEqual(ext, HostSettingsExtension{SettingsRevision: 3}) {
+		t.Error("truncated extension was not decoded:", ext, err)
+	}
+
+	// An extension sent with other settings is refused.
+	buf.Reset()
+	crypto.WriteSignedObject(buf, HostSettingsExtension{SettingsRevision: 2}, sk)
+	if _, err := ReadSettingsExtension(buf, pk, 3); err != ErrSettingsExtensionRevision {
+		t.Error("expected ErrSettingsExtensionRevision, got", err)
+	}
+
+	// An extension signed by another key is refused.
+	otherSK, _, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	crypto.WriteSignedObject(buf, HostSettingsExtension{SettingsRevision: 3}, otherSK)
+	if _, err := ReadSettingsExtension(buf, pk, 3); err == nil {
+		t.Error("extension signed by another key was accepted")
+	}
+}
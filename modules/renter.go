@@ -95,9 +95,11 @@ type RenterFinancialMetrics struct {
 }
 
 // A HostDBEntry represents one host entry in the Renter's host DB. It
-// aggregates the host's external settings with its public key.
+// aggregates the host's external settings and settings extension with its
+// public key.
 type HostDBEntry struct {
 	HostExternalSettings
+	HostSettingsExtension
 	PublicKey types.SiaPublicKey `json:"publickey"`
 }
 
@@ -0,0 +1,99 @@
+package hostdb
+
+// announcementcache.go caches the host announcements found in recently
+// processed blocks. During reorgs the same blocks are often applied several
+// times, and the cache prevents the transactions of those blocks from being
+// parsed again each time.
+
+import (
+	"container/list"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// announcementCacheSize is the number of blocks for which the host
+	// announcements are cached.
+	announcementCacheSize = 1000
+)
+
+type (
+	// blockKey identifies a block in the announcement cache. Computing the
+	// ID of a block requires hashing all of its transactions, which would
+	// cost as much as parsing them, so blocks are keyed by their parent and
+	// height instead.
+	blockKey struct {
+		parentID types.BlockID
+		height   types.BlockHeight
+	}
+
+	// blockAnnouncements holds the host announcements found in a block. The
+	// nonce and timestamp of the block tell apart sibling blocks, which share
+	// a key.
+	blockAnnouncements struct {
+		key           blockKey
+		nonce         types.BlockNonce
+		timestamp     types.Timestamp
+		announcements []modules.HostDBEntry
+	}
+
+	// announcementCache is an LRU cache of the host announcements found in
+	// blocks, keyed by parent ID and height.
+	announcementCache struct {
+		limit   int
+		order   *list.List // Front is the most recently used block.
+		entries map[blockKey]*list.Element
+	}
+)
+
+// newAnnouncementCache returns an empty announcementCache that holds up to
+// 'limit' blocks.
+func newAnnouncementCache(limit int) *announcementCache {
+	return &announcementCache{
+		limit:   limit,
+		order:   list.New(),
+		entries: make(map[blockKey]*list.Element),
+	}
+}
+
+// announcements returns the host announcements found in the provided block at
+// the provided height, parsing the block only if it is not already in the
+// cache.
+func (ac *announcementCache) announcements(b types.Block, height types.BlockHeight) []modules.HostDBEntry {
+	key := blockKey{parentID: b.ParentID, height: height}
+	if elem, exists := ac.entries[key]; exists {
+		ba := elem.Value.(*blockAnnouncements)
+		if ba.nonce == b.Nonce && ba.timestamp == b.Timestamp {
+			ac.order.MoveToFront(elem)
+			return ba.announcements
+		}
+		// A sibling of the cached block; replace it.
+		ac.order.Remove(elem)
+		delete(ac.entries, key)
+	}
+
+	ba := &blockAnnouncements{
+		key:           key,
+		nonce:         b.Nonce,
+		timestamp:     b.Timestamp,
+		announcements: findHostAnnouncements(b),
+	}
+	ac.entries[key] = ac.order.PushFront(ba)
+	for ac.order.Len() > ac.limit {
+		oldest := ac.order.Back()
+		ac.order.Remove(oldest)
+		delete(ac.entries, oldest.Value.(*blockAnnouncements).key)
+	}
+	return ba.announcements
+}
+
+// blockHostAnnouncements returns the host announcements found in the provided
+// block at the provided height, using the announcement cache if the hostdb
+// has one.
+func (hdb *HostDB) blockHostAnnouncements(b types.Block, height types.BlockHeight) []modules.HostDBEntry {
+	if hdb.announcementCache == nil {
+		return findHostAnnouncements(b)
+	}
+	return hdb.announcementCache.announcements(b, height)
+}
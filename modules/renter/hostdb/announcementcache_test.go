@@ -0,0 +1,105 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// announcementBlocks returns 'n' distinct blocks, each containing a host
+// announcement and some unrelated arbitrary data.
+func announcementBlocks(tb testing.TB, n int) []types.Block {
+	annBytes, err := makeSignedAnnouncement("foo.com:1234")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	blocks := make([]types.Block, n)
+	for i := range blocks {
+		var txns []types.Transaction
+		for j := 0; j < 10; j++ {
+			txns = append(txns, types.Transaction{ArbitraryData: [][]byte{[]byte("not an announcement"), annBytes}})
+		}
+		blocks[i] = types.Block{Timestamp: types.Timestamp(i), Transactions: txns}
+	}
+	return blocks
+}
+
+// TestAnnouncementCache checks that the announcement cache returns the same
+// announcements as parsing the block, and that it stays within its limit.
+func TestAnnouncementCache(t *testing.T) {
+	ac := newAnnouncementCache(3)
+	blocks := announcementBlocks(t, 5)
+	for i, b := range blocks {
+		if len(ac.announcements(b, types.BlockHeight(i))) != len(findHostAnnouncements(b)) {
+			t.Fatal("cache returned the wrong announcements")
+		}
+	}
+	if ac.order.Len() != 3 || len(ac.entries) != 3 {
+		t.Fatal("cache grew beyond its limit:", ac.order.Len(), len(ac.entries))
+	}
+	if _, exists := ac.entries[blockKey{height: 0}]; exists {
+		t.Error("least recently used block was not evicted")
+	}
+
+	// A cached block should be moved to the front on use.
+	ac.announcements(blocks[2], 2)
+	ac.announcements(blocks[0], 0)
+	if _, exists := ac.entries[blockKey{height: 2}]; !exists {
+		t.Error("recently used block was evicted")
+	}
+	if _, exists := ac.entries[blockKey{height: 3}]; exists {
+		t.Error("least recently used block was not evicted")
+	}
+
+	// A sibling block shares the key of the cached block, but must not be
+	// given its announcements.
+	sibling := types.Block{Timestamp: blocks[0].Timestamp, Nonce: types.BlockNonce{1}}
+	if len(ac.announcements(sibling, 0)) != 0 {
+		t.Error("sibling block was given the announcements of the cached block")
+	}
+	if len(ac.entries) != 3 {
+		t.Error("sibling block was not replaced in the cache:", len(ac.entries))
+	}
+}
+
+// BenchmarkFindAnnouncements measures the cost of reprocessing several
+// thousand blocks without the announcement cache.
+func BenchmarkFindAnnouncements(b *testing.B) {
+	blocks := announcementBlocks(b, 2000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, block := range blocks {
+			findHostAnnouncements(block)
+		}
+	}
+}
+
+// BenchmarkAnnouncementCache measures the cost of reprocessing several
+// thousand blocks with the announcement cache.
+func BenchmarkAnnouncementCache(b *testing.B) {
+	blocks := announcementBlocks(b, 2000)
+	ac := newAnnouncementCache(len(blocks))
+	for i, block := range blocks {
+		ac.announcements(block, types.BlockHeight(i))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, block := range blocks {
+			ac.announcements(block, types.BlockHeight(j))
+		}
+	}
+}
+
+// BenchmarkAnnouncementCacheMiss measures the cost of processing several
+// thousand blocks that are not in the announcement cache, which includes
+// evicting the least recently used blocks.
+func BenchmarkAnnouncementCacheMiss(b *testing.B) {
+	blocks := announcementBlocks(b, 2000)
+	ac := newAnnouncementCache(len(blocks) / 2)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, block := range blocks {
+			ac.announcements(block, types.BlockHeight(i*len(blocks)+j))
+		}
+	}
+}
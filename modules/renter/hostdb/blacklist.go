@@ -0,0 +1,89 @@
+package hostdb
+
+// blacklist.go allows ranges of addresses to be excluded from the hostdb. Hosts
+// whose address falls within a blacklisted range are removed from the hostdb,
+// and their announcements are ignored. Only hosts that announce an IP address
+// are matched; hostnames are not resolved.
+
+import (
+	"net"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// blacklisted returns true if the address falls within a blacklisted range.
+func (hdb *HostDB) blacklisted(addr modules.NetAddress) bool {
+	ip := net.ParseIP(addr.Host())
+	if ip == nil {
+		return false
+	}
+	for _, ipnet := range hdb.blacklist {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// addBlacklist adds a range to the blacklist, returning the parsed range.
+func (hdb *HostDB) addBlacklist(cidr string) (*net.IPNet, error) {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if hdb.blacklist == nil {
+		hdb.blacklist = make(map[string]*net.IPNet)
+	}
+	hdb.blacklist[ipnet.String()] = ipnet
+	return ipnet, nil
+}
+
+// BlacklistCIDR adds a range of addresses, in CIDR notation, to the blacklist.
+// Known hosts within the range are removed from the hostdb, even if they are
+// pinned.
+func (hdb *HostDB) BlacklistCIDR(cidr string) error {
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+
+	ipnet, err := hdb.addBlacklist(cidr)
+	if err != nil {
+		return err
+	}
+	for addr := range hdb.allHosts {
+		if ip := net.ParseIP(addr.Host()); ip != nil && ipnet.Contains(ip) {
+			delete(hdb.pinned, addr)
+			hdb.removeHost(addr)
+		}
+	}
+	return hdb.save()
+}
+
+// UnblacklistCIDR removes a range of addresses from the blacklist. Hosts in
+// the range are added to the hostdb again when they next announce.
+func (hdb *HostDB) UnblacklistCIDR(cidr string) error {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return err
+	}
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	if _, exists := hdb.blacklist[ipnet.String()]; !exists {
+		return nil
+	}
+	delete(hdb.blacklist, ipnet.String())
+	return hdb.save()
+}
+
+// BlacklistedCIDRs returns the blacklisted ranges, in CIDR notation.
+func (hdb *HostDB) BlacklistedCIDRs() []string {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	cidrs := make([]string, 0, len(hdb.blacklist))
+	for cidr := range hdb.blacklist {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+	return cidrs
+}
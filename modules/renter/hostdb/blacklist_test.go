@@ -0,0 +1,70 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestBlacklistCIDR checks that blacklisted ranges remove known hosts, reject
+// new announcements, and persist.
+func TestBlacklistCIDR(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	for i := uint8(1); i <= 3; i++ {
+		entry := &hostEntry{
+			HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(i)},
+			Weight:      types.NewCurrency64(1),
+		}
+		hdb.allHosts[entry.NetAddress] = entry
+		hdb.insertNode(entry)
+	}
+	outside := &hostEntry{
+		HostDBEntry: modules.HostDBEntry{NetAddress: "10.0.0.1:1"},
+		Weight:      types.NewCurrency64(1),
+	}
+	hdb.allHosts[outside.NetAddress] = outside
+	hdb.insertNode(outside)
+	if err := hdb.Pin(fakeAddr(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hdb.BlacklistCIDR("127.0.0.1"); err == nil {
+		t.Fatal("range without a prefix length was accepted")
+	}
+	if err := hdb.BlacklistCIDR("127.0.0.0/24"); err != nil {
+		t.Fatal(err)
+	}
+	if len(hdb.allHosts) != 1 || len(hdb.activeHosts) != 1 {
+		t.Fatal("blacklisted hosts were not removed:", len(hdb.allHosts), len(hdb.activeHosts))
+	}
+	if _, exists := hdb.allHosts[outside.NetAddress]; !exists {
+		t.Error("host outside of the range was removed")
+	}
+	if hdb.isPinned(fakeAddr(1)) {
+		t.Error("blacklisted host is still pinned")
+	}
+
+	hdb.insertHost(modules.HostDBEntry{HostExternalSettings: modules.HostExternalSettings{NetAddress: fakeAddr(4)}})
+	if _, exists := hdb.allHosts[fakeAddr(4)]; exists {
+		t.Error("announcement of a blacklisted host was accepted")
+	}
+
+	hdb2 := bareHostDB()
+	hdb2.persist = hdb.persist
+	if err := hdb2.load(); err != nil {
+		t.Fatal(err)
+	}
+	if cidrs := hdb2.BlacklistedCIDRs(); len(cidrs) != 1 || cidrs[0] != "127.0.0.0/24" {
+		t.Error("blacklist was not persisted:", cidrs)
+	}
+
+	if err := hdb.UnblacklistCIDR("127.0.0.0/24"); err != nil {
+		t.Fatal(err)
+	}
+	hdb.insertHost(modules.HostDBEntry{HostExternalSettings: modules.HostExternalSettings{NetAddress: fakeAddr(4)}})
+	if _, exists := hdb.allHosts[fakeAddr(4)]; !exists {
+		t.Error("announcement was rejected after the range was removed")
+	}
+}
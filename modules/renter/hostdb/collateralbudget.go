@@ -0,0 +1,39 @@
+package hostdb
+
+// collateralbudget.go accounts for the remaining collateral budget advertised
+// by hosts. A host whose budget is nearly exhausted by other renters may not
+// be able to collateralize a new large contract, so its weight is reduced as
+// the budget runs out, and it is demoted to inactive once the budget is gone.
+
+import (
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// collateralBudgetHeadroom is the number of maximally collateralized
+	// contracts that the remaining collateral budget of a host must cover
+	// for the weight of the host to be left unadjusted. Below that, the
+	// weight falls linearly with the remaining budget.
+	collateralBudgetHeadroom = 10
+)
+
+// collateralBudgetDepleted returns true if the host has reported that it has
+// no collateral budget left for new contracts.
+func collateralBudgetDepleted(entry *hostEntry) bool {
+	return entry.CollateralBudgetReported && entry.RemainingCollateralBudget.IsZero()
+}
+
+// collateralBudgetAdjustment scales a weight according to the share of the
+// collateral headroom that is still covered by the remaining collateral
+// budget of the host. Hosts that do not report their budget, or that put up
+// no collateral, are not adjusted.
+func collateralBudgetAdjustment(weight types.Currency, entry hostEntry) types.Currency {
+	if !entry.CollateralBudgetReported || entry.MaxCollateral.IsZero() {
+		return weight
+	}
+	headroom := entry.MaxCollateral.Mul64(collateralBudgetHeadroom)
+	if entry.RemainingCollateralBudget.Cmp(headroom) >= 0 {
+		return weight
+	}
+	return weight.Mul(entry.RemainingCollateralBudget).Div(headroom)
+}
@@ -0,0 +1,84 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestCollateralBudgetAdjustment checks that the weight of a host falls with
+// its remaining collateral budget, and that hosts which do not report a budget
+// are not adjusted.
+func TestCollateralBudgetAdjustment(t *testing.T) {
+	weight := types.NewCurrency64(1000)
+	var entry hostEntry
+	entry.MaxCollateral = types.NewCurrency64(10)
+	if collateralBudgetAdjustment(weight, entry).Cmp(weight) != 0 {
+		t.Error("host that does not report its budget was adjusted")
+	}
+
+	entry.CollateralBudgetReported = true
+	entry.RemainingCollateralBudget = types.NewCurrency64(10 * collateralBudgetHeadroom)
+	if collateralBudgetAdjustment(weight, entry).Cmp(weight) != 0 {
+		t.Error("host with enough budget for the headroom was adjusted")
+	}
+	entry.RemainingCollateralBudget = types.NewCurrency64(10 * collateralBudgetHeadroom / 4)
+	if collateralBudgetAdjustment(weight, entry).Cmp(weight.Div64(4)) != 0 {
+		t.Error("host with a quarter of the headroom was not weighted at a quarter")
+	}
+	if collateralBudgetDepleted(&entry) {
+		t.Error("host with budget remaining was reported as depleted")
+	}
+	entry.RemainingCollateralBudget = types.ZeroCurrency
+	if !collateralBudgetDepleted(&entry) {
+		t.Error("host without budget remaining was not reported as depleted")
+	}
+}
+
+// TestCollateralBudgetSelection checks that selection skews away from a host
+// whose collateral budget is nearly exhausted, and that a host whose budget is
+// exhausted is demoted to inactive.
+func TestCollateralBudgetSelection(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	var settings [2]modules.HostExternalSettings
+	var exts [2]modules.HostSettingsExtension
+	for i, budget := range []uint64{1000, 10} {
+		entry := &hostEntry{HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(uint8(i))}}
+		settings[i].AcceptingContracts = true
+		settings[i].StoragePrice = types.NewCurrency64(1e6)
+		settings[i].Collateral = types.NewCurrency64(10)
+		settings[i].MaxCollateral = types.NewCurrency64(10)
+		exts[i].CollateralBudgetReported = true
+		exts[i].RemainingCollateralBudget = types.NewCurrency64(budget)
+		hdb.managedUpdateEntry(entry, settings[i], exts[i], nil)
+	}
+
+	var exhaustedCount int
+	trials := 1000
+	for i := 0; i < trials; i++ {
+		if hdb.RandomHosts(1, nil)[0].NetAddress == fakeAddr(1) {
+			exhaustedCount++
+		}
+	}
+	// The nearly exhausted host covers a tenth of the headroom, and is
+	// expected to be picked about 9% of the time.
+	if exhaustedCount > trials/4 {
+		t.Errorf("nearly exhausted host picked %v of %v times", exhaustedCount, trials)
+	}
+
+	exts[1].RemainingCollateralBudget = types.ZeroCurrency
+	hdb.managedUpdateEntry(hdb.allHosts[fakeAddr(1)], settings[1], exts[1], nil)
+	if _, active := hdb.activeHosts[fakeAddr(1)]; active {
+		t.Error("host with an exhausted budget is still active")
+	}
+	for i := 0; i < 20; i++ {
+		if hdb.RandomHosts(1, nil)[0].NetAddress != fakeAddr(0) {
+			t.Fatal("host with an exhausted budget was selected")
+		}
+	}
+}
@@ -3,17 +3,21 @@ package hostdb
 import (
 	"net"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 // These interfaces define the HostDB's dependencies. Using the smallest
 // interface possible makes it easier to mock these dependencies in testing.
 type (
 	consensusSet interface {
+		BlockAtHeight(types.BlockHeight) (types.Block, bool)
 		ConsensusSetSubscribe(modules.ConsensusSetSubscriber, modules.ConsensusChangeID) error
+		Unsubscribe(modules.ConsensusSetSubscriber)
 	}
 
 	dialer interface {
@@ -31,11 +35,26 @@ type (
 	}
 )
 
-// stdDialer implements the dialer interface via net.DialTimeout.
-type stdDialer struct{}
+// stdDialer implements the dialer interface via net.Dialer. Announced
+// hostnames are resolved using the resolver, or the system resolver if the
+// resolver is nil.
+type stdDialer struct {
+	resolver *net.Resolver
+	mu       sync.Mutex
+}
+
+func (d *stdDialer) DialTimeout(addr modules.NetAddress, timeout time.Duration) (net.Conn, error) {
+	d.mu.Lock()
+	nd := &net.Dialer{Timeout: timeout, Resolver: d.resolver}
+	d.mu.Unlock()
+	return nd.Dial("tcp", string(addr))
+}
 
-func (d stdDialer) DialTimeout(addr modules.NetAddress, timeout time.Duration) (net.Conn, error) {
-	return net.DialTimeout("tcp", string(addr), timeout)
+// setResolver sets the resolver used for subsequent dials.
+func (d *stdDialer) setResolver(r *net.Resolver) {
+	d.mu.Lock()
+	d.resolver = r
+	d.mu.Unlock()
 }
 
 // stdSleeper implements the sleeper interface via time.Sleep.
@@ -0,0 +1,34 @@
+package hostdb
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestSetResolver checks that the hostdb resolves announced hostnames using
+// the configured resolver.
+func TestSetResolver(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.dialer = new(stdDialer)
+
+	queried := make(chan struct{}, 16)
+	hdb.SetResolver(&net.Resolver{
+		PreferGo: true,
+		Dial: func(context.Context, string, string) (net.Conn, error) {
+			queried <- struct{}{}
+			return nil, errors.New("resolver unavailable")
+		},
+	})
+	_, err := hdb.dialer.DialTimeout("host.sia.test:9982", time.Second)
+	if err == nil {
+		t.Fatal("dial succeeded despite the resolver failing")
+	}
+	select {
+	case <-queried:
+	default:
+		t.Fatal("configured resolver was not used")
+	}
+}
@@ -0,0 +1,72 @@
+package hostdb
+
+// detailed.go selects a random host together with every metric that the
+// hostdb tracks for it, so that debuggers and advanced renters can see why a
+// host was chosen without a second lookup that may observe different state.
+
+import (
+	"errors"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var errNoAcceptingHost = errors.New("no active host is accepting contracts")
+
+// HostRecord is a host entry along with the metrics that the hostdb tracks
+// for the host. SuccessRate is the decayed fraction of reported contract
+// outcomes that were successful, and is nil if no outcomes have been
+// reported.
+type HostRecord struct {
+	modules.HostDBEntry
+
+	Weight      types.Currency `json:"weight"`
+	Reliability types.Currency `json:"reliability"`
+	Throughput  uint64         `json:"throughput"`
+	Latency     time.Duration  `json:"latency"`
+	ConnectTime time.Duration  `json:"connecttime"`
+	RPCTime     time.Duration  `json:"rpctime"`
+	Uptime      float64        `json:"uptime"`
+	SuccessRate *float64       `json:"successrate,omitempty"`
+	LastSeen    time.Time      `json:"lastseen"`
+	Labels      []string       `json:"labels"`
+}
+
+// hostRecord returns the record of an entry.
+func (hdb *HostDB) hostRecord(entry *hostEntry) HostRecord {
+	return HostRecord{
+		HostDBEntry: entry.HostDBEntry,
+		Weight:      entry.Weight,
+		Reliability: entry.Reliability,
+		Throughput:  entry.Throughput,
+		Latency:     entry.Latency,
+		ConnectTime: entry.ConnectTime,
+		RPCTime:     entry.RPCTime,
+		Uptime:      entry.Uptime,
+		SuccessRate: entry.successRate(),
+		LastSeen:    entry.LastSeen,
+		Labels:      hdb.hostLabels(entry.NetAddress),
+	}
+}
+
+// RandomHostDetailed returns a random host from the hostdb, selected by
+// weight from among the hosts that are accepting contracts, along with the
+// metrics of the host at the moment that it was selected. If no such host
+// exists, errNoAcceptingHost is returned.
+func (hdb *HostDB) RandomHostDetailed() (HostRecord, error) {
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.releaseQuarantine()
+
+	entry, err := hdb.randomEntryFiltered(func(entry *hostEntry) bool {
+		return entry.AcceptingContracts
+	})
+	if err == errNoMatchingHost {
+		return HostRecord{}, errNoAcceptingHost
+	} else if err != nil {
+		return HostRecord{}, err
+	}
+	return hdb.hostRecord(entry), nil
+}
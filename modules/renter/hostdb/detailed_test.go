@@ -0,0 +1,52 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestRandomHostDetailed checks that RandomHostDetailed only selects hosts
+// that are accepting contracts, and reports the metrics of the selected host.
+func TestRandomHostDetailed(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	if _, err := hdb.RandomHostDetailed(); err != errNoAcceptingHost {
+		t.Fatal("expected errNoAcceptingHost, got", err)
+	}
+
+	for i := uint8(1); i <= 2; i++ {
+		entry := &hostEntry{
+			HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(i)},
+			Weight:      types.NewCurrency64(10),
+			Reliability: MaxReliability,
+		}
+		entry.AcceptingContracts = i == 2
+		hdb.allHosts[entry.NetAddress] = entry
+		hdb.insertNode(entry)
+	}
+	hdb.allHosts[fakeAddr(2)].recordOutcome(true)
+	if err := hdb.AddLabel(fakeAddr(2), "trusted"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		record, err := hdb.RandomHostDetailed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.NetAddress != fakeAddr(2) {
+			t.Fatal("host that is not accepting contracts was selected")
+		}
+		if record.Weight.Cmp(types.NewCurrency64(10)) != 0 || record.Reliability.Cmp(MaxReliability) != 0 {
+			t.Error("wrong weight or reliability:", record.Weight, record.Reliability)
+		}
+		if record.SuccessRate == nil || *record.SuccessRate != 1 {
+			t.Error("wrong success rate:", record.SuccessRate)
+		}
+		if len(record.Labels) != 1 || record.Labels[0] != "trusted" {
+			t.Error("wrong labels:", record.Labels)
+		}
+	}
+}
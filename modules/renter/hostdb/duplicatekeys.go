@@ -0,0 +1,149 @@
+package hostdb
+
+// duplicatekeys.go detects hosts that have announced the same public key at
+// multiple addresses. A host that announces itself many times would otherwise
+// be selected in proportion to the number of its addresses. Optionally, the
+// weight of such a host is split between its addresses, so that the combined
+// weight of the addresses is no greater than the weight of a single address.
+
+import (
+	"sort"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+type (
+	// A DuplicateKey is a public key that has been announced at more than
+	// one address.
+	DuplicateKey struct {
+		PublicKey types.SiaPublicKey
+		Addresses []modules.NetAddress
+	}
+
+	// duplicateKeysBySize sorts a set of duplicate keys so that the keys
+	// announced at the most addresses come first.
+	duplicateKeysBySize []DuplicateKey
+
+	// netAddresses sorts a set of addresses lexicographically.
+	netAddresses []modules.NetAddress
+)
+
+func (dk duplicateKeysBySize) Len() int           { return len(dk) }
+func (dk duplicateKeysBySize) Less(i, j int) bool { return len(dk[i].Addresses) > len(dk[j].Addresses) }
+func (dk duplicateKeysBySize) Swap(i, j int)      { dk[i], dk[j] = dk[j], dk[i] }
+
+func (na netAddresses) Len() int           { return len(na) }
+func (na netAddresses) Less(i, j int) bool { return na[i] < na[j] }
+func (na netAddresses) Swap(i, j int)      { na[i], na[j] = na[j], na[i] }
+
+// indexHostKey adds an entry of allHosts to the index of addresses by public
+// key. The first time that a key is found at more than one address, a warning
+// is logged.
+func (hdb *HostDB) indexHostKey(entry *hostEntry) {
+	if len(entry.PublicKey.Key) == 0 {
+		return
+	}
+	if hdb.keyAddresses == nil {
+		hdb.keyAddresses = make(map[string]map[modules.NetAddress]struct{})
+		hdb.warnedKeys = make(map[string]struct{})
+	}
+	key := string(entry.PublicKey.Key)
+	addrs, exists := hdb.keyAddresses[key]
+	if !exists {
+		addrs = make(map[modules.NetAddress]struct{})
+		hdb.keyAddresses[key] = addrs
+	}
+	addrs[entry.NetAddress] = struct{}{}
+	if _, warned := hdb.warnedKeys[key]; len(addrs) > 1 && !warned {
+		hdb.warnedKeys[key] = struct{}{}
+		hdb.log.Printf("WARN: host key %x has been announced at multiple addresses", entry.PublicKey.Key)
+	}
+}
+
+// unindexHostKey removes an entry of allHosts from the index of addresses by
+// public key.
+func (hdb *HostDB) unindexHostKey(entry *hostEntry) {
+	key := string(entry.PublicKey.Key)
+	addrs, exists := hdb.keyAddresses[key]
+	if !exists {
+		return
+	}
+	delete(addrs, entry.NetAddress)
+	if len(addrs) == 0 {
+		delete(hdb.keyAddresses, key)
+	}
+}
+
+// addressesWithKey returns the number of known hosts that have the provided
+// public key, counting only the hosts that are online if 'online' is set.
+func (hdb *HostDB) addressesWithKey(key types.SiaPublicKey, online bool) (n int) {
+	for addr := range hdb.keyAddresses[string(key.Key)] {
+		if entry, exists := hdb.allHosts[addr]; exists && (!online || entry.Online) {
+			n++
+		}
+	}
+	return n
+}
+
+// duplicateKeyAdjustment divides the weight of a host between all of the
+// online addresses that share its public key. Only the weight of the entry
+// being updated is changed, the other addresses converge as they are probed.
+func (hdb *HostDB) duplicateKeyAdjustment(weight types.Currency, entry *hostEntry) types.Currency {
+	if !hdb.collapseDuplicateKeys || !entry.Online || len(entry.PublicKey.Key) == 0 {
+		return weight
+	}
+	n := hdb.addressesWithKey(entry.PublicKey, true)
+	if n <= 1 {
+		return weight
+	}
+	return weight.Div64(uint64(n))
+}
+
+// hostWeight returns the weight of an entry, including the adjustments that
+// depend on the other hosts in the hostdb, the throughput selected by the
+// hostdb and the minimum weight floor, normalized to the bounded range of
+// host weights.
+func (hdb *HostDB) hostWeight(entry *hostEntry) types.Currency {
+	weighted := *entry
+	weighted.Throughput = hdb.weightedThroughput(entry)
+	return normalizeWeight(hdb.minWeightAdjustment(hdb.duplicateKeyAdjustment(calculateHostWeight(weighted, hdb.priceExponent, hdb.collateralExponent), entry)))
+}
+
+// SetCollapseDuplicateKeys sets whether the weight of a host that has
+// announced its public key at multiple addresses is split between the
+// addresses.
+func (hdb *HostDB) SetCollapseDuplicateKeys(collapse bool) {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.collapseDuplicateKeys = collapse
+}
+
+// DuplicateKeys returns the public keys that have been announced at more than
+// one address, with the keys announced at the most addresses first.
+func (hdb *HostDB) DuplicateKeys() []DuplicateKey {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+
+	byKey := make(map[string]*DuplicateKey)
+	for addr, entry := range hdb.allHosts {
+		if len(entry.PublicKey.Key) == 0 {
+			continue
+		}
+		dk, exists := byKey[string(entry.PublicKey.Key)]
+		if !exists {
+			dk = &DuplicateKey{PublicKey: entry.PublicKey}
+			byKey[string(entry.PublicKey.Key)] = dk
+		}
+		dk.Addresses = append(dk.Addresses, addr)
+	}
+	var dks []DuplicateKey
+	for _, dk := range byKey {
+		if len(dk.Addresses) > 1 {
+			sort.Sort(netAddresses(dk.Addresses))
+			dks = append(dks, *dk)
+		}
+	}
+	sort.Stable(duplicateKeysBySize(dks))
+	return dks
+}
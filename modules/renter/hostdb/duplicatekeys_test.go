@@ -0,0 +1,98 @@
+package hostdb
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestDuplicateKeys checks that keys announced at multiple addresses are
+// reported, and that their weight is split when collapsing is enabled.
+func TestDuplicateKeys(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	settings := modules.HostExternalSettings{AcceptingContracts: true}
+
+	sybil := types.SiaPublicKey{Key: []byte{1}}
+	honest := types.SiaPublicKey{Key: []byte{2}}
+	update := func(n uint8, key types.SiaPublicKey) *hostEntry {
+		entry := &hostEntry{
+			HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(n), PublicKey: key},
+			Reliability: DefaultReliability,
+		}
+		hdb.managedUpdateEntry(entry, settings, modules.HostSettingsExtension{}, nil)
+		return entry
+	}
+	single := update(0, honest)
+	for i := uint8(1); i <= 4; i++ {
+		update(i, sybil)
+	}
+
+	dks := hdb.DuplicateKeys()
+	if len(dks) != 1 || string(dks[0].PublicKey.Key) != string(sybil.Key) {
+		t.Fatal("wrong duplicate keys reported:", dks)
+	}
+	if len(dks[0].Addresses) != 4 || dks[0].Addresses[0] != fakeAddr(1) {
+		t.Error("wrong addresses reported:", dks[0].Addresses)
+	}
+
+	// With collapsing enabled, each of the four addresses should get a
+	// quarter of the weight of the honest host once it has been probed
+	// again.
+	hdb.SetCollapseDuplicateKeys(true)
+	for i := uint8(1); i <= 4; i++ {
+		hdb.managedUpdateEntry(hdb.allHosts[fakeAddr(i)], settings, modules.HostSettingsExtension{}, nil)
+	}
+	hdb.managedUpdateEntry(single, settings, modules.HostSettingsExtension{}, nil)
+	total := types.ZeroCurrency
+	for i := uint8(1); i <= 4; i++ {
+		total = total.Add(hdb.allHosts[fakeAddr(i)].Weight)
+	}
+	if total.Cmp(single.Weight) > 0 {
+		t.Error("combined weight of duplicate key exceeds a single host:", total, single.Weight)
+	}
+	if hdb.hostTree.weight.Cmp(total.Add(single.Weight)) != 0 {
+		t.Error("host tree weight does not match the collapsed weights")
+	}
+}
+
+// TestDuplicateKeyIndex checks that the index of addresses by public key
+// follows the hosts that are added and removed, that each duplicate key is
+// logged only once, and that the index is cleared along with the hosts.
+func TestDuplicateKeyIndex(t *testing.T) {
+	hdb := bareHostDB()
+	var buf bytes.Buffer
+	hdb.log = persist.NewLogger(&buf)
+	hdb.persist = &memPersist{}
+
+	sybil := types.SiaPublicKey{Key: []byte{1}}
+	for i := uint8(0); i < 3; i++ {
+		hdb.insertHost(modules.HostDBEntry{NetAddress: fakeAddr(i), PublicKey: sybil})
+	}
+	if n := hdb.addressesWithKey(sybil, false); n != 3 {
+		t.Fatal("expected the key to be indexed at 3 addresses, got", n)
+	}
+	if n := strings.Count(buf.String(), "announced at multiple addresses"); n != 1 {
+		t.Error("expected the duplicate key to be logged once, got", n)
+	}
+
+	// Announcing an address with a new key moves the address to that key.
+	honest := types.SiaPublicKey{Key: []byte{2}}
+	hdb.insertHost(modules.HostDBEntry{NetAddress: fakeAddr(2), PublicKey: honest})
+	if hdb.addressesWithKey(sybil, false) != 2 || hdb.addressesWithKey(honest, false) != 1 {
+		t.Error("reannounced address was not moved to its new key")
+	}
+	hdb.removeHost(fakeAddr(1))
+	if n := hdb.addressesWithKey(sybil, false); n != 1 {
+		t.Error("removed host is still indexed:", n)
+	}
+
+	hdb.resetConsensus()
+	if len(hdb.keyAddresses) != 0 || len(hdb.warnedKeys) != 0 {
+		t.Error("index was not cleared with the hosts")
+	}
+}
@@ -0,0 +1,35 @@
+package hostdb
+
+// duration.go selects hosts that are willing to hold a contract for at least
+// a given duration, so that a renter wanting a long-term contract is not
+// matched with a host whose advertised maximum duration is too short.
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var errNoLongEnoughHost = errors.New("no active host accepts contracts of the requested duration")
+
+// RandomHostWithDuration returns a random host from the hostdb, selected by
+// weight from among the hosts that are accepting contracts and whose
+// advertised maximum contract duration is at least 'minDuration'. If no such
+// host exists, errNoLongEnoughHost is returned.
+func (hdb *HostDB) RandomHostWithDuration(minDuration types.BlockHeight) (modules.HostDBEntry, error) {
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.releaseQuarantine()
+
+	entry, err := hdb.randomEntryFiltered(func(entry *hostEntry) bool {
+		return entry.AcceptingContracts && entry.MaxDuration >= minDuration
+	})
+	if err == errNoMatchingHost {
+		return modules.HostDBEntry{}, errNoLongEnoughHost
+	} else if err != nil {
+		return modules.HostDBEntry{}, err
+	}
+	return entry.HostDBEntry, nil
+}
@@ -0,0 +1,42 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestRandomHostWithDuration checks that only hosts accepting contracts of
+// the requested duration are selected.
+func TestRandomHostWithDuration(t *testing.T) {
+	hdb := bareHostDB()
+	for i := 0; i < 4; i++ {
+		entry := &hostEntry{
+			HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(uint8(i))},
+			Weight:      types.NewCurrency64(10),
+		}
+		entry.AcceptingContracts = true
+		entry.MaxDuration = types.BlockHeight(100 * (i + 1))
+		hdb.allHosts[entry.NetAddress] = entry
+		hdb.insertNode(entry)
+	}
+	// The host with the longest duration is not accepting contracts.
+	hdb.allHosts[fakeAddr(3)].AcceptingContracts = false
+
+	if _, err := hdb.RandomHostWithDuration(400); err != errNoLongEnoughHost {
+		t.Fatal("expected errNoLongEnoughHost, got", err)
+	}
+	for i := 0; i < 20; i++ {
+		host, err := hdb.RandomHostWithDuration(250)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if host.NetAddress != fakeAddr(2) {
+			t.Fatal("selected a host with too short a duration:", host.NetAddress)
+		}
+	}
+	if _, err := hdb.RandomHostWithDuration(0); err != nil {
+		t.Fatal("no host was selected without a minimum duration:", err)
+	}
+}
@@ -0,0 +1,260 @@
+package hostdb
+
+// events.go allows callers to subscribe to changes in the set of active hosts.
+// Events are queued by the methods that mutate the set while the hostdb is
+// locked, and delivered once the lock has been released. Delivery never
+// blocks: events that do not fit in the buffer of a subscriber are dropped and
+// counted.
+//
+// Coalesced subscriptions instead keep the latest event of each host until
+// the subscriber is ready for it, so that a burst of changes to the same host
+// reaches the subscriber as a single event. If too many hosts change before
+// the subscriber catches up, the pending events are discarded in favor of a
+// single EventResync.
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// eventBufferSize is the number of events that are buffered for each
+	// subscriber before further events are dropped.
+	eventBufferSize = 64
+)
+
+// The types of change to the set of active hosts.
+const (
+	EventInsert     HostEventType = "insert"     // A host was added to the active set.
+	EventRemove     HostEventType = "remove"     // A host was removed from the active set.
+	EventFlag       HostEventType = "flag"       // A host was quarantined.
+	EventReactivate HostEventType = "reactivate" // A host left quarantine.
+	EventReweight   HostEventType = "reweight"   // The weight of an active host changed.
+	EventResync     HostEventType = "resync"     // Events were discarded, the active set should be re-read.
+)
+
+type (
+	// HostEventType identifies the kind of change described by a HostEvent.
+	HostEventType string
+
+	// A HostEvent describes a change to the set of active hosts. Weight is
+	// the weight of the host after the change.
+	HostEvent struct {
+		Type   HostEventType
+		Host   modules.HostDBEntry
+		Weight types.Currency
+	}
+
+	// A HostSubscription receives the changes to the set of active hosts
+	// that are made after it was created.
+	HostSubscription struct {
+		atomicDropped uint64
+
+		events chan HostEvent
+		hdb    *HostDB
+
+		// The pending events of a coalesced subscription, which are sent by
+		// threadedForward. 'order' holds the addresses with a pending event
+		// in the order in which they first changed, and 'latest' holds the
+		// most recent event of each of those addresses. 'resync' is set if
+		// pending events were discarded.
+		coalesce bool
+		mu       sync.Mutex
+		order    []modules.NetAddress
+		latest   map[modules.NetAddress]HostEvent
+		resync   bool
+		wake     chan struct{}
+		stop     chan struct{}
+		done     chan struct{}
+	}
+)
+
+// Dropped returns the number of events that were discarded because the
+// subscriber was not keeping up.
+func (hs *HostSubscription) Dropped() uint64 {
+	return atomic.LoadUint64(&hs.atomicDropped)
+}
+
+// Events returns the channel on which events are delivered. The channel is
+// closed when the subscription is cancelled.
+func (hs *HostSubscription) Events() <-chan HostEvent {
+	return hs.events
+}
+
+// Unsubscribe cancels the subscription and closes its event channel.
+func (hs *HostSubscription) Unsubscribe() {
+	hdb := hs.hdb
+	hdb.subMu.Lock()
+	defer hdb.subMu.Unlock()
+	for i, sub := range hdb.subscriptions {
+		if sub == hs {
+			hdb.subscriptions = append(hdb.subscriptions[:i], hdb.subscriptions[i+1:]...)
+			atomic.AddInt32(&hdb.atomicSubscriptions, -1)
+			if hs.coalesce {
+				// Wait for the forwarder to exit, so that it cannot send on
+				// the closed channel.
+				close(hs.stop)
+				<-hs.done
+			}
+			close(hs.events)
+			return
+		}
+	}
+}
+
+// send delivers an event to the subscriber without blocking. The events of a
+// coalesced subscription are handed to its forwarder.
+func (hs *HostSubscription) send(event HostEvent) {
+	if hs.coalesce {
+		hs.coalesceEvent(event)
+		return
+	}
+	select {
+	case hs.events <- event:
+	default:
+		atomic.AddUint64(&hs.atomicDropped, 1)
+	}
+}
+
+// coalesceEvent adds an event to the pending events of a coalesced
+// subscription, replacing any pending event of the same host. If the event
+// is for a new host and eventBufferSize hosts already have pending events,
+// the pending events are discarded and replaced with a resync marker.
+// Further events are discarded until the marker has been delivered.
+func (hs *HostSubscription) coalesceEvent(event HostEvent) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	addr := event.Host.NetAddress
+	if _, exists := hs.latest[addr]; exists {
+		hs.latest[addr] = event
+	} else if hs.resync {
+		atomic.AddUint64(&hs.atomicDropped, 1)
+	} else if len(hs.order) >= eventBufferSize {
+		atomic.AddUint64(&hs.atomicDropped, uint64(len(hs.order))+1)
+		hs.order = nil
+		hs.latest = make(map[modules.NetAddress]HostEvent)
+		hs.resync = true
+	} else {
+		hs.order = append(hs.order, addr)
+		hs.latest[addr] = event
+	}
+	select {
+	case hs.wake <- struct{}{}:
+	default:
+	}
+}
+
+// nextEvent removes and returns the oldest pending event of a coalesced
+// subscription. A pending resync marker is always returned first.
+func (hs *HostSubscription) nextEvent() (HostEvent, bool) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if hs.resync {
+		hs.resync = false
+		return HostEvent{Type: EventResync}, true
+	}
+	if len(hs.order) == 0 {
+		return HostEvent{}, false
+	}
+	addr := hs.order[0]
+	hs.order = hs.order[1:]
+	event := hs.latest[addr]
+	delete(hs.latest, addr)
+	return event, true
+}
+
+// threadedForward sends the pending events of a coalesced subscription to
+// the subscriber, blocking until the subscriber receives each one. Changes
+// that are made while the subscriber is busy are coalesced.
+func (hs *HostSubscription) threadedForward() {
+	defer close(hs.done)
+	for {
+		select {
+		case <-hs.wake:
+		case <-hs.stop:
+			return
+		}
+		for event, ok := hs.nextEvent(); ok; event, ok = hs.nextEvent() {
+			select {
+			case hs.events <- event:
+			case <-hs.stop:
+				return
+			}
+		}
+	}
+}
+
+// subscribe registers a new subscription with the hostdb.
+func (hdb *HostDB) subscribe(hs *HostSubscription) *HostSubscription {
+	hdb.subMu.Lock()
+	hdb.subscriptions = append(hdb.subscriptions, hs)
+	atomic.AddInt32(&hdb.atomicSubscriptions, 1)
+	hdb.subMu.Unlock()
+	return hs
+}
+
+// SubscribeHostEvents returns a subscription to the changes in the set of
+// active hosts.
+func (hdb *HostDB) SubscribeHostEvents() *HostSubscription {
+	return hdb.subscribe(&HostSubscription{
+		events: make(chan HostEvent, eventBufferSize),
+		hdb:    hdb,
+	})
+}
+
+// SubscribeCoalescedHostEvents returns a subscription to the changes in the
+// set of active hosts in which successive changes to the same host are
+// collapsed into the latest one while the subscriber is busy. If more than
+// eventBufferSize hosts change before the subscriber catches up, it receives
+// an EventResync instead, and should re-read the set of active hosts.
+func (hdb *HostDB) SubscribeCoalescedHostEvents() *HostSubscription {
+	hs := &HostSubscription{
+		events: make(chan HostEvent),
+		hdb:    hdb,
+
+		coalesce: true,
+		latest:   make(map[modules.NetAddress]HostEvent),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go hs.threadedForward()
+	return hdb.subscribe(hs)
+}
+
+// queueEvent records a change to the set of active hosts, to be delivered
+// once the hostdb is unlocked. Nothing is recorded if there are no
+// subscribers.
+func (hdb *HostDB) queueEvent(t HostEventType, entry *hostEntry) {
+	if atomic.LoadInt32(&hdb.atomicSubscriptions) == 0 {
+		return
+	}
+	hdb.pendingEvents = append(hdb.pendingEvents, HostEvent{
+		Type:   t,
+		Host:   entry.HostDBEntry,
+		Weight: entry.Weight,
+	})
+}
+
+// managedDeliverEvents sends the queued events to all subscribers. It must be
+// called without holding the hostdb lock, typically by deferring it before the
+// lock is acquired.
+func (hdb *HostDB) managedDeliverEvents() {
+	// subMu is held while the events are collected so that concurrent
+	// deliveries cannot reorder events.
+	hdb.subMu.Lock()
+	defer hdb.subMu.Unlock()
+	hdb.mu.Lock()
+	events := hdb.pendingEvents
+	hdb.pendingEvents = nil
+	hdb.mu.Unlock()
+
+	for _, sub := range hdb.subscriptions {
+		for _, event := range events {
+			sub.send(event)
+		}
+	}
+}
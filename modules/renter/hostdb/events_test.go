@@ -0,0 +1,158 @@
+package hostdb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestHostEvents checks that subscribers are notified of changes to the set of
+// active hosts.
+func TestHostEvents(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	sub := hdb.SubscribeHostEvents()
+
+	// expectEvent checks the next event received by the subscription.
+	expectEvent := func(typ HostEventType, addr modules.NetAddress) {
+		select {
+		case event := <-sub.Events():
+			if event.Type != typ || event.Host.NetAddress != addr {
+				t.Fatalf("expected %v event for %v, got %v event for %v", typ, addr, event.Type, event.Host.NetAddress)
+			}
+		default:
+			t.Fatalf("expected %v event for %v, got nothing", typ, addr)
+		}
+	}
+
+	entry := &hostEntry{HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(1)}}
+	entry.AcceptingContracts = true
+	hdb.managedUpdateEntry(entry, modules.HostExternalSettings{AcceptingContracts: true}, modules.HostSettingsExtension{}, nil)
+	expectEvent(EventInsert, fakeAddr(1))
+
+	// A second successful scan reweights the host.
+	hdb.managedUpdateEntry(entry, modules.HostExternalSettings{AcceptingContracts: true}, modules.HostSettingsExtension{}, nil)
+	expectEvent(EventReweight, fakeAddr(1))
+
+	err := hdb.Quarantine(fakeAddr(1), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(EventFlag, fakeAddr(1))
+	hdb.Unquarantine(fakeAddr(1))
+	expectEvent(EventReactivate, fakeAddr(1))
+
+	hdb.managedUpdateEntry(entry, modules.HostExternalSettings{}, modules.HostSettingsExtension{}, errHostNotFound)
+	expectEvent(EventRemove, fakeAddr(1))
+
+	// Once unsubscribed, the channel should be closed.
+	sub.Unsubscribe()
+	if _, ok := <-sub.Events(); ok {
+		t.Error("event received after unsubscribing")
+	}
+	if len(hdb.pendingEvents) != 0 {
+		t.Error("events are queued without any subscribers")
+	}
+}
+
+// TestHostEventsDropped checks that events are dropped and counted when a
+// subscriber falls behind.
+func TestHostEventsDropped(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	sub := hdb.SubscribeHostEvents()
+	defer sub.Unsubscribe()
+
+	entry := &hostEntry{
+		HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(1)},
+		Weight:      types.NewCurrency64(1),
+	}
+	hdb.allHosts[entry.NetAddress] = entry
+	hdb.insertNode(entry)
+	for i := 0; i < eventBufferSize+10; i++ {
+		err := hdb.RecordOutcome(entry.NetAddress, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(sub.Events()) != eventBufferSize {
+		t.Error("wrong number of buffered events:", len(sub.Events()))
+	}
+	if sub.Dropped() != 10 {
+		t.Error("wrong number of dropped events:", sub.Dropped())
+	}
+}
+
+// TestCoalescedHostEvents checks that a coalesced subscription collapses the
+// changes to a host, and sends a resync marker when too many hosts change.
+func TestCoalescedHostEvents(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	sub := hdb.SubscribeCoalescedHostEvents()
+
+	// drain returns the events received until the subscription goes quiet.
+	drain := func() (events []HostEvent) {
+		for {
+			select {
+			case event := <-sub.Events():
+				events = append(events, event)
+			case <-time.After(100 * time.Millisecond):
+				return events
+			}
+		}
+	}
+
+	entry := &hostEntry{
+		HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(1)},
+		Weight:      types.NewCurrency64(1),
+	}
+	hdb.allHosts[entry.NetAddress] = entry
+	hdb.insertNode(entry)
+	changes := 20
+	for i := 0; i < changes; i++ {
+		err := hdb.RecordOutcome(entry.NetAddress, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	events := drain()
+	if len(events) == 0 || len(events) >= changes {
+		t.Fatal("changes were not coalesced:", len(events))
+	}
+	last := events[len(events)-1]
+	if last.Type != EventReweight || last.Weight.Cmp(entry.Weight) != 0 {
+		t.Error("last event does not hold the latest state of the host:", last)
+	}
+
+	// Changing more hosts than fit in the buffer should produce a resync.
+	for i := 0; i < eventBufferSize+5; i++ {
+		e := &hostEntry{
+			HostDBEntry: modules.HostDBEntry{NetAddress: modules.NetAddress(fmt.Sprintf("10.0.0.%d:1", i))},
+			Weight:      types.NewCurrency64(1),
+		}
+		hdb.allHosts[e.NetAddress] = e
+		hdb.insertNode(e)
+		err := hdb.RecordOutcome(e.NetAddress, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var resynced bool
+	for _, event := range drain() {
+		resynced = resynced || event.Type == EventResync
+	}
+	if !resynced {
+		t.Error("no resync marker after the buffer overflowed")
+	}
+	if sub.Dropped() == 0 {
+		t.Error("discarded events were not counted")
+	}
+
+	sub.Unsubscribe()
+	if _, ok := <-sub.Events(); ok {
+		t.Error("event received after unsubscribing")
+	}
+}
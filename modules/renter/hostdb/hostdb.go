@@ -15,10 +15,14 @@ package hostdb
 // unfairly over-penalize the hosts with the highest uptime.
 
 import (
+	"crypto/rand"
 	"errors"
+	"io"
+	"net"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/persist"
@@ -33,19 +37,29 @@ const (
 )
 
 var (
-	errNilCS = errors.New("cannot create hostdb with nil consensus set")
+	errHostNotFound = errors.New("host is not in the hostdb")
+	errNilCS        = errors.New("cannot create hostdb with nil consensus set")
 )
 
 // The HostDB is a database of potential hosts. It assigns a weight to each
 // host based on their hosting parameters, and then can select hosts at random
 // for uploading files.
 type HostDB struct {
+	// atomicSubscriptions is the number of active event subscriptions.
+	atomicSubscriptions int32
+
 	// dependencies
+	cs      consensusSet
 	dialer  dialer
 	log     *persist.Logger
 	persist persister
 	sleeper sleeper
 
+	// randSource is the source of randomness used when selecting hosts. If
+	// nil, crypto/rand is used. It can be replaced with a seeded source to
+	// make host selection reproducible.
+	randSource io.Reader
+
 	// The hostTree is the root node of the tree that organizes hosts by
 	// weight. The tree is necessary for selecting weighted hosts at
 	// random. 'activeHosts' provides a lookup from hostname to the the
@@ -59,6 +73,107 @@ type HostDB struct {
 	// including hosts that are currently offline.
 	allHosts map[modules.NetAddress]*hostEntry
 
+	// keyAddresses indexes the addresses in allHosts by public key, so that
+	// hosts announced at multiple addresses can be found without a scan of
+	// allHosts. warnedKeys holds the keys that have already been logged as
+	// announced at multiple addresses.
+	keyAddresses map[string]map[modules.NetAddress]struct{}
+	warnedKeys   map[string]struct{}
+
+	// quarantined maps the address of each quarantined host to the time at
+	// which its quarantine expires. Quarantined hosts are kept out of the
+	// hostTree.
+	quarantined map[modules.NetAddress]time.Time
+
+	// blacklist holds the ranges of addresses that are excluded from the
+	// hostdb, keyed by their CIDR notation.
+	blacklist map[string]*net.IPNet
+
+	// pinned is the set of hosts that are never demoted or pruned
+	// automatically. Pinned hosts are kept in the hostTree even when they
+	// fail probes or are quarantined.
+	pinned map[modules.NetAddress]struct{}
+
+	// maxTreeDepth is the depth beyond which an insertion causes the
+	// hostTree to be rebuilt. If zero, defaultMaxTreeDepth is used.
+	maxTreeDepth int
+
+	// uptimeFloor is the uptime below which a host is kept out of the set of
+	// active hosts. A floor of 0 never demotes a host.
+	uptimeFloor float64
+
+	// failureTolerance is the number of recent probe failures that an active
+	// host may accumulate before it is demoted.
+	failureTolerance int
+
+	// priceExponent and collateralExponent are the powers to which the total
+	// price and the collateral of a host are raised when weighting the host.
+	priceExponent      int
+	collateralExponent int
+
+	// minWeight is the weight below which no host is weighted, so that every
+	// active host keeps a chance of being selected. A minWeight of 0 does
+	// not adjust any weights.
+	minWeight types.Currency
+
+	// banned holds the public keys of the hosts that have been proven to
+	// misbehave, keyed by the key bytes. Announcements of banned keys are
+	// ignored.
+	banned map[string]types.SiaPublicKey
+
+	// labels holds the labels that have been attached to each address. The
+	// labels are kept apart from the host entries, so that they survive the
+	// host being removed and announced again.
+	labels map[modules.NetAddress]map[string]struct{}
+
+	// maxHosts is the maximum number of hosts that are retained, and
+	// evictedHosts is the number of hosts that have been evicted to stay
+	// within it. A maxHosts of 0 retains every host.
+	maxHosts     int
+	evictedHosts uint64
+
+	// collapseDuplicateKeys splits the weight of a host that has announced
+	// its public key at multiple addresses between those addresses.
+	collapseDuplicateKeys bool
+
+	// probeConcurrency and probeInterval control the poller, which probes
+	// every active host once per interval, running up to probeConcurrency
+	// probes at a time. If zero, the defaults are used.
+	probeConcurrency int
+	probeInterval    time.Duration
+
+	// pingProbes has the poller probe hosts with RPCPing rather than
+	// RPCSettings.
+	pingProbes bool
+
+	// throughputWindow is the number of recent throughput samples kept for
+	// each host, and throughputPercentile is the percentile of those samples
+	// that the hosts are weighted by. If throughputWindow is zero, the
+	// default is used. If throughputPercentile is zero, the hosts are
+	// weighted by the moving average of their throughput.
+	throughputWindow     int
+	throughputPercentile float64
+
+	// settingsTTL is the length of time for which the settings fetched from
+	// a host are served by HostSettings. If zero, defaultSettingsTTL is used.
+	settingsTTL time.Duration
+
+	// tlsEnabled indicates that the hostdb should connect to hosts that
+	// advertise TLS support using TLS. Host certificates are pinned to the
+	// certificate hash in the signed settings of the host.
+	tlsEnabled bool
+
+	// announcementCache holds the host announcements found in recently
+	// processed blocks.
+	announcementCache *announcementCache
+
+	// pendingEvents holds the changes to the set of active hosts that have
+	// not yet been delivered to the subscriptions. subMu protects the
+	// subscriptions, and is never acquired while mu is held.
+	pendingEvents []HostEvent
+	subMu         sync.Mutex
+	subscriptions []*HostSubscription
+
 	// the scanPool is a set of hosts that need to be scanned. There are a
 	// handful of goroutines constantly waiting on the channel for hosts to
 	// scan.
@@ -72,8 +187,20 @@ type HostDB struct {
 
 	blockHeight types.BlockHeight
 	lastChange  modules.ConsensusChangeID
+	recentBlock types.BlockID // The most recent block seen by the hostdb.
+
+	// subscription is the subscription that the hostdb applies consensus
+	// changes from, and nextSubscription is the subscription replacing it
+	// while the replacement is being made. resubscribing is set once a
+	// change delivered by subscription did not connect to the chain of the
+	// hostdb, until the replacement subscription has been started.
+	subscription     *consensusSubscription
+	nextSubscription *consensusSubscription
+	resubscribing    bool
 
-	mu sync.RWMutex
+	// csMu serializes calls to SetConsensusSet and resubscriptions.
+	csMu sync.Mutex
+	mu   sync.RWMutex
 }
 
 // New returns a new HostDB.
@@ -95,7 +222,7 @@ func New(cs consensusSet, persistDir string) (*HostDB, error) {
 	}
 
 	// Create HostDB using production dependencies.
-	return newHostDB(cs, stdDialer{}, stdSleeper{}, newPersist(persistDir), logger)
+	return newHostDB(cs, new(stdDialer), stdSleeper{}, newPersist(persistDir), logger)
 }
 
 // newHostDB creates a HostDB using the provided dependencies. It loads the old
@@ -104,15 +231,24 @@ func New(cs consensusSet, persistDir string) (*HostDB, error) {
 func newHostDB(cs consensusSet, d dialer, s sleeper, p persister, l *persist.Logger) (*HostDB, error) {
 	// Create the HostDB object.
 	hdb := &HostDB{
+		cs:      cs,
 		dialer:  d,
 		sleeper: s,
 		persist: p,
 		log:     l,
 
 		// TODO: should index by pubkey, not ip
-		activeHosts: make(map[modules.NetAddress]*hostNode),
-		allHosts:    make(map[modules.NetAddress]*hostEntry),
-		scanPool:    make(chan *hostEntry, scanPoolSize),
+		activeHosts:  make(map[modules.NetAddress]*hostNode),
+		allHosts:     make(map[modules.NetAddress]*hostEntry),
+		keyAddresses: make(map[string]map[modules.NetAddress]struct{}),
+		warnedKeys:   make(map[string]struct{}),
+		quarantined:  make(map[modules.NetAddress]time.Time),
+		scanPool:     make(chan *hostEntry, scanPoolSize),
+
+		priceExponent:      defaultPriceExponent,
+		collateralExponent: defaultCollateralExponent,
+
+		announcementCache: newAnnouncementCache(announcementCacheSize),
 
 		closeChan: make(chan struct{}),
 	}
@@ -123,17 +259,11 @@ func newHostDB(cs consensusSet, d dialer, s sleeper, p persister, l *persist.Log
 		return nil, err
 	}
 
-	err = cs.ConsensusSetSubscribe(hdb, hdb.lastChange)
-	if err == modules.ErrInvalidConsensusChangeID {
-		hdb.lastChange = modules.ConsensusChangeBeginning
-		// clear the host sets
-		hdb.activeHosts = make(map[modules.NetAddress]*hostNode)
-		hdb.allHosts = make(map[modules.NetAddress]*hostEntry)
-		// subscribe again using the new ID
-		err = cs.ConsensusSetSubscribe(hdb, hdb.lastChange)
-	}
+	hdb.csMu.Lock()
+	err = hdb.managedSubscribe(cs, hdb.lastChange)
+	hdb.csMu.Unlock()
 	if err != nil {
-		return nil, errors.New("hostdb subscription failed: " + err.Error())
+		return nil, err
 	}
 
 	// Begin listening to consensus and looking for hosts.
@@ -141,11 +271,124 @@ func newHostDB(cs consensusSet, d dialer, s sleeper, p persister, l *persist.Log
 	for i := 0; i < scanningThreads; i++ {
 		go hdb.threadedProbeHosts()
 	}
-	hdb.threadGroup.Add(1)
+	hdb.threadGroup.Add(3)
 	go hdb.threadedScan()
+	go hdb.threadedPoll()
+	go hdb.threadedReleaseQuarantine()
 	return hdb, nil
 }
 
+// SetConsensusSet replaces the consensus set that the hostdb receives updates
+// from. The hostdb subscribes to the new consensus set, and only once the
+// subscription has succeeded does it unsubscribe from the current one. If the
+// subscription fails, the hostdb keeps receiving updates from the current
+// consensus set. If the new consensus set does not recognize the most recent
+// consensus change seen by the hostdb, the consensus tracking and everything
+// derived from the blockchain are reset and the blockchain is rescanned from
+// the beginning.
+func (hdb *HostDB) SetConsensusSet(cs consensusSet) error {
+	if cs == nil {
+		return errNilCS
+	}
+	hdb.csMu.Lock()
+	defer hdb.csMu.Unlock()
+
+	hdb.mu.RLock()
+	lastChange := hdb.lastChange
+	hdb.mu.RUnlock()
+	return hdb.managedSubscribe(cs, lastChange)
+}
+
+// managedSubscribe subscribes the hostdb to the provided consensus set,
+// starting after lastChange, and replaces the current subscription of the
+// hostdb once the new subscription has succeeded. If the consensus set does
+// not recognize lastChange, the hostdb is reset and the blockchain is
+// rescanned from the beginning. csMu must be held, and locks on the hostdb
+// must not be held while subscribing, as subscribing will deliver updates to
+// the hostdb.
+func (hdb *HostDB) managedSubscribe(cs consensusSet, lastChange modules.ConsensusChangeID) error {
+	s := &consensusSubscription{hdb: hdb, cs: cs}
+	hdb.mu.Lock()
+	hdb.nextSubscription = s
+	hdb.resubscribing = false
+	hdb.mu.Unlock()
+
+	err := cs.ConsensusSetSubscribe(s, lastChange)
+	if err == modules.ErrInvalidConsensusChangeID {
+		hdb.mu.Lock()
+		hdb.resetConsensus()
+		hdb.mu.Unlock()
+		hdb.managedDeliverEvents()
+		err = cs.ConsensusSetSubscribe(s, modules.ConsensusChangeBeginning)
+	}
+
+	hdb.mu.Lock()
+	hdb.nextSubscription = nil
+	if err != nil {
+		hdb.mu.Unlock()
+		return errors.New("hostdb subscription failed: " + err.Error())
+	}
+	old := hdb.subscription
+	hdb.subscription = s
+	hdb.cs = cs
+	hdb.mu.Unlock()
+	if old != nil {
+		old.cs.Unsubscribe(old)
+	}
+	return nil
+}
+
+// resetConsensus clears the consensus tracking of the hostdb and the state
+// derived from the blockchain, so that the blockchain can be rescanned from
+// the beginning. Pins, labels, bans and the blacklist are kept.
+func (hdb *HostDB) resetConsensus() {
+	for _, node := range hdb.activeHosts {
+		hdb.queueEvent(EventRemove, node.hostEntry)
+	}
+	hdb.blockHeight = 0
+	hdb.lastChange = modules.ConsensusChangeBeginning
+	hdb.recentBlock = types.BlockID{}
+	hdb.hostTree = nil
+	hdb.activeHosts = make(map[modules.NetAddress]*hostNode)
+	hdb.allHosts = make(map[modules.NetAddress]*hostEntry)
+	hdb.keyAddresses = make(map[string]map[modules.NetAddress]struct{})
+	hdb.warnedKeys = make(map[string]struct{})
+	hdb.quarantined = make(map[modules.NetAddress]time.Time)
+	if hdb.announcementCache != nil {
+		hdb.announcementCache = newAnnouncementCache(announcementCacheSize)
+	}
+}
+
+// SetRandomSource replaces the source of randomness used when selecting hosts.
+// Given a deterministic source, such as a seeded math/rand.Rand, host
+// selection becomes reproducible, which is useful for testing. Passing nil
+// restores the default, cryptographically secure source. A deterministic
+// source should never be used in production.
+func (hdb *HostDB) SetRandomSource(r io.Reader) {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.randSource = r
+}
+
+// SetResolver sets the resolver that the hostdb uses to resolve the hostnames
+// announced by hosts when dialing them, such as a resolver that queries a
+// specific DNS server. Passing nil restores the system resolver.
+func (hdb *HostDB) SetResolver(r *net.Resolver) {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	if d, ok := hdb.dialer.(*stdDialer); ok {
+		d.setResolver(r)
+	}
+}
+
+// randReader returns the source of randomness used when selecting hosts.
+func (hdb *HostDB) randReader() io.Reader {
+	if hdb.randSource == nil {
+		return rand.Reader
+	}
+	return hdb.randSource
+}
+
 // Close closes the hostdb, terminating its scanning threads
 func (hdb *HostDB) Close() error {
 	close(hdb.scanPool)
@@ -1,14 +1,17 @@
 package hostdb
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 // bareHostDB returns a HostDB with its fields initialized, but without any
@@ -17,9 +20,15 @@ func bareHostDB() *HostDB {
 	return &HostDB{
 		log: persist.NewLogger(ioutil.Discard),
 
-		activeHosts: make(map[modules.NetAddress]*hostNode),
-		allHosts:    make(map[modules.NetAddress]*hostEntry),
-		scanPool:    make(chan *hostEntry, scanPoolSize),
+		activeHosts:  make(map[modules.NetAddress]*hostNode),
+		allHosts:     make(map[modules.NetAddress]*hostEntry),
+		keyAddresses: make(map[string]map[modules.NetAddress]struct{}),
+		warnedKeys:   make(map[string]struct{}),
+		quarantined:  make(map[modules.NetAddress]time.Time),
+		scanPool:     make(chan *hostEntry, scanPoolSize),
+
+		priceExponent:      defaultPriceExponent,
+		collateralExponent: defaultCollateralExponent,
 	}
 }
 
@@ -28,9 +37,11 @@ func bareHostDB() *HostDB {
 type newStub struct{}
 
 // consensus set stubs
+func (newStub) BlockAtHeight(types.BlockHeight) (types.Block, bool) { return types.Block{}, false }
 func (newStub) ConsensusSetSubscribe(modules.ConsensusSetSubscriber, modules.ConsensusChangeID) error {
 	return nil
 }
+func (newStub) Unsubscribe(modules.ConsensusSetSubscriber) {}
 
 // TestNew tests the New function.
 func TestNew(t *testing.T) {
@@ -69,3 +80,91 @@ func TestNew(t *testing.T) {
 		t.Fatalf("expected permissions error, got %v", err)
 	}
 }
+
+// TestSetConsensusSet tests that the hostdb can switch to a new consensus
+// set, rescanning the blockchain when the new set does not recognize the most
+// recent change.
+func TestSetConsensusSet(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = new(memPersist)
+	hdb.cs = new(rescanCS)
+
+	if err := hdb.SetConsensusSet(nil); err != errNilCS {
+		t.Fatal("expected errNilCS, got", err)
+	}
+
+	// Switch to a consensus set containing a host announcement. The hostdb
+	// has not seen any changes, so the whole chain is delivered.
+	annBytes, err := makeSignedAnnouncement("foo.com:1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs1 := new(rescanCS)
+	cs1.addBlock(types.Block{
+		Transactions: []types.Transaction{{
+			ArbitraryData: [][]byte{annBytes},
+		}},
+	})
+	err = hdb.SetConsensusSet(cs1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := hdb.allHosts["foo.com:1234"]; !exists || hdb.lastChange != cs1.changes[0].ID {
+		t.Fatal("hostdb did not receive the changes of the new consensus set")
+	}
+
+	// Switch to a consensus set that does not know the last change seen by
+	// the hostdb. The host sets, the quarantine and the consensus tracking
+	// should be rebuilt.
+	if err := hdb.Quarantine("foo.com:1234", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	annBytes, err = makeSignedAnnouncement("bar.com:1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs2 := new(rescanCS)
+	cs2.addBlock(types.Block{
+		Transactions: []types.Transaction{{
+			ArbitraryData: [][]byte{annBytes},
+		}},
+	})
+	err = hdb.SetConsensusSet(cs2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hdb.allHosts) != 1 {
+		t.Fatal("hostdb rescan resulted in wrong host set:", hdb.allHosts)
+	}
+	if _, exists := hdb.allHosts["bar.com:1234"]; !exists || hdb.lastChange != cs2.changes[0].ID {
+		t.Fatal("hostdb rescan resulted in wrong host set:", hdb.allHosts)
+	}
+	if hdb.cs != cs2 {
+		t.Error("consensus set was not replaced")
+	}
+	if len(hdb.quarantined) != 0 {
+		t.Error("rescan kept the quarantine:", hdb.quarantined)
+	}
+
+	// A failed subscription keeps the hostdb subscribed to the current
+	// consensus set.
+	if err := hdb.SetConsensusSet(failCS{}); err == nil {
+		t.Fatal("expected the subscription to fail")
+	}
+	if hdb.cs != cs2 || hdb.subscription == nil || hdb.subscription.cs != cs2 {
+		t.Fatal("failed subscription replaced the consensus set")
+	}
+	b := types.Block{ParentID: cs2.changes[0].AppliedBlocks[0].ID()}
+	cc := modules.ConsensusChange{AppliedBlocks: []types.Block{b}}
+	hdb.subscription.ProcessConsensusChange(cc)
+	if hdb.recentBlock != b.ID() {
+		t.Error("hostdb stopped receiving changes from the current consensus set")
+	}
+}
+
+// failCS is a consensus set that cannot be subscribed to.
+type failCS struct{ newStub }
+
+func (failCS) ConsensusSetSubscribe(modules.ConsensusSetSubscriber, modules.ConsensusChangeID) error {
+	return errors.New("subscription refused")
+}
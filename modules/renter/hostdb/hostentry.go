@@ -2,18 +2,82 @@ package hostdb
 
 import (
 	"bytes"
+	"sort"
+	"time"
 
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
+// HostOrder is the order in which SortedActiveHosts returns the active hosts.
+type HostOrder int
+
+const (
+	// OrderByAddress sorts hosts by their net address.
+	OrderByAddress HostOrder = iota
+
+	// OrderByWeight sorts hosts by descending weight, breaking ties by net
+	// address.
+	OrderByWeight
+)
+
 // A hostEntry represents a host on the network.
 type hostEntry struct {
 	modules.HostDBEntry
 
 	Weight      types.Currency
 	Reliability types.Currency
+	Throughput  uint64 // Moving average of observed bytes per second.
 	Online      bool
+
+	// ThroughputSamples holds the most recent throughput samples of the
+	// host, in bytes per second, oldest first.
+	ThroughputSamples []uint64
+
+	// Successes and Failures are the decayed counts of the contract outcomes
+	// that have been reported for the host, in units of outcomeUnit.
+	Successes uint64
+	Failures  uint64
+
+	// Uptime is a moving average of the fraction of probes that the host has
+	// answered, and UptimeProbes is the number of probes that have been
+	// folded into the average.
+	Uptime       float64
+	UptimeProbes uint64
+
+	// ProbeFailures is the number of recent failed probes of the host. Each
+	// failed probe increments it and each successful probe decrements it.
+	ProbeFailures uint64
+
+	// Latency is a moving average of the latency reported through Touch,
+	// and LastSeen is the last time that the host answered a probe or was
+	// touched.
+	Latency  time.Duration
+	LastSeen time.Time
+
+	// ConnectTime and RPCTime are moving averages of the time taken to
+	// connect to the host and of the round-trip time of the RPC, observed
+	// while probing the host.
+	ConnectTime time.Duration
+	RPCTime     time.Duration
+
+	// settingsFetched is the time at which the settings of the host were
+	// last fetched successfully. It is not persisted, so that settings are
+	// never served from the cache after a restart.
+	settingsFetched time.Time
+
+	// lastRefresh is the time at which the host was last probed by Refresh.
+	lastRefresh time.Time
+
+	// lastProbed is the time at which the host was last probed, whether or
+	// not it answered. Like settingsFetched, it is not persisted.
+	lastProbed time.Time
+
+	// added is the time at which the host was announced to the hostdb, and
+	// evicted is set once the host has been evicted to stay within the
+	// maximum number of hosts. Neither is persisted.
+	added   time.Time
+	evicted bool
 }
 
 // insertHost adds a host entry to the state. The host will be inserted into
@@ -27,18 +91,43 @@ func (hdb *HostDB) insertHost(host modules.HostDBEntry) {
 		hdb.log.Printf("WARN: host '%v' has an invalid NetAddress: %v", host.NetAddress, err)
 		return
 	}
+	if hdb.blacklisted(host.NetAddress) {
+		hdb.log.Debugf("INFO: ignoring announcement of blacklisted host '%v'", host.NetAddress)
+		return
+	}
+	if hdb.isBanned(host.PublicKey) {
+		hdb.log.Debugf("INFO: ignoring announcement of banned host '%v'", host.NetAddress)
+		return
+	}
 	// Don't do anything if we've already seen this host and the public key is
 	// the same.
-	if knownHost, exists := hdb.allHosts[host.NetAddress]; exists && bytes.Equal(host.PublicKey.Key, knownHost.PublicKey.Key) {
+	// The host may have changed its settings when re-announcing, so the
+	// cached settings are invalidated.
+	knownHost, exists := hdb.allHosts[host.NetAddress]
+	if exists && bytes.Equal(host.PublicKey.Key, knownHost.PublicKey.Key) {
+		knownHost.settingsFetched = time.Time{}
 		return
 	}
+	if exists {
+		// The address has been announced with a new key, which replaces the
+		// entry of the old key.
+		hdb.unindexHostKey(knownHost)
+	}
 
 	// Create hostEntry and add to allHosts.
 	h := &hostEntry{
 		HostDBEntry: host,
 		Reliability: DefaultReliability,
+		added:       time.Now(),
 	}
 	hdb.allHosts[host.NetAddress] = h
+	hdb.indexHostKey(h)
+	if hdb.isQuarantined(host.NetAddress) {
+		// The scan keeps the host out of the host tree until the quarantine
+		// of its address has expired.
+		hdb.log.Debugf("INFO: host '%v' was announced while quarantined", host.NetAddress)
+	}
+	hdb.enforceMaxHosts(host.NetAddress)
 
 	// Add the host to the scan queue. If the scan is successful, the host
 	// will be placed in activeHosts.
@@ -52,9 +141,13 @@ func (hdb *HostDB) removeHost(addr modules.NetAddress) error {
 	if exists {
 		node.removeNode()
 		delete(hdb.activeHosts, addr)
+		hdb.queueEvent(EventRemove, node.hostEntry)
 	}
 
 	// Remove the node from all hosts.
+	if entry, exists := hdb.allHosts[addr]; exists {
+		hdb.unindexHostKey(entry)
+	}
 	delete(hdb.allHosts, addr)
 
 	return nil
@@ -73,7 +166,9 @@ func (hdb *HostDB) Host(addr modules.NetAddress) (modules.HostDBEntry, bool) {
 }
 
 // ActiveHosts returns the hosts that can be randomly selected out of the
-// hostdb, sorted by preference.
+// hostdb, sorted by preference. The preference is drawn at random by weight,
+// so the order changes between calls; use SortedActiveHosts for a stable
+// order.
 func (hdb *HostDB) ActiveHosts() (activeHosts []modules.HostDBEntry) {
 	hdb.mu.RLock()
 	numHosts := len(hdb.activeHosts)
@@ -84,6 +179,37 @@ func (hdb *HostDB) ActiveHosts() (activeHosts []modules.HostDBEntry) {
 	return sortedHosts
 }
 
+// SortedActiveHosts returns the active hosts in the provided order. Unlike
+// ActiveHosts, the order is the same across calls as long as the set of active
+// hosts and their weights do not change.
+func (hdb *HostDB) SortedActiveHosts(order HostOrder) (activeHosts []modules.HostDBEntry) {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+
+	nodes := hdb.sortedActiveNodes()
+	if order == OrderByWeight {
+		sort.Stable(nodesByWeight(nodes))
+	}
+	for _, node := range nodes {
+		activeHosts = append(activeHosts, node.hostEntry.HostDBEntry)
+	}
+	return activeHosts
+}
+
+// ForEach calls 'fn' on each of the active hosts, in order of net address,
+// until 'fn' returns false. Unlike ActiveHosts, the hosts are not copied into
+// a slice. The hostdb is read-locked during the iteration, so 'fn' must not
+// call any methods of the HostDB, otherwise it will deadlock.
+func (hdb *HostDB) ForEach(fn func(modules.HostDBEntry) bool) {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	for _, node := range hdb.sortedActiveNodes() {
+		if !fn(node.hostEntry.HostDBEntry) {
+			return
+		}
+	}
+}
+
 // AllHosts returns all of the hosts known to the hostdb, including the
 // inactive ones.
 func (hdb *HostDB) AllHosts() (allHosts []modules.HostDBEntry) {
@@ -142,3 +142,83 @@ func TestIsOffline(t *testing.T) {
 		}
 	}
 }
+
+// TestForEach tests the ForEach method.
+func TestForEach(t *testing.T) {
+	hdb := bareHostDB()
+
+	// empty
+	var calls int
+	hdb.ForEach(func(modules.HostDBEntry) bool {
+		calls++
+		return true
+	})
+	if calls != 0 {
+		t.Error("callback called on an empty hostdb")
+	}
+
+	for i := 0; i < 5; i++ {
+		h := new(hostEntry)
+		h.NetAddress = fakeAddr(uint8(i))
+		h.Weight = types.NewCurrency64(1)
+		hdb.insertNode(h)
+	}
+
+	// all hosts visited exactly once
+	seen := make(map[modules.NetAddress]int)
+	hdb.ForEach(func(host modules.HostDBEntry) bool {
+		seen[host.NetAddress]++
+		return true
+	})
+	if len(seen) != 5 {
+		t.Error("expected 5 hosts, got", len(seen))
+	}
+	for addr, n := range seen {
+		if n != 1 {
+			t.Errorf("host %v visited %v times", addr, n)
+		}
+	}
+
+	// stop early
+	calls = 0
+	hdb.ForEach(func(modules.HostDBEntry) bool {
+		calls++
+		return calls < 2
+	})
+	if calls != 2 {
+		t.Error("iteration did not stop early:", calls)
+	}
+}
+
+// TestSortedActiveHosts checks that SortedActiveHosts and ForEach visit the
+// active hosts in a stable order.
+func TestSortedActiveHosts(t *testing.T) {
+	hdb := bareHostDB()
+	weights := []uint64{2, 5, 2, 1}
+	for _, i := range []int{3, 0, 2, 1} {
+		h := new(hostEntry)
+		h.NetAddress = fakeAddr(uint8(i))
+		h.Weight = types.NewCurrency64(weights[i])
+		hdb.insertNode(h)
+	}
+
+	check := func(hosts []modules.HostDBEntry, order []uint8) {
+		if len(hosts) != len(order) {
+			t.Fatal("wrong number of hosts:", len(hosts))
+		}
+		for i, n := range order {
+			if hosts[i].NetAddress != fakeAddr(n) {
+				t.Errorf("host %v: expected %v, got %v", i, fakeAddr(n), hosts[i].NetAddress)
+			}
+		}
+	}
+	check(hdb.SortedActiveHosts(OrderByAddress), []uint8{0, 1, 2, 3})
+	check(hdb.SortedActiveHosts(OrderByWeight), []uint8{1, 0, 2, 3})
+
+	var visited []modules.HostDBEntry
+	hdb.ForEach(func(host modules.HostDBEntry) bool {
+		visited = append(visited, host)
+		return true
+	})
+	check(visited, []uint8{0, 1, 2, 3})
+}
@@ -1,6 +1,7 @@
 package hostdb
 
 import (
+	"errors"
 	"math/big"
 
 	"github.com/NebulousLabs/Sia/types"
@@ -11,11 +12,48 @@ var (
 	// weight to 10^150 to give ourselves lots of precision when determing the
 	// weight of a host
 	baseWeight = types.NewCurrency(new(big.Int).Exp(big.NewInt(10), big.NewInt(150), nil))
+
+	// maxHostWeight is the largest weight that a host can have. The weight
+	// adjustments compound, and together with the minimum weight floor they
+	// could otherwise produce weights that no longer fit in a float64, which
+	// sampling relies on. The bound leaves enough headroom
+	// that the weights of millions of hosts still sum to a finite float64.
+	maxHostWeight = baseWeight.Mul(baseWeight)
+
+	// collateralFloor is the minimum collateral that is taken into account
+	// when weighting a host. Hosts offering less collateral, including no
+	// collateral at all, are weighted as though they offer the floor, which
+	// is competitively close to zero but does not zero out the weight.
+	collateralFloor = types.NewCurrency64(1)
+)
+
+const (
+	// defaultPriceExponent is the default power to which the total price of a
+	// host is raised when weighting the host. A host which has half the total
+	// price will be 2^priceExponent times as likely to be selected.
+	defaultPriceExponent = 5
+
+	// defaultCollateralExponent is the default power to which the collateral
+	// of a host is raised when weighting the host. Collateral is the money
+	// that the host burns if it fails to keep the data, and signals the
+	// host's commitment.
+	defaultCollateralExponent = 1
+
+	// maxWeightExponent is the largest price or collateral exponent that can
+	// be set. Larger exponents make the weights of all but the cheapest hosts
+	// vanish, and make weighting needlessly expensive.
+	maxWeightExponent = 16
 )
 
+var errInvalidWeightExponent = errors.New("weight exponents must be between 0 and 16")
+
 // calculateHostWeight returns the weight of a host according to the settings of
-// the host database entry. Currently, only the price is considered.
-func calculateHostWeight(entry hostEntry) (weight types.Currency) {
+// the host database entry. The price, collateral and remaining collateral
+// budget of the host are considered, as well as the uptime and recent failures
+// observed when probing the host, the throughput reported through
+// RecordTransfer, and the latency reported through Touch. The total price is
+// raised to priceExponent and the collateral to collateralExponent.
+func calculateHostWeight(entry hostEntry, priceExponent, collateralExponent int) (weight types.Currency) {
 	// Prices tiered as follows:
 	//    - the storage price is presented as 'per block per byte'
 	//    - the contract price is presented as a flat rate
@@ -37,14 +75,17 @@ func calculateHostWeight(entry hostEntry) (weight types.Currency) {
 	totalPrice := entry.StoragePrice.Add(adjustedContractPrice).Add(adjustedUploadPrice).Add(adjustedDownloadPrice).Add(siafundFee)
 
 	// Set the weight to the base weight, and then divide it by the price
-	// raised to the fifth power. This means that a host which has half the
-	// total price will be 32x as likely to be selected. A host with a quarter
-	// the total price will be 1024x as likely to be selected, and so on.
+	// raised to the priceExponent. With the default exponent of 5, a host
+	// which has half the total price will be 32x as likely to be selected. A
+	// host with a quarter the total price will be 1024x as likely to be
+	// selected, and so on.
 	weight = baseWeight
 	if !totalPrice.IsZero() {
 		// To avoid a divide-by-zero error, this operation is only performed on
 		// non-zero prices.
-		weight = baseWeight.Div(totalPrice).Div(totalPrice).Div(totalPrice).Div(totalPrice).Div(totalPrice)
+		for i := 0; i < priceExponent; i++ {
+			weight = weight.Div(totalPrice)
+		}
 	}
 
 	// Account for collateral. Collateral has a somewhat complicated
@@ -61,12 +102,54 @@ func calculateHostWeight(entry hostEntry) (weight types.Currency) {
 	// amount being spent on collateral, the hostdb can also clamp the amount
 	// of collateral being taken into account by the host, to optimize the
 	// host's score for the renter's needs.
-	if entry.Collateral.IsZero() {
-		// Instead of zeroing out the weight, just return the weight as though
-		// the collateral is 1 hasting. Competitively speaking, this is
-		// effectively zero.
-		return weight
+	//
+	// Instead of zeroing out the weight of hosts with no collateral, the
+	// collateral is raised to the collateralFloor. Competitively speaking,
+	// this is effectively zero.
+	collateral := entry.Collateral
+	if collateral.Cmp(collateralFloor) < 0 {
+		collateral = collateralFloor
+	}
+	for i := 0; i < collateralExponent; i++ {
+		weight = weight.Mul(collateral)
+	}
+	weight = collateralBudgetAdjustment(weight, entry)
+	weight = throughputAdjustment(weight, entry.Throughput)
+	weight = latencyAdjustment(weight, entry.Latency)
+	weight = outcomeAdjustment(weight, entry.Successes, entry.Failures)
+	weight = probeFailureAdjustment(weight, entry.ProbeFailures)
+	return uptimeAdjustment(weight, entry)
+}
+
+// SetWeightExponents sets the powers to which the total price and the
+// collateral of a host are raised when weighting the host. The weights of the
+// active hosts are recomputed immediately. An exponent of 0 disables the
+// corresponding factor.
+func (hdb *HostDB) SetWeightExponents(priceExponent, collateralExponent int) error {
+	if priceExponent < 0 || priceExponent > maxWeightExponent || collateralExponent < 0 || collateralExponent > maxWeightExponent {
+		return errInvalidWeightExponent
+	}
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.priceExponent = priceExponent
+	hdb.collateralExponent = collateralExponent
+	for _, node := range hdb.sortedActiveNodes() {
+		entry := node.hostEntry
+		newWeight := hdb.hostWeight(entry)
+		if newWeight.Cmp(entry.Weight) != 0 {
+			hdb.reweight(entry.NetAddress, newWeight)
+		}
+	}
+	return nil
+}
+
+// normalizeWeight bounds a weight to the range [0, maxHostWeight], so that the
+// total weight of the host tree stays within a range that every consumer of
+// the weights can represent.
+func normalizeWeight(weight types.Currency) types.Currency {
+	if weight.Cmp(maxHostWeight) > 0 {
+		return maxHostWeight
 	}
-	weight = weight.Mul(entry.Collateral)
 	return weight
 }
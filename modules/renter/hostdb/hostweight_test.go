@@ -1,15 +1,17 @@
 package hostdb
 
 import (
+	"math/big"
 	"testing"
 
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
 func calculateWeightFromUInt64Price(price uint64) (weight types.Currency) {
 	var entry hostEntry
 	entry.StoragePrice = types.NewCurrency64(price)
-	return calculateHostWeight(entry)
+	return calculateHostWeight(entry, defaultPriceExponent, defaultCollateralExponent)
 }
 
 func TestHostWeightDistinctPrices(t *testing.T) {
@@ -47,3 +49,139 @@ func TestHostWeightWithBothPricesZero(t *testing.T) {
 		t.Error("Weight of two zero-priced hosts should be equal.")
 	}
 }
+
+// TestHostWeightCollateral checks that hosts which offer more collateral are
+// favored, and that hosts which offer no collateral are weighted at the floor.
+func TestHostWeightCollateral(t *testing.T) {
+	var entry hostEntry
+	entry.StoragePrice = types.NewCurrency64(1e6)
+	noCollateral := calculateHostWeight(entry, defaultPriceExponent, defaultCollateralExponent)
+	entry.Collateral = collateralFloor
+	if calculateHostWeight(entry, defaultPriceExponent, defaultCollateralExponent).Cmp(noCollateral) != 0 {
+		t.Error("host without collateral should be weighted at the collateral floor")
+	}
+	if noCollateral.IsZero() {
+		t.Fatal("host without collateral should still have a weight")
+	}
+
+	entry.Collateral = types.NewCurrency64(10)
+	low := calculateHostWeight(entry, defaultPriceExponent, defaultCollateralExponent)
+	entry.Collateral = types.NewCurrency64(1000)
+	high := calculateHostWeight(entry, defaultPriceExponent, defaultCollateralExponent)
+	if low.Cmp(noCollateral) <= 0 || high.Cmp(low) <= 0 {
+		t.Error("raising collateral did not raise the weight of the host")
+	}
+}
+
+// TestCollateralSelection checks that hosts with more collateral are selected
+// more frequently.
+func TestCollateralSelection(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hdb := bareHostDB()
+	for i, collateral := range []uint64{10, 30} {
+		entry := hostEntry{HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(uint8(i))}}
+		entry.AcceptingContracts = true
+		entry.StoragePrice = types.NewCurrency64(1e6)
+		entry.Collateral = types.NewCurrency64(collateral)
+		entry.Weight = calculateHostWeight(entry, defaultPriceExponent, defaultCollateralExponent)
+		hdb.insertNode(&entry)
+	}
+
+	var highCount int
+	trials := 4000
+	for i := 0; i < trials; i++ {
+		if hdb.RandomHosts(1, nil)[0].NetAddress == fakeAddr(1) {
+			highCount++
+		}
+	}
+	// The host with 3x the collateral is expected to be picked 75% of the
+	// time.
+	if highCount < trials*2/3 {
+		t.Errorf("high collateral host picked %v of %v times", highCount, trials)
+	}
+}
+
+// TestSetWeightExponents checks that the weight exponents are validated, and
+// that changing them reweights the active hosts.
+func TestSetWeightExponents(t *testing.T) {
+	hdb := bareHostDB()
+	for i, collateral := range []uint64{10, 30} {
+		entry := hostEntry{HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(uint8(i))}}
+		entry.AcceptingContracts = true
+		entry.StoragePrice = types.NewCurrency64(1e6)
+		entry.Collateral = types.NewCurrency64(collateral)
+		entry.Weight = hdb.hostWeight(&entry)
+		hdb.insertNode(&entry)
+	}
+	low, high := hdb.activeHosts[fakeAddr(0)].hostEntry, hdb.activeHosts[fakeAddr(1)].hostEntry
+	if high.Weight.Cmp(low.Weight) <= 0 {
+		t.Fatal("host with more collateral should weigh more")
+	}
+
+	// Without a collateral exponent, collateral only adds to the siafund fee
+	// paid by the renter, and the host with more collateral weighs less.
+	if err := hdb.SetWeightExponents(defaultPriceExponent, 0); err != nil {
+		t.Fatal(err)
+	}
+	if high.Weight.Cmp(low.Weight) >= 0 || high.Weight.Cmp(hdb.hostWeight(high)) != 0 {
+		t.Error("active hosts were not reweighted:", low.Weight, high.Weight)
+	}
+	if hdb.hostTree.weight.Cmp(low.Weight.Add(high.Weight)) != 0 {
+		t.Error("tree weight does not match the reweighted hosts")
+	}
+
+	for _, exps := range [][2]int{{-1, 1}, {5, -1}, {maxWeightExponent + 1, 1}, {5, maxWeightExponent + 1}} {
+		if err := hdb.SetWeightExponents(exps[0], exps[1]); err != errInvalidWeightExponent {
+			t.Errorf("expected errInvalidWeightExponent for %v, got %v", exps, err)
+		}
+	}
+	if hdb.priceExponent != defaultPriceExponent || hdb.collateralExponent != 0 {
+		t.Error("invalid exponents were applied")
+	}
+}
+
+// TestExtremeWeights checks that hosts whose weights would exceed the bound
+// are normalized to maxHostWeight, and that selection from a tree of such
+// hosts neither overflows nor panics.
+func TestExtremeWeights(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	huge := types.NewCurrency(new(big.Int).Exp(big.NewInt(10), big.NewInt(400), nil))
+	if w := normalizeWeight(huge); w.Cmp(maxHostWeight) != 0 {
+		t.Fatal("weight was not normalized:", w)
+	}
+	if w := normalizeWeight(types.NewCurrency64(5)); w.Cmp(types.NewCurrency64(5)) != 0 {
+		t.Fatal("weight within the bound was changed:", w)
+	}
+
+	// A floor far beyond the bound raises every host beyond the bound.
+	hdb.SetMinWeight(huge)
+	const numHosts = 20
+	for i := 0; i < numHosts; i++ {
+		entry := &hostEntry{
+			HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(uint8(i))},
+			Reliability: DefaultReliability,
+		}
+		hdb.managedUpdateEntry(entry, modules.HostExternalSettings{AcceptingContracts: true}, modules.HostSettingsExtension{}, nil)
+		if entry.Weight.Cmp(maxHostWeight) != 0 {
+			t.Fatal("extreme weight was not normalized:", entry.Weight)
+		}
+	}
+	if hdb.hostTree.weight.Cmp(maxHostWeight.Mul64(numHosts)) != 0 {
+		t.Fatal("wrong total weight:", hdb.hostTree.weight)
+	}
+
+	if hosts := hdb.RandomHosts(numHosts, nil); len(hosts) != numHosts {
+		t.Error("RandomHosts returned", len(hosts), "hosts")
+	}
+	if hosts := hdb.SampleHosts(numHosts); len(hosts) != numHosts {
+		t.Error("SampleHosts returned", len(hosts), "hosts")
+	}
+	target := fakeAddr(7)
+	host, err := hdb.RandomHostFiltered(func(e modules.HostDBEntry) bool { return e.NetAddress == target })
+	if err != nil || host.NetAddress != target {
+		t.Error("filtered selection failed:", host.NetAddress, err)
+	}
+}
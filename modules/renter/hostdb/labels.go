@@ -0,0 +1,144 @@
+package hostdb
+
+// labels.go allows arbitrary labels, such as "trusted" or "eu-region", to be
+// attached to hosts, so that operators and renters can categorize hosts for
+// their own filtering on top of the automatic weighting. Labels are attached
+// to addresses rather than to host entries, so a host keeps its labels when it
+// is removed from the hostdb and announced again. Labels are persisted.
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// maxLabelLen is the maximum length of a label, in bytes.
+	maxLabelLen = 64
+)
+
+var (
+	errInvalidLabel   = errors.New("labels must be between 1 and 64 bytes long")
+	errNoLabeledHost  = errors.New("no active host has the requested label")
+	errEmptyLabelAddr = errors.New("cannot label an empty address")
+)
+
+// addLabel attaches a label to an address.
+func (hdb *HostDB) addLabel(addr modules.NetAddress, label string) {
+	if hdb.labels == nil {
+		hdb.labels = make(map[modules.NetAddress]map[string]struct{})
+	}
+	if hdb.labels[addr] == nil {
+		hdb.labels[addr] = make(map[string]struct{})
+	}
+	hdb.labels[addr][label] = struct{}{}
+}
+
+// hasLabel returns true if the provided label is attached to the address.
+func (hdb *HostDB) hasLabel(addr modules.NetAddress, label string) bool {
+	_, exists := hdb.labels[addr][label]
+	return exists
+}
+
+// hostLabels returns the labels attached to an address in sorted order.
+func (hdb *HostDB) hostLabels(addr modules.NetAddress) []string {
+	var labels []string
+	for label := range hdb.labels[addr] {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// AddLabel attaches a label to the host at the provided address. The host
+// does not need to be known to the hostdb, so that hosts can be labeled before
+// they announce themselves.
+func (hdb *HostDB) AddLabel(addr modules.NetAddress, label string) error {
+	if addr == "" {
+		return errEmptyLabelAddr
+	}
+	if len(label) == 0 || len(label) > maxLabelLen {
+		return errInvalidLabel
+	}
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	if hdb.hasLabel(addr, label) {
+		return nil
+	}
+	hdb.addLabel(addr, label)
+	return hdb.save()
+}
+
+// RemoveLabel removes a label from the host at the provided address.
+func (hdb *HostDB) RemoveLabel(addr modules.NetAddress, label string) error {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	if !hdb.hasLabel(addr, label) {
+		return nil
+	}
+	delete(hdb.labels[addr], label)
+	if len(hdb.labels[addr]) == 0 {
+		delete(hdb.labels, addr)
+	}
+	return hdb.save()
+}
+
+// Labels returns the labels attached to the host at the provided address, in
+// sorted order.
+func (hdb *HostDB) Labels(addr modules.NetAddress) []string {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	return hdb.hostLabels(addr)
+}
+
+// RandomHostWithLabel returns a random host from the hostdb, selected by
+// weight from among the hosts that are accepting contracts and carry the
+// provided label. If no such host exists, errNoLabeledHost is returned.
+func (hdb *HostDB) RandomHostWithLabel(label string) (modules.HostDBEntry, error) {
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.releaseQuarantine()
+
+	entry, err := hdb.randomEntryFiltered(func(entry *hostEntry) bool {
+		return entry.AcceptingContracts && hdb.hasLabel(entry.NetAddress, label)
+	})
+	if err == errNoMatchingHost {
+		return modules.HostDBEntry{}, errNoLabeledHost
+	} else if err != nil {
+		return modules.HostDBEntry{}, err
+	}
+	return entry.HostDBEntry, nil
+}
+
+// ActiveHostsWithLabel returns the active hosts that carry the provided
+// label, sorted by address.
+func (hdb *HostDB) ActiveHostsWithLabel(label string) (hosts []modules.HostDBEntry) {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	for _, node := range hdb.sortedActiveNodes() {
+		if hdb.hasLabel(node.hostEntry.NetAddress, label) {
+			hosts = append(hosts, node.hostEntry.HostDBEntry)
+		}
+	}
+	return hosts
+}
+
+// AllHostsWithLabel returns all of the known hosts, active or not, that carry
+// the provided label, sorted by address.
+func (hdb *HostDB) AllHostsWithLabel(label string) (hosts []modules.HostDBEntry) {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	var addrs netAddresses
+	for addr := range hdb.labels {
+		if _, exists := hdb.allHosts[addr]; exists && hdb.hasLabel(addr, label) {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Sort(addrs)
+	for _, addr := range addrs {
+		hosts = append(hosts, hdb.allHosts[addr].HostDBEntry)
+	}
+	return hosts
+}
@@ -0,0 +1,84 @@
+package hostdb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestLabels checks that labels can be attached and removed, that selection
+// and enumeration can be restricted to labeled hosts, and that labels persist
+// and survive the removal of the host.
+func TestLabels(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	settings := modules.HostExternalSettings{AcceptingContracts: true}
+	for i := uint8(1); i <= 3; i++ {
+		entry := &hostEntry{HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(i)}, Reliability: DefaultReliability}
+		hdb.managedUpdateEntry(entry, settings, modules.HostSettingsExtension{}, nil)
+	}
+
+	if err := hdb.AddLabel(fakeAddr(1), ""); err != errInvalidLabel {
+		t.Fatal("expected errInvalidLabel, got", err)
+	}
+	if err := hdb.AddLabel("", "trusted"); err != errEmptyLabelAddr {
+		t.Fatal("expected errEmptyLabelAddr, got", err)
+	}
+	if _, err := hdb.RandomHostWithLabel("trusted"); err != errNoLabeledHost {
+		t.Fatal("expected errNoLabeledHost, got", err)
+	}
+
+	for _, label := range []string{"trusted", "eu-region"} {
+		if err := hdb.AddLabel(fakeAddr(2), label); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := hdb.AddLabel(fakeAddr(3), "eu-region"); err != nil {
+		t.Fatal(err)
+	}
+	if labels := hdb.Labels(fakeAddr(2)); !reflect.DeepEqual(labels, []string{"eu-region", "trusted"}) {
+		t.Error("wrong labels:", labels)
+	}
+	for i := 0; i < 10; i++ {
+		host, err := hdb.RandomHostWithLabel("trusted")
+		if err != nil || host.NetAddress != fakeAddr(2) {
+			t.Fatal("selected the wrong host:", host.NetAddress, err)
+		}
+	}
+	hosts := hdb.ActiveHostsWithLabel("eu-region")
+	if len(hosts) != 2 || hosts[0].NetAddress != fakeAddr(2) || hosts[1].NetAddress != fakeAddr(3) {
+		t.Error("wrong active hosts with label:", hosts)
+	}
+
+	// Labels persist.
+	hdb2 := bareHostDB()
+	hdb2.persist = hdb.persist
+	if err := hdb2.load(); err != nil {
+		t.Fatal(err)
+	}
+	if labels := hdb2.Labels(fakeAddr(2)); !reflect.DeepEqual(labels, []string{"eu-region", "trusted"}) {
+		t.Error("labels were not persisted:", labels)
+	}
+
+	// Labels survive the host being removed and announced again.
+	hdb.removeHost(fakeAddr(2))
+	if hosts := hdb.AllHostsWithLabel("trusted"); len(hosts) != 0 {
+		t.Error("removed host was enumerated:", hosts)
+	}
+	hdb.insertHost(modules.HostDBEntry{NetAddress: fakeAddr(2)})
+	if hosts := hdb.AllHostsWithLabel("trusted"); len(hosts) != 1 || hosts[0].NetAddress != fakeAddr(2) {
+		t.Error("re-announced host lost its label:", hosts)
+	}
+
+	// Removing the labels removes the host from the selection.
+	if err := hdb.RemoveLabel(fakeAddr(2), "trusted"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hdb.RandomHostWithLabel("trusted"); err != errNoLabeledHost {
+		t.Error("expected errNoLabeledHost, got", err)
+	}
+	if labels := hdb.Labels(fakeAddr(2)); !reflect.DeepEqual(labels, []string{"eu-region"}) {
+		t.Error("wrong labels after removal:", labels)
+	}
+}
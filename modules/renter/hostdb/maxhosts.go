@@ -0,0 +1,131 @@
+package hostdb
+
+// maxhosts.go bounds the number of hosts retained by the hostdb, so that the
+// memory used by the hostdb stays bounded on small nodes during a large sync.
+// When the limit is exceeded, the lowest weighted inactive hosts are evicted
+// first, followed by the lowest weighted active hosts. Hosts that were added
+// recently and have not been probed yet have no weight to compare, so they
+// are evicted last, oldest first, giving them the chance to be probed and
+// weighted. Pinned hosts are never evicted.
+//
+// Eviction is done in batches from a heap: once the limit is exceeded, enough
+// hosts are evicted to fall evictionSlack below the limit, so that the
+// candidates are only collected once every few insertions during a sync.
+
+import (
+	"container/heap"
+	"errors"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// evictionGracePeriod is the period after being added during which a host
+	// that has not been probed is protected from eviction.
+	evictionGracePeriod = 30 * time.Minute
+
+	// evictionSlack is the fraction of the maximum number of hosts, as a
+	// divisor, that is evicted in addition to the excess once the limit is
+	// exceeded.
+	evictionSlack = 20
+)
+
+var errInvalidMaxHosts = errors.New("maximum number of hosts cannot be negative")
+
+// An evictionCandidate is a host that may be evicted, along with the tier
+// that determines the order of eviction: unprotected inactive hosts first,
+// then unprotected active hosts, then protected hosts.
+type evictionCandidate struct {
+	entry *hostEntry
+	tier  int
+}
+
+// evictionHeap is a min-heap of hosts in the order in which they are evicted:
+// by tier, then by weight for unprotected hosts and by age for protected
+// hosts, with ties broken by address.
+type evictionHeap []evictionCandidate
+
+func (eh evictionHeap) Len() int { return len(eh) }
+func (eh evictionHeap) Less(i, j int) bool {
+	a, b := eh[i], eh[j]
+	if a.tier != b.tier {
+		return a.tier < b.tier
+	}
+	if a.tier == evictionTierProtected {
+		if !a.entry.added.Equal(b.entry.added) {
+			return a.entry.added.Before(b.entry.added)
+		}
+	} else if c := a.entry.Weight.Cmp(b.entry.Weight); c != 0 {
+		return c < 0
+	}
+	return a.entry.NetAddress < b.entry.NetAddress
+}
+func (eh evictionHeap) Swap(i, j int)       { eh[i], eh[j] = eh[j], eh[i] }
+func (eh *evictionHeap) Push(x interface{}) { *eh = append(*eh, x.(evictionCandidate)) }
+func (eh *evictionHeap) Pop() interface{} {
+	old := *eh
+	c := old[len(old)-1]
+	*eh = old[:len(old)-1]
+	return c
+}
+
+// The eviction tiers.
+const (
+	evictionTierInactive = iota
+	evictionTierActive
+	evictionTierProtected
+)
+
+// evictionTier returns the eviction tier of the entry.
+func (hdb *HostDB) evictionTier(entry *hostEntry) int {
+	if entry.lastProbed.IsZero() && time.Since(entry.added) < evictionGracePeriod {
+		return evictionTierProtected
+	}
+	if _, active := hdb.activeHosts[entry.NetAddress]; active {
+		return evictionTierActive
+	}
+	return evictionTierInactive
+}
+
+// enforceMaxHosts evicts hosts once the number of known hosts exceeds the
+// limit, until the number of hosts is evictionSlack below the limit, or until
+// only pinned hosts and the host at 'keep' remain. The host at 'keep' has
+// just been added, and is spared so that it gets the chance to be probed and
+// weighted. Evicted entries are marked, so that a probe that was in flight
+// during the eviction does not add them back.
+func (hdb *HostDB) enforceMaxHosts(keep modules.NetAddress) {
+	if hdb.maxHosts == 0 || len(hdb.allHosts) <= hdb.maxHosts {
+		return
+	}
+	target := hdb.maxHosts - hdb.maxHosts/evictionSlack
+	eh := make(evictionHeap, 0, len(hdb.allHosts))
+	for addr, entry := range hdb.allHosts {
+		if addr == keep || hdb.isPinned(addr) {
+			continue
+		}
+		eh = append(eh, evictionCandidate{entry: entry, tier: hdb.evictionTier(entry)})
+	}
+	heap.Init(&eh)
+	for len(hdb.allHosts) > target && eh.Len() > 0 {
+		entry := heap.Pop(&eh).(evictionCandidate).entry
+		hdb.removeHost(entry.NetAddress)
+		entry.evicted = true
+		hdb.evictedHosts++
+	}
+}
+
+// SetMaxHosts sets the maximum number of hosts, active and inactive, that the
+// hostdb retains. If the hostdb holds more hosts, the excess is evicted
+// immediately. A maximum of 0 retains every host. The maximum is persisted.
+func (hdb *HostDB) SetMaxHosts(n int) error {
+	if n < 0 {
+		return errInvalidMaxHosts
+	}
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.maxHosts = n
+	hdb.enforceMaxHosts("")
+	return hdb.save()
+}
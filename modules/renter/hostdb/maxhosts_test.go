@@ -0,0 +1,128 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestMaxHosts checks that the hostdb evicts the lowest weighted inactive
+// hosts first, then the lowest weighted active hosts, and never evicts pinned
+// hosts.
+func TestMaxHosts(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	if err := hdb.SetMaxHosts(-1); err != errInvalidMaxHosts {
+		t.Fatal("expected errInvalidMaxHosts, got", err)
+	}
+
+	// Hosts 0-2 are inactive and hosts 3-5 are active. Within each group,
+	// the weight increases with the address.
+	for i := 0; i < 6; i++ {
+		entry := &hostEntry{
+			HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(uint8(i))},
+			Weight:      types.NewCurrency64(uint64(10 * (i%3 + 1))),
+		}
+		hdb.allHosts[entry.NetAddress] = entry
+		if i >= 3 {
+			hdb.insertNode(entry)
+		}
+	}
+	hdb.pinned = map[modules.NetAddress]struct{}{fakeAddr(0): {}, fakeAddr(3): {}}
+
+	// Evicting three hosts should remove the unpinned inactive hosts, and
+	// then the lowest weighted unpinned active host.
+	if err := hdb.SetMaxHosts(3); err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range []modules.NetAddress{fakeAddr(1), fakeAddr(2), fakeAddr(4)} {
+		if _, exists := hdb.allHosts[addr]; exists {
+			t.Error("host was not evicted:", addr)
+		}
+	}
+	if _, active := hdb.activeHosts[fakeAddr(4)]; active {
+		t.Error("evicted host is still active")
+	}
+	if len(hdb.allHosts) != 3 || hdb.Stats().EvictedHosts != 3 {
+		t.Fatal("wrong number of hosts retained or evicted:", len(hdb.allHosts), hdb.Stats().EvictedHosts)
+	}
+
+	// A newly announced host is kept, and another host makes room for it.
+	hdb.mu.Lock()
+	hdb.insertHost(modules.HostDBEntry{NetAddress: fakeAddr(9)})
+	hdb.mu.Unlock()
+	if _, exists := hdb.allHosts[fakeAddr(9)]; !exists {
+		t.Error("newly announced host was evicted")
+	}
+	if _, exists := hdb.allHosts[fakeAddr(5)]; exists {
+		t.Error("lowest weighted unpinned host was not evicted")
+	}
+
+	// A probe that was in flight when its host was evicted does not add the
+	// host back.
+	evicted := &hostEntry{HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(5)}, evicted: true}
+	hdb.managedUpdateEntry(evicted, modules.HostExternalSettings{AcceptingContracts: true}, modules.HostSettingsExtension{}, nil)
+	if _, exists := hdb.allHosts[fakeAddr(5)]; exists {
+		t.Error("in-flight probe added an evicted host back")
+	}
+
+	// The limit and the number of evicted hosts are persisted.
+	hdb2 := bareHostDB()
+	hdb2.persist = hdb.persist
+	if err := hdb.save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := hdb2.load(); err != nil {
+		t.Fatal(err)
+	}
+	if hdb2.maxHosts != 3 || hdb2.evictedHosts != hdb.evictedHosts {
+		t.Error("limit was not persisted:", hdb2.maxHosts, hdb2.evictedHosts)
+	}
+
+	// Pinned hosts are never evicted, even if the limit cannot be met.
+	if err := hdb.SetMaxHosts(1); err != nil {
+		t.Fatal(err)
+	}
+	if len(hdb.allHosts) != 2 || !hdb.isPinned(fakeAddr(0)) || !hdb.isPinned(fakeAddr(3)) {
+		t.Error("pinned hosts were evicted:", hdb.allHosts)
+	}
+}
+
+// TestMaxHostsProtectsNewHosts checks that hosts that were announced recently
+// and have not been probed are evicted after the probed hosts, and that hosts
+// are evicted in batches below the limit.
+func TestMaxHostsProtectsNewHosts(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	if err := hdb.SetMaxHosts(40); err != nil {
+		t.Fatal(err)
+	}
+
+	// Announce 40 hosts, then probe the first 20 of them.
+	hdb.mu.Lock()
+	for i := 0; i < 40; i++ {
+		hdb.insertHost(modules.HostDBEntry{NetAddress: fakeAddr(uint8(i))})
+	}
+	hdb.mu.Unlock()
+	for i := 0; i < 20; i++ {
+		hdb.managedUpdateEntry(hdb.allHosts[fakeAddr(uint8(i))], modules.HostExternalSettings{AcceptingContracts: true}, modules.HostSettingsExtension{}, nil)
+	}
+	if len(hdb.allHosts) != 40 {
+		t.Fatal("hosts were evicted within the limit:", len(hdb.allHosts))
+	}
+
+	// Exceeding the limit evicts a batch of probed hosts, sparing the new
+	// hosts that have not been probed.
+	hdb.mu.Lock()
+	hdb.insertHost(modules.HostDBEntry{NetAddress: fakeAddr(40)})
+	hdb.mu.Unlock()
+	if len(hdb.allHosts) != 40-40/evictionSlack {
+		t.Fatal("hosts were not evicted in a batch:", len(hdb.allHosts))
+	}
+	for i := 20; i <= 40; i++ {
+		if _, exists := hdb.allHosts[fakeAddr(uint8(i))]; !exists {
+			t.Error("new host was evicted before the probed hosts:", fakeAddr(uint8(i)))
+		}
+	}
+}
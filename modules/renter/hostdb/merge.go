@@ -0,0 +1,124 @@
+package hostdb
+
+// merge.go combines the hosts of another host database into this one, so that
+// a node can be seeded from a database that was built elsewhere.
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+)
+
+// mergeCandidate is a copy of a host from the database being merged, along
+// with whether the host was active in that database.
+type mergeCandidate struct {
+	entry  hostEntry
+	active bool
+}
+
+// mergeCopy returns a copy of the data of an entry that is carried over by a
+// merge: the announced entry, the reliability, and the throughput. The
+// throughput samples are copied, so that the two databases do not share
+// them, and the bookkeeping of the other database is left behind.
+func mergeCopy(entry *hostEntry) hostEntry {
+	return hostEntry{
+		HostDBEntry:       entry.HostDBEntry,
+		Reliability:       entry.Reliability,
+		Throughput:        entry.Throughput,
+		ThroughputSamples: append([]uint64(nil), entry.ThroughputSamples...),
+		Online:            entry.Online,
+	}
+}
+
+// MergeFrom inserts the hosts known to 'other' into the hostdb. Hosts that
+// are not yet known are added. When both databases know a host, the entry
+// with the higher reliability is kept. Hosts announced with a different
+// public key than the local entry, hosts with invalid addresses, hosts that
+// are quarantined or blacklisted locally, and hosts whose key is banned
+// locally are skipped. Hosts that were active in 'other' are made active
+// locally, with their weights recomputed. Once the hosts are merged, hosts in
+// excess of the maximum number of hosts are evicted. The number of hosts
+// that were added, updated, and skipped is returned.
+func (hdb *HostDB) MergeFrom(other *HostDB) (added, updated, skipped int) {
+	if other == hdb {
+		return 0, 0, 0
+	}
+
+	// Copy the hosts out of the other database before locking this one, so
+	// that two databases merging into each other cannot deadlock.
+	other.mu.RLock()
+	candidates := make([]mergeCandidate, 0, len(other.allHosts))
+	for addr, entry := range other.allHosts {
+		_, active := other.activeHosts[addr]
+		candidates = append(candidates, mergeCandidate{entry: mergeCopy(entry), active: active})
+	}
+	other.mu.RUnlock()
+
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	for i := range candidates {
+		c := &candidates[i]
+		addr := c.entry.NetAddress
+		if addr.IsValid() != nil || hdb.isQuarantined(addr) || hdb.blacklisted(addr) || hdb.isBanned(c.entry.PublicKey) {
+			skipped++
+			continue
+		}
+
+		local, exists := hdb.allHosts[addr]
+		if !exists {
+			entry := new(hostEntry)
+			*entry = c.entry
+			entry.added = time.Now()
+			hdb.allHosts[addr] = entry
+			hdb.indexHostKey(entry)
+			entry.Weight = hdb.hostWeight(entry)
+			hdb.mergeActivate(entry, c.active)
+			added++
+			continue
+		}
+		if !bytes.Equal(local.PublicKey.Key, c.entry.PublicKey.Key) || c.entry.Reliability.Cmp(local.Reliability) <= 0 {
+			skipped++
+			continue
+		}
+
+		// The weight of an active host may only be changed through the tree,
+		// so the local weight is kept until it is recomputed. The merged
+		// settings replace any cached settings, as when a host re-announces.
+		local.HostDBEntry = c.entry.HostDBEntry
+		local.Reliability = c.entry.Reliability
+		local.Throughput = c.entry.Throughput
+		local.ThroughputSamples = c.entry.ThroughputSamples
+		local.Online = c.entry.Online
+		local.settingsFetched = time.Time{}
+		newWeight := hdb.hostWeight(local)
+		if _, active := hdb.activeHosts[addr]; active {
+			err := hdb.reweight(addr, newWeight)
+			if err != nil {
+				build.Critical("unable to reweight an active host:", err)
+			}
+		} else {
+			local.Weight = newWeight
+			hdb.mergeActivate(local, c.active)
+		}
+		updated++
+	}
+	hdb.enforceMaxHosts("")
+
+	err := hdb.save()
+	if err != nil {
+		hdb.log.Println("ERROR: unable to save merged hosts:", err)
+	}
+	return added, updated, skipped
+}
+
+// mergeActivate inserts a merged host into the tree if it was active in the
+// database that it was merged from, and it is eligible to be active locally.
+func (hdb *HostDB) mergeActivate(entry *hostEntry, active bool) {
+	if !active || !entry.Online || hdb.belowUptimeFloor(entry) || len(hdb.activeHosts) >= maxActiveHosts {
+		return
+	}
+	hdb.insertNode(entry)
+	hdb.queueEvent(EventInsert, entry)
+}
@@ -0,0 +1,172 @@
+package hostdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// mergeEntry returns an online host entry with the provided address, key,
+// and reliability.
+func mergeEntry(addr modules.NetAddress, key byte, reliability uint64) *hostEntry {
+	entry := &hostEntry{
+		HostDBEntry: modules.HostDBEntry{
+			HostExternalSettings: modules.HostExternalSettings{
+				AcceptingContracts: true,
+				NetAddress:         addr,
+				StoragePrice:       types.NewCurrency64(uint64(key) + 1),
+			},
+			PublicKey: types.SiaPublicKey{Key: []byte{key}},
+		},
+		Online:      true,
+		Reliability: types.NewCurrency64(reliability),
+	}
+	entry.Weight = calculateHostWeight(*entry, defaultPriceExponent, defaultCollateralExponent)
+	return entry
+}
+
+// TestMergeFrom checks that MergeFrom adds, updates, and skips hosts, and
+// keeps the tree weights consistent.
+func TestMergeFrom(t *testing.T) {
+	local := bareHostDB()
+	local.persist = &memPersist{}
+	other := bareHostDB()
+	other.persist = &memPersist{}
+
+	// Host 1 is more reliable in the other database, host 2 is more reliable
+	// locally, host 3 has a conflicting key, host 4 is only in the other
+	// database, and host 5 is quarantined locally.
+	for _, e := range []*hostEntry{
+		mergeEntry(fakeAddr(1), 1, 10),
+		mergeEntry(fakeAddr(2), 2, 50),
+		mergeEntry(fakeAddr(3), 3, 10),
+		mergeEntry(fakeAddr(5), 5, 10),
+	} {
+		local.allHosts[e.NetAddress] = e
+		local.insertNode(e)
+	}
+	for _, e := range []*hostEntry{
+		mergeEntry(fakeAddr(1), 1, 50),
+		mergeEntry(fakeAddr(2), 2, 10),
+		mergeEntry(fakeAddr(3), 33, 50),
+		mergeEntry(fakeAddr(4), 4, 10),
+		mergeEntry(fakeAddr(5), 5, 50),
+	} {
+		other.allHosts[e.NetAddress] = e
+		other.insertNode(e)
+	}
+	other.allHosts[fakeAddr(1)].ContractPrice = types.NewCurrency64(1e12)
+	if err := local.Quarantine(fakeAddr(5), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	added, updated, skipped := local.MergeFrom(other)
+	if added != 1 || updated != 1 || skipped != 3 {
+		t.Fatal("wrong merge counts:", added, updated, skipped)
+	}
+	if _, active := local.activeHosts[fakeAddr(4)]; !active {
+		t.Error("new active host was not made active")
+	}
+	if local.allHosts[fakeAddr(1)].Reliability.Cmp(types.NewCurrency64(50)) != 0 {
+		t.Error("more reliable entry was not merged")
+	}
+	if local.allHosts[fakeAddr(2)].Reliability.Cmp(types.NewCurrency64(50)) != 0 {
+		t.Error("less reliable entry replaced the local entry")
+	}
+	if local.allHosts[fakeAddr(3)].PublicKey.Key[0] != 3 {
+		t.Error("entry with a conflicting key replaced the local entry")
+	}
+	if _, active := local.activeHosts[fakeAddr(5)]; active {
+		t.Error("quarantined host was made active")
+	}
+
+	// The tree weight should match the sum of the active weights, which in
+	// turn should match the recomputed weights.
+	var total types.Currency
+	for addr, node := range local.activeHosts {
+		if node.hostEntry.Weight.Cmp(calculateHostWeight(*node.hostEntry, defaultPriceExponent, defaultCollateralExponent)) != 0 {
+			t.Error("weight of host was not recomputed:", addr)
+		}
+		total = total.Add(node.hostEntry.Weight)
+	}
+	if local.hostTree.weight.Cmp(total) != 0 {
+		t.Error("tree weight does not match the weights of the active hosts")
+	}
+
+	// Merging a database into itself is a no-op.
+	if a, u, s := local.MergeFrom(local); a != 0 || u != 0 || s != 0 {
+		t.Error("merging a database into itself changed it")
+	}
+}
+
+// TestMergeFromCopiesEntries checks that merged entries do not share their
+// throughput samples with the other database, and do not bring over its
+// bookkeeping.
+func TestMergeFromCopiesEntries(t *testing.T) {
+	local := bareHostDB()
+	local.persist = &memPersist{}
+	other := bareHostDB()
+	other.persist = &memPersist{}
+
+	stale := time.Now().Add(-24 * time.Hour)
+	known := mergeEntry(fakeAddr(1), 1, 10)
+	known.lastProbed = time.Now()
+	local.allHosts[known.NetAddress] = known
+	local.insertNode(known)
+	for _, e := range []*hostEntry{mergeEntry(fakeAddr(1), 1, 50), mergeEntry(fakeAddr(2), 2, 10)} {
+		e.ThroughputSamples = []uint64{1, 2, 3}
+		e.added = stale
+		e.lastProbed = stale
+		e.settingsFetched = time.Now()
+		other.allHosts[e.NetAddress] = e
+		other.insertNode(e)
+	}
+
+	if added, updated, _ := local.MergeFrom(other); added != 1 || updated != 1 {
+		t.Fatal("wrong merge counts:", added, updated)
+	}
+	for i := uint8(1); i <= 2; i++ {
+		mine, theirs := local.allHosts[fakeAddr(i)], other.allHosts[fakeAddr(i)]
+		mine.ThroughputSamples[0] = 100
+		if theirs.ThroughputSamples[0] != 1 {
+			t.Errorf("host %v shares its throughput samples with the other database", i)
+		}
+		if !mine.settingsFetched.IsZero() {
+			t.Errorf("host %v brought over the settings cache of the other database", i)
+		}
+	}
+	if added := local.allHosts[fakeAddr(2)].added; added.Before(time.Now().Add(-time.Hour)) {
+		t.Error("added host kept the announcement time of the other database:", added)
+	}
+	if !local.allHosts[fakeAddr(1)].lastProbed.Equal(known.lastProbed) || known.added.Equal(stale) {
+		t.Error("updated host lost its local bookkeeping")
+	}
+}
+
+// TestMergeFromMaxHosts checks that merging a large database into a capped
+// hostdb evicts hosts in excess of the cap.
+func TestMergeFromMaxHosts(t *testing.T) {
+	local := bareHostDB()
+	local.persist = &memPersist{}
+	if err := local.SetMaxHosts(10); err != nil {
+		t.Fatal(err)
+	}
+	other := bareHostDB()
+	other.persist = &memPersist{}
+	for i := 0; i < 50; i++ {
+		e := mergeEntry(fakeAddr(uint8(i)), byte(i), 10)
+		other.allHosts[e.NetAddress] = e
+	}
+
+	if added, _, _ := local.MergeFrom(other); added != 50 {
+		t.Fatal("wrong number of hosts added:", added)
+	}
+	if len(local.allHosts) > 10 {
+		t.Error("merge grew the hostdb past the maximum number of hosts:", len(local.allHosts))
+	}
+	if local.evictedHosts == 0 {
+		t.Error("evictions were not counted")
+	}
+}
@@ -0,0 +1,94 @@
+package hostdb
+
+// metrics.go exports the metrics of the hostdb as a JSON document, so that CLI
+// tools and web interfaces can render the quality of the known hosts without
+// depending on the Go types of the hostdb.
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// metricsSchemaVersion is the version of the document produced by
+// MarshalMetrics. It should be incremented whenever a field is removed or its
+// meaning changes, so that consumers can adapt. Adding fields does not require
+// a new version.
+const metricsSchemaVersion = 1
+
+type (
+	// hostMetrics is the entry of a single host in the metrics document.
+	// SuccessRate is the decayed fraction of reported contract outcomes that
+	// were successful, and is omitted if no outcomes have been reported.
+	hostMetrics struct {
+		Address     modules.NetAddress `json:"address"`
+		Active      bool               `json:"active"`
+		Weight      types.Currency     `json:"weight"`
+		Latency     time.Duration      `json:"latency"`
+		ConnectTime time.Duration      `json:"connecttime"`
+		RPCTime     time.Duration      `json:"rpctime"`
+		SuccessRate *float64           `json:"successrate,omitempty"`
+		LastSeen    time.Time          `json:"lastseen"`
+
+		// ThroughputPercentile is the percentile of the recent throughput
+		// samples that the hostdb weights the host by, or the median if the
+		// hostdb weights hosts by their average throughput.
+		ThroughputPercentile uint64 `json:"throughputpercentile"`
+	}
+
+	// metricsDocument is the document produced by MarshalMetrics.
+	metricsDocument struct {
+		SchemaVersion int           `json:"schemaversion"`
+		Stats         HostDBStats   `json:"stats"`
+		Hosts         []hostMetrics `json:"hosts"`
+	}
+
+	// hostMetricsByAddress sorts a set of host metrics by address.
+	hostMetricsByAddress []hostMetrics
+)
+
+func (hm hostMetricsByAddress) Len() int           { return len(hm) }
+func (hm hostMetricsByAddress) Less(i, j int) bool { return hm[i].Address < hm[j].Address }
+func (hm hostMetricsByAddress) Swap(i, j int)      { hm[i], hm[j] = hm[j], hm[i] }
+
+// MarshalMetrics returns a JSON document holding the aggregate statistics of
+// the hostdb and the weight, latency, probe times, success rate and last-seen
+// time of each known host, sorted by address. The document is a consistent
+// snapshot of the hostdb.
+func (hdb *HostDB) MarshalMetrics() ([]byte, error) {
+	hdb.mu.RLock()
+	doc := metricsDocument{
+		SchemaVersion: metricsSchemaVersion,
+		Stats:         hdb.stats(),
+		Hosts:         make([]hostMetrics, 0, len(hdb.allHosts)),
+	}
+	percentile := hdb.throughputPercentile
+	if percentile == 0 {
+		percentile = reportedThroughputPercentile
+	}
+	for addr, entry := range hdb.allHosts {
+		hm := hostMetrics{
+			Address:     addr,
+			Weight:      entry.Weight,
+			Latency:     entry.Latency,
+			ConnectTime: entry.ConnectTime,
+			RPCTime:     entry.RPCTime,
+			LastSeen:    entry.LastSeen,
+
+			ThroughputPercentile: entry.throughputPercentile(percentile),
+		}
+		if node, active := hdb.activeHosts[addr]; active {
+			hm.Active = true
+			hm.Weight = node.hostEntry.Weight
+		}
+		hm.SuccessRate = entry.successRate()
+		doc.Hosts = append(doc.Hosts, hm)
+	}
+	hdb.mu.RUnlock()
+
+	sort.Sort(hostMetricsByAddress(doc.Hosts))
+	return json.Marshal(doc)
+}
@@ -0,0 +1,68 @@
+package hostdb
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestMarshalMetrics checks that the metrics document holds the aggregate
+// statistics and the metrics of every known host.
+func TestMarshalMetrics(t *testing.T) {
+	hdb := bareHostDB()
+	lastSeen := time.Unix(1e9, 0).UTC()
+	for i := 0; i < 3; i++ {
+		entry := &hostEntry{
+			HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(uint8(2 - i))},
+			Weight:      types.NewCurrency64(uint64(10 * (i + 1))),
+			Latency:     time.Duration(i+1) * time.Millisecond,
+			LastSeen:    lastSeen,
+		}
+		hdb.allHosts[entry.NetAddress] = entry
+		if i != 0 {
+			hdb.insertNode(entry)
+		}
+	}
+	hdb.allHosts[fakeAddr(1)].recordOutcome(true)
+
+	b, err := hdb.MarshalMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc metricsDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.SchemaVersion != metricsSchemaVersion {
+		t.Error("wrong schema version:", doc.SchemaVersion)
+	}
+	if doc.Stats.ActiveHosts != 2 || doc.Stats.InactiveHosts != 1 {
+		t.Error("wrong host counts:", doc.Stats.ActiveHosts, doc.Stats.InactiveHosts)
+	}
+	if len(doc.Hosts) != 3 {
+		t.Fatal("expected 3 hosts, got", len(doc.Hosts))
+	}
+	for i, hm := range doc.Hosts {
+		if hm.Address != fakeAddr(uint8(i)) {
+			t.Error("hosts are not sorted by address:", hm.Address)
+		}
+		if !hm.LastSeen.Equal(lastSeen) {
+			t.Error("wrong last seen time:", hm.LastSeen)
+		}
+	}
+	if doc.Hosts[2].Active || !doc.Hosts[0].Active {
+		t.Error("hosts were not reported as active correctly")
+	}
+	if doc.Hosts[0].Weight.Cmp(types.NewCurrency64(30)) != 0 || doc.Hosts[0].Latency != 3*time.Millisecond {
+		t.Error("wrong weight or latency:", doc.Hosts[0])
+	}
+	if doc.Hosts[1].SuccessRate == nil || *doc.Hosts[1].SuccessRate != 1 {
+		t.Error("wrong success rate for a host with a successful outcome")
+	}
+	if doc.Hosts[0].SuccessRate != nil {
+		t.Error("success rate reported for a host without outcomes")
+	}
+}
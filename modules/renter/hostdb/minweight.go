@@ -0,0 +1,40 @@
+package hostdb
+
+// minweight.go implements the minimum weight floor of the hostdb. A weighting
+// that strongly favors cheap or fast hosts can drive the weight of the other
+// hosts so close to zero that they are never selected, and never get a chance
+// to prove themselves. Raising every host to the floor guarantees that each
+// active host is drawn with a probability of at least floor/totalWeight. A
+// floor that is large compared to typical weights flattens the distribution
+// towards uniform selection, so the floor should be small relative to the
+// weight of a competitive host.
+
+import (
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// minWeightAdjustment raises a weight to the minimum weight of the hostdb.
+func (hdb *HostDB) minWeightAdjustment(weight types.Currency) types.Currency {
+	if weight.Cmp(hdb.minWeight) < 0 {
+		return hdb.minWeight
+	}
+	return weight
+}
+
+// SetMinWeight sets the weight below which no host is weighted. The weights
+// of the active hosts are recomputed immediately, and inactive hosts are
+// raised to the floor when they are next inserted. A floor of zero disables
+// the adjustment.
+func (hdb *HostDB) SetMinWeight(floor types.Currency) {
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.minWeight = floor
+	for _, node := range hdb.sortedActiveNodes() {
+		entry := node.hostEntry
+		newWeight := hdb.hostWeight(entry)
+		if newWeight.Cmp(entry.Weight) != 0 {
+			hdb.reweight(entry.NetAddress, newWeight)
+		}
+	}
+}
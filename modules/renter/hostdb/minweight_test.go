@@ -0,0 +1,58 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestMinWeight checks that the minimum weight floor raises the weight of
+// expensive hosts, and that the tree is updated when the floor changes.
+func TestMinWeight(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	update := func(n uint8, settings modules.HostExternalSettings) *hostEntry {
+		entry := &hostEntry{
+			HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(n)},
+			Reliability: DefaultReliability,
+		}
+		hdb.managedUpdateEntry(entry, settings, modules.HostSettingsExtension{}, nil)
+		return entry
+	}
+	cheap := update(0, modules.HostExternalSettings{AcceptingContracts: true})
+	expensive := update(1, modules.HostExternalSettings{
+		AcceptingContracts: true,
+		StoragePrice:       types.SiacoinPrecision.Mul64(1e12),
+	})
+	if !expensive.Weight.IsZero() {
+		t.Fatal("expected the expensive host to have no weight, got", expensive.Weight)
+	}
+
+	floor := cheap.Weight.Div64(1000)
+	hdb.SetMinWeight(floor)
+	if expensive.Weight.Cmp(floor) != 0 {
+		t.Error("expensive host was not raised to the floor:", expensive.Weight)
+	}
+	if cheap.Weight.Cmp(floor) <= 0 {
+		t.Error("cheap host was lowered to the floor")
+	}
+	if hdb.hostTree.weight.Cmp(cheap.Weight.Add(floor)) != 0 {
+		t.Error("tree weight does not include the floor")
+	}
+
+	// Newly probed hosts are raised to the floor as well.
+	other := update(2, modules.HostExternalSettings{
+		AcceptingContracts: true,
+		StoragePrice:       types.SiacoinPrecision.Mul64(1e12),
+	})
+	if other.Weight.Cmp(floor) != 0 {
+		t.Error("new host was not raised to the floor:", other.Weight)
+	}
+
+	// Removing the floor restores the original weights.
+	hdb.SetMinWeight(types.ZeroCurrency)
+	if !expensive.Weight.IsZero() || hdb.hostTree.weight.Cmp(cheap.Weight) != 0 {
+		t.Error("weights were not restored after removing the floor")
+	}
+}
@@ -0,0 +1,84 @@
+package hostdb
+
+// outcome.go tracks the first-hand experience that the renter has had with
+// each host. Callers report whether a host honored its contracts, and the
+// success ratio of the host is factored into its weight. Each outcome decays
+// the weight of the outcomes before it, so that ancient history matters less
+// than recent behavior.
+
+import (
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// outcomeDecay determines how quickly old outcomes are forgotten. Each
+	// new outcome reduces the influence of all prior outcomes by a factor of
+	// 1/outcomeDecay.
+	outcomeDecay = 20
+
+	// outcomeUnit is the amount that a single outcome adds to the decayed
+	// counts. Outcomes are counted in fixed point so that the decay does not
+	// round small counts to zero.
+	outcomeUnit = 1000
+)
+
+// recordOutcome decays the outcome counts of the entry and adds the new
+// outcome.
+func (he *hostEntry) recordOutcome(success bool) {
+	he.Successes = he.Successes * (outcomeDecay - 1) / outcomeDecay
+	he.Failures = he.Failures * (outcomeDecay - 1) / outcomeDecay
+	if success {
+		he.Successes += outcomeUnit
+	} else {
+		he.Failures += outcomeUnit
+	}
+}
+
+// successRate returns the decayed fraction of the reported outcomes of the
+// entry that were successful, or nil if no outcomes have been reported.
+func (he *hostEntry) successRate() *float64 {
+	total := he.Successes + he.Failures
+	if total == 0 {
+		return nil
+	}
+	rate := float64(he.Successes) / float64(total)
+	return &rate
+}
+
+// outcomeAdjustment scales a weight according to the success ratio of a host.
+// A single success and a single failure are assumed for every host, so that
+// hosts without any recorded outcomes keep their weight, and so that a few
+// outcomes do not swing the weight too far. Hosts with a perfect record gain
+// up to a factor of two, hosts that always fail lose nearly all weight.
+func outcomeAdjustment(weight types.Currency, successes, failures uint64) types.Currency {
+	numerator := 2 * (successes + outcomeUnit)
+	denominator := successes + failures + 2*outcomeUnit
+	return weight.Mul64(numerator).Div64(denominator)
+}
+
+// RecordOutcome records whether the host at the provided address honored a
+// contract, adjusting the weight of the host accordingly.
+func (hdb *HostDB) RecordOutcome(addr modules.NetAddress, success bool) error {
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+
+	entry, exists := hdb.allHosts[addr]
+	if !exists {
+		return errHostNotFound
+	}
+	entry.recordOutcome(success)
+
+	// The weight of an active host must be changed through the tree.
+	newWeight := hdb.hostWeight(entry)
+	if _, active := hdb.activeHosts[addr]; active {
+		err := hdb.reweight(addr, newWeight)
+		if err != nil {
+			return err
+		}
+	} else {
+		entry.Weight = newWeight
+	}
+	return hdb.save()
+}
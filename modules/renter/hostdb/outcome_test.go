@@ -0,0 +1,87 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestOutcomeAdjustment checks the scaling of weights by success ratio.
+func TestOutcomeAdjustment(t *testing.T) {
+	weight := types.NewCurrency64(1000)
+	if outcomeAdjustment(weight, 0, 0).Cmp(weight) != 0 {
+		t.Error("weight of a host without outcomes should not change")
+	}
+	if outcomeAdjustment(weight, 5*outcomeUnit, 5*outcomeUnit).Cmp(weight) != 0 {
+		t.Error("weight of a host with an even record should not change")
+	}
+	good := outcomeAdjustment(weight, 10*outcomeUnit, 0)
+	bad := outcomeAdjustment(weight, 0, 10*outcomeUnit)
+	if good.Cmp(weight) <= 0 || good.Cmp(weight.Mul64(2)) > 0 {
+		t.Error("reliable host has the wrong weight:", good)
+	}
+	if bad.Cmp(weight) >= 0 {
+		t.Error("unreliable host has the wrong weight:", bad)
+	}
+}
+
+// TestRecordOutcomeDecay checks that recent outcomes outweigh old ones.
+func TestRecordOutcomeDecay(t *testing.T) {
+	var entry hostEntry
+	for i := 0; i < 100; i++ {
+		entry.recordOutcome(false)
+	}
+	if entry.Failures > outcomeDecay*outcomeUnit {
+		t.Error("failures were not decayed:", entry.Failures)
+	}
+	for i := 0; i < 100; i++ {
+		entry.recordOutcome(true)
+	}
+	if entry.Successes <= entry.Failures*10 {
+		t.Error("old failures still dominate after many successes:", entry.Successes, entry.Failures)
+	}
+}
+
+// TestRecordOutcome checks that RecordOutcome reweights active hosts and that
+// the outcomes are persisted.
+func TestRecordOutcome(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	if err := hdb.RecordOutcome("foo:1234", true); err != errHostNotFound {
+		t.Fatal("expected errHostNotFound, got", err)
+	}
+
+	entry := &hostEntry{
+		HostDBEntry: modules.HostDBEntry{NetAddress: "foo:1234"},
+		Weight:      types.NewCurrency64(1),
+	}
+	entry.Weight = calculateHostWeight(*entry, defaultPriceExponent, defaultCollateralExponent)
+	hdb.allHosts[entry.NetAddress] = entry
+	hdb.insertNode(entry)
+	initialWeight := entry.Weight
+
+	for i := 0; i < 5; i++ {
+		err := hdb.RecordOutcome(entry.NetAddress, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if entry.Weight.Cmp(initialWeight) >= 0 {
+		t.Error("weight did not drop after failed outcomes")
+	}
+	if hdb.hostTree.weight.Cmp(entry.Weight) != 0 {
+		t.Error("tree weight was not updated:", hdb.hostTree.weight, entry.Weight)
+	}
+
+	// The outcomes should survive a reload.
+	hdb2 := bareHostDB()
+	hdb2.persist = hdb.persist
+	err := hdb2.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdb2.allHosts[entry.NetAddress].Failures != entry.Failures {
+		t.Error("outcomes were not persisted")
+	}
+}
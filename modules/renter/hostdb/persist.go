@@ -1,14 +1,26 @@
 package hostdb
 
 import (
+	"time"
+
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 // hdbPersist defines what HostDB data persists across sessions.
 type hdbPersist struct {
 	AllHosts    []hostEntry
 	ActiveHosts []hostEntry
+	PinnedHosts []modules.NetAddress
+	Blacklist   []string
+	BannedKeys  []types.SiaPublicKey
+	Labels      map[modules.NetAddress][]string
+	Quarantined map[modules.NetAddress]time.Time
 	LastChange  modules.ConsensusChangeID
+	RecentBlock types.BlockID
+
+	MaxHosts     int
+	EvictedHosts uint64
 }
 
 // persistData returns the data in the hostdb that will be saved to disk.
@@ -20,7 +32,34 @@ func (hdb *HostDB) persistData() hdbPersist {
 	for _, node := range hdb.activeHosts {
 		data.ActiveHosts = append(data.ActiveHosts, *node.hostEntry)
 	}
+	for addr := range hdb.pinned {
+		data.PinnedHosts = append(data.PinnedHosts, addr)
+	}
+	for cidr := range hdb.blacklist {
+		data.Blacklist = append(data.Blacklist, cidr)
+	}
+	for _, key := range hdb.banned {
+		data.BannedKeys = append(data.BannedKeys, key)
+	}
+	for addr := range hdb.labels {
+		if data.Labels == nil {
+			data.Labels = make(map[modules.NetAddress][]string)
+		}
+		data.Labels[addr] = hdb.hostLabels(addr)
+	}
+	for addr := range hdb.quarantined {
+		if !hdb.isQuarantined(addr) {
+			continue
+		}
+		if data.Quarantined == nil {
+			data.Quarantined = make(map[modules.NetAddress]time.Time)
+		}
+		data.Quarantined[addr] = hdb.quarantined[addr]
+	}
 	data.LastChange = hdb.lastChange
+	data.RecentBlock = hdb.recentBlock
+	data.MaxHosts = hdb.maxHosts
+	data.EvictedHosts = hdb.evictedHosts
 	return data
 }
 
@@ -41,12 +80,60 @@ func (hdb *HostDB) load() error {
 	if err != nil {
 		return err
 	}
+	hdb.loadData(data)
+	return nil
+}
+
+// loadData adds the hosts in the provided persistence data to the hostdb.
+// Active hosts that are missing from the set of all hosts are ignored, and
+// active hosts that are still quarantined are kept out of the host tree
+// unless they are pinned.
+func (hdb *HostDB) loadData(data hdbPersist) {
 	for i := range data.AllHosts {
 		hdb.allHosts[data.AllHosts[i].NetAddress] = &data.AllHosts[i]
+		hdb.indexHostKey(&data.AllHosts[i])
+	}
+	for _, addr := range data.PinnedHosts {
+		if _, exists := hdb.allHosts[addr]; !exists {
+			continue
+		}
+		if hdb.pinned == nil {
+			hdb.pinned = make(map[modules.NetAddress]struct{})
+		}
+		hdb.pinned[addr] = struct{}{}
+	}
+	for addr, expiry := range data.Quarantined {
+		if _, exists := hdb.allHosts[addr]; !exists || hdb.isPinned(addr) {
+			continue
+		}
+		hdb.quarantined[addr] = expiry
 	}
 	for i := range data.ActiveHosts {
-		hdb.insertNode(hdb.allHosts[data.ActiveHosts[i].NetAddress])
+		entry, exists := hdb.allHosts[data.ActiveHosts[i].NetAddress]
+		if !exists || (hdb.isQuarantined(entry.NetAddress) && !hdb.isPinned(entry.NetAddress)) {
+			continue
+		}
+		hdb.insertNode(entry)
+	}
+	for _, cidr := range data.Blacklist {
+		if _, err := hdb.addBlacklist(cidr); err != nil {
+			hdb.log.Printf("WARN: blacklisted range %q is invalid: %v", cidr, err)
+		}
+	}
+	for _, key := range data.BannedKeys {
+		if hdb.banned == nil {
+			hdb.banned = make(map[string]types.SiaPublicKey)
+		}
+		hdb.banned[string(key.Key)] = key
+	}
+	for addr, labels := range data.Labels {
+		for _, label := range labels {
+			hdb.addLabel(addr, label)
+		}
 	}
 	hdb.lastChange = data.LastChange
-	return nil
+	hdb.recentBlock = data.RecentBlock
+	hdb.maxHosts = data.MaxHosts
+	hdb.evictedHosts = data.EvictedHosts
+	hdb.enforceMaxHosts("")
 }
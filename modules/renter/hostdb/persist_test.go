@@ -104,6 +104,16 @@ func (cs *rescanCS) ConsensusSetSubscribe(s modules.ConsensusSetSubscriber, last
 	return nil
 }
 
+func (cs *rescanCS) Unsubscribe(modules.ConsensusSetSubscriber) {}
+
+// BlockAtHeight returns the block applied by the change at index 'height'.
+func (cs *rescanCS) BlockAtHeight(height types.BlockHeight) (types.Block, bool) {
+	if height >= types.BlockHeight(len(cs.changes)) || len(cs.changes[height].AppliedBlocks) == 0 {
+		return types.Block{}, false
+	}
+	return cs.changes[height].AppliedBlocks[0], true
+}
+
 // TestRescan tests that the hostdb will rescan the blockchain properly.
 func TestRescan(t *testing.T) {
 	// create hostdb with mocked persist dependency
@@ -151,7 +161,7 @@ func TestRescan(t *testing.T) {
 	// Reload the hostdb using the same persist and the mocked consensus set.
 	// The old change ID will be rejected, causing a rescan, which should
 	// discover the new announcement.
-	hdb, err = newHostDB(cs, stdDialer{}, stdSleeper{}, hdb.persist, hdb.log)
+	hdb, err = newHostDB(cs, new(stdDialer), stdSleeper{}, hdb.persist, hdb.log)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,70 @@
+package hostdb
+
+// pin.go allows hosts to be pinned to the set of active hosts. A pinned host
+// is still weighted and scanned like any other host, but it is never demoted
+// or pruned automatically: failed probes, the uptime floor, and quarantine all
+// leave it in the host tree. Pins are persisted, and last until the host is
+// unpinned.
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+var errHostPinned = errors.New("host is pinned")
+
+// isPinned returns true if the host at the provided address is pinned.
+func (hdb *HostDB) isPinned(addr modules.NetAddress) bool {
+	_, exists := hdb.pinned[addr]
+	return exists
+}
+
+// Pin marks the host at the provided address as immune to automatic demotion
+// and pruning. If the host is not currently active, it is returned to the set
+// of active hosts.
+func (hdb *HostDB) Pin(addr modules.NetAddress) error {
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+
+	entry, exists := hdb.allHosts[addr]
+	if !exists {
+		return errHostNotFound
+	}
+	if hdb.pinned == nil {
+		hdb.pinned = make(map[modules.NetAddress]struct{})
+	}
+	hdb.pinned[addr] = struct{}{}
+	delete(hdb.quarantined, addr)
+
+	if _, active := hdb.activeHosts[addr]; !active {
+		entry.Weight = hdb.hostWeight(entry)
+		hdb.insertNode(entry)
+		hdb.queueEvent(EventReactivate, entry)
+	}
+	return hdb.save()
+}
+
+// Unpin removes the pin from the host at the provided address. The host is
+// not demoted immediately, but becomes subject to automatic demotion again.
+func (hdb *HostDB) Unpin(addr modules.NetAddress) error {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+
+	if !hdb.isPinned(addr) {
+		return nil
+	}
+	delete(hdb.pinned, addr)
+	return hdb.save()
+}
+
+// PinnedHosts returns the addresses of all pinned hosts.
+func (hdb *HostDB) PinnedHosts() (addrs []modules.NetAddress) {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	for addr := range hdb.pinned {
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
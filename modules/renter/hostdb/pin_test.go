@@ -0,0 +1,77 @@
+package hostdb
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestPin checks that pinned hosts survive probe failures and quarantine, and
+// that unpinned hosts are demoted as usual.
+func TestPin(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	settings := modules.HostExternalSettings{AcceptingContracts: true}
+
+	if err := hdb.Pin(fakeAddr(1)); err != errHostNotFound {
+		t.Fatal("expected errHostNotFound, got", err)
+	}
+
+	pinned := &hostEntry{HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(1)}, Reliability: DefaultReliability}
+	unpinned := &hostEntry{HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(2)}, Reliability: DefaultReliability}
+	hdb.managedUpdateEntry(pinned, settings, modules.HostSettingsExtension{}, nil)
+	hdb.managedUpdateEntry(unpinned, settings, modules.HostSettingsExtension{}, nil)
+	if err := hdb.Pin(pinned.NetAddress); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fail enough probes to drive the reliability of both hosts to zero.
+	failures := int(MaxReliability.Big().Int64()) + 1
+	for i := 0; i < failures; i++ {
+		hdb.managedUpdateEntry(pinned, settings, modules.HostSettingsExtension{}, errors.New("probe failed"))
+		if i == 0 {
+			hdb.managedUpdateEntry(unpinned, settings, modules.HostSettingsExtension{}, errors.New("probe failed"))
+		}
+	}
+	if _, exists := hdb.activeHosts[pinned.NetAddress]; !exists {
+		t.Error("pinned host was demoted by failed probes")
+	}
+	if _, exists := hdb.allHosts[pinned.NetAddress]; !exists {
+		t.Error("pinned host was pruned by failed probes")
+	}
+	if !pinned.Reliability.IsZero() {
+		t.Error("pinned host should still lose reliability:", pinned.Reliability)
+	}
+	if _, exists := hdb.activeHosts[unpinned.NetAddress]; exists {
+		t.Error("unpinned host was not demoted by a failed probe")
+	}
+
+	// Pinned hosts cannot be quarantined.
+	if err := hdb.Quarantine(pinned.NetAddress, time.Hour); err != errHostPinned {
+		t.Error("expected errHostPinned, got", err)
+	}
+	if _, exists := hdb.activeHosts[pinned.NetAddress]; !exists {
+		t.Error("pinned host was removed by a quarantine")
+	}
+
+	// The pin set persists.
+	hdb2 := bareHostDB()
+	hdb2.persist = hdb.persist
+	if err := hdb2.load(); err != nil {
+		t.Fatal(err)
+	}
+	if !hdb2.isPinned(pinned.NetAddress) || hdb2.isPinned(unpinned.NetAddress) {
+		t.Error("pin set was not persisted correctly")
+	}
+
+	// Once unpinned, the host is subject to demotion again.
+	if err := hdb.Unpin(pinned.NetAddress); err != nil {
+		t.Fatal(err)
+	}
+	hdb.managedUpdateEntry(pinned, settings, modules.HostSettingsExtension{}, errors.New("probe failed"))
+	if _, exists := hdb.activeHosts[pinned.NetAddress]; exists {
+		t.Error("unpinned host was not demoted by a failed probe")
+	}
+}
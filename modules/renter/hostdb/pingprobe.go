@@ -0,0 +1,127 @@
+package hostdb
+
+// pingprobe.go lets the poller probe hosts with RPCPing instead of
+// RPCSettings. A ping goes through the same dial and TLS code as every other
+// RPC, and is answered by the same connection handling code on the host, so
+// it catches hosts that accept connections but fail at the protocol layer,
+// without the cost of transferring and verifying the full settings. The
+// settings of the hosts are still refreshed by the scans and by Refresh.
+//
+// Every probe, whether it uses RPCPing or RPCSettings, records the time taken
+// to connect to the host and the round-trip time of the RPC separately.
+
+import (
+	"crypto/rand"
+	"errors"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	// errPingNonceMismatch is returned if a host does not echo the nonce of
+	// a ping.
+	errPingNonceMismatch = errors.New("host did not echo the ping nonce")
+)
+
+// recordProbeTimes folds the connect time and the RPC round-trip time of a
+// successful probe into the moving averages of the entry. The first sample
+// of each replaces the average entirely.
+func (he *hostEntry) recordProbeTimes(connect, roundTrip time.Duration) {
+	if he.ConnectTime == 0 {
+		he.ConnectTime = connect
+	} else {
+		he.ConnectTime = (he.ConnectTime*(latencyDecay-1) + connect) / latencyDecay
+	}
+	if he.RPCTime == 0 {
+		he.RPCTime = roundTrip
+	} else {
+		he.RPCTime = (he.RPCTime*(latencyDecay-1) + roundTrip) / latencyDecay
+	}
+}
+
+// SetPingProbes sets whether the poller probes hosts with RPCPing rather than
+// RPCSettings. The change takes effect when the poller begins its next cycle.
+func (hdb *HostDB) SetPingProbes(enabled bool) {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.pingProbes = enabled
+}
+
+// managedPingHost pings a host and updates the host's entry with the result,
+// returning the error encountered while probing, if any. A successful ping
+// counts towards the reliability and uptime of the host in the same way as a
+// successful settings probe, but leaves the settings of the host unchanged.
+func (hdb *HostDB) managedPingHost(entry *hostEntry) error {
+	hdb.log.Debugln("Pinging", entry.NetAddress, entry.PublicKey)
+	var connectTime, rpcTime time.Duration
+	err := func() error {
+		start := time.Now()
+		conn, err := hdb.dialer.DialTimeout(entry.NetAddress, hostRequestTimeout)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		conn, err = hdb.managedWrapTLS(conn, entry)
+		if err != nil {
+			return err
+		}
+		connectTime = time.Since(start)
+
+		conn.SetDeadline(time.Now().Add(hostRequestTimeout))
+		start = time.Now()
+		var nonce [8]byte
+		_, err = rand.Read(nonce[:])
+		if err != nil {
+			return err
+		}
+		err = encoding.WriteObject(conn, modules.RPCPing)
+		if err != nil {
+			return err
+		}
+		err = encoding.WriteObject(conn, nonce)
+		if err != nil {
+			return err
+		}
+		var resp modules.HostPingResponse
+		err = encoding.ReadObject(conn, &resp, 1024)
+		if err != nil {
+			return err
+		}
+		if resp.Nonce != nonce {
+			return errPingNonceMismatch
+		}
+		rpcTime = time.Since(start)
+		return nil
+	}()
+	if err != nil {
+		hdb.log.Debugln("Pinging", entry.NetAddress, entry.PublicKey, "failed", err)
+		hdb.managedUpdateEntry(entry, modules.HostExternalSettings{}, modules.HostSettingsExtension{}, err)
+		return err
+	}
+	hdb.log.Debugln("Pinging", entry.NetAddress, entry.PublicKey, "succeeded")
+
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	// Only the entry that is currently active is updated; hosts that have
+	// been removed or re-announced since the poller began its cycle are left
+	// to the next cycle.
+	node, active := hdb.activeHosts[entry.NetAddress]
+	if !active || node.hostEntry != entry {
+		return nil
+	}
+	entry.Reliability = MaxReliability
+	entry.Online = true
+	entry.recordUptime(true)
+	entry.recordProbe(true)
+	entry.recordProbeTimes(connectTime, rpcTime)
+	entry.LastSeen = time.Now()
+	entry.lastProbed = entry.LastSeen
+	if newWeight := hdb.hostWeight(entry); newWeight.Cmp(entry.Weight) != 0 {
+		hdb.reweight(entry.NetAddress, newWeight)
+	}
+	hdb.save()
+	return nil
+}
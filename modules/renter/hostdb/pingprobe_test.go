@@ -0,0 +1,81 @@
+package hostdb
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// pingDialer returns a dialer whose connections answer an RPCPing, echoing
+// the nonce if 'echo' is true.
+func pingDialer(echo bool) probeDialer {
+	return probeDialer(func(modules.NetAddress, time.Duration) (net.Conn, error) {
+		ourConn, theirConn := net.Pipe()
+		go func() {
+			defer ourConn.Close()
+			var id types.Specifier
+			var nonce [8]byte
+			encoding.ReadObject(ourConn, &id, types.SpecifierLen)
+			encoding.ReadObject(ourConn, &nonce, 8)
+			if id != modules.RPCPing {
+				return
+			}
+			if !echo {
+				nonce[0]++
+			}
+			encoding.WriteObject(ourConn, modules.HostPingResponse{Nonce: nonce})
+		}()
+		return theirConn, nil
+	})
+}
+
+// TestPingHost checks that a successful ping counts towards the reliability
+// of a host and records its probe times, and that a host that answers the
+// connection but not the RPC is penalized.
+func TestPingHost(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	settings := modules.HostExternalSettings{AcceptingContracts: true, StoragePrice: types.NewCurrency64(15e6)}
+	entry := &hostEntry{HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(1)}, Reliability: DefaultReliability}
+	hdb.managedUpdateEntry(entry, settings, modules.HostSettingsExtension{}, nil)
+	entry.Reliability = DefaultReliability
+
+	hdb.dialer = pingDialer(true)
+	if err := hdb.managedPingHost(entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Reliability.Cmp(MaxReliability) != 0 {
+		t.Error("successful ping did not restore the reliability of the host")
+	}
+	if entry.ConnectTime == 0 || entry.RPCTime == 0 {
+		t.Error("probe times were not recorded:", entry.ConnectTime, entry.RPCTime)
+	}
+	if entry.StoragePrice.Cmp(settings.StoragePrice) != 0 {
+		t.Error("ping changed the settings of the host")
+	}
+
+	hdb.dialer = pingDialer(false)
+	if err := hdb.managedPingHost(entry); err != errPingNonceMismatch {
+		t.Fatal("expected errPingNonceMismatch, got", err)
+	}
+	if entry.Reliability.Cmp(MaxReliability) >= 0 {
+		t.Error("failed ping did not penalize the host")
+	}
+}
+
+// TestRecordProbeTimes checks the moving averages of the probe times.
+func TestRecordProbeTimes(t *testing.T) {
+	var he hostEntry
+	he.recordProbeTimes(100*time.Millisecond, 200*time.Millisecond)
+	if he.ConnectTime != 100*time.Millisecond || he.RPCTime != 200*time.Millisecond {
+		t.Fatal("first sample did not replace the averages:", he.ConnectTime, he.RPCTime)
+	}
+	he.recordProbeTimes(500*time.Millisecond, 200*time.Millisecond)
+	if he.ConnectTime != 200*time.Millisecond || he.RPCTime != 200*time.Millisecond {
+		t.Error("wrong moving averages:", he.ConnectTime, he.RPCTime)
+	}
+}
@@ -0,0 +1,114 @@
+package hostdb
+
+// poll.go implements the poller, which cycles through the active hosts and
+// probes each of them in turn to keep their settings and metrics fresh. The
+// probes of a cycle are spread evenly across the probe interval rather than
+// being sent in a burst, and no more than the configured number of probes are
+// in flight at once.
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultProbeConcurrency is the default number of probes that the poller
+	// runs at a time.
+	defaultProbeConcurrency = 2
+
+	// defaultProbeInterval is the default length of time in which the poller
+	// probes every active host once.
+	defaultProbeInterval = 30 * time.Minute
+)
+
+var (
+	// errInvalidProbeSchedule is returned if the probe concurrency or the
+	// probe interval is negative.
+	errInvalidProbeSchedule = errors.New("probe concurrency and interval cannot be negative")
+)
+
+// probeSchedule returns the probe concurrency and interval of the poller,
+// applying the defaults to any that are unset.
+func (hdb *HostDB) probeSchedule() (int, time.Duration) {
+	concurrency, interval := hdb.probeConcurrency, hdb.probeInterval
+	if concurrency == 0 {
+		concurrency = defaultProbeConcurrency
+	}
+	if interval == 0 {
+		interval = defaultProbeInterval
+	}
+	return concurrency, interval
+}
+
+// SetProbeSchedule sets the number of probes that the poller runs at a time,
+// and the length of time in which the poller probes every active host once.
+// A value of 0 restores the default. The new schedule takes effect when the
+// poller begins its next cycle.
+func (hdb *HostDB) SetProbeSchedule(concurrency int, interval time.Duration) error {
+	if concurrency < 0 || interval < 0 {
+		return errInvalidProbeSchedule
+	}
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.probeConcurrency = concurrency
+	hdb.probeInterval = interval
+	return nil
+}
+
+// threadedPoll probes the active hosts in cycles until the hostdb is closed.
+// Each cycle probes the hosts that were active when the cycle began, waiting
+// interval/n between probes. The poller does not return until its probes
+// have finished.
+func (hdb *HostDB) threadedPoll() {
+	defer hdb.threadGroup.Done()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		hdb.mu.RLock()
+		var entries []*hostEntry
+		for _, node := range hdb.sortedActiveNodes() {
+			entries = append(entries, node.hostEntry)
+		}
+		concurrency, interval := hdb.probeSchedule()
+		probe := hdb.managedProbeHost
+		if hdb.pingProbes {
+			probe = hdb.managedPingHost
+		}
+		hdb.mu.RUnlock()
+
+		if len(entries) == 0 {
+			select {
+			case <-hdb.closeChan:
+				return
+			case <-time.After(interval):
+			}
+			continue
+		}
+
+		spacing := interval / time.Duration(len(entries))
+		slots := make(chan struct{}, concurrency)
+		for _, entry := range entries {
+			select {
+			case <-hdb.closeChan:
+				return
+			case <-time.After(spacing):
+			}
+
+			// Wait for a free slot, so that slow hosts cannot cause the
+			// number of probes in flight to grow.
+			select {
+			case <-hdb.closeChan:
+				return
+			case slots <- struct{}{}:
+			}
+			wg.Add(1)
+			go func(entry *hostEntry) {
+				defer wg.Done()
+				probe(entry)
+				<-slots
+			}(entry)
+		}
+	}
+}
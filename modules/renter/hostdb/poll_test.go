@@ -0,0 +1,108 @@
+package hostdb
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestSetProbeSchedule checks the validation and defaults of the probe
+// schedule.
+func TestSetProbeSchedule(t *testing.T) {
+	hdb := bareHostDB()
+	if c, i := hdb.probeSchedule(); c != defaultProbeConcurrency || i != defaultProbeInterval {
+		t.Error("zero value hostdb does not use the default schedule:", c, i)
+	}
+	if err := hdb.SetProbeSchedule(-1, time.Second); err != errInvalidProbeSchedule {
+		t.Error("expected errInvalidProbeSchedule, got", err)
+	}
+	if err := hdb.SetProbeSchedule(3, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if c, i := hdb.probeSchedule(); c != 3 || i != time.Second {
+		t.Error("schedule was not set:", c, i)
+	}
+}
+
+// TestThreadedPoll checks that the poller probes every active host, spreads
+// the probes across the interval, and respects the probe concurrency.
+func TestThreadedPoll(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	hdb.closeChan = make(chan struct{})
+
+	var inFlight, maxInFlight int32
+	var mu sync.Mutex
+	probed := make(map[modules.NetAddress]time.Time)
+	hdb.dialer = probeDialer(func(addr modules.NetAddress, _ time.Duration) (net.Conn, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		mu.Lock()
+		if _, exists := probed[addr]; !exists {
+			probed[addr] = time.Now()
+		}
+		mu.Unlock()
+		time.Sleep(100 * time.Millisecond)
+		return nil, net.UnknownNetworkError("fail")
+	})
+
+	const numHosts = 10
+	for i := 0; i < numHosts; i++ {
+		entry := &hostEntry{
+			HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(uint8(i))},
+			Reliability: MaxReliability,
+			Weight:      types.NewCurrency64(1),
+		}
+		hdb.allHosts[entry.NetAddress] = entry
+		hdb.insertNode(entry)
+	}
+	interval := 500 * time.Millisecond
+	if err := hdb.SetProbeSchedule(1, interval); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	hdb.threadGroup.Add(1)
+	go hdb.threadedPoll()
+	for i := 0; i < 100; i++ {
+		mu.Lock()
+		n := len(probed)
+		mu.Unlock()
+		if n == numHosts {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	close(hdb.closeChan)
+	hdb.threadGroup.Wait()
+
+	if len(probed) != numHosts {
+		t.Fatal("expected every active host to be probed, got", len(probed))
+	}
+	if max := atomic.LoadInt32(&maxInFlight); max != 1 {
+		t.Error("probe concurrency was not respected:", max)
+	}
+	var first time.Time
+	for _, probedAt := range probed {
+		if first.IsZero() || probedAt.Before(first) {
+			first = probedAt
+		}
+	}
+	if first.Sub(start) < interval/numHosts/2 {
+		t.Error("probes were not spread across the interval")
+	}
+}
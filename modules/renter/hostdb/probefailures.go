@@ -0,0 +1,72 @@
+package hostdb
+
+// probefailures.go penalizes hosts that have recently failed a probe. Each
+// failed probe divides the weight of the host by probeFailurePenalty, and each
+// successful probe lifts one failure's worth of the penalty, so a host that
+// suffers a transient outage is sharply deprioritized and then recovers as it
+// proves itself again. By default a failed probe still demotes an active host;
+// with a failure tolerance, the host is kept in the tree with its penalized
+// weight until it has failed more probes than the tolerance allows.
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// probeFailurePenalty is the factor by which the weight of a host is
+	// divided for each recent probe failure.
+	probeFailurePenalty = 4
+
+	// maxPenalizedFailures bounds the number of failures that are penalized,
+	// so that a host which has been offline for a long time can still
+	// recover within a handful of probes.
+	maxPenalizedFailures = 8
+)
+
+var errInvalidFailureTolerance = errors.New("failure tolerance cannot be negative")
+
+// recordProbe updates the number of recent probe failures of the entry.
+func (he *hostEntry) recordProbe(success bool) {
+	if !success {
+		if he.ProbeFailures < maxPenalizedFailures {
+			he.ProbeFailures++
+		}
+	} else if he.ProbeFailures > 0 {
+		he.ProbeFailures--
+	}
+}
+
+// probeFailureAdjustment divides a weight by probeFailurePenalty for each
+// recent probe failure of a host.
+func probeFailureAdjustment(weight types.Currency, failures uint64) types.Currency {
+	if failures > maxPenalizedFailures {
+		failures = maxPenalizedFailures
+	}
+	for i := uint64(0); i < failures; i++ {
+		weight = weight.Div64(probeFailurePenalty)
+	}
+	return weight
+}
+
+// toleratesFailure returns true if an active host that has just failed a
+// probe should stay in the tree.
+func (hdb *HostDB) toleratesFailure(entry *hostEntry) bool {
+	_, active := hdb.activeHosts[entry.NetAddress]
+	return active && entry.ProbeFailures <= uint64(hdb.failureTolerance)
+}
+
+// SetFailureTolerance sets the number of recent probe failures that an active
+// host may accumulate before it is demoted. Until then, the host stays in the
+// tree with a penalized weight. A tolerance of 0 demotes a host on its first
+// failed probe.
+func (hdb *HostDB) SetFailureTolerance(n int) error {
+	if n < 0 {
+		return errInvalidFailureTolerance
+	}
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.failureTolerance = n
+	return nil
+}
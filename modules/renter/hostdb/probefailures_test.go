@@ -0,0 +1,74 @@
+package hostdb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestProbeFailurePenalty checks that failed probes penalize the weight of a
+// tolerated host without demoting it, and that successful probes restore the
+// weight.
+func TestProbeFailurePenalty(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	if err := hdb.SetFailureTolerance(-1); err != errInvalidFailureTolerance {
+		t.Fatal("expected a negative tolerance to be rejected, got", err)
+	}
+	if err := hdb.SetFailureTolerance(2); err != nil {
+		t.Fatal(err)
+	}
+
+	settings := modules.HostExternalSettings{AcceptingContracts: true}
+	entry := &hostEntry{
+		HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(1)},
+		Reliability: DefaultReliability,
+	}
+	hdb.managedUpdateEntry(entry, settings, modules.HostSettingsExtension{}, nil)
+	// Probe once more with an unchanged uptime, so that the weights below
+	// are only affected by the failures.
+	hdb.managedUpdateEntry(entry, settings, modules.HostSettingsExtension{}, nil)
+	full := entry.Weight
+
+	probeErr := errors.New("probe failed")
+	hdb.managedUpdateEntry(entry, settings, modules.HostSettingsExtension{}, probeErr)
+	if _, active := hdb.activeHosts[entry.NetAddress]; !active {
+		t.Fatal("host was demoted within the failure tolerance")
+	}
+	if entry.ProbeFailures != 1 || entry.Weight.Cmp(full.Div64(probeFailurePenalty)) >= 0 {
+		t.Error("failed probe did not penalize the weight:", entry.ProbeFailures, entry.Weight)
+	}
+	if hdb.hostTree.weight.Cmp(entry.Weight) != 0 {
+		t.Error("tree weight does not match the penalized weight")
+	}
+	penalized := entry.Weight
+
+	// A successful probe lifts the penalty.
+	hdb.managedUpdateEntry(entry, settings, modules.HostSettingsExtension{}, nil)
+	if entry.ProbeFailures != 0 || entry.Weight.Cmp(penalized) <= 0 {
+		t.Error("successful probe did not restore the weight:", entry.ProbeFailures, entry.Weight)
+	}
+
+	// Exceeding the tolerance demotes the host.
+	for i := 0; i < 3; i++ {
+		hdb.managedUpdateEntry(entry, settings, modules.HostSettingsExtension{}, probeErr)
+	}
+	if _, active := hdb.activeHosts[entry.NetAddress]; active {
+		t.Error("host was not demoted after exceeding the failure tolerance")
+	}
+}
+
+// TestProbeFailureAdjustment checks that the penalty is bounded.
+func TestProbeFailureAdjustment(t *testing.T) {
+	weight := baseWeight
+	if probeFailureAdjustment(weight, 0).Cmp(weight) != 0 {
+		t.Error("weight was penalized without any failures")
+	}
+	if probeFailureAdjustment(weight, 2).Cmp(weight.Div64(probeFailurePenalty*probeFailurePenalty)) != 0 {
+		t.Error("wrong penalty for two failures")
+	}
+	if probeFailureAdjustment(weight, 100).Cmp(probeFailureAdjustment(weight, maxPenalizedFailures)) != 0 {
+		t.Error("penalty was not bounded")
+	}
+}
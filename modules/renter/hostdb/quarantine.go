@@ -0,0 +1,108 @@
+package hostdb
+
+// quarantine.go allows hosts to be temporarily excluded from selection. A
+// quarantined host remains in the set of all hosts and continues to be
+// scanned, but it is held out of the host tree until the quarantine expires.
+// Quarantines are persisted, and expired quarantines are released both when
+// the host tree is next read and by a sweeper that runs every
+// quarantineSweepInterval.
+
+import (
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// quarantineSweepInterval is how often the hostdb releases the hosts whose
+// quarantine has expired, if nothing else has released them first.
+const quarantineSweepInterval = time.Minute
+
+// isQuarantined returns true if the host at the provided address is currently
+// quarantined.
+func (hdb *HostDB) isQuarantined(addr modules.NetAddress) bool {
+	expiry, exists := hdb.quarantined[addr]
+	return exists && time.Now().Before(expiry)
+}
+
+// releaseQuarantine returns all hosts whose quarantine has expired to the host
+// tree, provided that they are still online.
+func (hdb *HostDB) releaseQuarantine() {
+	now := time.Now()
+	for addr, expiry := range hdb.quarantined {
+		if now.Before(expiry) {
+			continue
+		}
+		delete(hdb.quarantined, addr)
+
+		entry, exists := hdb.allHosts[addr]
+		if !exists || !entry.Online {
+			continue
+		}
+		if _, active := hdb.activeHosts[addr]; !active && len(hdb.activeHosts) < maxActiveHosts {
+			hdb.insertNode(entry)
+			hdb.queueEvent(EventReactivate, entry)
+		}
+	}
+}
+
+// Quarantine prevents the host at the provided address from being selected
+// for the provided duration, without removing the host from the hostdb.
+// Quarantining a host that is already quarantined replaces the expiration.
+// Pinned hosts cannot be quarantined.
+func (hdb *HostDB) Quarantine(addr modules.NetAddress, duration time.Duration) error {
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+
+	if _, exists := hdb.allHosts[addr]; !exists {
+		return errHostNotFound
+	}
+	if hdb.isPinned(addr) {
+		return errHostPinned
+	}
+	hdb.quarantined[addr] = time.Now().Add(duration)
+
+	// Remove the host from the tree so that it cannot be selected.
+	node, exists := hdb.activeHosts[addr]
+	if exists {
+		node.removeNode()
+		delete(hdb.activeHosts, addr)
+		hdb.queueEvent(EventFlag, node.hostEntry)
+	}
+	return hdb.save()
+}
+
+// Unquarantine ends the quarantine of a host early, returning the host to the
+// set of active hosts if it is online.
+func (hdb *HostDB) Unquarantine(addr modules.NetAddress) {
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+
+	if _, exists := hdb.quarantined[addr]; !exists {
+		return
+	}
+	hdb.quarantined[addr] = time.Time{}
+	hdb.releaseQuarantine()
+	hdb.save()
+}
+
+// threadedReleaseQuarantine periodically releases the hosts whose quarantine
+// has expired, so that they return to the host tree even if the tree is not
+// read in the meantime.
+func (hdb *HostDB) threadedReleaseQuarantine() {
+	defer hdb.threadGroup.Done()
+	for {
+		select {
+		case <-hdb.closeChan:
+			return
+		case <-time.After(quarantineSweepInterval):
+		}
+		func() {
+			defer hdb.managedDeliverEvents()
+			hdb.mu.Lock()
+			defer hdb.mu.Unlock()
+			hdb.releaseQuarantine()
+		}()
+	}
+}
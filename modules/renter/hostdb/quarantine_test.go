@@ -0,0 +1,118 @@
+package hostdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestQuarantine checks that quarantined hosts are not selected, but remain
+// in the hostdb and return to selection once the quarantine ends.
+func TestQuarantine(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+
+	// Quarantining an unknown host should fail.
+	err := hdb.Quarantine(fakeAddr(1), time.Hour)
+	if err != errHostNotFound {
+		t.Fatalf("expected %v, got %v", errHostNotFound, err)
+	}
+
+	var dbe modules.HostDBEntry
+	dbe.AcceptingContracts = true
+	for i := uint8(1); i <= 2; i++ {
+		dbe.NetAddress = fakeAddr(i)
+		entry := &hostEntry{
+			HostDBEntry: dbe,
+			Weight:      types.NewCurrency64(10),
+			Online:      true,
+		}
+		hdb.allHosts[entry.NetAddress] = entry
+		hdb.insertNode(entry)
+	}
+
+	err = hdb.Quarantine(fakeAddr(1), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		hosts := hdb.RandomHosts(2, nil)
+		if len(hosts) != 1 || hosts[0].NetAddress != fakeAddr(2) {
+			t.Fatal("quarantined host was selected:", hosts)
+		}
+	}
+	if _, exists := hdb.Host(fakeAddr(1)); !exists {
+		t.Error("quarantined host was removed from the hostdb")
+	}
+
+	// A successful scan should not bring the host back into selection.
+	hdb.managedUpdateEntry(hdb.allHosts[fakeAddr(1)], modules.HostExternalSettings{AcceptingContracts: true}, modules.HostSettingsExtension{}, nil)
+	if len(hdb.RandomHosts(2, nil)) != 1 {
+		t.Error("scan returned a quarantined host to the active set")
+	}
+
+	// Ending the quarantine should return the host to selection.
+	hdb.Unquarantine(fakeAddr(1))
+	if len(hdb.RandomHosts(2, nil)) != 2 {
+		t.Error("host was not returned after the quarantine ended")
+	}
+
+	// An expired quarantine should be released automatically.
+	err = hdb.Quarantine(fakeAddr(2), time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if len(hdb.RandomHosts(2, nil)) != 2 {
+		t.Error("host was not returned after the quarantine expired")
+	}
+}
+
+// TestQuarantinePersist checks that quarantines survive a restart, and that
+// loading a quarantined host does not return it to the host tree.
+func TestQuarantinePersist(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	var dbe modules.HostDBEntry
+	dbe.AcceptingContracts = true
+	for i := uint8(1); i <= 2; i++ {
+		dbe.NetAddress = fakeAddr(i)
+		entry := &hostEntry{
+			HostDBEntry: dbe,
+			Weight:      types.NewCurrency64(10),
+			Online:      true,
+		}
+		hdb.allHosts[entry.NetAddress] = entry
+		hdb.insertNode(entry)
+	}
+	if err := hdb.Quarantine(fakeAddr(1), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := hdb.Quarantine(fakeAddr(2), time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+
+	hdb2 := bareHostDB()
+	hdb2.persist = hdb.persist
+	if err := hdb2.load(); err != nil {
+		t.Fatal(err)
+	}
+	if !hdb2.isQuarantined(fakeAddr(1)) {
+		t.Error("quarantine was not persisted")
+	}
+	if _, exists := hdb2.quarantined[fakeAddr(2)]; exists {
+		t.Error("expired quarantine was persisted")
+	}
+
+	// A quarantined host recorded as active is kept out of the tree.
+	data := hdb.persistData()
+	data.ActiveHosts = append(data.ActiveHosts, *hdb.allHosts[fakeAddr(1)])
+	hdb3 := bareHostDB()
+	hdb3.loadData(data)
+	if _, exists := hdb3.activeHosts[fakeAddr(1)]; exists {
+		t.Error("loading returned a quarantined host to the host tree")
+	}
+}
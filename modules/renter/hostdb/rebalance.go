@@ -0,0 +1,108 @@
+package hostdb
+
+// rebalance.go bounds the depth of the host tree. Removing a host leaves an
+// empty node in the tree, and new hosts are not always inserted into empty
+// nodes, so a tree that sees a lot of churn grows deeper than the number of
+// active hosts requires. When an insertion places a host deeper than the
+// maximum depth, the tree is rebuilt from the active hosts, which discards
+// the empty nodes.
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// defaultMaxTreeDepth is the maximum depth of the host tree if none has
+	// been set. A balanced tree holding maxActiveHosts is about 9 levels
+	// deep.
+	defaultMaxTreeDepth = 16
+)
+
+var errInvalidTreeDepth = errors.New("maximum tree depth must be positive")
+
+// depth returns the number of nodes between the node and the root of its
+// tree, counting both. The root has a depth of 1.
+func (hn *hostNode) depth() (d int) {
+	for current := hn; current != nil; current = current.parent {
+		d++
+	}
+	return d
+}
+
+// treeDepth returns the depth of the deepest node in the tree rooted at 'hn'.
+// The tree is walked iteratively, so that the stack usage is constant.
+func (hn *hostNode) treeDepth() (max int) {
+	if hn == nil {
+		return 0
+	}
+	type frame struct {
+		node  *hostNode
+		depth int
+	}
+	stack := []frame{{hn, 1}}
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if f.depth > max {
+			max = f.depth
+		}
+		if f.node.left != nil {
+			stack = append(stack, frame{f.node.left, f.depth + 1})
+		}
+		if f.node.right != nil {
+			stack = append(stack, frame{f.node.right, f.depth + 1})
+		}
+	}
+	return max
+}
+
+// maxDepth returns the depth at which the host tree is rebuilt.
+func (hdb *HostDB) maxDepth() int {
+	if hdb.maxTreeDepth == 0 {
+		return defaultMaxTreeDepth
+	}
+	return hdb.maxTreeDepth
+}
+
+// rebuildTree replaces the host tree with a tree that holds only the active
+// hosts. The weights of the hosts are unchanged.
+func (hdb *HostDB) rebuildTree() {
+	nodes := hdb.sortedActiveNodes()
+	hdb.hostTree = nil
+	hdb.activeHosts = make(map[modules.NetAddress]*hostNode, len(nodes))
+	for _, node := range nodes {
+		hdb.insertNode(node.hostEntry)
+	}
+}
+
+// rebalanceIfDeep rebuilds the host tree if 'node' lies beyond the maximum
+// depth and the tree holds empty nodes that a rebuild would discard. A tree
+// without empty nodes is already as shallow as it can be.
+func (hdb *HostDB) rebalanceIfDeep(node *hostNode) {
+	if node.depth() <= hdb.maxDepth() || hdb.hostTree.count <= len(hdb.activeHosts) {
+		return
+	}
+	hdb.rebuildTree()
+}
+
+// SetMaxTreeDepth sets the depth beyond which an insertion causes the host tree
+// to be rebuilt. A depth of 0 restores the default.
+func (hdb *HostDB) SetMaxTreeDepth(depth int) error {
+	if depth < 0 {
+		return errInvalidTreeDepth
+	}
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.maxTreeDepth = depth
+	return nil
+}
+
+// TreeDepth returns the current depth of the host tree. It is intended for
+// debugging.
+func (hdb *HostDB) TreeDepth() int {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	return hdb.hostTree.treeDepth()
+}
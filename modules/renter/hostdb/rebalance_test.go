@@ -0,0 +1,79 @@
+package hostdb
+
+import (
+	mrand "math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// churnTree removes a random host from the tree and inserts a new one,
+// 'rounds' times.
+func churnTree(hdb *HostDB, rounds int, r *mrand.Rand) {
+	var addrs []modules.NetAddress
+	for _, node := range hdb.sortedActiveNodes() {
+		addrs = append(addrs, node.hostEntry.NetAddress)
+	}
+	for i := 0; i < rounds; i++ {
+		j := r.Intn(len(addrs))
+		node := hdb.activeHosts[addrs[j]]
+		node.removeNode()
+		delete(hdb.activeHosts, addrs[j])
+
+		entry := &hostEntry{Weight: types.NewCurrency64(uint64(r.Intn(20) + 1))}
+		entry.NetAddress = modules.NetAddress("churn" + strconv.Itoa(i) + ":1")
+		hdb.insertNode(entry)
+		addrs[j] = entry.NetAddress
+	}
+}
+
+// TestTreeRebalance checks that the depth of the host tree stays within the
+// maximum depth under churn, and that rebuilding the tree preserves the
+// active hosts and their weights.
+func TestTreeRebalance(t *testing.T) {
+	if err := bareHostDB().SetMaxTreeDepth(-1); err != errInvalidTreeDepth {
+		t.Fatal("expected errInvalidTreeDepth, got", err)
+	}
+
+	hdb := benchmarkTree(100)
+	const maxDepth = 9
+	if err := hdb.SetMaxTreeDepth(maxDepth); err != nil {
+		t.Fatal(err)
+	}
+	churnTree(hdb, 2000, mrand.New(mrand.NewSource(0)))
+	if depth := hdb.TreeDepth(); depth > maxDepth {
+		t.Error("tree depth exceeds the maximum:", depth)
+	}
+	if len(hdb.activeHosts) != 100 {
+		t.Fatal("wrong number of active hosts:", len(hdb.activeHosts))
+	}
+	total := types.ZeroCurrency
+	for addr, node := range hdb.activeHosts {
+		if node.hostEntry.NetAddress != addr || !node.taken {
+			t.Fatal("active host map does not match the tree")
+		}
+		total = total.Add(node.hostEntry.Weight)
+	}
+	if total.Cmp(hdb.hostTree.weight) != 0 {
+		t.Error("tree weight does not match the weights of the active hosts")
+	}
+}
+
+// BenchmarkTreeChurn benchmarks removing and inserting hosts with a bounded
+// tree depth, failing if the depth exceeds the bound.
+func BenchmarkTreeChurn(b *testing.B) {
+	hdb := benchmarkTree(500)
+	const maxDepth = 12
+	if err := hdb.SetMaxTreeDepth(maxDepth); err != nil {
+		b.Fatal(err)
+	}
+	r := mrand.New(mrand.NewSource(0))
+	b.ResetTimer()
+	churnTree(hdb, b.N, r)
+	b.StopTimer()
+	if depth := hdb.TreeDepth(); depth > maxDepth {
+		b.Fatal("tree depth exceeds the maximum:", depth)
+	}
+}
@@ -0,0 +1,41 @@
+package hostdb
+
+// refresh.go allows a single host to be probed on demand, rather than waiting
+// for the poller or the scan loop to reach it.
+
+import (
+	"errors"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// minRefreshInterval is the minimum amount of time between two refreshes
+	// of the same host, so that callers cannot use the hostdb to flood a
+	// host with probes.
+	minRefreshInterval = time.Minute
+)
+
+var errRefreshTooSoon = errors.New("host was refreshed too recently")
+
+// Refresh immediately probes the host at the provided address, updating its
+// settings, metrics, and weight, or demoting it if the probe fails. The error
+// encountered while probing the host is returned. A host can be refreshed at
+// most once per minRefreshInterval.
+func (hdb *HostDB) Refresh(addr modules.NetAddress) error {
+	hdb.mu.Lock()
+	entry, exists := hdb.allHosts[addr]
+	if !exists {
+		hdb.mu.Unlock()
+		return errHostNotFound
+	}
+	if time.Since(entry.lastRefresh) < minRefreshInterval {
+		hdb.mu.Unlock()
+		return errRefreshTooSoon
+	}
+	entry.lastRefresh = time.Now()
+	hdb.mu.Unlock()
+
+	return hdb.managedProbeHost(entry)
+}
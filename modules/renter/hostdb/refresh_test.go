@@ -0,0 +1,51 @@
+package hostdb
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestRefresh checks that Refresh probes a host immediately, demotes it if the
+// probe fails, and limits how often a host can be refreshed.
+func TestRefresh(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	var dials int
+	hdb.dialer = probeDialer(func(modules.NetAddress, time.Duration) (net.Conn, error) {
+		dials++
+		return nil, net.UnknownNetworkError("fail")
+	})
+
+	if err := hdb.Refresh(fakeAddr(1)); err != errHostNotFound {
+		t.Fatal("expected errHostNotFound, got", err)
+	}
+
+	entry := &hostEntry{
+		HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(1)},
+		Reliability: MaxReliability,
+		Weight:      types.NewCurrency64(1),
+		Online:      true,
+	}
+	hdb.allHosts[entry.NetAddress] = entry
+	hdb.insertNode(entry)
+	if err := hdb.Refresh(entry.NetAddress); err == nil {
+		t.Fatal("expected the probe to fail")
+	}
+	if dials != 1 {
+		t.Error("host was not probed:", dials)
+	}
+	if _, active := hdb.activeHosts[entry.NetAddress]; active {
+		t.Error("host was not demoted after a failed refresh")
+	}
+
+	if err := hdb.Refresh(entry.NetAddress); err != errRefreshTooSoon {
+		t.Error("expected errRefreshTooSoon, got", err)
+	}
+	if dials != 1 {
+		t.Error("host was probed again within the refresh interval")
+	}
+}
@@ -0,0 +1,89 @@
+package hostdb
+
+// replace.go allows a caller that holds fresher settings for a host, such as
+// the renter after negotiating with it, to store them without waiting for the
+// next probe and without removing and re-inserting the host.
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	// errReplaceBlacklisted is returned by ReplaceEntry if the address of the
+	// entry is blacklisted.
+	errReplaceBlacklisted = errors.New("cannot replace the entry of a blacklisted host")
+
+	// errReplaceBanned is returned by ReplaceEntry if the public key of the
+	// entry is banned.
+	errReplaceBanned = errors.New("cannot replace the entry of a banned host")
+)
+
+// ReplaceEntry stores the provided entry at its address, returning true if an
+// entry with the same public key was already known and has been updated in
+// place, and false if the entry was inserted. An updated entry keeps its
+// reliability, uptime and other metrics, and an active host is reweighted in
+// place. A known entry with a different public key is replaced entirely.
+// Inserted hosts are made active under the same rules as a successfully
+// probed host, so quarantined hosts stay inactive and pinned hosts are
+// always made active. Blacklisted addresses and banned keys are refused.
+func (hdb *HostDB) ReplaceEntry(entry modules.HostDBEntry) (updated bool, err error) {
+	addr := entry.NetAddress
+	if err := addr.IsValid(); err != nil {
+		return false, err
+	}
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	if hdb.blacklisted(addr) {
+		return false, errReplaceBlacklisted
+	}
+	if hdb.isBanned(entry.PublicKey) {
+		return false, errReplaceBanned
+	}
+
+	local, exists := hdb.allHosts[addr]
+	if exists && !bytes.Equal(local.PublicKey.Key, entry.PublicKey.Key) {
+		hdb.removeHost(addr)
+		exists = false
+	}
+	if !exists {
+		local = &hostEntry{
+			Reliability: DefaultReliability,
+			added:       time.Now(),
+		}
+		hdb.allHosts[addr] = local
+	}
+
+	// The weight of an active host may only be changed through the tree, so
+	// the weight is kept until the entry has been replaced.
+	oldWeight := local.Weight
+	local.HostDBEntry = entry
+	hdb.indexHostKey(local)
+	local.Weight = oldWeight
+	local.Online = true
+	local.settingsFetched = time.Now()
+	local.LastSeen = local.settingsFetched
+	newWeight := hdb.hostWeight(local)
+	if _, active := hdb.activeHosts[addr]; active {
+		err := hdb.reweight(addr, newWeight)
+		if err != nil {
+			build.Critical("unable to reweight an active host:", err)
+		}
+	} else {
+		local.Weight = newWeight
+		eligible := !hdb.belowUptimeFloor(local) && !collateralBudgetDepleted(local)
+		if hdb.isPinned(addr) || (eligible && len(hdb.activeHosts) < maxActiveHosts && !hdb.isQuarantined(addr)) {
+			hdb.insertNode(local)
+			hdb.queueEvent(EventInsert, local)
+		}
+	}
+	if !exists {
+		hdb.enforceMaxHosts(addr)
+	}
+	return exists, hdb.save()
+}
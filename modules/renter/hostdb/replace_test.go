@@ -0,0 +1,111 @@
+package hostdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestReplaceEntry checks that ReplaceEntry inserts unknown hosts, updates
+// known hosts in place, and honors the blacklist and quarantine.
+func TestReplaceEntry(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	entry := modules.HostDBEntry{PublicKey: types.SiaPublicKey{Key: []byte{1}}}
+	entry.NetAddress = fakeAddr(1)
+	entry.AcceptingContracts = true
+	entry.StoragePrice = types.NewCurrency64(15e6)
+
+	if updated, err := hdb.ReplaceEntry(entry); err != nil || updated {
+		t.Fatal("unknown host was not inserted:", updated, err)
+	}
+	weight, active := hdb.WeightOf(fakeAddr(1))
+	if !active {
+		t.Fatal("inserted host is not active")
+	}
+
+	// Lowering the price raises the weight of the host in place.
+	hdb.allHosts[fakeAddr(1)].Uptime = 0.5
+	entry.StoragePrice = types.NewCurrency64(15e3)
+	if updated, err := hdb.ReplaceEntry(entry); err != nil || !updated {
+		t.Fatal("known host was not updated:", updated, err)
+	}
+	if newWeight, _ := hdb.WeightOf(fakeAddr(1)); newWeight.Cmp(weight) <= 0 {
+		t.Error("weight was not updated:", weight, newWeight)
+	}
+	if hdb.allHosts[fakeAddr(1)].Uptime != 0.5 {
+		t.Error("metrics of the host were not kept")
+	}
+	if err := uniformTreeVerification(hdb, 1); err != nil {
+		t.Error(err)
+	}
+
+	// A different key replaces the entry entirely.
+	entry.PublicKey = types.SiaPublicKey{Key: []byte{2}}
+	if updated, err := hdb.ReplaceEntry(entry); err != nil || updated {
+		t.Fatal("entry with a new key was not inserted:", updated, err)
+	}
+	if hdb.allHosts[fakeAddr(1)].Uptime != 0 || len(hdb.activeHosts) != 1 {
+		t.Error("entry with a new key was not replaced")
+	}
+
+	// Quarantined hosts are stored but not made active.
+	entry.NetAddress = fakeAddr(2)
+	hdb.allHosts[fakeAddr(2)] = &hostEntry{HostDBEntry: entry}
+	if err := hdb.Quarantine(fakeAddr(2), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hdb.ReplaceEntry(entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, active := hdb.WeightOf(fakeAddr(2)); active {
+		t.Error("quarantined host was made active")
+	}
+
+	if err := hdb.BlacklistCIDR("127.0.0.0/24"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hdb.ReplaceEntry(entry); err != errReplaceBlacklisted {
+		t.Error("expected errReplaceBlacklisted, got", err)
+	}
+}
+
+// TestReplaceEntryMaxHosts checks that an entry inserted by ReplaceEntry is
+// timestamped like an announced host, and that the maximum number of hosts
+// is enforced once the entry has been filled in.
+func TestReplaceEntryMaxHosts(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	stale := time.Now().Add(-time.Hour)
+	for i := uint8(0); i < 10; i++ {
+		entry := &hostEntry{
+			HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(i), PublicKey: types.SiaPublicKey{Key: []byte{i}}},
+			Reliability: DefaultReliability,
+			added:       stale,
+		}
+		hdb.allHosts[entry.NetAddress] = entry
+	}
+	hdb.maxHosts = 10
+
+	entry := modules.HostDBEntry{PublicKey: types.SiaPublicKey{Key: []byte{20}}}
+	entry.NetAddress = fakeAddr(20)
+	entry.AcceptingContracts = true
+	if _, err := hdb.ReplaceEntry(entry); err != nil {
+		t.Fatal(err)
+	}
+	if len(hdb.allHosts) > 10 {
+		t.Fatal("maximum number of hosts was not enforced:", len(hdb.allHosts))
+	}
+	inserted, exists := hdb.allHosts[fakeAddr(20)]
+	if !exists {
+		t.Fatal("inserted host was evicted")
+	}
+	if inserted.added.IsZero() || inserted.added.Before(stale) {
+		t.Error("inserted host was not timestamped:", inserted.added)
+	}
+	if len(hdb.keyAddresses[string(entry.PublicKey.Key)]) != 1 {
+		t.Error("inserted host was not indexed by its key")
+	}
+}
@@ -0,0 +1,111 @@
+package hostdb
+
+// report.go allows a renter to report a host for misbehavior, backed by a
+// proof that is verified against the public key of the host. Hosts that are
+// proven to have misbehaved are removed from the hostdb, and their public key
+// is banned so that later announcements of the key are ignored. The proofs
+// are self-contained, so that they could also be shared between renters.
+//
+// The only misbehavior that can currently be proven is equivocation over
+// settings. A host increments and persists the revision number of its
+// settings before every time that it signs them, so two different sets of
+// settings signed by the host with the same revision number can only have
+// been produced by a host that is presenting different terms to different
+// renters.
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var errInvalidProof = errors.New("misbehavior proof is not valid")
+
+// A MisbehaviorProof shows that the host at Host signed two different sets of
+// external settings with the same revision number. Each signature is the
+// signature sent by the host in response to RPCSettings, which covers the
+// hash of the encoded settings.
+type MisbehaviorProof struct {
+	Host       modules.NetAddress
+	Settings   [2]modules.HostExternalSettings
+	Signatures [2]crypto.Signature
+}
+
+// verifyMisbehaviorProof checks that the proof is valid for a host with the
+// provided public key.
+func verifyMisbehaviorProof(proof MisbehaviorProof, key types.SiaPublicKey) error {
+	if key.Algorithm != types.SignatureEd25519 || len(key.Key) != crypto.PublicKeySize {
+		return errInvalidProof
+	}
+	var pk crypto.PublicKey
+	copy(pk[:], key.Key)
+
+	if proof.Settings[0].RevisionNumber != proof.Settings[1].RevisionNumber {
+		return errInvalidProof
+	}
+	encoded := [2][]byte{encoding.Marshal(proof.Settings[0]), encoding.Marshal(proof.Settings[1])}
+	if bytes.Equal(encoded[0], encoded[1]) {
+		return errInvalidProof
+	}
+	for i := range encoded {
+		if crypto.VerifyHash(crypto.HashBytes(encoded[i]), pk, proof.Signatures[i]) != nil {
+			return errInvalidProof
+		}
+	}
+	return nil
+}
+
+// isBanned returns true if the public key has been banned for misbehavior.
+func (hdb *HostDB) isBanned(key types.SiaPublicKey) bool {
+	_, banned := hdb.banned[string(key.Key)]
+	return banned
+}
+
+// ReportHost verifies a proof of misbehavior by a host, and if it is valid,
+// bans the public key of the host and removes every address that announced
+// the key from the hostdb, even if the address is pinned. errInvalidProof is
+// returned if the proof does not verify against the public key that the
+// hostdb knows for the host.
+func (hdb *HostDB) ReportHost(proof MisbehaviorProof) error {
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+
+	entry, exists := hdb.allHosts[proof.Host]
+	if !exists {
+		return errHostNotFound
+	}
+	key := entry.PublicKey
+	if err := verifyMisbehaviorProof(proof, key); err != nil {
+		return err
+	}
+
+	if hdb.banned == nil {
+		hdb.banned = make(map[string]types.SiaPublicKey)
+	}
+	hdb.banned[string(key.Key)] = key
+	for addr, entry := range hdb.allHosts {
+		if bytes.Equal(entry.PublicKey.Key, key.Key) {
+			delete(hdb.pinned, addr)
+			hdb.removeHost(addr)
+		}
+	}
+	hdb.log.Printf("WARN: host key %x was banned for misbehavior reported at %v", key.Key, proof.Host)
+	return hdb.save()
+}
+
+// Unban lifts the ban on a public key. Addresses of the host are added to the
+// hostdb again when they next announce.
+func (hdb *HostDB) Unban(key types.SiaPublicKey) error {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	if !hdb.isBanned(key) {
+		return nil
+	}
+	delete(hdb.banned, string(key.Key))
+	return hdb.save()
+}
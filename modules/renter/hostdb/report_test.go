@@ -0,0 +1,122 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// signSettings signs the settings the way that a host does in response to
+// RPCSettings.
+func signSettings(t *testing.T, settings modules.HostExternalSettings, sk crypto.SecretKey) crypto.Signature {
+	sig, err := crypto.SignHash(crypto.HashObject(settings), sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+// TestReportHost checks that a valid proof of equivocation bans the host, and
+// that invalid proofs are rejected.
+func TestReportHost(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	sk, pk, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: pk[:]}
+	for i := 0; i < 2; i++ {
+		entry := &hostEntry{
+			HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(uint8(i)), PublicKey: key},
+			Weight:      types.NewCurrency64(10),
+		}
+		hdb.allHosts[entry.NetAddress] = entry
+		hdb.insertNode(entry)
+	}
+	hdb.pinned = map[modules.NetAddress]struct{}{fakeAddr(1): {}}
+
+	var proof MisbehaviorProof
+	proof.Host = fakeAddr(0)
+	proof.Settings[0].RevisionNumber = 5
+	proof.Settings[0].StoragePrice = types.NewCurrency64(1)
+	proof.Settings[1].RevisionNumber = 5
+	proof.Settings[1].StoragePrice = types.NewCurrency64(2)
+	proof.Signatures[0] = signSettings(t, proof.Settings[0], sk)
+	proof.Signatures[1] = signSettings(t, proof.Settings[1], sk)
+
+	// Identical settings, settings with different revision numbers, and
+	// settings signed by another key are not proof of misbehavior.
+	same := proof
+	same.Settings[1] = same.Settings[0]
+	same.Signatures[1] = same.Signatures[0]
+	revised := proof
+	revised.Settings[1].RevisionNumber = 6
+	revised.Signatures[1] = signSettings(t, revised.Settings[1], sk)
+	otherSK, _, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := proof
+	forged.Signatures[1] = signSettings(t, forged.Settings[1], otherSK)
+	for _, invalid := range []MisbehaviorProof{same, revised, forged} {
+		if err := hdb.ReportHost(invalid); err != errInvalidProof {
+			t.Fatal("expected errInvalidProof, got", err)
+		}
+	}
+	unknown := proof
+	unknown.Host = fakeAddr(9)
+	if err := hdb.ReportHost(unknown); err != errHostNotFound {
+		t.Fatal("expected errHostNotFound, got", err)
+	}
+	if len(hdb.allHosts) != 2 {
+		t.Fatal("an invalid report removed hosts")
+	}
+
+	// A valid proof removes every address of the host, including pinned
+	// addresses, and later announcements of the key are ignored.
+	if err := hdb.ReportHost(proof); err != nil {
+		t.Fatal(err)
+	}
+	if len(hdb.allHosts) != 0 || len(hdb.activeHosts) != 0 || hdb.isPinned(fakeAddr(1)) {
+		t.Fatal("reported host was not removed")
+	}
+	hdb.insertHost(modules.HostDBEntry{NetAddress: fakeAddr(2), PublicKey: key})
+	if len(hdb.allHosts) != 0 {
+		t.Fatal("announcement of a banned key was not ignored")
+	}
+
+	// Neither a probe that was in flight during the ban nor a merge from
+	// another hostdb adds the host back.
+	inFlight := &hostEntry{HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(0), PublicKey: key}}
+	hdb.managedUpdateEntry(inFlight, modules.HostExternalSettings{AcceptingContracts: true}, modules.HostSettingsExtension{}, nil)
+	if len(hdb.allHosts) != 0 {
+		t.Fatal("in-flight probe added a banned host back")
+	}
+	other := bareHostDB()
+	other.persist = &memPersist{}
+	other.insertHost(modules.HostDBEntry{NetAddress: fakeAddr(3), PublicKey: key})
+	if _, _, skipped := hdb.MergeFrom(other); skipped != 1 || len(hdb.allHosts) != 0 {
+		t.Fatal("merge added a banned host back")
+	}
+
+	// The ban is persisted.
+	hdb2 := bareHostDB()
+	hdb2.persist = hdb.persist
+	if err := hdb2.load(); err != nil {
+		t.Fatal(err)
+	}
+	if !hdb2.isBanned(key) {
+		t.Error("ban was not persisted")
+	}
+
+	if err := hdb.Unban(key); err != nil {
+		t.Fatal(err)
+	}
+	hdb.insertHost(modules.HostDBEntry{NetAddress: fakeAddr(2), PublicKey: key})
+	if len(hdb.allHosts) != 1 {
+		t.Error("announcement of an unbanned key was ignored")
+	}
+}
@@ -0,0 +1,109 @@
+package hostdb
+
+// sample.go implements weighted sampling without replacement over the set of
+// active hosts. Each host is assigned an exponentially distributed key with a
+// rate equal to its weight, and the 'n' hosts with the smallest keys are
+// selected (the A-Res algorithm of Efraimidis and Spirakis). Unlike repeatedly
+// drawing from the tree, every host is considered exactly once, and no entries
+// need to be pulled out of the tree and reinserted.
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+type (
+	// sampleKey pairs a host with the random key that it was assigned during
+	// sampling.
+	sampleKey struct {
+		key   float64
+		entry *hostEntry
+	}
+
+	// sampleHeap is a max-heap of sampleKeys, used to hold the 'n' smallest
+	// keys seen so far. The largest of the retained keys is at the root.
+	sampleHeap []sampleKey
+
+	// sampleKeys sorts a set of sampleKeys from smallest to largest key.
+	sampleKeys []sampleKey
+)
+
+func (sh sampleHeap) Len() int            { return len(sh) }
+func (sh sampleHeap) Less(i, j int) bool  { return sh[i].key > sh[j].key }
+func (sh sampleHeap) Swap(i, j int)       { sh[i], sh[j] = sh[j], sh[i] }
+func (sh *sampleHeap) Push(x interface{}) { *sh = append(*sh, x.(sampleKey)) }
+func (sh *sampleHeap) Pop() interface{} {
+	old := *sh
+	sk := old[len(old)-1]
+	*sh = old[:len(old)-1]
+	return sk
+}
+
+func (sk sampleKeys) Len() int           { return len(sk) }
+func (sk sampleKeys) Less(i, j int) bool { return sk[i].key < sk[j].key }
+func (sk sampleKeys) Swap(i, j int)      { sk[i], sk[j] = sk[j], sk[i] }
+
+// randUnitFloat returns a uniformly distributed float in the range (0, 1],
+// drawn from the provided source of randomness.
+func randUnitFloat(r io.Reader) (float64, error) {
+	b := make([]byte, 8)
+	_, err := io.ReadFull(r, b)
+	if err != nil {
+		return 0, err
+	}
+	// Use the top 53 bits, which is the precision of a float64.
+	n := binary.LittleEndian.Uint64(b) >> 11
+	return float64(n+1) / (1 << 53), nil
+}
+
+// SampleHosts returns up to 'n' hosts from the set of active hosts, sampled
+// by weight without replacement. Only hosts that are accepting contracts and
+// have a non-zero weight are considered. The hosts that get returned first
+// have the higher priority.
+func (hdb *HostDB) SampleHosts(n int) (hosts []modules.HostDBEntry) {
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.releaseQuarantine()
+	if n <= 0 || hdb.isEmpty() {
+		return
+	}
+
+	sh := make(sampleHeap, 0, n)
+	for _, node := range hdb.sortedActiveNodes() {
+		entry := node.hostEntry
+		if !entry.AcceptingContracts || entry.Weight.IsZero() {
+			continue
+		}
+		weight, _ := new(big.Float).SetInt(entry.Weight.Big()).Float64()
+		u, err := randUnitFloat(hdb.randReader())
+		if err != nil {
+			build.Critical("unable to generate random number for sampling:", err)
+			return
+		}
+		key := -math.Log(u) / weight
+
+		if sh.Len() < n {
+			heap.Push(&sh, sampleKey{key: key, entry: entry})
+		} else if key < sh[0].key {
+			sh[0] = sampleKey{key: key, entry: entry}
+			heap.Fix(&sh, 0)
+		}
+	}
+
+	// Return the hosts in order of increasing keys, which is the order in
+	// which they would have been drawn one at a time.
+	sorted := sampleKeys(sh)
+	sort.Sort(sorted)
+	for _, sk := range sorted {
+		hosts = append(hosts, sk.entry.HostDBEntry)
+	}
+	return hosts
+}
@@ -0,0 +1,87 @@
+package hostdb
+
+import (
+	"math"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestSampleHosts checks that SampleHosts returns unique, eligible hosts.
+func TestSampleHosts(t *testing.T) {
+	hdb := bareHostDB()
+	if len(hdb.SampleHosts(3)) != 0 {
+		t.Fatal("empty hostdb should return no hosts")
+	}
+
+	for i := 0; i < 10; i++ {
+		entry := hostEntry{
+			HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(uint8(i))},
+			Weight:      types.NewCurrency64(uint64(i + 1)),
+		}
+		entry.AcceptingContracts = i != 0
+		hdb.insertNode(&entry)
+	}
+
+	hosts := hdb.SampleHosts(20)
+	if len(hosts) != 9 {
+		t.Fatal("expected 9 hosts, got", len(hosts))
+	}
+	seen := make(map[modules.NetAddress]struct{})
+	for _, host := range hosts {
+		if host.NetAddress == fakeAddr(0) {
+			t.Error("returned a host that is not accepting contracts")
+		}
+		if _, exists := seen[host.NetAddress]; exists {
+			t.Error("returned a duplicate host")
+		}
+		seen[host.NetAddress] = struct{}{}
+	}
+	if len(hdb.SampleHosts(4)) != 4 {
+		t.Error("wrong number of hosts returned")
+	}
+	if len(hdb.SampleHosts(0)) != 0 {
+		t.Error("hosts returned when none were requested")
+	}
+}
+
+// TestSampleHostsDistribution checks that the empirical frequencies of
+// SampleHosts approximate the weights of the hosts.
+func TestSampleHostsDistribution(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hdb := bareHostDB()
+	weights := []uint64{1, 2, 3, 4}
+	var total uint64
+	for i, w := range weights {
+		entry := hostEntry{
+			HostDBEntry: modules.HostDBEntry{
+				NetAddress:         fakeAddr(uint8(i)),
+				AcceptingContracts: true,
+			},
+			Weight: types.NewCurrency64(w),
+		}
+		hdb.insertNode(&entry)
+		total += w
+	}
+
+	// The first host of each sample should be drawn in proportion to weight.
+	trials := 20000
+	counts := make(map[modules.NetAddress]int)
+	for i := 0; i < trials; i++ {
+		hosts := hdb.SampleHosts(2)
+		if len(hosts) != 2 {
+			t.Fatal("wrong number of hosts returned")
+		}
+		counts[hosts[0].NetAddress]++
+	}
+	for i, w := range weights {
+		expected := float64(w) / float64(total)
+		actual := float64(counts[fakeAddr(uint8(i))]) / float64(trials)
+		if math.Abs(expected-actual) > 0.02 {
+			t.Errorf("host %v: expected frequency %.3f, got %.3f", i, expected, actual)
+		}
+	}
+}
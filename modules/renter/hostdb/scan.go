@@ -6,8 +6,11 @@ package hostdb
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
+	"errors"
 	"math/big"
+	"sync"
 	"time"
 
 	"github.com/NebulousLabs/Sia/build"
@@ -32,6 +35,15 @@ const (
 	// scanningThreads is the number of threads that will be probing hosts for
 	// their settings and checking for reliability.
 	scanningThreads = 25
+
+	// probeAllThreads is the number of hosts that ProbeAll probes at a time.
+	probeAllThreads = 10
+)
+
+var (
+	// errProbeCancelled is reported by ProbeAll for the hosts that were not
+	// probed because the probe was cancelled.
+	errProbeCancelled = errors.New("probe was cancelled before the host was contacted")
 )
 
 // Reliability is a measure of a host's uptime.
@@ -52,7 +64,8 @@ func (hdb *HostDB) scanHostEntry(entry *hostEntry) {
 }
 
 // decrementReliability reduces the reliability of a node, moving it out of the
-// set of active hosts or deleting it entirely if necessary.
+// set of active hosts or deleting it entirely if necessary. Pinned hosts lose
+// reliability, but are neither demoted nor deleted.
 func (hdb *HostDB) decrementReliability(addr modules.NetAddress, penalty types.Currency) {
 	// Look up the entry and decrement the reliability.
 	entry, exists := hdb.allHosts[addr]
@@ -60,8 +73,17 @@ func (hdb *HostDB) decrementReliability(addr modules.NetAddress, penalty types.C
 		// TODO: should panic here
 		return
 	}
-	entry.Reliability = entry.Reliability.Sub(penalty)
+	// The reliability of a pinned host can reach zero without the host
+	// being deleted, so the reliability is floored at zero.
+	if entry.Reliability.Cmp(penalty) < 0 {
+		entry.Reliability = types.ZeroCurrency
+	} else {
+		entry.Reliability = entry.Reliability.Sub(penalty)
+	}
 	entry.Online = false
+	if hdb.isPinned(addr) {
+		return
+	}
 
 	// If the entry is in the active database, remove it from the active
 	// database.
@@ -69,98 +91,239 @@ func (hdb *HostDB) decrementReliability(addr modules.NetAddress, penalty types.C
 	if exists {
 		node.removeNode()
 		delete(hdb.activeHosts, entry.NetAddress)
+		hdb.queueEvent(EventRemove, entry)
 	}
 
 	// If the reliability has fallen to 0, remove the host from the
 	// database entirely.
 	if entry.Reliability.IsZero() {
+		hdb.unindexHostKey(entry)
 		delete(hdb.allHosts, addr)
 	}
 }
 
 // managedUpdateEntry updates an entry in the hostdb after a scan has taken
 // place.
-func (hdb *HostDB) managedUpdateEntry(entry *hostEntry, newSettings modules.HostExternalSettings, netErr error) {
+func (hdb *HostDB) managedUpdateEntry(entry *hostEntry, newSettings modules.HostExternalSettings, newExt modules.HostSettingsExtension, netErr error) {
+	defer hdb.managedDeliverEvents()
 	hdb.mu.Lock()
 	defer hdb.mu.Unlock()
 
+	// The host may have been evicted, or its key banned, while the probe
+	// was in flight, in which case the host must not be added back.
+	if entry.evicted || hdb.isBanned(entry.PublicKey) {
+		return
+	}
+
 	// Regardless of whether the host responded, add it to allHosts.
 	priorHost, exists := hdb.allHosts[entry.NetAddress]
 	if !exists {
 		hdb.allHosts[entry.NetAddress] = entry
+		hdb.indexHostKey(entry)
+		hdb.enforceMaxHosts(entry.NetAddress)
+	}
+	entry.lastProbed = time.Now()
+	if exists {
+		priorHost.lastProbed = entry.lastProbed
 	}
 
 	// If the scan was unsuccessful, decrement the host's reliability.
 	if netErr != nil {
+		entry.settingsFetched = time.Time{}
 		if exists && bytes.Equal(priorHost.PublicKey.Key, entry.PublicKey.Key) {
 			// Only decrement the reliability if the public key in the
 			// hostdb matches the public key in the host announcement -
 			// the failure may just be a failed signature, indicating
 			// the wrong public key.
+			priorHost.recordUptime(false)
+			priorHost.recordProbe(false)
+			if hdb.toleratesFailure(priorHost) {
+				// Keep the host in the tree with a penalized weight.
+				err := hdb.reweight(entry.NetAddress, hdb.hostWeight(priorHost))
+				if err != nil {
+					build.Critical("unable to reweight an active host:", err)
+				}
+				return
+			}
 			hdb.decrementReliability(entry.NetAddress, UnreachablePenalty)
 		}
 		return
 	}
 
-	// The host entry should be updated to reflect the new weight. The safety
-	// properties of the tree require that the weight does not change while the
-	// node is in the tree, so the node must be removed before the settings and
-	// weight are changed.
+	// The safety properties of the tree require that the weight of an entry
+	// is only changed through the tree. If the active node for this address
+	// holds a different entry (e.g. the host was re-announced with a new
+	// public key), the stale node must be removed.
 	existingNode, exists := hdb.activeHosts[entry.NetAddress]
-	if exists {
+	if exists && existingNode.hostEntry != entry {
 		existingNode.removeNode()
 		delete(hdb.activeHosts, entry.NetAddress)
+		hdb.queueEvent(EventRemove, existingNode.hostEntry)
+		exists = false
 	}
 
-	// Update the host settings, reliability, and weight. The old NetAddress
-	// must be preserved.
+	// Update the host settings and reliability. The old NetAddress must be
+	// preserved.
 	newSettings.NetAddress = entry.HostExternalSettings.NetAddress
 	entry.HostExternalSettings = newSettings
+	entry.HostSettingsExtension = newExt
 	entry.Reliability = MaxReliability
-	entry.Weight = calculateHostWeight(*entry)
 	entry.Online = true
+	entry.recordUptime(true)
+	entry.recordProbe(true)
+	entry.settingsFetched = time.Now()
+	entry.LastSeen = entry.settingsFetched
 
-	// If 'maxActiveHosts' has not been reached, add the host to the
-	// activeHosts tree.
-	if _, exists := hdb.activeHosts[entry.NetAddress]; exists || len(hdb.activeHosts) < maxActiveHosts {
-		hdb.insertNode(entry)
+	// Hosts that are too often unreachable, or that have exhausted their
+	// collateral budget, are demoted to inactive, even when they answer a
+	// probe, unless they are pinned.
+	if (hdb.belowUptimeFloor(entry) || collateralBudgetDepleted(entry)) && !hdb.isPinned(entry.NetAddress) {
+		if exists {
+			existingNode.removeNode()
+			delete(hdb.activeHosts, entry.NetAddress)
+			hdb.queueEvent(EventRemove, entry)
+		}
+		entry.Weight = hdb.hostWeight(entry)
+		hdb.save()
+		return
+	}
+
+	// If the host is already in the tree, adjust its weight in place.
+	// Otherwise, add the host to the activeHosts tree if 'maxActiveHosts' has
+	// not been reached and the host is not quarantined.
+	newWeight := hdb.hostWeight(entry)
+	if exists {
+		err := hdb.reweight(entry.NetAddress, newWeight)
+		if err != nil {
+			build.Critical("unable to reweight an active host:", err)
+		}
+	} else {
+		entry.Weight = newWeight
+		if hdb.isPinned(entry.NetAddress) || (len(hdb.activeHosts) < maxActiveHosts && !hdb.isQuarantined(entry.NetAddress)) {
+			hdb.insertNode(entry)
+			hdb.queueEvent(EventInsert, entry)
+		}
 	}
 	hdb.save()
 }
 
+// managedProbeHost fetches the settings of a host and updates the host's
+// entry with the result, returning the error encountered while probing, if
+// any.
+func (hdb *HostDB) managedProbeHost(hostEntry *hostEntry) error {
+	// TODO: use dialer.Cancel to shutdown quickly
+	hdb.log.Debugln("Scanning", hostEntry.NetAddress, hostEntry.PublicKey)
+	var settings modules.HostExternalSettings
+	var ext modules.HostSettingsExtension
+	var connectTime, rpcTime time.Duration
+	err := func() error {
+		dialStart := time.Now()
+		conn, err := hdb.dialer.DialTimeout(hostEntry.NetAddress, hostRequestTimeout)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		conn, err = hdb.managedWrapTLS(conn, hostEntry)
+		if err != nil {
+			return err
+		}
+		connectTime = time.Since(dialStart)
+		rpcStart := time.Now()
+		err = encoding.WriteObject(conn, modules.RPCSettings)
+		if err != nil {
+			return err
+		}
+		var pubkey crypto.PublicKey
+		copy(pubkey[:], hostEntry.PublicKey.Key)
+		err = crypto.ReadSignedObject(conn, &settings, maxSettingsLen, pubkey)
+		if err != nil {
+			return err
+		}
+		ext, err = modules.ReadSettingsExtension(conn, pubkey, settings.RevisionNumber)
+		if err != nil {
+			return err
+		}
+		rpcTime = time.Since(rpcStart)
+		return nil
+	}()
+	if err != nil {
+		hdb.log.Debugln("Scanning", hostEntry.NetAddress, hostEntry.PublicKey, "failed", err)
+	} else {
+		hdb.log.Debugln("Scanning", hostEntry.NetAddress, hostEntry.PublicKey, "succeeded")
+		hdb.mu.Lock()
+		hostEntry.recordProbeTimes(connectTime, rpcTime)
+		hdb.mu.Unlock()
+	}
+
+	// Update the host tree to have a new entry.
+	hdb.managedUpdateEntry(hostEntry, settings, ext, err)
+	return err
+}
+
 // threadedProbeHosts tries to fetch the settings of a host. If successful, the
 // host is put in the set of active hosts. If unsuccessful, the host id deleted
 // from the set of active hosts.
 func (hdb *HostDB) threadedProbeHosts() {
 	defer hdb.threadGroup.Done()
 	for hostEntry := range hdb.scanPool {
-		// Request settings from the queued host entry.
-		// TODO: use dialer.Cancel to shutdown quickly
-		hdb.log.Debugln("Scanning", hostEntry.NetAddress, hostEntry.PublicKey)
-		var settings modules.HostExternalSettings
-		err := func() error {
-			conn, err := hdb.dialer.DialTimeout(hostEntry.NetAddress, hostRequestTimeout)
-			if err != nil {
-				return err
-			}
-			defer conn.Close()
-			err = encoding.WriteObject(conn, modules.RPCSettings)
-			if err != nil {
-				return err
+		hdb.managedProbeHost(hostEntry)
+	}
+}
+
+// ProbeAll probes every active host once, updating the settings, metrics, and
+// weight of each host, and returns the result of each probe. Up to
+// probeAllThreads hosts are probed at a time. Once 'ctx' is done, no further
+// probes are started, and the hosts that were not probed are reported with
+// errProbeCancelled. ProbeAll does not return until the probes that have
+// started are complete.
+func (hdb *HostDB) ProbeAll(ctx context.Context) map[modules.NetAddress]error {
+	hdb.mu.RLock()
+	var entries []*hostEntry
+	for _, node := range hdb.sortedActiveNodes() {
+		entries = append(entries, node.hostEntry)
+	}
+	hdb.mu.RUnlock()
+
+	results := make(map[modules.NetAddress]error, len(entries))
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+	work := make(chan *hostEntry)
+	for i := 0; i < probeAllThreads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range work {
+				err := hdb.managedProbeHost(entry)
+				resultsMu.Lock()
+				results[entry.NetAddress] = err
+				resultsMu.Unlock()
 			}
-			var pubkey crypto.PublicKey
-			copy(pubkey[:], hostEntry.PublicKey.Key)
-			return crypto.ReadSignedObject(conn, &settings, maxSettingsLen, pubkey)
 		}()
-		if err != nil {
-			hdb.log.Debugln("Scanning", hostEntry.NetAddress, hostEntry.PublicKey, "failed", err)
-		} else {
-			hdb.log.Debugln("Scanning", hostEntry.NetAddress, hostEntry.PublicKey, "succeeded")
+	}
+
+	var next int
+feed:
+	for ; next < len(entries); next++ {
+		// Check for cancellation first, a ready worker should not win the
+		// race against a cancellation that has already happened.
+		select {
+		case <-ctx.Done():
+			break feed
+		default:
 		}
+		select {
+		case work <- entries[next]:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
 
-		// Update the host tree to have a new entry.
-		hdb.managedUpdateEntry(hostEntry, settings, err)
+	for _, entry := range entries[next:] {
+		results[entry.NetAddress] = errProbeCancelled
 	}
+	return results
 }
 
 // threadedScan is an ongoing function which will query the full set of hosts
@@ -1,6 +1,7 @@
 package hostdb
 
 import (
+	"context"
 	"net"
 	"testing"
 	"time"
@@ -273,3 +274,70 @@ func TestThreadedScan(t *testing.T) {
 		t.Error("host was not scanned")
 	}
 }
+
+// TestProbeAll checks that ProbeAll probes every active host and reports the
+// result of each probe.
+func TestProbeAll(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+
+	sk, pk, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		entry := &hostEntry{
+			HostDBEntry: modules.HostDBEntry{
+				NetAddress: fakeAddr(uint8(i)),
+				PublicKey:  types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: pk[:]},
+			},
+			Weight:      types.NewCurrency64(1),
+			Reliability: baseWeight,
+		}
+		hdb.allHosts[entry.NetAddress] = entry
+		hdb.insertNode(entry)
+	}
+
+	// Half of the hosts respond, the others are unreachable.
+	reachable := make(map[modules.NetAddress]bool)
+	for i := 0; i < 20; i += 2 {
+		reachable[fakeAddr(uint8(i))] = true
+	}
+	hdb.dialer = probeDialer(func(addr modules.NetAddress, _ time.Duration) (net.Conn, error) {
+		if !reachable[addr] {
+			return nil, net.UnknownNetworkError("fail")
+		}
+		ourConn, theirConn := net.Pipe()
+		go func() {
+			encoding.ReadObject(ourConn, new(types.Specifier), types.SpecifierLen)
+			crypto.WriteSignedObject(ourConn, modules.HostExternalSettings{AcceptingContracts: true}, sk)
+			ourConn.Close()
+		}()
+		return theirConn, nil
+	})
+
+	results := hdb.ProbeAll(context.Background())
+	if len(results) != 20 {
+		t.Fatal("wrong number of results:", len(results))
+	}
+	for addr, err := range results {
+		if reachable[addr] != (err == nil) {
+			t.Errorf("wrong result for %v: %v", addr, err)
+		}
+	}
+	if len(hdb.ActiveHosts()) != 10 {
+		t.Error("unreachable hosts were not removed:", len(hdb.ActiveHosts()))
+	}
+
+	// A cancelled probe should not contact any hosts.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for addr, err := range hdb.ProbeAll(ctx) {
+		if err != errProbeCancelled {
+			t.Errorf("host %v was probed after cancellation: %v", addr, err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package hostdb
+
+// scanrange.go re-scans a range of blocks for host announcements on demand,
+// so that announcements missed by the hostdb (for example because of a bug in
+// a prior version) can be recovered without rescanning the whole blockchain.
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	errInvalidScanRange = errors.New("scan range ends before it starts")
+	errScanRangeTooHigh = errors.New("scan range extends beyond the most recent block seen by the hostdb")
+)
+
+// ScanRange scans the blocks at heights 'start' through 'end', inclusive, for
+// host announcements, inserting any hosts that the hostdb does not already
+// know. The number of hosts that were inserted is returned. The range must not
+// extend beyond the most recent block processed by the hostdb.
+func (hdb *HostDB) ScanRange(start, end types.BlockHeight) (inserted int, err error) {
+	if start > end {
+		return 0, errInvalidScanRange
+	}
+	hdb.mu.RLock()
+	height := hdb.blockHeight
+	hdb.mu.RUnlock()
+	if end > height {
+		return 0, errScanRangeTooHigh
+	}
+
+	// The blocks are fetched before the hostdb is locked, because the
+	// consensus set holds its own lock while delivering changes to the
+	// hostdb.
+	blocks := make([]types.Block, 0, end-start+1)
+	for h := start; h <= end; h++ {
+		b, exists := hdb.cs.BlockAtHeight(h)
+		if !exists {
+			return 0, fmt.Errorf("consensus set has no block at height %v", h)
+		}
+		blocks = append(blocks, b)
+	}
+
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	for _, b := range blocks {
+		for _, host := range findHostAnnouncements(b) {
+			prior := hdb.allHosts[host.NetAddress]
+			hdb.insertHost(host)
+			if entry, exists := hdb.allHosts[host.NetAddress]; exists && entry != prior {
+				hdb.log.Debugln("Found a host in a rescanned host announcement:", host.NetAddress, host.PublicKey.Key)
+				inserted++
+			}
+		}
+	}
+	if inserted > 0 {
+		err = hdb.save()
+		if err != nil {
+			hdb.log.Println(err)
+		}
+	}
+	return inserted, nil
+}
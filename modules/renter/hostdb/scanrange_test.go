@@ -0,0 +1,56 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestScanRange checks that ScanRange inserts the hosts announced in the
+// requested blocks, skips known hosts, and refuses invalid ranges.
+func TestScanRange(t *testing.T) {
+	cs := new(rescanCS)
+	for _, addr := range []modules.NetAddress{"foo.com:1234", "bar.com:1234", "baz.com:1234"} {
+		annBytes, err := makeSignedAnnouncement(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cs.addBlock(types.Block{
+			Transactions: []types.Transaction{{
+				ArbitraryData: [][]byte{annBytes},
+			}},
+		})
+	}
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	hdb.cs = cs
+	hdb.blockHeight = 2
+
+	if _, err := hdb.ScanRange(2, 1); err != errInvalidScanRange {
+		t.Fatal("expected errInvalidScanRange, got", err)
+	}
+	if _, err := hdb.ScanRange(0, 3); err != errScanRangeTooHigh {
+		t.Fatal("expected errScanRangeTooHigh, got", err)
+	}
+
+	inserted, err := hdb.ScanRange(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted != 2 || len(hdb.allHosts) != 2 {
+		t.Fatal("expected 2 hosts to be inserted, got", inserted, len(hdb.allHosts))
+	}
+	if _, exists := hdb.allHosts["foo.com:1234"]; exists {
+		t.Error("host announced outside of the scan range was inserted")
+	}
+
+	// Rescanning known announcements should not insert them again.
+	inserted, err = hdb.ScanRange(0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted != 1 || len(hdb.allHosts) != 3 {
+		t.Fatal("expected 1 host to be inserted, got", inserted, len(hdb.allHosts))
+	}
+}
@@ -0,0 +1,74 @@
+package hostdb
+
+// settingscache.go serves the settings fetched by the most recent probe of a
+// host, so that renters forming several contracts in a short window do not
+// need to perform an RPCSettings for each one. The cache of a host is
+// refreshed each time the host is probed, and is invalidated when the host
+// fails a probe or re-announces.
+
+import (
+	"errors"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// defaultSettingsTTL is the length of time for which the settings of a
+	// host are served from the cache if no TTL has been set.
+	defaultSettingsTTL = 10 * time.Minute
+)
+
+var errNoFreshHost = errors.New("no active host has settings that are fresh enough")
+
+// HostSettings returns the settings that were fetched from the host the last
+// time that it was probed. False is returned if the host is unknown, or if
+// its settings are older than the settings TTL.
+func (hdb *HostDB) HostSettings(addr modules.NetAddress) (modules.HostExternalSettings, bool) {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	entry, exists := hdb.allHosts[addr]
+	if !exists || entry.settingsFetched.IsZero() {
+		return modules.HostExternalSettings{}, false
+	}
+	ttl := hdb.settingsTTL
+	if ttl == 0 {
+		ttl = defaultSettingsTTL
+	}
+	if time.Since(entry.settingsFetched) > ttl {
+		return modules.HostExternalSettings{}, false
+	}
+	return entry.HostExternalSettings, true
+}
+
+// RandomFreshHost returns a random host from the hostdb, selected by weight
+// from among the hosts whose settings were fetched within 'maxAge'. If no host
+// has fresh settings, a host with stale settings is returned if 'fallback' is
+// set, and errNoFreshHost is returned otherwise.
+func (hdb *HostDB) RandomFreshHost(maxAge time.Duration, fallback bool) (modules.HostDBEntry, error) {
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.releaseQuarantine()
+
+	entry, err := hdb.randomEntryFiltered(func(entry *hostEntry) bool {
+		return !entry.settingsFetched.IsZero() && time.Since(entry.settingsFetched) <= maxAge
+	})
+	if err == errNoMatchingHost && fallback {
+		entry, err = hdb.randomEntryFiltered(func(*hostEntry) bool { return true })
+	}
+	if err == errNoMatchingHost {
+		return modules.HostDBEntry{}, errNoFreshHost
+	} else if err != nil {
+		return modules.HostDBEntry{}, err
+	}
+	return entry.HostDBEntry, nil
+}
+
+// SetSettingsTTL sets the length of time for which the settings fetched from
+// a host are served by HostSettings. A TTL of 0 restores the default.
+func (hdb *HostDB) SetSettingsTTL(ttl time.Duration) {
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.settingsTTL = ttl
+}
@@ -0,0 +1,101 @@
+package hostdb
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestHostSettings checks that the settings of a probed host are served until
+// they expire, fail a probe, or the host re-announces.
+func TestHostSettings(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	if _, ok := hdb.HostSettings(fakeAddr(1)); ok {
+		t.Fatal("settings returned for an unknown host")
+	}
+
+	entry := &hostEntry{
+		HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(1)},
+		Reliability: DefaultReliability,
+	}
+	hdb.allHosts[entry.NetAddress] = entry
+	if _, ok := hdb.HostSettings(entry.NetAddress); ok {
+		t.Fatal("settings returned for a host that has not been probed")
+	}
+
+	settings := modules.HostExternalSettings{
+		AcceptingContracts: true,
+		StoragePrice:       types.NewCurrency64(5),
+	}
+	hdb.managedUpdateEntry(entry, settings, modules.HostSettingsExtension{}, nil)
+	cached, ok := hdb.HostSettings(entry.NetAddress)
+	if !ok {
+		t.Fatal("settings of a probed host were not cached")
+	}
+	if cached.StoragePrice.Cmp(settings.StoragePrice) != 0 {
+		t.Error("wrong settings returned:", cached.StoragePrice)
+	}
+
+	// The settings should expire after the TTL.
+	hdb.SetSettingsTTL(time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, ok := hdb.HostSettings(entry.NetAddress); ok {
+		t.Error("settings were served after the TTL expired")
+	}
+	hdb.SetSettingsTTL(0)
+	hdb.managedUpdateEntry(entry, settings, modules.HostSettingsExtension{}, nil)
+	if _, ok := hdb.HostSettings(entry.NetAddress); !ok {
+		t.Error("settings were not refreshed by a probe")
+	}
+
+	// A re-announcement invalidates the settings.
+	hdb.mu.Lock()
+	hdb.insertHost(entry.HostDBEntry)
+	hdb.mu.Unlock()
+	if _, ok := hdb.HostSettings(entry.NetAddress); ok {
+		t.Error("settings were served after the host re-announced")
+	}
+
+	// So does a failed probe.
+	hdb.managedUpdateEntry(entry, settings, modules.HostSettingsExtension{}, nil)
+	hdb.managedUpdateEntry(entry, modules.HostExternalSettings{}, modules.HostSettingsExtension{}, errors.New("unreachable"))
+	if _, ok := hdb.HostSettings(entry.NetAddress); ok {
+		t.Error("settings were served after a failed probe")
+	}
+}
+
+// TestRandomFreshHost checks that only hosts with fresh settings are selected,
+// and that stale hosts are only returned as a fallback.
+func TestRandomFreshHost(t *testing.T) {
+	hdb := bareHostDB()
+	for i := 0; i < 4; i++ {
+		entry := &hostEntry{
+			HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(uint8(i))},
+			Weight:      types.NewCurrency64(10),
+		}
+		entry.settingsFetched = time.Now().Add(-time.Hour)
+		hdb.allHosts[entry.NetAddress] = entry
+		hdb.insertNode(entry)
+	}
+	if _, err := hdb.RandomFreshHost(time.Minute, false); err != errNoFreshHost {
+		t.Fatal("expected errNoFreshHost, got", err)
+	}
+	if _, err := hdb.RandomFreshHost(time.Minute, true); err != nil {
+		t.Fatal("fallback did not return a stale host:", err)
+	}
+
+	hdb.allHosts[fakeAddr(2)].settingsFetched = time.Now()
+	for i := 0; i < 20; i++ {
+		host, err := hdb.RandomFreshHost(time.Minute, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if host.NetAddress != fakeAddr(2) {
+			t.Fatal("selected a host with stale settings:", host.NetAddress)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package hostdb
+
+// snapshot.go allows the state of the hostdb to be backed up and restored as
+// a single blob, independent of the persist file. This allows the hostdb to be
+// included in a larger backup without racing against the live database.
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// snapshotVersion is the version of the snapshot format that is produced by
+// Snapshot. It should be incremented whenever the format changes in a way that
+// older versions of Restore cannot read.
+const snapshotVersion = 1
+
+var (
+	errInvalidSnapshot     = errors.New("snapshot is not valid")
+	errUnsupportedSnapshot = errors.New("snapshot was made by a newer version of the hostdb")
+)
+
+// hdbSnapshot is the serialized form of a snapshot. Quarantined holds the
+// quarantined hosts of snapshots made before the quarantine was persisted.
+type hdbSnapshot struct {
+	Version     int
+	Persist     hdbPersist
+	Quarantined map[modules.NetAddress]time.Time
+}
+
+// Snapshot returns a serialization of the full state of the hostdb, which can
+// be passed to Restore.
+func (hdb *HostDB) Snapshot() ([]byte, error) {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	return json.Marshal(hdbSnapshot{
+		Version: snapshotVersion,
+		Persist: hdb.persistData(),
+	})
+}
+
+// Restore replaces the state of the hostdb with the state in a snapshot
+// produced by Snapshot. If the snapshot cannot be read, the hostdb is left
+// unchanged. The hostdb remains subscribed to the consensus set at its current
+// position, the consensus change recorded in the snapshot is not restored.
+func (hdb *HostDB) Restore(b []byte) error {
+	var snap hdbSnapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return errInvalidSnapshot
+	}
+	if snap.Version == 0 {
+		return errInvalidSnapshot
+	} else if snap.Version > snapshotVersion {
+		return errUnsupportedSnapshot
+	}
+
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+
+	for _, node := range hdb.activeHosts {
+		hdb.queueEvent(EventRemove, node.hostEntry)
+	}
+	hdb.hostTree = nil
+	hdb.activeHosts = make(map[modules.NetAddress]*hostNode)
+	hdb.allHosts = make(map[modules.NetAddress]*hostEntry)
+	hdb.keyAddresses = make(map[string]map[modules.NetAddress]struct{})
+	hdb.warnedKeys = make(map[string]struct{})
+	hdb.pinned = nil
+	hdb.blacklist = nil
+	hdb.banned = nil
+	hdb.labels = nil
+	hdb.quarantined = make(map[modules.NetAddress]time.Time)
+	for addr, expiry := range snap.Quarantined {
+		hdb.quarantined[addr] = expiry
+	}
+	snap.Persist.LastChange = hdb.lastChange
+	snap.Persist.RecentBlock = hdb.recentBlock
+	hdb.loadData(snap.Persist)
+	for _, node := range hdb.activeHosts {
+		hdb.queueEvent(EventInsert, node.hostEntry)
+	}
+	return hdb.save()
+}
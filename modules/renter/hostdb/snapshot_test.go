@@ -0,0 +1,135 @@
+package hostdb
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestSnapshotRestore checks that a snapshot restores the hosts, pins, and
+// quarantines of a hostdb, and that invalid snapshots are rejected.
+func TestSnapshotRestore(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	for i := 0; i < 3; i++ {
+		entry := &hostEntry{
+			HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(uint8(i))},
+			Weight:      types.NewCurrency64(uint64(i + 1)),
+			Reliability: DefaultReliability,
+		}
+		hdb.allHosts[entry.NetAddress] = entry
+		hdb.insertNode(entry)
+	}
+	if err := hdb.Pin(fakeAddr(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := hdb.Quarantine(fakeAddr(1), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := hdb.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Restore the snapshot into a hostdb that has other hosts.
+	hdb2 := bareHostDB()
+	hdb2.persist = &memPersist{}
+	other := &hostEntry{HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(9)}, Weight: types.NewCurrency64(1)}
+	hdb2.allHosts[other.NetAddress] = other
+	hdb2.insertNode(other)
+	hdb2.lastChange = modules.ConsensusChangeID{1}
+	if err := hdb2.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+	if len(hdb2.allHosts) != 3 || len(hdb2.activeHosts) != 2 {
+		t.Fatal("wrong hosts after restore:", len(hdb2.allHosts), len(hdb2.activeHosts))
+	}
+	if _, exists := hdb2.allHosts[other.NetAddress]; exists {
+		t.Error("restore did not replace the existing hosts")
+	}
+	if hdb2.hostTree.weight.Cmp(types.NewCurrency64(4)) != 0 {
+		t.Error("host tree has the wrong weight:", hdb2.hostTree.weight)
+	}
+	if !hdb2.isPinned(fakeAddr(0)) || !hdb2.isQuarantined(fakeAddr(1)) {
+		t.Error("pins and quarantines were not restored")
+	}
+	if hdb2.lastChange != (modules.ConsensusChangeID{1}) {
+		t.Error("restore changed the consensus change of the hostdb")
+	}
+
+	// Invalid and newer snapshots should leave the hostdb unchanged.
+	if err := hdb2.Restore([]byte("garbage")); err != errInvalidSnapshot {
+		t.Error("expected errInvalidSnapshot, got", err)
+	}
+	future, _ := json.Marshal(hdbSnapshot{Version: snapshotVersion + 1})
+	if err := hdb2.Restore(future); err != errUnsupportedSnapshot {
+		t.Error("expected errUnsupportedSnapshot, got", err)
+	}
+	if len(hdb2.allHosts) != 3 {
+		t.Error("failed restore modified the hostdb")
+	}
+}
+
+// TestRestoreClearsBans checks that a key banned after a snapshot was taken
+// is not banned once the snapshot is restored.
+func TestRestoreClearsBans(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	key := types.SiaPublicKey{Key: []byte{1}}
+	entry := &hostEntry{
+		HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(1), PublicKey: key},
+		Weight:      types.NewCurrency64(1),
+		Reliability: DefaultReliability,
+	}
+	hdb.allHosts[entry.NetAddress] = entry
+	hdb.insertNode(entry)
+	snap, err := hdb.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hdb.banned = map[string]types.SiaPublicKey{string(key.Key): key}
+	hdb.removeHost(entry.NetAddress)
+	if err := hdb.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+	if hdb.isBanned(key) {
+		t.Error("ban made after the snapshot survived the restore")
+	}
+	if _, exists := hdb.allHosts[fakeAddr(1)]; !exists {
+		t.Error("host was not restored")
+	}
+}
+
+// TestRestoreClearsLabels checks that a label attached after a snapshot was
+// taken is not kept once the snapshot is restored.
+func TestRestoreClearsLabels(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	if err := hdb.AddLabel(fakeAddr(1), "kept"); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := hdb.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hdb.AddLabel(fakeAddr(1), "dropped"); err != nil {
+		t.Fatal(err)
+	}
+	if err := hdb.AddLabel(fakeAddr(2), "dropped"); err != nil {
+		t.Fatal(err)
+	}
+	if err := hdb.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+	if labels := hdb.Labels(fakeAddr(1)); len(labels) != 1 || labels[0] != "kept" {
+		t.Error("wrong labels after restore:", labels)
+	}
+	if labels := hdb.Labels(fakeAddr(2)); len(labels) != 0 {
+		t.Error("label attached after the snapshot survived the restore:", labels)
+	}
+}
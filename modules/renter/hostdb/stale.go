@@ -0,0 +1,46 @@
+package hostdb
+
+// stale.go reports the active hosts whose metrics have not been refreshed
+// recently, so that an external scheduler can refresh them through Refresh
+// instead of waiting for the poller to reach them.
+
+import (
+	"sort"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// hostsByLastProbed sorts host entries by the time at which they were last
+// probed, least recently probed first. Entries probed at the same time are
+// sorted by address.
+type hostsByLastProbed []*hostEntry
+
+func (hs hostsByLastProbed) Len() int      { return len(hs) }
+func (hs hostsByLastProbed) Swap(i, j int) { hs[i], hs[j] = hs[j], hs[i] }
+func (hs hostsByLastProbed) Less(i, j int) bool {
+	if !hs[i].lastProbed.Equal(hs[j].lastProbed) {
+		return hs[i].lastProbed.Before(hs[j].lastProbed)
+	}
+	return hs[i].NetAddress < hs[j].NetAddress
+}
+
+// StaleHosts returns the addresses of the active hosts that have not been
+// probed within 'olderThan', least recently probed first. Hosts that have not
+// been probed since the hostdb was started are the first to be returned.
+func (hdb *HostDB) StaleHosts(olderThan time.Duration) []modules.NetAddress {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	var stale hostsByLastProbed
+	for _, node := range hdb.activeHosts {
+		if time.Since(node.hostEntry.lastProbed) > olderThan {
+			stale = append(stale, node.hostEntry)
+		}
+	}
+	sort.Sort(stale)
+	addrs := make([]modules.NetAddress, len(stale))
+	for i, entry := range stale {
+		addrs[i] = entry.NetAddress
+	}
+	return addrs
+}
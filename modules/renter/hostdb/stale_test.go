@@ -0,0 +1,42 @@
+package hostdb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestStaleHosts checks that StaleHosts returns the active hosts that have
+// not been probed within the window, least recently probed first.
+func TestStaleHosts(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	settings := modules.HostExternalSettings{AcceptingContracts: true}
+	for i := uint8(1); i <= 4; i++ {
+		entry := &hostEntry{HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(i)}, Reliability: DefaultReliability}
+		hdb.managedUpdateEntry(entry, settings, modules.HostSettingsExtension{}, nil)
+	}
+	if stale := hdb.StaleHosts(time.Hour); len(stale) != 0 {
+		t.Fatal("recently probed hosts were reported as stale:", stale)
+	}
+
+	// Age the probes of some of the hosts.
+	hdb.allHosts[fakeAddr(1)].lastProbed = time.Now().Add(-2 * time.Hour)
+	hdb.allHosts[fakeAddr(3)].lastProbed = time.Now().Add(-3 * time.Hour)
+	hdb.allHosts[fakeAddr(4)].lastProbed = time.Time{}
+	stale := hdb.StaleHosts(time.Hour)
+	if !reflect.DeepEqual(stale, []modules.NetAddress{fakeAddr(4), fakeAddr(3), fakeAddr(1)}) {
+		t.Fatal("wrong stale hosts:", stale)
+	}
+
+	// A probe refreshes the host, and inactive hosts
+	// are not reported.
+	hdb.managedUpdateEntry(hdb.allHosts[fakeAddr(3)], settings, modules.HostSettingsExtension{}, nil)
+	hdb.removeHost(fakeAddr(4))
+	stale = hdb.StaleHosts(time.Hour)
+	if !reflect.DeepEqual(stale, []modules.NetAddress{fakeAddr(1)}) {
+		t.Error("wrong stale hosts after a probe:", stale)
+	}
+}
@@ -0,0 +1,113 @@
+package hostdb
+
+// stats.go reports aggregate statistics about the hostdb. The statistics are
+// gathered under a single acquisition of the lock, so that they describe one
+// consistent state of the hostdb.
+
+import (
+	"sort"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+type (
+	// HostDBStats summarizes the state of the hostdb. The weights only cover
+	// the active hosts; if there are no active hosts, they are all zero.
+	HostDBStats struct {
+		// ActiveHosts is the number of hosts in the host tree, and
+		// InactiveHosts is the number of known hosts that are not.
+		ActiveHosts   int `json:"activehosts"`
+		InactiveHosts int `json:"inactivehosts"`
+
+		// TotalWeight is the sum of the weights of the active hosts.
+		// MinWeight, MaxWeight and MedianWeight describe the distribution
+		// of those weights. With an even number of active hosts, the median
+		// is the mean of the two middle weights, rounded down.
+		TotalWeight  types.Currency `json:"totalweight"`
+		MinWeight    types.Currency `json:"minweight"`
+		MaxWeight    types.Currency `json:"maxweight"`
+		MedianWeight types.Currency `json:"medianweight"`
+
+		// BlacklistSize is the number of blacklisted address ranges.
+		BlacklistSize int `json:"blacklistsize"`
+
+		// EvictedHosts is the number of hosts that have been evicted to
+		// stay within the maximum number of retained hosts.
+		EvictedHosts uint64 `json:"evictedhosts"`
+
+		// BlockHeight is the height of the most recent block processed by
+		// the hostdb.
+		BlockHeight types.BlockHeight `json:"blockheight"`
+	}
+
+	// currencies sorts a set of currencies in ascending order.
+	currencies []types.Currency
+)
+
+func (c currencies) Len() int           { return len(c) }
+func (c currencies) Less(i, j int) bool { return c[i].Cmp(c[j]) < 0 }
+func (c currencies) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+
+// nodeWeights returns the weights of the hosts held by the tree rooted at
+// 'hn'. Empty nodes are skipped. The tree is walked iteratively, so that the
+// stack usage is constant.
+func (hn *hostNode) nodeWeights() (weights currencies) {
+	if hn == nil {
+		return nil
+	}
+	stack := []*hostNode{hn}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if node.taken {
+			weights = append(weights, node.hostEntry.Weight)
+		}
+		if node.left != nil {
+			stack = append(stack, node.left)
+		}
+		if node.right != nil {
+			stack = append(stack, node.right)
+		}
+	}
+	return weights
+}
+
+// Stats returns aggregate statistics about the hostdb.
+func (hdb *HostDB) Stats() HostDBStats {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	return hdb.stats()
+}
+
+// stats computes the aggregate statistics of the hostdb.
+func (hdb *HostDB) stats() HostDBStats {
+	stats := HostDBStats{
+		ActiveHosts:   len(hdb.activeHosts),
+		BlacklistSize: len(hdb.blacklist),
+		BlockHeight:   hdb.blockHeight,
+		EvictedHosts:  hdb.evictedHosts,
+	}
+	for addr := range hdb.allHosts {
+		if _, active := hdb.activeHosts[addr]; !active {
+			stats.InactiveHosts++
+		}
+	}
+	if hdb.hostTree != nil {
+		stats.TotalWeight = hdb.hostTree.weight
+	}
+
+	weights := hdb.hostTree.nodeWeights()
+	if len(weights) == 0 {
+		return stats
+	}
+	sort.Sort(weights)
+	stats.MinWeight = weights[0]
+	stats.MaxWeight = weights[len(weights)-1]
+	mid := len(weights) / 2
+	if len(weights)%2 == 1 {
+		stats.MedianWeight = weights[mid]
+	} else {
+		stats.MedianWeight = weights[mid-1].Add(weights[mid]).Div64(2)
+	}
+	return stats
+}
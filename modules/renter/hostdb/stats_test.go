@@ -0,0 +1,59 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestStats checks that Stats reports the counts and weight distribution of
+// the hostdb.
+func TestStats(t *testing.T) {
+	hdb := bareHostDB()
+	stats := hdb.Stats()
+	if stats.ActiveHosts != 0 || !stats.TotalWeight.IsZero() || !stats.MedianWeight.IsZero() {
+		t.Fatal("empty hostdb reported non-empty stats:", stats)
+	}
+
+	for i, w := range []uint64{5, 1, 4, 2} {
+		entry := &hostEntry{
+			HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(uint8(i))},
+			Weight:      types.NewCurrency64(w),
+		}
+		hdb.allHosts[entry.NetAddress] = entry
+		hdb.insertNode(entry)
+	}
+	offline := &hostEntry{HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(10)}}
+	hdb.allHosts[offline.NetAddress] = offline
+	if _, err := hdb.addBlacklist("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	hdb.blockHeight = 7
+
+	stats = hdb.Stats()
+	if stats.ActiveHosts != 4 || stats.InactiveHosts != 1 {
+		t.Error("wrong host counts:", stats.ActiveHosts, stats.InactiveHosts)
+	}
+	if stats.TotalWeight.Cmp(types.NewCurrency64(12)) != 0 {
+		t.Error("wrong total weight:", stats.TotalWeight)
+	}
+	if stats.MinWeight.Cmp(types.NewCurrency64(1)) != 0 || stats.MaxWeight.Cmp(types.NewCurrency64(5)) != 0 {
+		t.Error("wrong weight bounds:", stats.MinWeight, stats.MaxWeight)
+	}
+	if stats.MedianWeight.Cmp(types.NewCurrency64(3)) != 0 {
+		t.Error("wrong median weight:", stats.MedianWeight)
+	}
+	if stats.BlacklistSize != 1 || stats.BlockHeight != 7 {
+		t.Error("wrong blacklist size or block height:", stats.BlacklistSize, stats.BlockHeight)
+	}
+
+	// Removing a host should leave an empty node that is not counted.
+	if err := hdb.removeHost(fakeAddr(0)); err != nil {
+		t.Fatal(err)
+	}
+	stats = hdb.Stats()
+	if stats.ActiveHosts != 3 || stats.MedianWeight.Cmp(types.NewCurrency64(2)) != 0 || stats.MaxWeight.Cmp(types.NewCurrency64(4)) != 0 {
+		t.Error("wrong stats after removal:", stats)
+	}
+}
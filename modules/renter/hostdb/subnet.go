@@ -0,0 +1,84 @@
+package hostdb
+
+// subnet.go builds host selection filters from ranges of addresses, so that a
+// renter can avoid storing data on hosts in its own network, which could fail
+// or be compromised together with the renter, or can restrict itself to hosts
+// in a set of trusted networks. Like the blacklist, only hosts that announce
+// an IP address are matched; hostnames are not resolved.
+
+import (
+	"errors"
+	"net"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// A SubnetMode determines how a subnet filter treats the hosts within its
+// ranges.
+type SubnetMode int
+
+const (
+	// SubnetExclude rejects the hosts within the ranges, and accepts all
+	// other hosts, including hosts that announce a hostname.
+	SubnetExclude SubnetMode = iota
+
+	// SubnetIncludeOnly accepts only the hosts within the ranges. Hosts
+	// that announce a hostname are rejected, because they cannot be matched.
+	SubnetIncludeOnly
+)
+
+var (
+	errEmptySubnets      = errors.New("an include-only subnet filter needs at least one range")
+	errInvalidSubnet     = errors.New("subnet is neither an IP address nor a range in CIDR notation")
+	errUnknownSubnetMode = errors.New("unknown subnet mode")
+)
+
+// parseSubnet parses a range in CIDR notation, or a single IP address, which
+// is treated as a range holding only that address.
+func parseSubnet(s string) (*net.IPNet, error) {
+	if _, ipnet, err := net.ParseCIDR(s); err == nil {
+		return ipnet, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, errInvalidSubnet
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// SubnetFilter returns a filter for RandomHostFiltered that accepts or rejects
+// hosts according to whether their address falls within one of 'subnets'.
+// Each subnet is either a range in CIDR notation, such as the renter's local
+// network, or a single IP address, such as the renter's own public IP.
+func SubnetFilter(mode SubnetMode, subnets []string) (func(modules.HostDBEntry) bool, error) {
+	if mode != SubnetExclude && mode != SubnetIncludeOnly {
+		return nil, errUnknownSubnetMode
+	}
+	if mode == SubnetIncludeOnly && len(subnets) == 0 {
+		return nil, errEmptySubnets
+	}
+	nets := make([]*net.IPNet, 0, len(subnets))
+	for _, s := range subnets {
+		ipnet, err := parseSubnet(s)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipnet)
+	}
+
+	return func(entry modules.HostDBEntry) bool {
+		ip := net.ParseIP(entry.NetAddress.Host())
+		if ip == nil {
+			return mode == SubnetExclude
+		}
+		for _, ipnet := range nets {
+			if ipnet.Contains(ip) {
+				return mode == SubnetIncludeOnly
+			}
+		}
+		return mode == SubnetExclude
+	}, nil
+}
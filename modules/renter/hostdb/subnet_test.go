@@ -0,0 +1,85 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestSubnetFilter checks the matching of hosts by the subnet filters in both
+// modes.
+func TestSubnetFilter(t *testing.T) {
+	if _, err := SubnetFilter(SubnetIncludeOnly, nil); err != errEmptySubnets {
+		t.Error("expected errEmptySubnets, got", err)
+	}
+	if _, err := SubnetFilter(SubnetExclude, []string{"not-an-ip"}); err != errInvalidSubnet {
+		t.Error("expected errInvalidSubnet, got", err)
+	}
+	if _, err := SubnetFilter(SubnetMode(-1), nil); err != errUnknownSubnetMode {
+		t.Error("expected errUnknownSubnetMode, got", err)
+	}
+
+	subnets := []string{"10.0.0.0/8", "203.0.113.7", "2001:db8::1"}
+	exclude, err := SubnetFilter(SubnetExclude, subnets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	include, err := SubnetFilter(SubnetIncludeOnly, subnets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		addr    modules.NetAddress
+		inRange bool
+	}{
+		{"10.1.2.3:9982", true},
+		{"11.1.2.3:9982", false},
+		{"203.0.113.7:9982", true},
+		{"203.0.113.8:9982", false},
+		{"[2001:db8::1]:9982", true},
+		{"[2001:db8::2]:9982", false},
+	}
+	for _, test := range tests {
+		entry := modules.HostDBEntry{NetAddress: test.addr}
+		if exclude(entry) == test.inRange {
+			t.Errorf("exclude filter accepted %v: %v", test.addr, exclude(entry))
+		}
+		if include(entry) != test.inRange {
+			t.Errorf("include-only filter accepted %v: %v", test.addr, include(entry))
+		}
+	}
+
+	// Hostnames cannot be matched, so they are only accepted when excluding.
+	entry := modules.HostDBEntry{NetAddress: "host.example.com:9982"}
+	if !exclude(entry) || include(entry) {
+		t.Error("hostname was not handled as unmatched")
+	}
+}
+
+// TestSubnetSelection checks that a subnet filter keeps the weighted
+// selection out of the excluded subnet.
+func TestSubnetSelection(t *testing.T) {
+	hdb := bareHostDB()
+	for i, addr := range []modules.NetAddress{"10.0.0.1:1", "10.0.0.2:1", "192.0.2.1:1"} {
+		entry := &hostEntry{
+			HostDBEntry: modules.HostDBEntry{NetAddress: addr},
+			Weight:      types.NewCurrency64(uint64(100 - 40*i)),
+		}
+		hdb.allHosts[addr] = entry
+		hdb.insertNode(entry)
+	}
+	filter, err := SubnetFilter(SubnetExclude, []string{"10.0.0.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		host, err := hdb.RandomHostFiltered(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if host.NetAddress != "192.0.2.1:1" {
+			t.Fatal("selected a host in the excluded subnet:", host.NetAddress)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package hostdb
+
+// throughput.go tracks the throughput that has been observed on transfers
+// with hosts. Throughput is kept as a moving average in bytes per second, and
+// is factored into the weight of the host so that faster hosts are favored.
+//
+// Probes do not measure throughput: the settings of a host are only a few
+// kilobytes, and a transfer that small measures the latency of the host
+// rather than its bandwidth. Instead, callers report real transfers, such as
+// uploads and downloads, through RecordTransfer, and transfers smaller than
+// minThroughputSampleBytes are ignored. Hosts without any throughput samples
+// are weighted as if they had the reference throughput.
+//
+// The most recent samples are also kept, so that the hostdb can be configured
+// to weight hosts by a percentile of their recent throughput instead of the
+// moving average. A percentile such as the median is not dragged down by a
+// single slow probe.
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// throughputDecay determines how quickly old throughput samples are
+	// forgotten. Each new sample contributes 1/throughputDecay of the moving
+	// average.
+	throughputDecay = 4
+
+	// referenceThroughput is the throughput, in bytes per second, at which
+	// the weight of a host is not adjusted. Hosts with a higher throughput
+	// gain weight linearly, and hosts with a lower throughput lose weight
+	// linearly. Hosts with no observed throughput are treated as having the
+	// reference throughput.
+	referenceThroughput = 1e6
+
+	// minThroughput and maxThroughput bound the throughput that is taken into
+	// account when weighting a host, so that a single unusually fast or slow
+	// probe cannot dominate the weight of the host.
+	minThroughput = referenceThroughput / 100
+	maxThroughput = referenceThroughput * 100
+
+	// minThroughputSampleBytes is the smallest transfer, in bytes, that is
+	// recorded as a throughput sample. Smaller transfers are dominated by
+	// the round-trip time to the host.
+	minThroughputSampleBytes = 1 << 20
+
+	// defaultThroughputWindow is the default number of recent throughput
+	// samples that are kept for each host.
+	defaultThroughputWindow = 8
+
+	// reportedThroughputPercentile is the percentile of the recent samples
+	// that is reported in the metrics if the hostdb is not weighting by a
+	// percentile.
+	reportedThroughputPercentile = 0.5
+)
+
+var (
+	// errInvalidThroughputPercentile is returned if the throughput window is
+	// negative or the percentile is not between 0 and 1.
+	errInvalidThroughputPercentile = errors.New("throughput window cannot be negative and the percentile must be between 0 and 1")
+)
+
+// uint64s sorts a slice of uint64s in ascending order.
+type uint64s []uint64
+
+func (u uint64s) Len() int           { return len(u) }
+func (u uint64s) Less(i, j int) bool { return u[i] < u[j] }
+func (u uint64s) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
+
+// throughputSample converts a number of bytes transferred over a duration
+// into bytes per second. 0 is returned if the transfer is too small to
+// measure the throughput of the host.
+func throughputSample(bytes uint64, elapsed time.Duration) uint64 {
+	if elapsed <= 0 || bytes < minThroughputSampleBytes {
+		return 0
+	}
+	return uint64(float64(bytes) / elapsed.Seconds())
+}
+
+// recordThroughput folds a throughput sample into the moving average of the
+// entry. The first sample replaces the average entirely.
+func (he *hostEntry) recordThroughput(sample uint64) {
+	if sample == 0 {
+		return
+	}
+	if he.Throughput == 0 {
+		he.Throughput = sample
+		return
+	}
+	he.Throughput = (he.Throughput*(throughputDecay-1) + sample) / throughputDecay
+}
+
+// recordThroughputSample adds a throughput sample to the recent samples of
+// the entry, dropping the oldest samples so that at most 'window' are kept.
+func (he *hostEntry) recordThroughputSample(sample uint64, window int) {
+	if sample == 0 {
+		return
+	}
+	he.ThroughputSamples = append(he.ThroughputSamples, sample)
+	if excess := len(he.ThroughputSamples) - window; excess > 0 {
+		he.ThroughputSamples = append([]uint64(nil), he.ThroughputSamples[excess:]...)
+	}
+}
+
+// throughputPercentile returns the given percentile, between 0 and 1, of the
+// recent throughput samples of the entry, using the nearest-rank method. 0 is
+// returned if there are no samples.
+func (he *hostEntry) throughputPercentile(percentile float64) uint64 {
+	if len(he.ThroughputSamples) == 0 {
+		return 0
+	}
+	sorted := append(uint64s(nil), he.ThroughputSamples...)
+	sort.Sort(sorted)
+	rank := int(math.Ceil(percentile*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// throughputWindowSize returns the number of recent throughput samples that
+// are kept for each host.
+func (hdb *HostDB) throughputWindowSize() int {
+	if hdb.throughputWindow == 0 {
+		return defaultThroughputWindow
+	}
+	return hdb.throughputWindow
+}
+
+// weightedThroughput returns the throughput that is used when weighting the
+// entry: the configured percentile of the recent samples, or the moving
+// average if the hostdb is not weighting by a percentile or the host has no
+// recent samples.
+func (hdb *HostDB) weightedThroughput(entry *hostEntry) uint64 {
+	if hdb.throughputPercentile == 0 {
+		return entry.Throughput
+	}
+	if p := entry.throughputPercentile(hdb.throughputPercentile); p != 0 {
+		return p
+	}
+	return entry.Throughput
+}
+
+// SetThroughputPercentile has the hostdb weight hosts by the given
+// percentile, between 0 and 1, of their most recent 'window' throughput
+// samples, rather than by the moving average of their throughput. A
+// percentile of 0 restores weighting by the moving average, and a window of 0
+// restores the default window. The weights of the hosts are updated the next
+// time that they are probed.
+func (hdb *HostDB) SetThroughputPercentile(window int, percentile float64) error {
+	if window < 0 || percentile < 0 || percentile > 1 {
+		return errInvalidThroughputPercentile
+	}
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.throughputWindow = window
+	hdb.throughputPercentile = percentile
+	return nil
+}
+
+// RecordTransfer records that 'bytes' were transferred to or from the host at
+// 'addr' over 'elapsed', folding the throughput of the transfer into the
+// weight of the host. Transfers smaller than minThroughputSampleBytes are
+// ignored, as are unknown addresses. The change is persisted the next time
+// that the hostdb is saved.
+func (hdb *HostDB) RecordTransfer(addr modules.NetAddress, bytes uint64, elapsed time.Duration) {
+	sample := throughputSample(bytes, elapsed)
+	if sample == 0 {
+		return
+	}
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+
+	entry, exists := hdb.allHosts[addr]
+	if !exists {
+		return
+	}
+	entry.recordThroughput(sample)
+	entry.recordThroughputSample(sample, hdb.throughputWindowSize())
+
+	// The weight of an active host must be changed through the tree.
+	newWeight := hdb.hostWeight(entry)
+	if _, active := hdb.activeHosts[addr]; active {
+		if newWeight.Cmp(entry.Weight) != 0 {
+			hdb.reweight(addr, newWeight)
+		}
+	} else {
+		entry.Weight = newWeight
+	}
+}
+
+// throughputAdjustment scales a weight according to the observed throughput
+// of a host. A throughput of 0 means that no transfer has been measured, and
+// leaves the weight unadjusted.
+func throughputAdjustment(weight types.Currency, throughput uint64) types.Currency {
+	if throughput == 0 {
+		return weight
+	}
+	if throughput < minThroughput {
+		throughput = minThroughput
+	} else if throughput > maxThroughput {
+		throughput = maxThroughput
+	}
+	return weight.Mul64(throughput).Div64(referenceThroughput)
+}
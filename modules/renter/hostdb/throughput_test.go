@@ -0,0 +1,146 @@
+package hostdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestRecordThroughput checks that throughput samples are folded into a
+// moving average.
+func TestRecordThroughput(t *testing.T) {
+	var he hostEntry
+	he.recordThroughput(0)
+	if he.Throughput != 0 {
+		t.Fatal("empty sample should be ignored")
+	}
+	he.recordThroughput(800)
+	if he.Throughput != 800 {
+		t.Fatal("first sample should replace the average:", he.Throughput)
+	}
+	he.recordThroughput(0)
+	he.recordThroughput(400)
+	if he.Throughput != 700 {
+		t.Fatal("sample was not averaged correctly:", he.Throughput)
+	}
+
+	if throughputSample(2e6, 2*time.Second) != 1e6 {
+		t.Error("wrong throughput sample")
+	}
+	if throughputSample(2e6, 0) != 0 {
+		t.Error("zero duration should give an empty sample")
+	}
+	if throughputSample(2e3, time.Millisecond) != 0 {
+		t.Error("transfer the size of the settings should give an empty sample")
+	}
+}
+
+// TestThroughputWeight checks that hosts with a higher throughput receive a
+// higher weight, within bounds.
+func TestThroughputWeight(t *testing.T) {
+	base := calculateHostWeight(hostEntry{}, defaultPriceExponent, defaultCollateralExponent)
+	reference := calculateHostWeight(hostEntry{Throughput: referenceThroughput}, defaultPriceExponent, defaultCollateralExponent)
+	if base.Cmp(reference) != 0 {
+		t.Error("host with unknown throughput should have the reference weight")
+	}
+	fast := calculateHostWeight(hostEntry{Throughput: referenceThroughput * 2}, defaultPriceExponent, defaultCollateralExponent)
+	if fast.Cmp(base.Mul64(2)) != 0 {
+		t.Error("host with twice the throughput should have twice the weight")
+	}
+	tooFast := calculateHostWeight(hostEntry{Throughput: maxThroughput * 10}, defaultPriceExponent, defaultCollateralExponent)
+	if tooFast.Cmp(base.Mul64(maxThroughput/referenceThroughput)) != 0 {
+		t.Error("throughput adjustment was not capped")
+	}
+	tooSlow := calculateHostWeight(hostEntry{Throughput: 1}, defaultPriceExponent, defaultCollateralExponent)
+	if tooSlow.Cmp(base.Div64(referenceThroughput/minThroughput)) != 0 {
+		t.Error("throughput adjustment was not floored")
+	}
+}
+
+// TestRecordTransfer checks that the throughput of a reported transfer is
+// reflected in the weight of the host, that small transfers are ignored, and
+// that probing a host leaves its throughput neutral.
+func TestRecordTransfer(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	entry := &hostEntry{HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(1)}}
+	hdb.allHosts[entry.NetAddress] = entry
+
+	settings := modules.HostExternalSettings{AcceptingContracts: true}
+	hdb.managedUpdateEntry(entry, settings, modules.HostSettingsExtension{}, nil)
+	if entry.Throughput != 0 {
+		t.Fatal("probe recorded a throughput")
+	}
+	w0 := hdb.activeHosts[entry.NetAddress].hostEntry.Weight
+
+	hdb.RecordTransfer(entry.NetAddress, 2e3, time.Second)
+	if entry.Throughput != 0 || hdb.activeHosts[entry.NetAddress].hostEntry.Weight.Cmp(w0) != 0 {
+		t.Fatal("small transfer was recorded")
+	}
+	hdb.RecordTransfer(entry.NetAddress, 4*referenceThroughput, 4*time.Second)
+	w1 := hdb.activeHosts[entry.NetAddress].hostEntry.Weight
+	if w1.Cmp(w0) != 0 {
+		t.Error("host at the reference throughput was not weighted neutrally")
+	}
+	hdb.RecordTransfer(entry.NetAddress, 5*referenceThroughput, time.Second)
+	w2 := hdb.activeHosts[entry.NetAddress].hostEntry.Weight
+	if w2.Cmp(w1.Mul64(2)) != 0 {
+		t.Error("weight did not track the moving average of throughput")
+	}
+	if hdb.hostTree.weight.Cmp(w2) != 0 {
+		t.Error("tree weight was not updated")
+	}
+	if len(entry.ThroughputSamples) != 2 {
+		t.Error("transfers were not recorded as samples:", entry.ThroughputSamples)
+	}
+}
+
+// TestThroughputPercentile checks that the recent throughput samples are kept
+// within the window, and that hosts can be weighted by a percentile of the
+// samples so that a single slow sample does not drag the weight down.
+func TestThroughputPercentile(t *testing.T) {
+	var he hostEntry
+	if he.throughputPercentile(0.5) != 0 {
+		t.Fatal("entry without samples should have no percentile")
+	}
+	for _, s := range []uint64{5e6, 0, 1e6, 4e6, 2e6, 3e6} {
+		he.recordThroughputSample(s, 4)
+	}
+	if len(he.ThroughputSamples) != 4 || he.ThroughputSamples[0] != 1e6 {
+		t.Fatal("samples were not kept within the window:", he.ThroughputSamples)
+	}
+	if p := he.throughputPercentile(0.5); p != 2e6 {
+		t.Error("wrong median:", p)
+	}
+	if p := he.throughputPercentile(1); p != 4e6 {
+		t.Error("wrong maximum:", p)
+	}
+
+	hdb := bareHostDB()
+	if err := hdb.SetThroughputPercentile(-1, 0.5); err != errInvalidThroughputPercentile {
+		t.Error("expected errInvalidThroughputPercentile, got", err)
+	}
+	if err := hdb.SetThroughputPercentile(0, 1.5); err != errInvalidThroughputPercentile {
+		t.Error("expected errInvalidThroughputPercentile, got", err)
+	}
+
+	// A single slow sample lowers the moving average, but not the median.
+	entry := &hostEntry{Throughput: referenceThroughput}
+	for i := 0; i < 4; i++ {
+		entry.recordThroughputSample(referenceThroughput, defaultThroughputWindow)
+	}
+	entry.recordThroughput(minThroughput)
+	entry.recordThroughputSample(minThroughput, defaultThroughputWindow)
+	average := hdb.hostWeight(entry)
+	if err := hdb.SetThroughputPercentile(0, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	median := hdb.hostWeight(entry)
+	if median.Cmp(average) <= 0 {
+		t.Error("slow sample lowered the weight by the median:", average, median)
+	}
+	if median.Cmp(calculateHostWeight(hostEntry{Throughput: referenceThroughput}, defaultPriceExponent, defaultCollateralExponent)) != 0 {
+		t.Error("host was not weighted by its median throughput")
+	}
+}
@@ -0,0 +1,122 @@
+package hostdb
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// testCertificate returns a self-signed certificate for the provided host
+// name.
+func testCertificate(name string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// TestProbeTLS checks that the hostdb probes hosts that advertise TLS over
+// TLS once TLS has been enabled, pinned to the certificate hash advertised by
+// the host, and in plaintext otherwise.
+func TestProbeTLS(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+
+	cert, err := testCertificate("foo.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk, pk, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := new(hostEntry)
+	h.NetAddress = "foo.com:1234"
+	h.AcceptingContracts = true
+	h.TLS = true
+	h.TLSCertificateHash = crypto.HashBytes(cert.Certificate[0])
+	h.PublicKey = types.SiaPublicKey{
+		Algorithm: types.SignatureEd25519,
+		Key:       pk[:],
+	}
+	h.Reliability = baseWeight
+
+	// The host only speaks TLS, so a plaintext probe fails.
+	hdb.dialer = probeDialer(func(modules.NetAddress, time.Duration) (net.Conn, error) {
+		ourConn, theirConn := net.Pipe()
+		go func() {
+			conn := tls.Server(ourConn, &tls.Config{Certificates: []tls.Certificate{cert}})
+			defer conn.Close()
+			encoding.ReadObject(conn, new(types.Specifier), types.SpecifierLen)
+			crypto.WriteSignedObject(conn, modules.HostExternalSettings{
+				AcceptingContracts: true,
+				NetAddress:         "foo.com:1234",
+			}, sk)
+			crypto.WriteSignedObject(conn, modules.HostSettingsExtension{
+				TLS:                true,
+				TLSCertificateHash: crypto.HashBytes(cert.Certificate[0]),
+			}, sk)
+		}()
+		return theirConn, nil
+	})
+	hdb.threadGroup.Add(100)
+	runProbe := func(h *hostEntry) {
+		hdb.scanPool <- h
+		close(hdb.scanPool)
+		hdb.threadedProbeHosts()
+		hdb.scanPool = make(chan *hostEntry, 1)
+	}
+	runProbe(h)
+	if len(hdb.ActiveHosts()) != 0 {
+		t.Fatal("host was added after a plaintext probe of a TLS-only host")
+	}
+
+	// A certificate that does not match the advertised hash is rejected,
+	// even though it is valid for the host name.
+	other, err := testCertificate("foo.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdb.SetTLS(true)
+	h.TLSCertificateHash = crypto.HashBytes(other.Certificate[0])
+	runProbe(h)
+	if len(hdb.ActiveHosts()) != 0 {
+		t.Fatal("host was added despite an unpinned certificate")
+	}
+
+	h.TLSCertificateHash = crypto.HashBytes(cert.Certificate[0])
+	runProbe(h)
+	if len(hdb.ActiveHosts()) != 1 {
+		t.Fatal("host was not added after a TLS probe")
+	}
+	if !h.TLS || h.TLSCertificateHash != crypto.HashBytes(cert.Certificate[0]) {
+		t.Fatal("extension was not recorded after a TLS probe")
+	}
+}
@@ -0,0 +1,87 @@
+package hostdb
+
+// touch.go lets callers report evidence that a host is alive which was
+// gathered outside of the probe loop, such as a successful download. The
+// latency of those interactions is kept as a moving average and factored into
+// the weight of the host, so that real traffic serves as free health data.
+
+import (
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// latencyDecay determines how quickly old latency samples are
+	// forgotten. Each new sample contributes 1/latencyDecay of the moving
+	// average.
+	latencyDecay = 4
+
+	// referenceLatency is the latency at which the weight of a host is not
+	// adjusted. Hosts with a lower latency gain weight and hosts with a
+	// higher latency lose weight, in inverse proportion to the latency.
+	// Hosts with no observed latency are treated as having the reference
+	// latency.
+	referenceLatency = 200 * time.Millisecond
+
+	// minLatency and maxLatency bound the latency that is taken into account
+	// when weighting a host.
+	minLatency = referenceLatency / 20
+	maxLatency = referenceLatency * 50
+)
+
+// recordLatency folds a latency sample into the moving average of the entry.
+// The first sample replaces the average entirely.
+func (he *hostEntry) recordLatency(sample time.Duration) {
+	if sample <= 0 {
+		return
+	}
+	if he.Latency == 0 {
+		he.Latency = sample
+		return
+	}
+	he.Latency = (he.Latency*(latencyDecay-1) + sample) / latencyDecay
+}
+
+// latencyAdjustment scales a weight according to the observed latency of a
+// host.
+func latencyAdjustment(weight types.Currency, latency time.Duration) types.Currency {
+	if latency == 0 {
+		return weight
+	}
+	if latency < minLatency {
+		latency = minLatency
+	} else if latency > maxLatency {
+		latency = maxLatency
+	}
+	return weight.Mul64(uint64(referenceLatency)).Div64(uint64(latency))
+}
+
+// Touch records that the host at 'addr' was seen alive outside of the probe
+// loop, with the provided observed latency, updating the last seen time and
+// the weight of the host without probing it. A latency of 0 only updates the
+// last seen time. Touch does nothing for unknown addresses. The change is
+// persisted the next time that the hostdb is saved.
+func (hdb *HostDB) Touch(addr modules.NetAddress, observedLatency time.Duration) {
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+
+	entry, exists := hdb.allHosts[addr]
+	if !exists {
+		return
+	}
+	entry.LastSeen = time.Now()
+	entry.recordLatency(observedLatency)
+
+	// The weight of an active host must be changed through the tree.
+	newWeight := hdb.hostWeight(entry)
+	if _, active := hdb.activeHosts[addr]; active {
+		if newWeight.Cmp(entry.Weight) != 0 {
+			hdb.reweight(addr, newWeight)
+		}
+	} else {
+		entry.Weight = newWeight
+	}
+}
@@ -0,0 +1,64 @@
+package hostdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestTouch checks that Touch updates the last seen time and the weight of a
+// host from its observed latency.
+func TestTouch(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+
+	// Touching an unknown host does nothing.
+	hdb.Touch(fakeAddr(9), time.Second)
+	if len(hdb.allHosts) != 0 {
+		t.Fatal("touching an unknown host added it")
+	}
+
+	entry := &hostEntry{
+		HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(1)},
+		Reliability: DefaultReliability,
+	}
+	hdb.managedUpdateEntry(entry, modules.HostExternalSettings{AcceptingContracts: true}, modules.HostSettingsExtension{}, nil)
+	reference := entry.Weight
+	entry.LastSeen = time.Time{}
+
+	hdb.Touch(entry.NetAddress, referenceLatency/2)
+	if entry.LastSeen.IsZero() {
+		t.Error("last seen time was not updated")
+	}
+	if entry.Latency != referenceLatency/2 {
+		t.Error("latency was not recorded:", entry.Latency)
+	}
+	if entry.Weight.Cmp(reference.Mul64(2)) != 0 {
+		t.Error("fast host did not gain weight:", entry.Weight, reference)
+	}
+	if hdb.hostTree.weight.Cmp(entry.Weight) != 0 {
+		t.Error("tree weight was not updated")
+	}
+
+	// Slow samples are averaged in.
+	hdb.Touch(entry.NetAddress, 5*referenceLatency/2)
+	if entry.Latency != referenceLatency {
+		t.Error("latency was not averaged:", entry.Latency)
+	}
+}
+
+// TestLatencyAdjustment checks that the latency adjustment is bounded.
+func TestLatencyAdjustment(t *testing.T) {
+	weight := types.NewCurrency64(1e9)
+	if latencyAdjustment(weight, 0).Cmp(weight) != 0 {
+		t.Error("weight was adjusted without a latency")
+	}
+	if latencyAdjustment(weight, time.Nanosecond).Cmp(latencyAdjustment(weight, minLatency)) != 0 {
+		t.Error("low latencies were not bounded")
+	}
+	if latencyAdjustment(weight, time.Hour).Cmp(latencyAdjustment(weight, maxLatency)) != 0 {
+		t.Error("high latencies were not bounded")
+	}
+}
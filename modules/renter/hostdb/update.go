@@ -1,10 +1,17 @@
 package hostdb
 
 import (
+	"errors"
+
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
+var (
+	errRevertGap = errors.New("consensus change reverts blocks that are not at the tip of the hostdb's chain")
+	errApplyGap  = errors.New("consensus change applies blocks that do not extend the hostdb's chain")
+)
+
 // findHostAnnouncements returns a list of the host announcements found within
 // a given block. No check is made to see that the ip address found in the
 // announcement is actually a valid ip address.
@@ -28,11 +35,115 @@ func findHostAnnouncements(b types.Block) (announcements []modules.HostDBEntry)
 	return
 }
 
-// ProcessConsensusChange will be called by the consensus set every time there
-// is a change in the blockchain. Updates will always be called in order.
+// checkContiguous checks that the blocks of a consensus change connect to the
+// most recent block seen by the hostdb, returning the block that will be the
+// most recent block once the change is applied. The check is skipped if the
+// hostdb has not yet seen any blocks.
+func (hdb *HostDB) checkContiguous(cc modules.ConsensusChange) (types.BlockID, error) {
+	tip := hdb.recentBlock
+	if tip == (types.BlockID{}) {
+		if len(cc.AppliedBlocks) > 0 {
+			tip = cc.AppliedBlocks[len(cc.AppliedBlocks)-1].ID()
+		}
+		return tip, nil
+	}
+
+	// Reverted blocks are listed starting with the current tip.
+	for _, block := range cc.RevertedBlocks {
+		if block.ID() != tip {
+			return types.BlockID{}, errRevertGap
+		}
+		tip = block.ParentID
+	}
+	for _, block := range cc.AppliedBlocks {
+		if block.ParentID != tip {
+			return types.BlockID{}, errApplyGap
+		}
+		tip = block.ID()
+	}
+	return tip, nil
+}
+
+// A consensusSubscription delivers the changes of one consensus set to the
+// hostdb. The hostdb applies the changes of its current subscription, or of
+// the subscription replacing it while the replacement is being made, so that
+// it can subscribe to a new consensus set before unsubscribing from the old
+// one.
+type consensusSubscription struct {
+	hdb *HostDB
+	cs  consensusSet
+}
+
+// ProcessConsensusChange applies a consensus change to the hostdb if the
+// hostdb is receiving changes from the subscription.
+func (s *consensusSubscription) ProcessConsensusChange(cc modules.ConsensusChange) {
+	hdb := s.hdb
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	if hdb.resubscribing {
+		// The subscription is about to be replaced after a gap, and the
+		// replacement delivers this change again.
+		return
+	}
+	if hdb.nextSubscription != nil && s != hdb.nextSubscription {
+		return
+	}
+	if hdb.nextSubscription == nil && s != hdb.subscription {
+		return
+	}
+	hdb.processConsensusChange(cc)
+}
+
+// ProcessConsensusChange applies a consensus change to the hostdb. Updates
+// will always be called in order.
 func (hdb *HostDB) ProcessConsensusChange(cc modules.ConsensusChange) {
 	hdb.mu.Lock()
 	defer hdb.mu.Unlock()
+	hdb.processConsensusChange(cc)
+}
+
+// processConsensusChange applies a consensus change to the hostdb. If the
+// change does not connect to the chain of the hostdb, the hostdb resubscribes
+// from the most recent change that it applied, so that the missing changes
+// are delivered again.
+func (hdb *HostDB) processConsensusChange(cc modules.ConsensusChange) {
+	err := hdb.update(cc)
+	if (err == errRevertGap || err == errApplyGap) && (hdb.subscription != nil || hdb.nextSubscription != nil) {
+		hdb.log.Printf("WARN: %v, resubscribing from change %v", err, hdb.lastChange)
+		hdb.resubscribing = true
+		hdb.threadGroup.Add(1)
+		go hdb.threadedResubscribe()
+	} else if err != nil {
+		hdb.log.Println("ERROR: unable to process consensus change:", err)
+	}
+}
+
+// threadedResubscribe replaces the subscription of the hostdb with one that
+// starts after the most recent change applied by the hostdb. The consensus
+// set cannot be subscribed to while it is delivering a change, so the
+// subscription is replaced in its own thread.
+func (hdb *HostDB) threadedResubscribe() {
+	defer hdb.threadGroup.Done()
+	hdb.csMu.Lock()
+	defer hdb.csMu.Unlock()
+
+	hdb.mu.RLock()
+	cs, lastChange := hdb.cs, hdb.lastChange
+	hdb.mu.RUnlock()
+	err := hdb.managedSubscribe(cs, lastChange)
+	if err != nil {
+		hdb.log.Println("ERROR: unable to resubscribe to the consensus set:", err)
+	}
+}
+
+// update applies a consensus change to the hostdb. An error is returned, and
+// the hostdb is left unchanged, if the change does not connect to the most
+// recent block seen by the hostdb.
+func (hdb *HostDB) update(cc modules.ConsensusChange) error {
+	recentBlock, err := hdb.checkContiguous(cc)
+	if err != nil {
+		return err
+	}
 
 	if hdb.blockHeight != 0 || cc.AppliedBlocks[len(cc.AppliedBlocks)-1].ID() != types.GenesisID {
 		hdb.blockHeight += types.BlockHeight(len(cc.AppliedBlocks))
@@ -40,16 +151,19 @@ func (hdb *HostDB) ProcessConsensusChange(cc modules.ConsensusChange) {
 	}
 
 	// Add hosts announced in blocks that were applied.
-	for _, block := range cc.AppliedBlocks {
-		for _, host := range findHostAnnouncements(block) {
+	firstHeight := hdb.blockHeight + 1 - types.BlockHeight(len(cc.AppliedBlocks))
+	for i, block := range cc.AppliedBlocks {
+		for _, host := range hdb.blockHostAnnouncements(block, firstHeight+types.BlockHeight(i)) {
 			hdb.log.Debugln("Found a host in a host announcement:", host.NetAddress, host.PublicKey.Key)
 			hdb.insertHost(host)
 		}
 	}
 
 	hdb.lastChange = cc.ID
-	err := hdb.save()
+	hdb.recentBlock = recentBlock
+	err = hdb.save()
 	if err != nil {
 		hdb.log.Println(err)
 	}
+	return nil
 }
@@ -1,6 +1,7 @@
 package hostdb
 
 import (
+	"sync"
 	"testing"
 	"time"
 
@@ -92,3 +93,125 @@ func TestReceiveConsensusSetUpdate(t *testing.T) {
 		t.Fatal("hostdb should have a host after getting a host announcement transcation")
 	}
 }
+
+// TestUpdateGap checks that the hostdb rejects consensus changes that do not
+// connect to the most recent block it has seen.
+func TestUpdateGap(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+
+	// Build a short chain.
+	b1 := types.Block{Timestamp: 1}
+	b2 := types.Block{ParentID: b1.ID(), Timestamp: 2}
+	b3 := types.Block{ParentID: b2.ID(), Timestamp: 3}
+	b4 := types.Block{ParentID: b3.ID(), Timestamp: 4}
+
+	err := hdb.update(modules.ConsensusChange{AppliedBlocks: []types.Block{b1, b2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdb.recentBlock != b2.ID() {
+		t.Fatal("recent block was not updated")
+	}
+
+	// Skip b3.
+	annBytes, err := makeSignedAnnouncement("foo.com:1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b4.Transactions = []types.Transaction{{ArbitraryData: [][]byte{annBytes}}}
+	err = hdb.update(modules.ConsensusChange{AppliedBlocks: []types.Block{b4}})
+	if err != errApplyGap {
+		t.Fatal("expected errApplyGap, got", err)
+	}
+	if len(hdb.allHosts) != 0 || hdb.recentBlock != b2.ID() {
+		t.Fatal("hostdb was modified by a gapped consensus change")
+	}
+
+	// Revert a block that is not the tip.
+	err = hdb.update(modules.ConsensusChange{RevertedBlocks: []types.Block{b1}, AppliedBlocks: []types.Block{b2}})
+	if err != errRevertGap {
+		t.Fatal("expected errRevertGap, got", err)
+	}
+
+	// Revert b2 and apply b3 in its place, then extend with b4.
+	b3.ParentID = b1.ID()
+	b4.ParentID = b3.ID()
+	err = hdb.update(modules.ConsensusChange{RevertedBlocks: []types.Block{b2}, AppliedBlocks: []types.Block{b3, b4}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdb.recentBlock != b4.ID() || len(hdb.allHosts) != 1 {
+		t.Fatal("reorg was not applied correctly")
+	}
+}
+
+// gapCS is a consensus set that skips the change at index skip the first time
+// that it delivers its changes. Like the real consensus set, it does not
+// return from Unsubscribe while it is delivering changes.
+type gapCS struct {
+	changes []modules.ConsensusChange
+	skip    int
+	skipped bool
+	mu      sync.Mutex
+}
+
+func (cs *gapCS) ConsensusSetSubscribe(s modules.ConsensusSetSubscriber, lastChange modules.ConsensusChangeID) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	var start int
+	for i, cc := range cs.changes {
+		if cc.ID == lastChange {
+			start = i + 1
+		}
+	}
+	for i, cc := range cs.changes[start:] {
+		if start+i == cs.skip && !cs.skipped {
+			cs.skipped = true
+			continue
+		}
+		s.ProcessConsensusChange(cc)
+	}
+	return nil
+}
+
+func (cs *gapCS) Unsubscribe(modules.ConsensusSetSubscriber) {
+	cs.mu.Lock()
+	cs.mu.Unlock()
+}
+
+func (cs *gapCS) BlockAtHeight(types.BlockHeight) (types.Block, bool) { return types.Block{}, false }
+
+// TestUpdateGapResubscribe checks that the hostdb resubscribes from the most
+// recent change it applied after receiving a change that does not connect to
+// its chain, and catches up with the consensus set.
+func TestUpdateGapResubscribe(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+
+	cs := &gapCS{skip: 1}
+	var parent types.BlockID
+	for i := 0; i < 3; i++ {
+		b := types.Block{ParentID: parent, Timestamp: types.Timestamp(i + 1)}
+		cc := modules.ConsensusChange{AppliedBlocks: []types.Block{b}}
+		cc.ID[0] = byte(i + 1)
+		cs.changes = append(cs.changes, cc)
+		parent = b.ID()
+	}
+	hdb.csMu.Lock()
+	err := hdb.managedSubscribe(cs, modules.ConsensusChangeBeginning)
+	hdb.csMu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdb.threadGroup.Wait()
+
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	if hdb.recentBlock != parent || hdb.lastChange != cs.changes[2].ID {
+		t.Fatal("hostdb did not catch up after a gap")
+	}
+	if hdb.resubscribing {
+		t.Error("hostdb is still resubscribing")
+	}
+}
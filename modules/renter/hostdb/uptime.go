@@ -0,0 +1,67 @@
+package hostdb
+
+// uptime.go tracks the fraction of probes that each host answers. Hosts with a
+// higher uptime are given a proportionally higher weight, and hosts with an
+// uptime below the configured floor are kept out of the set of active hosts.
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// uptimeDecay determines how quickly old probes are forgotten. Each new
+	// probe contributes 1/uptimeDecay of the moving average.
+	uptimeDecay = 10
+
+	// uptimePrecision is the fixed point precision with which the uptime is
+	// applied to a weight.
+	uptimePrecision = 1e6
+)
+
+var errInvalidUptimeFloor = errors.New("uptime floor must be between 0 and 1")
+
+// recordUptime folds the result of a probe into the uptime of the entry. The
+// first probe replaces the average entirely.
+func (he *hostEntry) recordUptime(success bool) {
+	var sample float64
+	if success {
+		sample = 1
+	}
+	if he.UptimeProbes == 0 {
+		he.Uptime = sample
+	} else {
+		he.Uptime = (he.Uptime*(uptimeDecay-1) + sample) / uptimeDecay
+	}
+	he.UptimeProbes++
+}
+
+// uptimeAdjustment scales a weight by the uptime of a host. Hosts that have
+// not been probed keep their weight.
+func uptimeAdjustment(weight types.Currency, entry hostEntry) types.Currency {
+	if entry.UptimeProbes == 0 {
+		return weight
+	}
+	return weight.Mul64(uint64(entry.Uptime * uptimePrecision)).Div64(uptimePrecision)
+}
+
+// belowUptimeFloor returns true if the host has been probed and its uptime is
+// below the uptime floor of the hostdb.
+func (hdb *HostDB) belowUptimeFloor(entry *hostEntry) bool {
+	return entry.UptimeProbes > 0 && entry.Uptime < hdb.uptimeFloor
+}
+
+// SetUptimeFloor sets the uptime, between 0 and 1, below which hosts are
+// kept out of the set of active hosts. The floor is applied to each host the
+// next time that it is probed. A floor of 0 never demotes a host. An error is
+// returned if the floor is outside of [0, 1].
+func (hdb *HostDB) SetUptimeFloor(floor float64) error {
+	if !(floor >= 0 && floor <= 1) {
+		return errInvalidUptimeFloor
+	}
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.uptimeFloor = floor
+	return nil
+}
@@ -0,0 +1,106 @@
+package hostdb
+
+import (
+	"math"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestRecordUptime checks that the uptime of a host follows its probes.
+func TestRecordUptime(t *testing.T) {
+	var entry hostEntry
+	entry.recordUptime(false)
+	if entry.Uptime != 0 || entry.UptimeProbes != 1 {
+		t.Fatal("first probe should replace the uptime:", entry.Uptime)
+	}
+	for i := 0; i < 50; i++ {
+		entry.recordUptime(true)
+	}
+	if entry.Uptime < 0.99 {
+		t.Error("uptime did not recover after many successful probes:", entry.Uptime)
+	}
+	if uptimeAdjustment(types.NewCurrency64(1000), hostEntry{}).Cmp(types.NewCurrency64(1000)) != 0 {
+		t.Error("weight of a host that has not been probed should not change")
+	}
+}
+
+// TestUptimeSelection checks that a host with a high uptime is selected
+// proportionally more often than a host with a low uptime and the same price.
+func TestUptimeSelection(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	hdb := bareHostDB()
+	uptimes := []float64{0.9, 0.3}
+	for i, uptime := range uptimes {
+		entry := &hostEntry{
+			HostDBEntry: modules.HostDBEntry{
+				HostExternalSettings: modules.HostExternalSettings{
+					AcceptingContracts: true,
+					NetAddress:         fakeAddr(uint8(i)),
+					StoragePrice:       types.NewCurrency64(100),
+				},
+			},
+			Uptime:       uptime,
+			UptimeProbes: 10,
+		}
+		entry.Weight = calculateHostWeight(*entry, defaultPriceExponent, defaultCollateralExponent)
+		hdb.insertNode(entry)
+	}
+
+	trials := 20000
+	counts := make(map[modules.NetAddress]int)
+	for i := 0; i < trials; i++ {
+		hosts := hdb.SampleHosts(1)
+		if len(hosts) != 1 {
+			t.Fatal("wrong number of hosts returned")
+		}
+		counts[hosts[0].NetAddress]++
+	}
+	ratio := float64(counts[fakeAddr(0)]) / float64(counts[fakeAddr(1)])
+	if ratio < 2.5 || ratio > 3.5 {
+		t.Error("expected the high uptime host to be selected about 3x as often, got", ratio)
+	}
+}
+
+// TestUptimeFloor checks that hosts below the uptime floor are demoted to
+// inactive, even when they answer a probe.
+func TestUptimeFloor(t *testing.T) {
+	hdb := bareHostDB()
+	hdb.persist = &memPersist{}
+	for _, floor := range []float64{-0.1, 1.1, math.NaN()} {
+		if err := hdb.SetUptimeFloor(floor); err != errInvalidUptimeFloor {
+			t.Errorf("floor %v: expected %v, got %v", floor, errInvalidUptimeFloor, err)
+		}
+	}
+	if err := hdb.SetUptimeFloor(0.5); err != nil {
+		t.Fatal(err)
+	}
+	settings := modules.HostExternalSettings{AcceptingContracts: true}
+
+	entry := &hostEntry{HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(1)}, Reliability: DefaultReliability}
+	hdb.managedUpdateEntry(entry, settings, modules.HostSettingsExtension{}, nil)
+	if _, exists := hdb.activeHosts[entry.NetAddress]; !exists {
+		t.Fatal("reachable host was not made active")
+	}
+
+	// Drop the uptime below the floor, then answer a probe.
+	entry.Uptime = 0.2
+	hdb.managedUpdateEntry(entry, settings, modules.HostSettingsExtension{}, nil)
+	if _, exists := hdb.activeHosts[entry.NetAddress]; exists {
+		t.Error("host below the uptime floor is still active")
+	}
+	if _, exists := hdb.allHosts[entry.NetAddress]; !exists {
+		t.Error("demoted host should still be known to the hostdb")
+	}
+
+	// Once the uptime recovers, the host is made active again.
+	for i := 0; i < 10 && entry.Uptime < 0.5; i++ {
+		hdb.managedUpdateEntry(entry, settings, modules.HostSettingsExtension{}, nil)
+	}
+	if _, exists := hdb.activeHosts[entry.NetAddress]; !exists {
+		t.Error("host was not reactivated after its uptime recovered")
+	}
+}
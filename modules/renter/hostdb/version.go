@@ -0,0 +1,42 @@
+package hostdb
+
+// version.go selects hosts that advertise at least a given version, so that a
+// renter relying on protocol features introduced in a newer version is not
+// matched with a host that does not support them.
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	errInvalidMinVersion = errors.New("invalid minimum host version")
+	errNoRecentHost      = errors.New("no active host runs the requested version or a newer one")
+)
+
+// RandomHostWithVersion returns a random host from the hostdb, selected by
+// weight from among the hosts that are accepting contracts and advertise a
+// version of at least 'minVersion'. Hosts advertising a malformed version are
+// skipped. If no such host exists, errNoRecentHost is returned.
+func (hdb *HostDB) RandomHostWithVersion(minVersion string) (modules.HostDBEntry, error) {
+	if !build.IsVersion(minVersion) {
+		return modules.HostDBEntry{}, errInvalidMinVersion
+	}
+
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.releaseQuarantine()
+
+	entry, err := hdb.randomEntryFiltered(func(entry *hostEntry) bool {
+		return entry.AcceptingContracts && build.IsVersion(entry.Version) && build.VersionCmp(entry.Version, minVersion) >= 0
+	})
+	if err == errNoMatchingHost {
+		return modules.HostDBEntry{}, errNoRecentHost
+	} else if err != nil {
+		return modules.HostDBEntry{}, err
+	}
+	return entry.HostDBEntry, nil
+}
@@ -0,0 +1,54 @@
+package hostdb
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestRandomHostWithVersion checks that only hosts advertising at least the
+// requested version are selected.
+func TestRandomHostWithVersion(t *testing.T) {
+	hdb := bareHostDB()
+	for i, version := range []string{"0.6", "1.0", "1.0.1", "", "x.y", "1.1"} {
+		entry := &hostEntry{
+			HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(uint8(i))},
+			Weight:      types.NewCurrency64(10),
+		}
+		entry.AcceptingContracts = true
+		entry.Version = version
+		hdb.allHosts[entry.NetAddress] = entry
+		hdb.insertNode(entry)
+	}
+	// The newest host is not accepting contracts.
+	hdb.allHosts[fakeAddr(5)].AcceptingContracts = false
+
+	if _, err := hdb.RandomHostWithVersion("1.x"); err != errInvalidMinVersion {
+		t.Fatal("expected errInvalidMinVersion, got", err)
+	}
+	if _, err := hdb.RandomHostWithVersion(""); err != errInvalidMinVersion {
+		t.Fatal("expected errInvalidMinVersion, got", err)
+	}
+	if _, err := hdb.RandomHostWithVersion("1.1"); err != errNoRecentHost {
+		t.Fatal("expected errNoRecentHost, got", err)
+	}
+	for i := 0; i < 20; i++ {
+		host, err := hdb.RandomHostWithVersion("1.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if host.NetAddress != fakeAddr(2) {
+			t.Fatal("selected a host with too old a version:", host.NetAddress, host.Version)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		host, err := hdb.RandomHostWithVersion("1.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if host.NetAddress != fakeAddr(1) && host.NetAddress != fakeAddr(2) {
+			t.Fatal("selected a host with too old a version:", host.NetAddress, host.Version)
+		}
+	}
+}
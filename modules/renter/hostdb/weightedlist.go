@@ -7,6 +7,8 @@ package hostdb
 import (
 	"crypto/rand"
 	"errors"
+	"math/big"
+	"sort"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/modules"
@@ -14,7 +16,16 @@ import (
 )
 
 var (
-	errOverweight = errors.New("requested a too-heavy weight")
+	errHostNotActive  = errors.New("host is not in the set of active hosts")
+	errNoMatchingHost = errors.New("no active host matches the filter")
+	errOverweight     = errors.New("requested a too-heavy weight")
+)
+
+const (
+	// filteredDrawAttempts is the number of weighted draws that
+	// RandomHostFiltered makes before falling back to a scan of all active
+	// hosts.
+	filteredDrawAttempts = 10
 )
 
 // hostNode is the node of an unsorted, balanced, weighted binary tree. When
@@ -54,30 +65,39 @@ func createNode(parent *hostNode, entry *hostEntry) *hostNode {
 // nodeAtWeight grabs an element in the tree that appears at the given weight.
 // Though the tree has an arbitrary sorting, a sufficiently random weight will
 // pull a random element. The tree is searched through in a post-ordered way.
+//
+// The search is an iterative descent from 'hn', which keeps the stack usage
+// constant even if the tree has become deep.
 func (hn *hostNode) nodeAtWeight(weight types.Currency) (*hostNode, error) {
 	// Sanity check - weight must be less than the total weight of the tree.
 	if weight.Cmp(hn.weight) > 0 {
 		return nil, errOverweight
 	}
 
-	// Check if the left or right child should be returned.
-	if hn.left != nil {
-		if weight.Cmp(hn.left.weight) < 0 {
-			return hn.left.nodeAtWeight(weight)
+	current := hn
+	for {
+		// Check if the left or right child should be searched next.
+		if current.left != nil {
+			if weight.Cmp(current.left.weight) < 0 {
+				current = current.left
+				continue
+			}
+			weight = weight.Sub(current.left.weight) // Search from 0th index of right side.
 		}
-		weight = weight.Sub(hn.left.weight) // Search from 0th index of right side.
-	}
-	if hn.right != nil && weight.Cmp(hn.right.weight) < 0 {
-		return hn.right.nodeAtWeight(weight)
+		if current.right != nil && weight.Cmp(current.right.weight) < 0 {
+			current = current.right
+			continue
+		}
+		break
 	}
 
 	// Sanity check
-	if build.DEBUG && !hn.taken {
+	if build.DEBUG && !current.taken {
 		build.Critical("nodeAtWeight should not be returning a nil entry")
 	}
 
-	// Return the root entry.
-	return hn, nil
+	// Return the current entry.
+	return current, nil
 }
 
 // recursiveInsert is a recursive function for adding a hostNode to an existing tree
@@ -127,6 +147,30 @@ func (hn *hostNode) removeNode() {
 	}
 }
 
+// reweightNode changes the weight of the entry held by a node, applying the
+// difference to the cumulative weight of the node and each of its parents.
+// Only the path from the node to the root is touched, which is cheaper than
+// removing the node and inserting it again.
+func (hn *hostNode) reweightNode(newWeight types.Currency) {
+	oldWeight := hn.hostEntry.Weight
+	for current := hn; current != nil; current = current.parent {
+		current.weight = current.weight.Sub(oldWeight).Add(newWeight)
+	}
+	hn.hostEntry.Weight = newWeight
+}
+
+// reweight updates the weight of an active host in place, without removing
+// the host from the tree.
+func (hdb *HostDB) reweight(addr modules.NetAddress, newWeight types.Currency) error {
+	node, exists := hdb.activeHosts[addr]
+	if !exists {
+		return errHostNotActive
+	}
+	node.reweightNode(newWeight)
+	hdb.queueEvent(EventReweight, node.hostEntry)
+	return nil
+}
+
 // insertNode inserts a host entry into the host tree, removing
 // any conflicts. The host settings are assumed to be correct. Though hosts
 // with 0 weight will never be selected, they are accepted into the tree.
@@ -144,9 +188,63 @@ func (hdb *HostDB) insertNode(entry *hostEntry) {
 	} else {
 		_, hostNode := hdb.hostTree.recursiveInsert(entry)
 		hdb.activeHosts[entry.NetAddress] = hostNode
+		hdb.rebalanceIfDeep(hostNode)
 	}
 }
 
+// WeightedHost is an active host along with its weight and the probability
+// that it is the first host drawn by RandomHosts.
+type WeightedHost struct {
+	modules.HostDBEntry
+	Weight      types.Currency
+	Probability float64
+}
+
+// weightedHostsByWeight sorts a set of weighted hosts by descending weight,
+// breaking ties by address.
+type weightedHostsByWeight []WeightedHost
+
+func (whw weightedHostsByWeight) Len() int      { return len(whw) }
+func (whw weightedHostsByWeight) Swap(i, j int) { whw[i], whw[j] = whw[j], whw[i] }
+func (whw weightedHostsByWeight) Less(i, j int) bool {
+	if c := whw[i].Weight.Cmp(whw[j].Weight); c != 0 {
+		return c > 0
+	}
+	return whw[i].NetAddress < whw[j].NetAddress
+}
+
+// nodesByWeight sorts a set of host nodes by the descending weight of their
+// hosts. It is meant to be applied with sort.Stable to nodes that are already
+// sorted by address, so that ties are broken by address.
+type nodesByWeight []*hostNode
+
+func (nbw nodesByWeight) Len() int      { return len(nbw) }
+func (nbw nodesByWeight) Swap(i, j int) { nbw[i], nbw[j] = nbw[j], nbw[i] }
+func (nbw nodesByWeight) Less(i, j int) bool {
+	return nbw[i].hostEntry.Weight.Cmp(nbw[j].hostEntry.Weight) > 0
+}
+
+// nodesByAddress sorts a set of host nodes by the address of their hosts.
+type nodesByAddress []*hostNode
+
+func (nba nodesByAddress) Len() int      { return len(nba) }
+func (nba nodesByAddress) Swap(i, j int) { nba[i], nba[j] = nba[j], nba[i] }
+func (nba nodesByAddress) Less(i, j int) bool {
+	return nba[i].hostEntry.NetAddress < nba[j].hostEntry.NetAddress
+}
+
+// sortedActiveNodes returns the nodes of the active hosts, sorted by address.
+// Selections that walk the set of active hosts use a fixed order so that they
+// are reproducible when the source of randomness is deterministic.
+func (hdb *HostDB) sortedActiveNodes() []*hostNode {
+	nodes := make(nodesByAddress, 0, len(hdb.activeHosts))
+	for _, node := range hdb.activeHosts {
+		nodes = append(nodes, node)
+	}
+	sort.Sort(nodes)
+	return nodes
+}
+
 // isEmpty returns whether the hostTree contains no entries.
 func (hdb *HostDB) isEmpty() bool {
 	return hdb.hostTree == nil || hdb.hostTree.weight.IsZero()
@@ -158,8 +256,10 @@ func (hdb *HostDB) isEmpty() bool {
 // Hosts specified in 'ignore' will not be considered; pass 'nil' if no
 // blacklist is desired.
 func (hdb *HostDB) RandomHosts(n int, ignore []modules.NetAddress) (hosts []modules.HostDBEntry) {
+	defer hdb.managedDeliverEvents()
 	hdb.mu.Lock()
 	defer hdb.mu.Unlock()
+	hdb.releaseQuarantine()
 	if hdb.isEmpty() {
 		return
 	}
@@ -181,7 +281,7 @@ func (hdb *HostDB) RandomHosts(n int, ignore []modules.NetAddress) (hosts []modu
 	// Pick a host, remove it from the tree, and repeat until we have n hosts
 	// or the tree is empty.
 	for len(hosts) < n && !hdb.isEmpty() {
-		randWeight, err := rand.Int(rand.Reader, hdb.hostTree.weight.Big())
+		randWeight, err := rand.Int(hdb.randReader(), hdb.hostTree.weight.Big())
 		if err != nil {
 			build.Critical("rand.Int is returning an error:", err)
 			break
@@ -207,3 +307,110 @@ func (hdb *HostDB) RandomHosts(n int, ignore []modules.NetAddress) (hosts []modu
 	}
 	return hosts
 }
+
+// RandomHostFiltered returns a random host from the hostdb, selected by weight
+// from among the hosts for which 'filter' returns true. A limited number of
+// weighted draws are made from the full set of active hosts; if none of the
+// drawn hosts match, all of the active hosts are scanned and the selection is
+// made from the set of matching hosts. The hostdb is locked while 'filter' is
+// called, so 'filter' must not call any methods of the HostDB.
+func (hdb *HostDB) RandomHostFiltered(filter func(modules.HostDBEntry) bool) (modules.HostDBEntry, error) {
+	defer hdb.managedDeliverEvents()
+	hdb.mu.Lock()
+	defer hdb.mu.Unlock()
+	hdb.releaseQuarantine()
+	entry, err := hdb.randomEntryFiltered(func(entry *hostEntry) bool {
+		return filter(entry.HostDBEntry)
+	})
+	if err != nil {
+		return modules.HostDBEntry{}, err
+	}
+	return entry.HostDBEntry, nil
+}
+
+// randomEntryFiltered selects an active host by weight from among the hosts
+// for which 'filter' returns true, using the strategy of RandomHostFiltered.
+func (hdb *HostDB) randomEntryFiltered(filter func(*hostEntry) bool) (*hostEntry, error) {
+	if hdb.isEmpty() {
+		return nil, errNoMatchingHost
+	}
+
+	// Draw from the tree, which is fast when most hosts match.
+	for i := 0; i < filteredDrawAttempts; i++ {
+		randWeight, err := rand.Int(hdb.randReader(), hdb.hostTree.weight.Big())
+		if err != nil {
+			return nil, err
+		}
+		node, err := hdb.hostTree.nodeAtWeight(types.NewCurrency(randWeight))
+		if err != nil {
+			return nil, err
+		}
+		if filter(node.hostEntry) {
+			return node.hostEntry, nil
+		}
+	}
+
+	// Few hosts match, collect the matching hosts and select one by weight.
+	var matches []*hostEntry
+	var totalWeight types.Currency
+	for _, node := range hdb.sortedActiveNodes() {
+		if node.hostEntry.Weight.IsZero() || !filter(node.hostEntry) {
+			continue
+		}
+		matches = append(matches, node.hostEntry)
+		totalWeight = totalWeight.Add(node.hostEntry.Weight)
+	}
+	if len(matches) == 0 {
+		return nil, errNoMatchingHost
+	}
+	randWeight, err := rand.Int(hdb.randReader(), totalWeight.Big())
+	if err != nil {
+		return nil, err
+	}
+	weight := types.NewCurrency(randWeight)
+	for _, entry := range matches {
+		if weight.Cmp(entry.Weight) < 0 {
+			return entry, nil
+		}
+		weight = weight.Sub(entry.Weight)
+	}
+	build.Critical("weighted selection did not select a matching host")
+	return matches[len(matches)-1], nil
+}
+
+// WeightOf returns the current weight of the host at the provided address, and
+// whether the host is active. Inactive and unknown hosts have no weight.
+func (hdb *HostDB) WeightOf(addr modules.NetAddress) (types.Currency, bool) {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	node, exists := hdb.activeHosts[addr]
+	if !exists {
+		return types.ZeroCurrency, false
+	}
+	return node.hostEntry.Weight, true
+}
+
+// WeightedList returns all of the active hosts sorted by descending weight,
+// with ties broken by address, along with the total weight of the active
+// hosts. The probability of each host is its share of the total weight, which
+// is the chance that the host is the first host drawn by RandomHosts.
+func (hdb *HostDB) WeightedList() (hosts []WeightedHost, totalWeight types.Currency) {
+	hdb.mu.RLock()
+	defer hdb.mu.RUnlock()
+	if hdb.hostTree != nil {
+		totalWeight = hdb.hostTree.weight
+	}
+
+	for _, node := range hdb.activeHosts {
+		wh := WeightedHost{
+			HostDBEntry: node.hostEntry.HostDBEntry,
+			Weight:      node.hostEntry.Weight,
+		}
+		if !totalWeight.IsZero() {
+			wh.Probability, _ = new(big.Rat).SetFrac(wh.Weight.Big(), totalWeight.Big()).Float64()
+		}
+		hosts = append(hosts, wh)
+	}
+	sort.Sort(weightedHostsByWeight(hosts))
+	return hosts, totalWeight
+}
@@ -3,6 +3,7 @@ package hostdb
 import (
 	"crypto/rand"
 	"math/big"
+	mrand "math/rand"
 	"strconv"
 	"testing"
 
@@ -313,3 +314,295 @@ func TestRandomHosts(t *testing.T) {
 		t.Error("doubled up")
 	}
 }
+
+// TestReweight checks that reweighting a host updates the cumulative weights
+// along the path to the root without disturbing the rest of the tree.
+func TestReweight(t *testing.T) {
+	hdb := bareHostDB()
+
+	// Reweighting a host that is not in the tree should fail.
+	err := hdb.reweight(fakeAddr(0), types.NewCurrency64(1))
+	if err != errHostNotActive {
+		t.Fatalf("expected %v, got %v", errHostNotActive, err)
+	}
+
+	// Insert a set of hosts with equal weight.
+	var dbe modules.HostDBEntry
+	dbe.AcceptingContracts = true
+	numEntries := 24
+	for i := 0; i < numEntries; i++ {
+		dbe.NetAddress = fakeAddr(uint8(i))
+		entry := hostEntry{
+			HostDBEntry: dbe,
+			Weight:      types.NewCurrency64(10),
+		}
+		hdb.insertNode(&entry)
+	}
+
+	// Increase the weight of one host and check that the weight of the tree
+	// changed by the difference.
+	err = hdb.reweight(fakeAddr(5), types.NewCurrency64(50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedWeight := types.NewCurrency64(uint64(10*(numEntries-1) + 50))
+	if hdb.hostTree.weight.Cmp(expectedWeight) != 0 {
+		t.Fatalf("expected tree weight %v, got %v", expectedWeight, hdb.hostTree.weight)
+	}
+	if hdb.activeHosts[fakeAddr(5)].hostEntry.Weight.Cmp(types.NewCurrency64(50)) != 0 {
+		t.Error("entry weight was not updated")
+	}
+
+	// Restore the original weight, after which the tree should be uniform
+	// again.
+	err = hdb.reweight(fakeAddr(5), types.NewCurrency64(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = uniformTreeVerification(hdb, numEntries)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// benchmarkTree returns a hostdb that has been filled with 'n' hosts of equal
+// weight.
+func benchmarkTree(n int) *HostDB {
+	hdb := bareHostDB()
+	var dbe modules.HostDBEntry
+	for i := 0; i < n; i++ {
+		dbe.NetAddress = modules.NetAddress("host" + strconv.Itoa(i) + ":1")
+		entry := hostEntry{
+			HostDBEntry: dbe,
+			Weight:      types.NewCurrency64(10),
+		}
+		hdb.insertNode(&entry)
+	}
+	return hdb
+}
+
+// BenchmarkReweight benchmarks changing the weight of a host in place.
+func BenchmarkReweight(b *testing.B) {
+	hdb := benchmarkTree(1000)
+	addr := modules.NetAddress("host500:1")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := hdb.reweight(addr, types.NewCurrency64(uint64(i%20+1)))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRemoveInsert benchmarks changing the weight of a host by removing
+// the host from the tree and inserting it again.
+func BenchmarkRemoveInsert(b *testing.B) {
+	hdb := benchmarkTree(1000)
+	addr := modules.NetAddress("host500:1")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		node := hdb.activeHosts[addr]
+		node.removeNode()
+		delete(hdb.activeHosts, addr)
+		entry := *node.hostEntry
+		entry.Weight = types.NewCurrency64(uint64(i%20 + 1))
+		hdb.insertNode(&entry)
+	}
+}
+
+// TestNodeAtWeightSkewed checks that nodeAtWeight returns the correct nodes
+// from a deliberately unbalanced tree that is thousands of nodes deep.
+func TestNodeAtWeightSkewed(t *testing.T) {
+	// Build a tree where every node only has a left child, each node holding
+	// an entry of weight 1.
+	depth := 5000
+	entries := make([]*hostEntry, depth)
+	for i := range entries {
+		entries[i] = &hostEntry{Weight: types.NewCurrency64(1)}
+		entries[i].NetAddress = modules.NetAddress("host" + strconv.Itoa(i) + ":1")
+	}
+	root := createNode(nil, entries[0])
+	current := root
+	for i := 1; i < depth; i++ {
+		current.left = createNode(current, entries[i])
+		current = current.left
+	}
+	// Set the cumulative weights and counts from the bottom up.
+	for node, total := current, 1; node != nil; node, total = node.parent, total+1 {
+		node.weight = types.NewCurrency64(uint64(total))
+		node.count = total
+	}
+
+	// The search is post-ordered, so weight 0 belongs to the deepest node and
+	// the final weight belongs to the root.
+	for _, w := range []int{0, 1, depth / 2, depth - 1} {
+		node, err := root.nodeAtWeight(types.NewCurrency64(uint64(w)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if node.hostEntry != entries[depth-1-w] {
+			t.Errorf("wrong node at weight %v: got %v", w, node.hostEntry.NetAddress)
+		}
+	}
+}
+
+// TestRandomHostFiltered checks that RandomHostFiltered only returns matching
+// hosts, including when very few hosts match.
+func TestRandomHostFiltered(t *testing.T) {
+	hdb := bareHostDB()
+	if _, err := hdb.RandomHostFiltered(func(modules.HostDBEntry) bool { return true }); err != errNoMatchingHost {
+		t.Fatal("expected errNoMatchingHost, got", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		entry := hostEntry{
+			HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(uint8(i))},
+			Weight:      types.NewCurrency64(10),
+		}
+		entry.AcceptingContracts = true
+		entry.MaxDuration = types.BlockHeight(i)
+		hdb.insertNode(&entry)
+	}
+
+	// Dense match.
+	even := func(host modules.HostDBEntry) bool { return host.MaxDuration%2 == 0 }
+	for i := 0; i < 20; i++ {
+		host, err := hdb.RandomHostFiltered(even)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !even(host) {
+			t.Fatal("returned a host that does not match the filter")
+		}
+	}
+
+	// Sparse match, the fallback scan will almost always be needed.
+	sparse := func(host modules.HostDBEntry) bool { return host.MaxDuration == 37 || host.MaxDuration == 73 }
+	for i := 0; i < 20; i++ {
+		host, err := hdb.RandomHostFiltered(sparse)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sparse(host) {
+			t.Fatal("returned a host that does not match the filter")
+		}
+	}
+
+	// No match.
+	_, err := hdb.RandomHostFiltered(func(modules.HostDBEntry) bool { return false })
+	if err != errNoMatchingHost {
+		t.Fatal("expected errNoMatchingHost, got", err)
+	}
+}
+
+// TestSeededSelection checks that host selection is reproducible when the
+// hostdb is given a seeded source of randomness.
+func TestSeededSelection(t *testing.T) {
+	newDB := func() *HostDB {
+		hdb := bareHostDB()
+		for i := 0; i < 50; i++ {
+			entry := hostEntry{
+				HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(uint8(i))},
+				Weight:      types.NewCurrency64(uint64(i + 1)),
+			}
+			entry.AcceptingContracts = true
+			hdb.insertNode(&entry)
+		}
+		return hdb
+	}
+	selections := func(hdb *HostDB) (addrs []modules.NetAddress) {
+		hdb.SetRandomSource(mrand.New(mrand.NewSource(42)))
+		for _, host := range hdb.RandomHosts(10, nil) {
+			addrs = append(addrs, host.NetAddress)
+		}
+		for _, host := range hdb.SampleHosts(10) {
+			addrs = append(addrs, host.NetAddress)
+		}
+		host, err := hdb.RandomHostFiltered(func(h modules.HostDBEntry) bool { return h.NetAddress == fakeAddr(3) || h.NetAddress == fakeAddr(4) })
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append(addrs, host.NetAddress)
+	}
+
+	first, second := selections(newDB()), selections(newDB())
+	if len(first) != 21 || len(first) != len(second) {
+		t.Fatal("wrong number of selections")
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatal("seeded selections differ:", first, second)
+		}
+	}
+}
+
+// TestWeightedListAccessor checks that WeightedList sorts the active hosts by weight
+// and reports the probability of each host being selected.
+func TestWeightedListAccessor(t *testing.T) {
+	hdb := bareHostDB()
+	if hosts, total := hdb.WeightedList(); len(hosts) != 0 || !total.IsZero() {
+		t.Fatal("empty hostdb should have an empty weighted list")
+	}
+
+	weights := []uint64{2, 5, 1, 2}
+	for i, w := range weights {
+		entry := hostEntry{
+			HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(uint8(i))},
+			Weight:      types.NewCurrency64(w),
+		}
+		hdb.insertNode(&entry)
+	}
+
+	hosts, total := hdb.WeightedList()
+	if total.Cmp(types.NewCurrency64(10)) != 0 {
+		t.Fatal("wrong total weight:", total)
+	}
+	expected := []struct {
+		addr        modules.NetAddress
+		probability float64
+	}{
+		{fakeAddr(1), 0.5},
+		{fakeAddr(0), 0.2},
+		{fakeAddr(3), 0.2},
+		{fakeAddr(2), 0.1},
+	}
+	if len(hosts) != len(expected) {
+		t.Fatal("wrong number of hosts:", len(hosts))
+	}
+	var sum float64
+	for i, e := range expected {
+		if hosts[i].NetAddress != e.addr || hosts[i].Probability != e.probability {
+			t.Errorf("host %v: expected %v with probability %v, got %v with probability %v", i, e.addr, e.probability, hosts[i].NetAddress, hosts[i].Probability)
+		}
+		sum += hosts[i].Probability
+	}
+	if sum < 0.999 || sum > 1.001 {
+		t.Error("probabilities do not sum to 1:", sum)
+	}
+}
+
+// TestWeightOf checks that WeightOf reports the weight of active hosts, and
+// reports inactive and unknown hosts as not found.
+func TestWeightOf(t *testing.T) {
+	hdb := bareHostDB()
+	entry := hostEntry{
+		HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(1)},
+		Weight:      types.NewCurrency64(7),
+	}
+	hdb.insertNode(&entry)
+	hdb.allHosts[fakeAddr(2)] = &hostEntry{HostDBEntry: modules.HostDBEntry{NetAddress: fakeAddr(2)}}
+
+	if weight, active := hdb.WeightOf(fakeAddr(1)); !active || weight.Cmp(types.NewCurrency64(7)) != 0 {
+		t.Error("wrong weight for active host:", weight, active)
+	}
+	if weight, active := hdb.WeightOf(fakeAddr(2)); active || !weight.IsZero() {
+		t.Error("inactive host was reported as active:", weight)
+	}
+	if _, active := hdb.WeightOf(fakeAddr(3)); active {
+		t.Error("unknown host was reported as active")
+	}
+	hdb.removeHost(fakeAddr(1))
+	if _, active := hdb.WeightOf(fakeAddr(1)); active {
+		t.Error("removed host was reported as active")
+	}
+}
@@ -2,7 +2,12 @@ package sync
 
 import (
 	"errors"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
+
+	"github.com/NebulousLabs/Sia/build"
 )
 
 // ErrStopped is returned by ThreadGroup methods if Stop has already been
@@ -30,6 +35,35 @@ type ThreadGroup struct {
 	bmu      sync.Mutex // Ensures blocking between calls to 'Add', 'Flush', and 'Stop'
 	mu       sync.Mutex // Protects the 'onStopFns' and 'afterStopFns' variable
 	wg       sync.WaitGroup
+
+	// active is the number of routines that have called Add but not yet
+	// called Done. In debug builds, sites counts the active routines by the
+	// function that called Add.
+	active int32
+	sites  map[string]int
+	smu    sync.Mutex // Protects the 'sites' variable
+}
+
+// callerFunc returns the name of the function that called the thread group
+// method, with any closure suffix removed so that a Done called from a
+// goroutine launched by a function is attributed to that function.
+func callerFunc() string {
+	pc, _, _, ok := runtime.Caller(2)
+	if !ok {
+		return "unknown"
+	}
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return "unknown"
+	}
+	name := fn.Name()
+	pkgEnd := strings.LastIndex(name, "/") + 1
+	for i := pkgEnd; i < len(name); i++ {
+		if strings.HasPrefix(name[i:], ".func") && i+5 < len(name) && name[i+5] >= '0' && name[i+5] <= '9' {
+			return name[:i]
+		}
+	}
+	return name
 }
 
 // init creates the stop channel for the thread group.
@@ -57,9 +91,44 @@ func (tg *ThreadGroup) Add() error {
 		return ErrStopped
 	}
 	tg.wg.Add(1)
+	atomic.AddInt32(&tg.active, 1)
+	if build.DEBUG {
+		site := callerFunc()
+		tg.smu.Lock()
+		if tg.sites == nil {
+			tg.sites = make(map[string]int)
+		}
+		tg.sites[site]++
+		tg.smu.Unlock()
+	}
 	return nil
 }
 
+// Active returns the number of routines that have called Add but have not yet
+// called Done. A count that does not fall to zero while Stop is blocking
+// points to a routine that is not respecting StopChan.
+func (tg *ThreadGroup) Active() int {
+	return int(atomic.LoadInt32(&tg.active))
+}
+
+// ActiveSites returns the number of active routines, keyed by the function
+// that called Add. The sites are only tracked in debug builds; otherwise nil
+// is returned. A Done is matched to the function that called it, so a routine
+// that calls Done from a different function than the one that called Add
+// stays listed at its registration site.
+func (tg *ThreadGroup) ActiveSites() map[string]int {
+	if !build.DEBUG {
+		return nil
+	}
+	tg.smu.Lock()
+	defer tg.smu.Unlock()
+	sites := make(map[string]int, len(tg.sites))
+	for site, n := range tg.sites {
+		sites[site] = n
+	}
+	return sites
+}
+
 // AfterStop ensures that a function will be called after Stop() has been
 // called and after all running routines have called Done(). The functions will
 // be called in reverse order to how they were added, similar to defer. If
@@ -99,6 +168,17 @@ func (tg *ThreadGroup) OnStop(fn func()) {
 
 // Done decrements the thread group counter.
 func (tg *ThreadGroup) Done() {
+	if build.DEBUG {
+		site := callerFunc()
+		tg.smu.Lock()
+		if tg.sites[site] > 1 {
+			tg.sites[site]--
+		} else {
+			delete(tg.sites, site)
+		}
+		tg.smu.Unlock()
+	}
+	atomic.AddInt32(&tg.active, -1)
 	tg.wg.Done()
 }
 
@@ -467,6 +467,49 @@ func TestAddOnStop(t *testing.T) {
 	}
 }
 
+// TestThreadGroupActive checks that the thread group reports the number of
+// active routines, and in debug builds the functions that registered them.
+func TestThreadGroupActive(t *testing.T) {
+	var tg ThreadGroup
+	if tg.Active() != 0 {
+		t.Fatal("new thread group reports active routines:", tg.Active())
+	}
+
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		err := tg.Add()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer tg.Done()
+			<-release
+		}()
+	}
+	if tg.Active() != 3 {
+		t.Error("expected 3 active routines, got", tg.Active())
+	}
+	if build.DEBUG {
+		sites := tg.ActiveSites()
+		site := "github.com/NebulousLabs/Sia/sync.TestThreadGroupActive"
+		if len(sites) != 1 || sites[site] != 3 {
+			t.Error("unexpected registration sites:", sites)
+		}
+	}
+
+	close(release)
+	wg.Wait()
+	if tg.Active() != 0 {
+		t.Error("expected no active routines, got", tg.Active())
+	}
+	if build.DEBUG && len(tg.ActiveSites()) != 0 {
+		t.Error("registration sites were not cleared:", tg.ActiveSites())
+	}
+}
+
 // BenchmarkThreadGroup times how long it takes to add a ton of threads and
 // trigger goroutines that call Done.
 func BenchmarkThreadGroup(b *testing.B) {